@@ -0,0 +1,571 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/m-motawea/gSwitch/config"
+	"github.com/m-motawea/gSwitch/controlplane"
+	"github.com/m-motawea/gSwitch/dataplane"
+	"github.com/m-motawea/gSwitch/l2"
+	"github.com/m-motawea/gSwitch/logging"
+)
+
+var logger = logging.Logger("api")
+
+const DEFAULT_ADDRESS = "127.0.0.1:8080"
+const DEFAULT_SOCKET = "/var/run/gswitch.sock"
+
+/*
+	GET    /api/ports                     list ports
+	GET    /api/ports/{name}              port state
+	POST   /api/ports/{name}/up           bring the port up
+	POST   /api/ports/{name}/down         bring the port down
+	PUT    /api/ports/{name}/vlans        change vlan membership. body: {"Trunk": true, "AllowedVLANs": [10, 20]}
+	GET    /api/ports/{name}/stats        port counters
+	DELETE /api/ports/{name}/stats        clear port counters
+	GET    /api/ports/{name}/security     port security settings, learned addresses and violations
+	PUT    /api/ports/{name}/security     change port security. body: {"Enabled": true, "MaxMACs": 2, "Violation": "restrict"}
+	POST   /api/ports/{name}/capture      start a pcapng capture. body: {"Path": "/tmp/sw1.pcapng", "Filter": "vlan 10 and arp"}
+	DELETE /api/ports/{name}/capture      stop the capture
+	GET    /api/port-security             port security of every port
+	GET    /api/pipeline                  control processes in pipeline order
+	POST   /api/pipeline                  insert a process. body: {"Layer": 2, "Name": "MACFilter", "ConfigFile": "...", "Position": 1}
+	GET    /api/pipeline/{layer}/{name}   config file, config and stored values of the process
+	PUT    /api/pipeline/{layer}/{name}   replace the process with another. body: {"Layer": 2, "Name": "L2Switch"}
+	DELETE /api/pipeline/{layer}/{name}   remove the process
+	GET    /api/mac                       MAC address table. ?vlan=10&port=sw1&mac=...&type=static select entries
+	POST   /api/mac                       add a static entry. body: {"VLAN": 10, "MAC": "52:54:00:12:34:56", "Port": "sw1"}
+	DELETE /api/mac                       clear dynamic entries. same selection as GET. type=sticky, static or all clears those
+	GET    /api/mac/aging                 aging times and sticky ports
+	GET    /api/mac/moves                 address moves, flap alarms and the addresses flapping now
+	GET    /api/stp                       spanning tree bridge, root and ports
+	GET    /api/lldp                      LLDP neighbors and port counters
+	DELETE /api/lldp                      forget the LLDP neighbors
+	GET    /api/arp                       ARP table
+	DELETE /api/arp                       flush ARP table
+	GET    /api/routes                    vlan interfaces and static routes
+	POST   /api/reload                    re-read the config file and apply it
+*/
+
+type VLANsRequest struct {
+	Trunk        bool
+	AllowedVLANs []int
+}
+
+// ProcRequest names a registered control process. Position is the index the
+// process is inserted at (0 is the first). it is appended if Position is not set.
+type ProcRequest struct {
+	Layer      int
+	Name       string
+	ConfigFile string
+	Position   *int `json:",omitempty"`
+}
+
+func (req ProcRequest) config() config.ControlProcessConfig {
+	return config.ControlProcessConfig{Layer: req.Layer, Name: req.Name, ConfigFile: req.ConfigFile}
+}
+
+type StaticMACRequest struct {
+	VLAN int
+	MAC  string
+	Port string
+}
+
+// CaptureRequest starts a capture. Path is a file on the switch host
+type CaptureRequest struct {
+	Path   string
+	Filter string
+}
+
+type CaptureResponse struct {
+	Port    string
+	Path    string
+	Filter  string
+	Started time.Time
+	Frames  uint64 // frames written. final once the capture is stopped
+}
+
+type ClearResponse struct {
+	Cleared int
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+type API struct {
+	sw     *controlplane.Switch
+	mux    *http.ServeMux
+	reload func() error
+}
+
+// NewAPI returns the api of sw. reload re-reads the config file and applies
+// it. it can be nil when there is no config file to reload.
+func NewAPI(sw *controlplane.Switch, reload func() error) *API {
+	a := &API{sw: sw, mux: http.NewServeMux(), reload: reload}
+	a.mux.HandleFunc("GET /api/ports", a.listPorts)
+	a.mux.HandleFunc("GET /api/ports/{name}", a.getPort)
+	a.mux.HandleFunc("POST /api/ports/{name}/up", a.upPort)
+	a.mux.HandleFunc("POST /api/ports/{name}/down", a.downPort)
+	a.mux.HandleFunc("PUT /api/ports/{name}/vlans", a.setPortVLANs)
+	a.mux.HandleFunc("GET /api/ports/{name}/stats", a.getPortStats)
+	a.mux.HandleFunc("DELETE /api/ports/{name}/stats", a.clearPortStats)
+	a.mux.HandleFunc("GET /api/ports/{name}/security", a.getPortSecurity)
+	a.mux.HandleFunc("PUT /api/ports/{name}/security", a.setPortSecurity)
+	a.mux.HandleFunc("POST /api/ports/{name}/capture", a.startCapture)
+	a.mux.HandleFunc("DELETE /api/ports/{name}/capture", a.stopCapture)
+	a.mux.HandleFunc("GET /api/port-security", a.getPortSecurity)
+	a.mux.HandleFunc("GET /api/pipeline", a.listProcs)
+	a.mux.HandleFunc("POST /api/pipeline", a.insertProc)
+	a.mux.HandleFunc("GET /api/pipeline/{layer}/{name}", a.procStor)
+	a.mux.HandleFunc("PUT /api/pipeline/{layer}/{name}", a.swapProc)
+	a.mux.HandleFunc("DELETE /api/pipeline/{layer}/{name}", a.removeProc)
+	a.mux.HandleFunc("GET /api/mac", a.showMACs)
+	a.mux.HandleFunc("POST /api/mac", a.addStaticMAC)
+	a.mux.HandleFunc("DELETE /api/mac", a.clearMACs)
+	a.mux.HandleFunc("GET /api/mac/aging", a.macAging)
+	a.mux.HandleFunc("GET /api/mac/moves", a.macMoves)
+	a.mux.HandleFunc("GET /api/stp", a.dumpTable(2, "STP"))
+	a.mux.HandleFunc("GET /api/lldp", a.dumpTable(2, "LLDP"))
+	a.mux.HandleFunc("DELETE /api/lldp", a.flushTable(2, "LLDP"))
+	a.mux.HandleFunc("GET /api/arp", a.dumpTable(2, "ARP"))
+	a.mux.HandleFunc("DELETE /api/arp", a.flushTable(2, "ARP"))
+	a.mux.HandleFunc("GET /api/routes", a.dumpTable(3, "Routing"))
+	a.mux.HandleFunc("DELETE /api/routes", a.flushTable(3, "Routing"))
+	a.mux.HandleFunc("POST /api/reload", a.reloadConfig)
+	return a
+}
+
+func (a *API) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.mux.ServeHTTP(w, r)
+}
+
+// Serve runs the management api. it blocks until ctx is done or the listener fails.
+func Serve(ctx context.Context, sw *controlplane.Switch, cfg config.APIConfig, reload func() error) error {
+	if cfg.Address == "" {
+		cfg.Address = DEFAULT_ADDRESS
+	}
+	l, err := net.Listen("tcp", cfg.Address)
+	if err != nil {
+		return err
+	}
+	logger.Info("serving management api", "address", cfg.Address)
+	return serve(ctx, l, NewAPI(sw, reload))
+}
+
+// ServeUnix runs the management api on a unix socket for gswitchctl. a stale
+// socket left by a previous run is removed. it blocks until ctx is done or the
+// listener fails.
+func ServeUnix(ctx context.Context, sw *controlplane.Switch, path string, reload func() error) error {
+	if path == "" {
+		path = DEFAULT_SOCKET
+	}
+	err := os.Remove(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+	err = os.Chmod(path, 0660)
+	if err != nil {
+		return err
+	}
+	logger.Info("serving management api", "socket", path)
+	return serve(ctx, l, NewAPI(sw, reload))
+}
+
+// serve runs handler on l until ctx is done. it returns nil when stopped by ctx
+func serve(ctx context.Context, l net.Listener, handler http.Handler) error {
+	srv := &http.Server{Handler: handler}
+	stop := context.AfterFunc(ctx, func() {
+		srv.Close()
+	})
+	defer stop()
+	err := srv.Serve(l)
+	if ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	err := json.NewEncoder(w).Encode(v)
+	if err != nil {
+		logger.Warn("failed to write response", "error", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, controlplane.ErrNoPort), errors.Is(err, controlplane.ErrNoProc), errors.Is(err, dataplane.ErrNoCapture):
+		status = http.StatusNotFound
+	case errors.Is(err, controlplane.ErrNotSupported):
+		status = http.StatusNotImplemented
+	case errors.Is(err, controlplane.ErrRestartRequired), errors.Is(err, controlplane.ErrProcExists), errors.Is(err, controlplane.ErrPortExists), errors.Is(err, dataplane.ErrCaptureRunning):
+		status = http.StatusConflict
+	case errors.Is(err, dataplane.ErrAccessVLAN), errors.Is(err, dataplane.ErrTrunkVLANs), errors.Is(err, dataplane.ErrInvalidVLAN), errors.Is(err, l2.ErrInvalidMAC), errors.Is(err, dataplane.ErrPortSecurity), errors.Is(err, dataplane.ErrInvalidFilter):
+		status = http.StatusBadRequest
+	case errors.Is(err, controlplane.ErrUnknownProc), errors.Is(err, controlplane.ErrInvalidPosition), errors.Is(err, controlplane.ErrProcOrder):
+		status = http.StatusBadRequest
+	}
+	writeJSON(w, status, errorResponse{Error: err.Error()})
+}
+
+func (a *API) listPorts(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, a.sw.PortInfos())
+}
+
+func (a *API) getPort(w http.ResponseWriter, r *http.Request) {
+	info, err := a.sw.PortInfo(r.PathValue("name"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, info)
+}
+
+func (a *API) upPort(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	err := a.sw.UpPort(name)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	logger.Info("port brought up", "port", name, "remote", r.RemoteAddr)
+	a.getPort(w, r)
+}
+
+func (a *API) downPort(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	err := a.sw.DownPort(name)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	logger.Info("port brought down", "port", name, "remote", r.RemoteAddr)
+	a.getPort(w, r)
+}
+
+func (a *API) setPortVLANs(w http.ResponseWriter, r *http.Request) {
+	req := VLANsRequest{}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: err.Error()})
+		return
+	}
+	err = a.sw.SetPortVLANs(r.PathValue("name"), req.Trunk, req.AllowedVLANs...)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	a.getPort(w, r)
+}
+
+// getPortSecurity serves the port security of one port or, without a port
+// name, of every port
+func (a *API) getPortSecurity(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	statuses, err := l2.PortSecurity(a.sw, name)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if name != "" {
+		writeJSON(w, http.StatusOK, statuses[0])
+		return
+	}
+	writeJSON(w, http.StatusOK, statuses)
+}
+
+func (a *API) setPortSecurity(w http.ResponseWriter, r *http.Request) {
+	req := config.PortSecurityConfig{}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: err.Error()})
+		return
+	}
+	err = a.sw.SetPortSecurity(r.PathValue("name"), req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	logger.Info("port security changed", "port", r.PathValue("name"), "remote", r.RemoteAddr)
+	a.getPortSecurity(w, r)
+}
+
+func (a *API) startCapture(w http.ResponseWriter, r *http.Request) {
+	req := CaptureRequest{}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err == nil && req.Path == "" {
+		err = errors.New("no capture path")
+	}
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: err.Error()})
+		return
+	}
+	name := r.PathValue("name")
+	err = a.sw.StartCapture(name, req.Path, req.Filter)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	logger.Info("capture started", "port", name, "path", req.Path, "filter", req.Filter, "remote", r.RemoteAddr)
+	writeJSON(w, http.StatusCreated, CaptureResponse{Port: name, Path: req.Path, Filter: req.Filter, Started: time.Now()})
+}
+
+func (a *API) stopCapture(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	c, err := a.sw.StopCapture(name)
+	if c == nil {
+		writeError(w, err)
+		return
+	}
+	if err != nil {
+		// the frames written before the error are still in the file
+		logger.Warn("failed to close capture", "port", name, "path", c.Path, "error", err)
+	}
+	logger.Info("capture stopped", "port", name, "path", c.Path, "remote", r.RemoteAddr)
+	writeJSON(w, http.StatusOK, CaptureResponse{Port: name, Path: c.Path, Filter: c.Filter, Started: c.Started, Frames: c.Frames})
+}
+
+func (a *API) getPortStats(w http.ResponseWriter, r *http.Request) {
+	stats, err := a.sw.PortStats(r.PathValue("name"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, stats)
+}
+
+func (a *API) clearPortStats(w http.ResponseWriter, r *http.Request) {
+	err := a.sw.ClearPortStats(r.PathValue("name"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *API) listProcs(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, a.sw.Procs())
+}
+
+func (a *API) insertProc(w http.ResponseWriter, r *http.Request) {
+	req := ProcRequest{}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: err.Error()})
+		return
+	}
+	pos := len(a.sw.Procs())
+	if req.Position != nil {
+		pos = *req.Position
+	}
+	err = a.sw.InsertProc(r.Context(), pos, req.config())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	logger.Info("process inserted", "layer", req.Layer, "process", req.Name, "position", pos, "remote", r.RemoteAddr)
+	a.listProcs(w, r)
+}
+
+func (a *API) procStor(w http.ResponseWriter, r *http.Request) {
+	layer, err := strconv.Atoi(r.PathValue("layer"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid layer: " + r.PathValue("layer")})
+		return
+	}
+	info, err := a.sw.ProcStorInfo(layer, r.PathValue("name"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, info)
+}
+
+func (a *API) swapProc(w http.ResponseWriter, r *http.Request) {
+	layer, err := strconv.Atoi(r.PathValue("layer"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid layer: " + r.PathValue("layer")})
+		return
+	}
+	req := ProcRequest{}
+	err = json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: err.Error()})
+		return
+	}
+	name := r.PathValue("name")
+	err = a.sw.SwapProc(r.Context(), layer, name, req.config())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	logger.Info("process replaced", "layer", layer, "process", name, "with", req.Name, "remote", r.RemoteAddr)
+	a.listProcs(w, r)
+}
+
+func (a *API) removeProc(w http.ResponseWriter, r *http.Request) {
+	layer, err := strconv.Atoi(r.PathValue("layer"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid layer: " + r.PathValue("layer")})
+		return
+	}
+	name := r.PathValue("name")
+	err = a.sw.RemoveProc(r.Context(), layer, name)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	logger.Info("process removed", "layer", layer, "process", name, "remote", r.RemoteAddr)
+	a.listProcs(w, r)
+}
+
+func (a *API) dumpTable(layer int, name string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		table, err := a.sw.ProcTable(layer, name)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, table)
+	}
+}
+
+func (a *API) flushTable(layer int, name string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		err := a.sw.FlushProcTable(layer, name)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		logger.Info("table flushed", "layer", layer, "process", name, "remote", r.RemoteAddr)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// macQuery reads the entry selection of the mac routes from the query string
+func macQuery(r *http.Request) (l2.MACQuery, error) {
+	values := r.URL.Query()
+	q := l2.MACQuery{Port: values.Get("port"), MAC: values.Get("mac"), Type: l2.MACEntryType(values.Get("type"))}
+	vlan := values.Get("vlan")
+	if vlan != "" {
+		id, err := strconv.Atoi(vlan)
+		if err != nil {
+			return q, fmt.Errorf("invalid vlan %q", vlan)
+		}
+		q.VLAN = id
+	}
+	switch q.Type {
+	case "", l2.MACDynamic, l2.MACSticky, l2.MACStatic, "all":
+	default:
+		return q, fmt.Errorf("invalid entry type %q", q.Type)
+	}
+	return q, nil
+}
+
+func (a *API) showMACs(w http.ResponseWriter, r *http.Request) {
+	q, err := macQuery(r)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: err.Error()})
+		return
+	}
+	if q.Type == "all" {
+		q.Type = ""
+	}
+	entries, err := l2.MACEntries(a.sw, q)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, entries)
+}
+
+func (a *API) addStaticMAC(w http.ResponseWriter, r *http.Request) {
+	req := StaticMACRequest{}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: err.Error()})
+		return
+	}
+	err = l2.AddStaticMAC(a.sw, req.VLAN, req.MAC, req.Port)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	logger.Info("static mac added", "vlan", req.VLAN, "mac", req.MAC, "port", req.Port, "remote", r.RemoteAddr)
+	entries, err := l2.MACEntries(a.sw, l2.MACQuery{VLAN: req.VLAN, MAC: req.MAC})
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, entries)
+}
+
+func (a *API) clearMACs(w http.ResponseWriter, r *http.Request) {
+	q, err := macQuery(r)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: err.Error()})
+		return
+	}
+	switch q.Type {
+	case "":
+		q.Type = l2.MACDynamic
+	case "all":
+		q.Type = ""
+	}
+	n, err := l2.ClearMACs(a.sw, q)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	logger.Info("mac entries cleared", "vlan", q.VLAN, "port", q.Port, "mac", q.MAC, "type", q.Type, "entries", n, "remote", r.RemoteAddr)
+	writeJSON(w, http.StatusOK, ClearResponse{Cleared: n})
+}
+
+func (a *API) macAging(w http.ResponseWriter, r *http.Request) {
+	info, err := l2.MACAging(a.sw)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, info)
+}
+
+func (a *API) macMoves(w http.ResponseWriter, r *http.Request) {
+	info, err := l2.MACMoves(a.sw)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, info)
+}
+
+func (a *API) reloadConfig(w http.ResponseWriter, r *http.Request) {
+	if a.reload == nil {
+		writeError(w, fmt.Errorf("%w: no config file to reload", controlplane.ErrNotSupported))
+		return
+	}
+	logger.Info("reloading config", "remote", r.RemoteAddr)
+	err := a.reload()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
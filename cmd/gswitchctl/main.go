@@ -0,0 +1,810 @@
+// gswitchctl operates a running gSwitch over its management socket:
+//
+//	gswitchctl show interfaces [<port>]
+//	gswitchctl show mac address-table [dynamic|sticky|static] [vlan <id>] [interface <port>] [address <mac>]
+//	gswitchctl show mac address-table aging-time
+//	gswitchctl show mac address-table moves
+//	gswitchctl show port-security [interface <port>]
+//	gswitchctl show spanning-tree
+//	gswitchctl show arp
+//	gswitchctl show ip route
+//	gswitchctl show pipeline
+//	gswitchctl clear mac [dynamic|sticky|static|all] [vlan <id>] [interface <port>] [address <mac>]
+//	gswitchctl clear arp
+//	gswitchctl mac address-table static <mac> vlan <id> interface <port>
+//	gswitchctl no mac address-table static <mac> vlan <id>
+//	gswitchctl interface <port> shutdown
+//	gswitchctl interface <port> no shutdown
+//	gswitchctl interface <port> capture start <file> [filter <expression>]
+//	gswitchctl interface <port> capture stop
+//	gswitchctl pipeline insert L<layer>:<name> [at <position>] [config <file>]
+//	gswitchctl pipeline remove L<layer>:<name>
+//	gswitchctl pipeline swap L<layer>:<name> L<layer>:<name> [config <file>]
+//	gswitchctl reload
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/m-motawea/gSwitch/api"
+	"github.com/m-motawea/gSwitch/controlplane"
+	"github.com/m-motawea/gSwitch/dataplane"
+	"github.com/m-motawea/gSwitch/l2"
+	"github.com/m-motawea/gSwitch/l3"
+)
+
+var errUsage = errors.New("usage")
+
+type client struct {
+	http *http.Client
+}
+
+func newClient(socket string) *client {
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", socket)
+		},
+	}
+	return &client{http: &http.Client{Transport: transport, Timeout: 10 * time.Second}}
+}
+
+// do sends a request to the switch and decodes the response into out if it is not nil
+func (c *client) do(method string, path string, out interface{}) error {
+	return c.send(method, path, nil, out)
+}
+
+// send is do with in encoded as the json body of the request
+func (c *client) send(method string, path string, in interface{}, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+	req, err := http.NewRequest(method, "http://gswitch"+path, body)
+	if err != nil {
+		return err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(resp.Body)
+		apiErr := struct {
+			Error string `json:"error"`
+		}{}
+		if json.Unmarshal(body, &apiErr) == nil && apiErr.Error != "" {
+			return errors.New(apiErr.Error)
+		}
+		return fmt.Errorf("%s %s: %s", method, path, resp.Status)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func newTable() *tabwriter.Writer {
+	return tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+}
+
+func vlanList(vlans []int) string {
+	ids := []string{}
+	for _, id := range vlans {
+		ids = append(ids, strconv.Itoa(id))
+	}
+	return strings.Join(ids, ",")
+}
+
+func showInterfaces(c *client, args []string) error {
+	ports := []controlplane.PortInfo{}
+	if len(args) > 0 {
+		port := controlplane.PortInfo{}
+		err := c.do("GET", "/api/ports/"+args[0], &port)
+		if err != nil {
+			return err
+		}
+		ports = append(ports, port)
+	} else {
+		err := c.do("GET", "/api/ports", &ports)
+		if err != nil {
+			return err
+		}
+	}
+	t := newTable()
+	fmt.Fprintln(t, "Port\tStatus\tMode\tVLANs\tBackend\tRx pkts\tRx bytes\tTx pkts\tTx bytes\tDrops")
+	for _, port := range ports {
+		stats := dataplane.PortStats{}
+		err := c.do("GET", "/api/ports/"+port.Name+"/stats", &stats)
+		if err != nil {
+			return err
+		}
+		status := "down"
+		if port.Up {
+			status = "up"
+		}
+		if port.ErrDisabled != nil {
+			status = "err-disabled"
+		}
+		mode := "access"
+		if port.Trunk {
+			mode = "trunk"
+		}
+		drops := uint64(0)
+		for _, n := range stats.Drops {
+			drops += n
+		}
+		fmt.Fprintf(t, "%s\t%s\t%s\t%s\t%s\t%d\t%d\t%d\t%d\t%d\n", port.Name, status, mode, vlanList(port.AllowedVLANs), port.Backend,
+			stats.Rx.Packets, stats.Rx.Bytes, stats.Tx.Packets, stats.Tx.Bytes, drops)
+	}
+	return t.Flush()
+}
+
+// macFilter parses the [<type>] [vlan <id>] [interface <port>] [address <mac>]
+// selection of the mac commands into the query of /api/mac
+func macFilter(args []string, types ...string) (string, error) {
+	values := url.Values{}
+	if len(args) > 0 {
+		for _, entType := range types {
+			if args[0] == entType {
+				values.Set("type", entType)
+				args = args[1:]
+				break
+			}
+		}
+	}
+	for len(args) > 0 {
+		if len(args) < 2 {
+			return "", errUsage
+		}
+		switch args[0] {
+		case "vlan":
+			_, err := strconv.Atoi(args[1])
+			if err != nil {
+				return "", fmt.Errorf("invalid vlan %q", args[1])
+			}
+			values.Set("vlan", args[1])
+		case "interface":
+			values.Set("port", args[1])
+		case "address":
+			values.Set("mac", args[1])
+		default:
+			return "", errUsage
+		}
+		args = args[2:]
+	}
+	if len(values) == 0 {
+		return "", nil
+	}
+	return "?" + values.Encode(), nil
+}
+
+func showMAC(c *client, args []string) error {
+	if len(args) < 1 || args[0] != "address-table" {
+		return errUsage
+	}
+	if len(args) == 2 && args[1] == "aging-time" {
+		return showMACAging(c)
+	}
+	if len(args) == 2 && args[1] == "moves" {
+		return showMACMoves(c)
+	}
+	query, err := macFilter(args[1:], string(l2.MACDynamic), string(l2.MACSticky), string(l2.MACStatic))
+	if err != nil {
+		return err
+	}
+	entries := []l2.MACTableEntry{}
+	err = c.do("GET", "/api/mac"+query, &entries)
+	if err != nil {
+		return err
+	}
+	t := newTable()
+	fmt.Fprintln(t, "VLAN\tMAC Address\tType\tPort\tAge")
+	for _, ent := range entries {
+		age := fmt.Sprintf("%.0fs", ent.Age)
+		if ent.Type != l2.MACDynamic {
+			age = "-"
+		}
+		fmt.Fprintf(t, "%d\t%s\t%s\t%s\t%s\n", ent.VLAN, ent.MAC, ent.Type, ent.Port, age)
+	}
+	t.Flush()
+	fmt.Printf("Total MAC addresses: %d\n", len(entries))
+	return nil
+}
+
+func agingTime(seconds int) string {
+	if seconds == 0 {
+		return "never"
+	}
+	return fmt.Sprintf("%ds", seconds)
+}
+
+func showMACMoves(c *client) error {
+	info := l2.MACMoveInfo{}
+	err := c.do("GET", "/api/mac/moves", &info)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("MAC moves: %d\nFlap alarms: %d\n", info.Moves, info.FlapAlarms)
+	if len(info.Flapping) == 0 {
+		return nil
+	}
+	fmt.Println()
+	t := newTable()
+	fmt.Fprintln(t, "VLAN\tMAC Address\tPort\tFrom Port\tMoves\tSince")
+	for _, flap := range info.Flapping {
+		fmt.Fprintf(t, "%d\t%s\t%s\t%s\t%d\t%.0fs\n", flap.VLAN, flap.MAC, flap.Port, flap.OldPort, flap.Moves, time.Since(flap.Since).Seconds())
+	}
+	return t.Flush()
+}
+
+func showMACAging(c *client) error {
+	info := l2.MACAgingInfo{}
+	err := c.do("GET", "/api/mac/aging", &info)
+	if err != nil {
+		return err
+	}
+	t := newTable()
+	fmt.Fprintln(t, "VLAN\tAging Time")
+	fmt.Fprintf(t, "default\t%s\n", agingTime(info.AgingSeconds))
+	vlans := []int{}
+	for vlan := range info.VLANAgingSeconds {
+		vlans = append(vlans, vlan)
+	}
+	sort.Ints(vlans)
+	for _, vlan := range vlans {
+		fmt.Fprintf(t, "%d\t%s\n", vlan, agingTime(info.VLANAgingSeconds[vlan]))
+	}
+	t.Flush()
+	if len(info.StickyPorts) > 0 {
+		fmt.Printf("Sticky ports: %s\n", strings.Join(info.StickyPorts, ","))
+	}
+	return nil
+}
+
+func showPortSecurity(c *client, args []string) error {
+	statuses := []l2.PortSecurityStatus{}
+	switch {
+	case len(args) == 0:
+		err := c.do("GET", "/api/port-security", &statuses)
+		if err != nil {
+			return err
+		}
+	case len(args) == 2 && args[0] == "interface":
+		status := l2.PortSecurityStatus{}
+		err := c.do("GET", "/api/ports/"+args[1]+"/security", &status)
+		if err != nil {
+			return err
+		}
+		statuses = append(statuses, status)
+	default:
+		return errUsage
+	}
+	t := newTable()
+	fmt.Fprintln(t, "Port\tMax MACs\tLearned\tViolations\tAction\tRecovery\tLast Violation\tStatus")
+	for _, status := range statuses {
+		if len(args) == 0 && !status.Enabled && status.ErrDisabled == nil && status.Counters.Violations == 0 {
+			// ports without port security
+			continue
+		}
+		recovery := "-"
+		if status.RecoverySeconds > 0 {
+			recovery = fmt.Sprintf("%ds", status.RecoverySeconds)
+		}
+		last := "-"
+		if status.Counters.LastMAC != "" {
+			last = fmt.Sprintf("%s vlan %d", status.Counters.LastMAC, status.Counters.LastVLAN)
+		}
+		state := "secure"
+		if !status.Enabled {
+			state = "disabled"
+		}
+		if status.ErrDisabled != nil {
+			state = "err-disabled (" + status.ErrDisabled.Reason + ")"
+		}
+		fmt.Fprintf(t, "%s\t%d\t%d\t%d\t%s\t%s\t%s\t%s\n", status.Port, status.MaxMACs, status.LearnedMACs,
+			status.Counters.Violations, status.Violation, recovery, last, state)
+	}
+	return t.Flush()
+}
+
+func topologyChange(changes uint64, last time.Time) string {
+	ago := "never"
+	if !last.IsZero() {
+		ago = fmt.Sprintf("%.0fs ago", time.Since(last).Seconds())
+	}
+	return fmt.Sprintf("Topology changes: %d, last %s", changes, ago)
+}
+
+func printSTPPorts(ports []l2.STPPortStatus) error {
+	t := newTable()
+	fmt.Fprintln(t, "Port\tID\tRole\tState\tCost\tType\tDesignated Bridge\tDesignated Port\tBPDUs In\tBPDUs Out")
+	for _, port := range ports {
+		kind := port.Protocol
+		if port.Edge {
+			kind += " edge"
+		}
+		if port.Boundary {
+			kind += " boundary"
+		}
+		if port.Disabled {
+			kind = "disabled"
+		}
+		bridge, designated := "-", "-"
+		if port.DesignatedBridge != "" {
+			bridge, designated = port.DesignatedBridge, port.DesignatedPort
+		}
+		fmt.Fprintf(t, "%s\t%s\t%s\t%s\t%d\t%s\t%s\t%s\t%d\t%d\n", port.Name, port.ID, port.Role, port.State, port.Cost,
+			kind, bridge, designated, port.BPDUsReceived, port.BPDUsSent)
+	}
+	return t.Flush()
+}
+
+func showSpanningTree(c *client, args []string) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+	status := l2.STPStatus{}
+	err := c.do("GET", "/api/stp", &status)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Protocol: %s\nBridge ID: %s\nRoot ID: %s\n", status.Protocol, status.BridgeID, status.RootID)
+	if status.IsRoot {
+		fmt.Println("This bridge is the root")
+	} else {
+		fmt.Printf("Root port: %s, cost %d\n", status.RootPort, status.RootCost)
+	}
+	if status.Region != "" {
+		fmt.Printf("Region: %s, revision %d, digest %s\n", status.Region, status.Revision, status.Digest)
+		fmt.Printf("Regional root ID: %s, internal cost %d\n", status.RegionalRootID, status.InternalCost)
+	}
+	fmt.Printf("Hello %.0fs, max age %.0fs, forward delay %.0fs\n", status.HelloSeconds, status.MaxAgeSeconds, status.ForwardDelaySeconds)
+	fmt.Printf("%s\n\n", topologyChange(status.TopologyChanges, status.LastTopologyChange))
+	err = printSTPPorts(status.Ports)
+	if err != nil {
+		return err
+	}
+	for _, msti := range status.Instances {
+		fmt.Printf("\nMST%d vlans %s\nBridge ID: %s\nRegional root ID: %s\n", msti.Instance, vlanList(msti.VLANs), msti.BridgeID, msti.RootID)
+		if msti.IsRoot {
+			fmt.Println("This bridge is the regional root")
+		} else {
+			fmt.Printf("Root port: %s, cost %d\n", msti.RootPort, msti.RootCost)
+		}
+		fmt.Printf("%s\n\n", topologyChange(msti.TopologyChanges, msti.LastTopologyChange))
+		err = printSTPPorts(msti.Ports)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func showLLDP(c *client, args []string) error {
+	if len(args) != 1 || args[0] != "neighbors" {
+		return errUsage
+	}
+	status := l2.LLDPStatus{}
+	err := c.do("GET", "/api/lldp", &status)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Chassis ID: %s\nSystem name: %s\n", status.ChassisID, status.SystemName)
+	if status.ManagementAddress != "" {
+		fmt.Printf("Management address: %s\n", status.ManagementAddress)
+	}
+	fmt.Printf("Interval %.0fs, TTL %.0fs\n\n", status.TxIntervalSeconds, status.TTLSeconds)
+	t := newTable()
+	fmt.Fprintln(t, "Local Port\tSystem Name\tChassis ID\tPort ID\tManagement Address\tExpires")
+	for _, n := range status.Neighbors {
+		name, addr := n.SystemName, strings.Join(n.ManagementAddresses, ",")
+		if name == "" {
+			name = "-"
+		}
+		if addr == "" {
+			addr = "-"
+		}
+		fmt.Fprintf(t, "%s\t%s\t%s\t%s\t%s\t%.0fs\n", n.Port, name, n.ChassisID, n.PortID, addr, n.Expires)
+	}
+	return t.Flush()
+}
+
+func showARP(c *client, args []string) error {
+	entries := []l2.ARPTableEntry{}
+	err := c.do("GET", "/api/arp", &entries)
+	if err != nil {
+		return err
+	}
+	t := newTable()
+	fmt.Fprintln(t, "IP Address\tMAC Address\tPort\tAge")
+	for _, ent := range entries {
+		fmt.Fprintf(t, "%s\t%s\t%s\t%.0fs\n", ent.IP, ent.MAC, ent.Port, ent.Age)
+	}
+	return t.Flush()
+}
+
+func showRoutes(c *client, args []string) error {
+	if len(args) != 1 || args[0] != "route" {
+		return errUsage
+	}
+	table := l3.RoutingTable{}
+	err := c.do("GET", "/api/routes", &table)
+	if err != nil {
+		return err
+	}
+	t := newTable()
+	fmt.Fprintln(t, "Interface\tIP Address\tMAC Address\tVLAN")
+	names := []string{}
+	for name := range table.VLANIfaces {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		iface := table.VLANIfaces[name]
+		fmt.Fprintf(t, "%s\t%s\t%s\t%d\n", name, iface.IP, iface.MAC, iface.VLAN)
+	}
+	t.Flush()
+	fmt.Println()
+
+	t = newTable()
+	fmt.Fprintln(t, "Prefix\tInterface\tNext Hop")
+	prefixes := []string{}
+	for prefix := range table.Routes {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+	for _, prefix := range prefixes {
+		for _, port := range table.Routes[prefix].Ports {
+			nextHop := port.NextHop
+			if nextHop == "" {
+				nextHop = "connected"
+			}
+			fmt.Fprintf(t, "%s\t%s\t%s\n", prefix, port.Name, nextHop)
+		}
+	}
+	return t.Flush()
+}
+
+func showPipeline(c *client, args []string) error {
+	procs := []controlplane.ProcInfo{}
+	err := c.do("GET", "/api/pipeline", &procs)
+	if err != nil {
+		return err
+	}
+	return printProcs(procs)
+}
+
+func printProcs(procs []controlplane.ProcInfo) error {
+	t := newTable()
+	fmt.Fprintln(t, "#\tLayer\tProcess\tIn\tIn dropped\tIn finished\tOut\tOut dropped\tOut finished\tConfig")
+	for i, proc := range procs {
+		in, out := proc.Stats.In, proc.Stats.Out
+		fmt.Fprintf(t, "%d\tL%d\t%s\t%d\t%d\t%d\t%d\t%d\t%d\t%s\n", i+1, proc.Layer, proc.Name,
+			in.Messages, in.Dropped, in.Finished, out.Messages, out.Dropped, out.Finished, proc.ConfigFile)
+	}
+	return t.Flush()
+}
+
+func show(c *client, args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+	switch args[0] {
+	case "interfaces":
+		return showInterfaces(c, args[1:])
+	case "mac":
+		return showMAC(c, args[1:])
+	case "port-security":
+		return showPortSecurity(c, args[1:])
+	case "spanning-tree":
+		return showSpanningTree(c, args[1:])
+	case "lldp":
+		return showLLDP(c, args[1:])
+	case "arp":
+		return showARP(c, args[1:])
+	case "ip":
+		return showRoutes(c, args[1:])
+	case "pipeline":
+		return showPipeline(c, args[1:])
+	}
+	return errUsage
+}
+
+func clearTable(c *client, args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+	switch {
+	case args[0] == "mac":
+		query, err := macFilter(args[1:], string(l2.MACDynamic), string(l2.MACSticky), string(l2.MACStatic), "all")
+		if err != nil {
+			return err
+		}
+		resp := api.ClearResponse{}
+		err = c.do("DELETE", "/api/mac"+query, &resp)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Cleared MAC addresses: %d\n", resp.Cleared)
+		return nil
+	case args[0] == "arp" && len(args) == 1:
+		return c.do("DELETE", "/api/arp", nil)
+	case args[0] == "lldp" && len(args) == 1:
+		return c.do("DELETE", "/api/lldp", nil)
+	}
+	return errUsage
+}
+
+// staticMAC parses <mac> vlan <id> [interface <port>] of the static mac commands
+func staticMAC(args []string, withPort bool) (api.StaticMACRequest, error) {
+	req := api.StaticMACRequest{}
+	if len(args) != 3 && len(args) != 5 || args[1] != "vlan" {
+		return req, errUsage
+	}
+	vlan, err := strconv.Atoi(args[2])
+	if err != nil {
+		return req, fmt.Errorf("invalid vlan %q", args[2])
+	}
+	req.MAC, req.VLAN = args[0], vlan
+	switch {
+	case withPort && len(args) == 5 && args[3] == "interface":
+		req.Port = args[4]
+	case withPort || len(args) != 3:
+		return req, errUsage
+	}
+	return req, nil
+}
+
+func macCmd(c *client, args []string) error {
+	if len(args) < 2 || args[0] != "address-table" || args[1] != "static" {
+		return errUsage
+	}
+	req, err := staticMAC(args[2:], true)
+	if err != nil {
+		return err
+	}
+	return c.send("POST", "/api/mac", req, nil)
+}
+
+func noCmd(c *client, args []string) error {
+	if len(args) < 3 || args[0] != "mac" || args[1] != "address-table" || args[2] != "static" {
+		return errUsage
+	}
+	req, err := staticMAC(args[3:], false)
+	if err != nil {
+		return err
+	}
+	query, err := macFilter([]string{"static", "vlan", strconv.Itoa(req.VLAN), "address", req.MAC}, "static")
+	if err != nil {
+		return err
+	}
+	resp := api.ClearResponse{}
+	err = c.do("DELETE", "/api/mac"+query, &resp)
+	if err != nil {
+		return err
+	}
+	if resp.Cleared == 0 {
+		return fmt.Errorf("no static entry for %s in vlan %d", req.MAC, req.VLAN)
+	}
+	return nil
+}
+
+func iface(c *client, args []string) error {
+	if len(args) < 2 {
+		return errUsage
+	}
+	name := args[0]
+	if args[1] == "capture" {
+		return capture(c, name, args[2:])
+	}
+	switch strings.Join(args[1:], " ") {
+	case "shutdown":
+		return c.do("POST", "/api/ports/"+name+"/down", nil)
+	case "no shutdown":
+		return c.do("POST", "/api/ports/"+name+"/up", nil)
+	}
+	return errUsage
+}
+
+// capture starts or stops the capture of a port. the file is written by the
+// switch, so a relative path is made absolute here
+func capture(c *client, name string, args []string) error {
+	if len(args) == 1 && args[0] == "stop" {
+		resp := api.CaptureResponse{}
+		err := c.do("DELETE", "/api/ports/"+name+"/capture", &resp)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%d frames written to %s\n", resp.Frames, resp.Path)
+		return nil
+	}
+	if len(args) < 2 || args[0] != "start" || (len(args) > 2 && (args[2] != "filter" || len(args) == 3)) {
+		return errUsage
+	}
+	path, err := filepath.Abs(args[1])
+	if err != nil {
+		return err
+	}
+	req := api.CaptureRequest{Path: path}
+	if len(args) > 2 {
+		req.Filter = strings.Join(args[3:], " ")
+	}
+	return c.send("POST", "/api/ports/"+name+"/capture", req, nil)
+}
+
+// parseProc parses a process name as shown by show pipeline (L2:L2Switch)
+func parseProc(s string) (api.ProcRequest, error) {
+	layer, name, ok := strings.Cut(strings.TrimPrefix(s, "L"), ":")
+	if !ok || name == "" {
+		return api.ProcRequest{}, errUsage
+	}
+	n, err := strconv.Atoi(layer)
+	if err != nil {
+		return api.ProcRequest{}, errUsage
+	}
+	return api.ProcRequest{Layer: n, Name: name}, nil
+}
+
+// procOptions parses the [at <position>] [config <file>] options of a pipeline command
+func procOptions(req *api.ProcRequest, args []string) error {
+	for len(args) > 0 {
+		if len(args) < 2 {
+			return errUsage
+		}
+		switch args[0] {
+		case "at":
+			pos, err := strconv.Atoi(args[1])
+			if err != nil || pos < 1 {
+				return errUsage
+			}
+			// positions start at 1 like the # column of show pipeline
+			pos--
+			req.Position = &pos
+		case "config":
+			req.ConfigFile = args[1]
+		default:
+			return errUsage
+		}
+		args = args[2:]
+	}
+	return nil
+}
+
+func pipelineCmd(c *client, args []string) error {
+	if len(args) < 2 {
+		return errUsage
+	}
+	proc, err := parseProc(args[1])
+	if err != nil {
+		return err
+	}
+	procs := []controlplane.ProcInfo{}
+	switch {
+	case args[0] == "insert":
+		err = procOptions(&proc, args[2:])
+		if err != nil {
+			return err
+		}
+		err = c.send("POST", "/api/pipeline", proc, &procs)
+	case args[0] == "remove" && len(args) == 2:
+		err = c.do("DELETE", fmt.Sprintf("/api/pipeline/%d/%s", proc.Layer, proc.Name), &procs)
+	case args[0] == "swap" && len(args) >= 3:
+		with, perr := parseProc(args[2])
+		if perr != nil {
+			return perr
+		}
+		err = procOptions(&with, args[3:])
+		if err != nil || with.Position != nil {
+			return errUsage
+		}
+		err = c.send("PUT", fmt.Sprintf("/api/pipeline/%d/%s", proc.Layer, proc.Name), with, &procs)
+	default:
+		return errUsage
+	}
+	if err != nil {
+		return err
+	}
+	return printProcs(procs)
+}
+
+func reload(c *client, args []string) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+	return c.do("POST", "/api/reload", nil)
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, `usage: gswitchctl [-s socket] <command>
+
+commands:
+  show interfaces [<port>]
+  show mac address-table [dynamic|sticky|static] [vlan <id>] [interface <port>] [address <mac>]
+  show mac address-table aging-time
+  show mac address-table moves
+  show port-security [interface <port>]
+  show spanning-tree
+  show lldp neighbors
+  show arp
+  show ip route
+  show pipeline
+  clear mac [dynamic|sticky|static|all] [vlan <id>] [interface <port>] [address <mac>]
+  clear arp
+  clear lldp
+  mac address-table static <mac> vlan <id> interface <port>
+  no mac address-table static <mac> vlan <id>
+  interface <port> shutdown
+  interface <port> no shutdown
+  interface <port> capture start <file> [filter <expression>]
+  interface <port> capture stop
+  pipeline insert L<layer>:<name> [at <position>] [config <file>]
+  pipeline remove L<layer>:<name>
+  pipeline swap L<layer>:<name> L<layer>:<name> [config <file>]
+  reload
+
+flags:
+`)
+	flag.PrintDefaults()
+}
+
+func main() {
+	socket := flag.String("s", api.DEFAULT_SOCKET, "management socket of the switch")
+	flag.Usage = usage
+	flag.Parse()
+	args := flag.Args()
+	if len(args) == 0 {
+		usage()
+		os.Exit(2)
+	}
+
+	c := newClient(*socket)
+	var err error
+	switch args[0] {
+	case "show":
+		err = show(c, args[1:])
+	case "clear":
+		err = clearTable(c, args[1:])
+	case "mac":
+		err = macCmd(c, args[1:])
+	case "no":
+		err = noCmd(c, args[1:])
+	case "interface":
+		err = iface(c, args[1:])
+	case "pipeline":
+		err = pipelineCmd(c, args[1:])
+	case "reload":
+		err = reload(c, args[1:])
+	default:
+		err = errUsage
+	}
+	if errors.Is(err, errUsage) {
+		usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "gswitchctl: %v\n", err)
+		os.Exit(1)
+	}
+}
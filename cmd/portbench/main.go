@@ -0,0 +1,135 @@
+// portbench compares the throughput of port backends over a veth pair, and
+// of rawconn, the raw.Conn path SwitchPort used before them.
+// it needs root and an existing pair whose both ends are up:
+//
+//	ip link add bench0 type veth peer name bench1
+//	ip link set bench0 up && ip link set bench1 up
+//	sudo ./portbench -tx bench0 -rx bench1 -n 1000000
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/m-motawea/gSwitch/config"
+	"github.com/m-motawea/gSwitch/dataplane"
+	"github.com/mdlayher/ethernet"
+)
+
+type result struct {
+	backend  string
+	sent     int
+	received uint64
+	elapsed  time.Duration
+}
+
+func (r result) String() string {
+	pps := float64(r.received) / r.elapsed.Seconds()
+	return fmt.Sprintf("%-10s sent %d received %d in %v (%.0f pps)", r.backend, r.sent, r.received, r.elapsed, pps)
+}
+
+func openBackend(name string, ifname string) (dataplane.Iface, error) {
+	if name == "rawconn" {
+		return openRawConn(ifname)
+	}
+	backend, err := dataplane.NewBackend(ifname, config.SwitchPortConfig{Backend: name})
+	if err != nil {
+		return nil, err
+	}
+	return backend, backend.Open()
+}
+
+func run(name string, txName string, rxName string, count int, size int) (result, error) {
+	res := result{backend: name, sent: count}
+	tx, err := openBackend(name, txName)
+	if err != nil {
+		return res, err
+	}
+	defer tx.Close()
+	rx, err := openBackend(name, rxName)
+	if err != nil {
+		return res, err
+	}
+
+	src, _ := net.ParseMAC("02:00:00:00:be:01")
+	dst, _ := net.ParseMAC("02:00:00:00:be:02")
+	f := ethernet.Frame{
+		Destination: dst,
+		Source:      src,
+		EtherType:   0x88b5, // local experimental ethertype
+		Payload:     make([]byte, size),
+	}
+	frame, err := f.MarshalBinary()
+	if err != nil {
+		rx.Close()
+		return res, err
+	}
+
+	var received uint64
+	done := make(chan int)
+	go func() {
+		buf := make([]byte, rx.MTU())
+		for {
+			_, _, err := rx.ReadFrame(buf)
+			if err != nil {
+				close(done)
+				return
+			}
+			atomic.AddUint64(&received, 1)
+		}
+	}()
+
+	flusher, batched := tx.(dataplane.Flusher)
+	start := time.Now()
+	for i := 0; i < count; i++ {
+		_, err := tx.WriteFrame(frame)
+		if err != nil {
+			log.Printf("%s: write failed: %v", name, err)
+		}
+		if batched && i%dataplane.IFACE_BUFFER_SIZE == 0 {
+			flusher.Flush()
+		}
+	}
+	if batched {
+		flusher.Flush()
+	}
+	// give the receiver a moment to drain what is still in flight
+	last := uint64(0)
+	for {
+		time.Sleep(100 * time.Millisecond)
+		cur := atomic.LoadUint64(&received)
+		if cur == last || cur >= uint64(count) {
+			break
+		}
+		last = cur
+	}
+	res.elapsed = time.Since(start)
+	res.received = atomic.LoadUint64(&received)
+	rx.Close()
+	<-done
+	return res, nil
+}
+
+func main() {
+	txName := flag.String("tx", "bench0", "interface frames are sent on")
+	rxName := flag.String("rx", "bench1", "interface frames are received on")
+	count := flag.Int("n", 100000, "number of frames to send")
+	size := flag.Int("size", 64, "payload size of each frame")
+	backends := flag.String("backends", "rawconn,afpacket,tpacket", "comma separated port backends to compare. rawconn is the raw.Conn path they replaced")
+	flag.Parse()
+
+	for _, name := range strings.Split(*backends, ",") {
+		res, err := run(name, *txName, *rxName, *count, *size)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+			continue
+		}
+		fmt.Println(res)
+	}
+}
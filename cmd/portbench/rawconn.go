@@ -0,0 +1,55 @@
+package main
+
+import (
+	"net"
+
+	"github.com/mdlayher/raw"
+)
+
+// ETH_P_ALL in host byte order. raw.ListenPacket converts it
+const ethPAll = 0x0003
+
+// rawConn is the raw.Conn path SwitchPort used before the port backends:
+// one ReadFrom into a fresh mtu sized buffer and one WriteTo per frame.
+// it is the baseline the backends are compared with
+type rawConn struct {
+	ifi  *net.Interface
+	conn *raw.Conn
+}
+
+func openRawConn(ifname string) (*rawConn, error) {
+	ifi, err := net.InterfaceByName(ifname)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := raw.ListenPacket(ifi, ethPAll, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &rawConn{ifi: ifi, conn: conn}, nil
+}
+
+func (c *rawConn) Open() error {
+	return nil
+}
+
+func (c *rawConn) ReadFrame(buf []byte) (int, net.Addr, error) {
+	frame := make([]byte, c.MTU())
+	n, addr, err := c.conn.ReadFrom(frame)
+	if err != nil {
+		return 0, nil, err
+	}
+	return copy(buf, frame[:n]), addr, nil
+}
+
+func (c *rawConn) WriteFrame(frame []byte) (int, error) {
+	return c.conn.WriteTo(frame, c.conn.LocalAddr())
+}
+
+func (c *rawConn) Close() error {
+	return c.conn.Close()
+}
+
+func (c *rawConn) MTU() int {
+	return c.ifi.MTU + 18 // ethernet header and a vlan tag
+}
@@ -7,17 +7,69 @@ import (
 )
 
 type RedisConfig struct {
-	Port     int
-	DB       int
-	Address  string
-	Password string
-	Prefix   string
+	Enabled     bool
+	Port        int
+	DB          int
+	Address     string
+	Password    string
+	Prefix      string // prepended to every key and channel
+	SyncSeconds int    // full resync interval. defaults to 60
+}
+
+type LogConfig struct {
+	Level      string            // debug, info, warn or error. defaults to "info"
+	Format     string            // "text" or "json". defaults to "text"
+	File       string            // defaults to "gSwitch.log". "-" writes to stderr
+	MaxSizeMB  int               // rotate the file when it reaches this size. 0 disables rotation
+	MaxBackups int               // rotated files to keep. 0 keeps all
+	MaxAgeDays int               // days to keep rotated files. 0 keeps them forever
+	Compress   bool              // gzip rotated files
+	Subsystems map[string]string // level per subsystem (dataplane, controlplane, l2, l3, metrics, api, grpc, datastore) or control process name
+}
+
+type APIConfig struct {
+	Enabled bool   // serves the http listener and the socket. false disables both
+	Address string // listen address. "-" disables the http listener. defaults to "127.0.0.1:8080"
+	Socket  string // unix socket gswitchctl connects to. "-" disables it. defaults to "/var/run/gswitch.sock"
+}
+
+type GRPCConfig struct {
+	Enabled bool
+	Address string // listen address. defaults to "127.0.0.1:9090"
+}
+
+type MetricsConfig struct {
+	Enabled bool
+	Address string // listen address. defaults to ":9100"
+	Path    string // defaults to "/metrics"
+}
+
+type TapPortConfig struct {
+	MAC string // optional mac address of the tap interface
+}
+
+type PcapPortConfig struct {
+	In       string // pcap or pcapng file replayed as ingress traffic
+	Out      string // pcap file egress traffic is written to
+	Realtime bool   // keep the original gaps between replayed frames
+}
+
+type PortSecurityConfig struct {
+	Enabled         bool
+	MaxMACs         *int     // addresses learned on the port at the same time. 1 if not set
+	AllowedMACs     []string // only these addresses are learned when it is not empty
+	Violation       string   // "protect", "restrict" or "shutdown". defaults to "shutdown"
+	RecoverySeconds int      // a port shut down by a violation comes back up after this. 0 keeps it down
 }
 
 type SwitchPortConfig struct {
 	Trunk        bool
 	AllowedVLANs []int
 	Up           bool
+	Backend      string // port backend name. defaults to "afpacket"
+	Tap          TapPortConfig
+	Pcap         PcapPortConfig
+	Security     PortSecurityConfig
 }
 
 type ControlProcessConfig struct {
@@ -28,6 +80,10 @@ type ControlProcessConfig struct {
 
 type Config struct {
 	Redis          RedisConfig
+	Metrics        MetricsConfig
+	API            APIConfig
+	GRPC           GRPCConfig
+	Log            LogConfig
 	SwitchPorts    map[string]SwitchPortConfig
 	ControlProcess []ControlProcessConfig
 }
@@ -1,12 +1,16 @@
 package controlplane
 
 import (
+	"errors"
+	"time"
+
 	"github.com/m-motawea/gSwitch/dataplane"
 	"github.com/m-motawea/pipeline"
 )
 
 type ControlMessage struct {
 	InFrame      *dataplane.IncomingFrame
+	Received     time.Time   // when the frame entered the pipeline
 	PreMessage   interface{} // To be able to reconstruct the packet again
 	LayerPayload interface{} // To separate each leayer payload
 	OutPorts     []*dataplane.SwitchPort
@@ -18,10 +22,21 @@ type ControlProcessFuncPair struct {
 	InFunc  func(proc pipeline.PipelineProcess, msg pipeline.PipelineMessage) pipeline.PipelineMessage
 	OutFunc func(proc pipeline.PipelineProcess, msg pipeline.PipelineMessage) pipeline.PipelineMessage
 	Init    func(sw *Switch)
+	Gauges  func(sw *Switch) []ProcGauge              // optional. reports process state (table sizes, ...) for metrics
+	Dump    func(sw *Switch) interface{}              // optional. returns the process tables for the management api
+	Flush   func(sw *Switch) error                    // optional. clears the process tables
+	Reload  func(sw *Switch, configFile string) error // optional. re-reads the config file while the switch runs
+
+	// where the process goes in the pipeline. checked when the pipeline is built or changed
+	Position ProcPosition // optional. where the process sits among the processes of its layer
+	Requires []string     // optional. capabilities that a process before this one must provide
+	Provides []string     // optional. capabilities this process gives the processes after it
 }
 
 var ControlProcs map[int]map[string]ControlProcessFuncPair
 
+var ErrUnknownProc = errors.New("no control process registered with this name")
+
 func init() {
 	ControlProcs = map[int]map[string]ControlProcessFuncPair{}
 }
@@ -0,0 +1,144 @@
+package controlplane
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type EventType string
+
+const (
+	EventMACLearned   EventType = "mac_learned"
+	EventMACMoved     EventType = "mac_moved"
+	EventMACAged      EventType = "mac_aged"
+	EventMACFlushed   EventType = "mac_flushed"
+	EventMACFlap      EventType = "mac_flap"
+	EventARPAdded     EventType = "arp_added"
+	EventARPExpired   EventType = "arp_expired"
+	EventARPFlushed   EventType = "arp_flushed"
+	EventPortUp       EventType = "port_up"
+	EventPortDown     EventType = "port_down"
+	EventPortSecurity EventType = "port_security_violation"
+	EventRouteAdded   EventType = "route_added"
+	EventRouteRemoved EventType = "route_removed"
+	EventSTPPortState EventType = "stp_port_state"
+	EventSTPTopology  EventType = "stp_topology_change"
+)
+
+const DEFAULT_EVENT_BUFFER = 1024
+
+// Event is a change in the switch tables or ports. only the fields that
+// apply to the type are set.
+type Event struct {
+	Type     EventType
+	Time     time.Time
+	Port     string `json:",omitempty"`
+	OldPort  string `json:",omitempty"` // previous port of a moved mac
+	VLAN     int    `json:",omitempty"`
+	MAC      string `json:",omitempty"`
+	IP       string `json:",omitempty"`
+	Prefix   string `json:",omitempty"` // route prefix
+	Reason   string `json:",omitempty"` // why a port was err-disabled
+	Moves    int    `json:",omitempty"` // moves of a flapping mac within the flap window
+	Role     string `json:",omitempty"` // spanning tree role of the port
+	State    string `json:",omitempty"` // spanning tree state of the port
+	Instance int    `json:",omitempty"` // multiple spanning tree instance. 0 for the common tree
+}
+
+/*
+EventBus fans events out to subscribers. processes publish from the
+pipeline so Publish never blocks: a subscriber that does not keep up
+loses events and the loss is counted on its subscription.
+
+	sub := sw.Events.Subscribe(0, controlplane.EventMACLearned, controlplane.EventMACMoved)
+	defer sub.Close()
+	for ev := range sub.C {
+		...
+	}
+*/
+type EventBus struct {
+	mutex *sync.RWMutex
+	subs  map[*Subscription]struct{}
+}
+
+type Subscription struct {
+	C       <-chan Event
+	ch      chan Event
+	types   map[EventType]bool // empty for all types
+	bus     *EventBus
+	dropped atomic.Uint64
+	once    sync.Once
+}
+
+func NewEventBus() *EventBus {
+	return &EventBus{
+		mutex: &sync.RWMutex{},
+		subs:  map[*Subscription]struct{}{},
+	}
+}
+
+// Subscribe returns a subscription to the given types, or to all events if
+// none are given. size is the channel buffer (DEFAULT_EVENT_BUFFER if 0).
+func (b *EventBus) Subscribe(size int, types ...EventType) *Subscription {
+	if size <= 0 {
+		size = DEFAULT_EVENT_BUFFER
+	}
+	sub := &Subscription{
+		ch:    make(chan Event, size),
+		types: map[EventType]bool{},
+		bus:   b,
+	}
+	sub.C = sub.ch
+	for _, t := range types {
+		sub.types[t] = true
+	}
+	b.mutex.Lock()
+	b.subs[sub] = struct{}{}
+	b.mutex.Unlock()
+	return sub
+}
+
+// Publish sends the event to every interested subscriber. it is safe to call
+// on a nil bus so tables can be used without a switch.
+func (b *EventBus) Publish(ev Event) {
+	if b == nil {
+		return
+	}
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+	defer b.mutex.RUnlock()
+	b.mutex.RLock()
+	for sub := range b.subs {
+		if len(sub.types) > 0 && !sub.types[ev.Type] {
+			continue
+		}
+		select {
+		case sub.ch <- ev:
+		default:
+			sub.dropped.Add(1)
+		}
+	}
+}
+
+func (b *EventBus) Subscribers() int {
+	defer b.mutex.RUnlock()
+	b.mutex.RLock()
+	return len(b.subs)
+}
+
+// Close removes the subscription from the bus and closes C
+func (s *Subscription) Close() {
+	s.once.Do(func() {
+		s.bus.mutex.Lock()
+		delete(s.bus.subs, s)
+		close(s.ch)
+		s.bus.mutex.Unlock()
+	})
+}
+
+// Dropped returns the number of events lost because C was full
+func (s *Subscription) Dropped() uint64 {
+	return s.dropped.Load()
+}
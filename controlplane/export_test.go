@@ -0,0 +1,3 @@
+package controlplane
+
+var CheckOrder = checkOrder
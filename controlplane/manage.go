@@ -0,0 +1,184 @@
+package controlplane
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/m-motawea/gSwitch/config"
+	"github.com/m-motawea/gSwitch/dataplane"
+)
+
+var ErrNoPort = errors.New("no such port")
+var ErrPortExists = errors.New("port already exists")
+var ErrNoProc = errors.New("no such process in the pipeline")
+var ErrNotSupported = errors.New("not supported by the process")
+
+type PortInfo struct {
+	Name         string
+	Up           bool
+	Trunk        bool
+	VLAN         int // access vlan. 0 for trunk ports
+	AllowedVLANs []int
+	Backend      string
+	ErrDisabled  *dataplane.ErrDisableInfo `json:",omitempty"` // set while the port is err-disabled
+}
+
+type ProcInfo struct {
+	Layer      int
+	Name       string
+	ConfigFile string
+	Stats      ProcStats
+}
+
+func (sw *Switch) getPort(name string) (*dataplane.SwitchPort, error) {
+	port, ok := sw.PortMap()[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNoPort, name)
+	}
+	return port, nil
+}
+
+func (sw *Switch) portInfo(port *dataplane.SwitchPort) PortInfo {
+	trunk, vlan, allowed := port.VLANConfig()
+	sw.mutex.RLock()
+	backend := sw.portConfigs[port.Name].Backend
+	sw.mutex.RUnlock()
+	if backend == "" {
+		backend = dataplane.DEFAULT_BACKEND
+	}
+	var errDisabled *dataplane.ErrDisableInfo
+	info, ok := port.ErrDisabled()
+	if ok {
+		errDisabled = &info
+	}
+	return PortInfo{
+		Name:         port.Name,
+		Up:           port.IsUp(),
+		Trunk:        trunk,
+		VLAN:         vlan,
+		AllowedVLANs: append([]int{}, allowed...),
+		Backend:      backend,
+		ErrDisabled:  errDisabled,
+	}
+}
+
+func (sw *Switch) PortInfo(name string) (PortInfo, error) {
+	port, err := sw.getPort(name)
+	if err != nil {
+		return PortInfo{}, err
+	}
+	return sw.portInfo(port), nil
+}
+
+// PortInfos lists the ports sorted by name
+func (sw *Switch) PortInfos() []PortInfo {
+	infos := []PortInfo{}
+	for _, port := range sw.PortMap() {
+		infos = append(infos, sw.portInfo(port))
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos
+}
+
+// SetPortVLANs changes the vlan membership of a port without taking it down
+func (sw *Switch) SetPortVLANs(name string, trunk bool, vlans ...int) error {
+	port, err := sw.getPort(name)
+	if err != nil {
+		return err
+	}
+	err = port.SetVLANs(trunk, vlans...)
+	if err != nil {
+		return err
+	}
+	sw.mutex.Lock()
+	cfg := sw.portConfigs[name]
+	cfg.Trunk = trunk
+	cfg.AllowedVLANs = vlans
+	sw.portConfigs[name] = cfg
+	sw.mutex.Unlock()
+	logger.Info("port vlans changed", "switch", sw.Name, "port", name, "trunk", trunk, "vlans", vlans)
+	return nil
+}
+
+// SetPortSecurity changes the port security of a port. the addresses already
+// learned on it are kept
+func (sw *Switch) SetPortSecurity(name string, cfg config.PortSecurityConfig) error {
+	port, err := sw.getPort(name)
+	if err != nil {
+		return err
+	}
+	security, err := dataplane.NewPortSecurity(cfg)
+	if err != nil {
+		return err
+	}
+	port.SetSecurity(security)
+	sw.mutex.Lock()
+	portCfg := sw.portConfigs[name]
+	portCfg.Security = cfg
+	sw.portConfigs[name] = portCfg
+	sw.mutex.Unlock()
+	logger.Info("port security changed", "switch", sw.Name, "port", name, "enabled", cfg.Enabled)
+	return nil
+}
+
+// Procs lists the processes of the pipeline in order
+func (sw *Switch) Procs() []ProcInfo {
+	infos := []ProcInfo{}
+	defer sw.mutex.RUnlock()
+	sw.mutex.RLock()
+	for i, procConfig := range sw.procConfigs {
+		infos = append(infos, ProcInfo{
+			Layer:      procConfig.Layer,
+			Name:       procConfig.Name,
+			ConfigFile: procConfig.ConfigFile,
+			Stats:      sw.procCounters[i].stats(),
+		})
+	}
+	return infos
+}
+
+func (sw *Switch) getProcPair(layer int, name string) (ControlProcessFuncPair, error) {
+	defer sw.mutex.RUnlock()
+	sw.mutex.RLock()
+	for _, procConfig := range sw.procConfigs {
+		if procConfig.Layer == layer && procConfig.Name == name {
+			return ControlProcs[layer][name], nil
+		}
+	}
+	return ControlProcessFuncPair{}, fmt.Errorf("%w: L%d:%s", ErrNoProc, layer, name)
+}
+
+// ProcTable returns the tables of a process in the pipeline (MAC table, ARP table, ...)
+func (sw *Switch) ProcTable(layer int, name string) (interface{}, error) {
+	pair, err := sw.getProcPair(layer, name)
+	if err != nil {
+		return nil, err
+	}
+	if pair.Dump == nil {
+		return nil, fmt.Errorf("%w: L%d:%s has no table", ErrNotSupported, layer, name)
+	}
+	return pair.Dump(sw), nil
+}
+
+// ProcStorInfo describes the storage of a process in the pipeline
+func (sw *Switch) ProcStorInfo(layer int, name string) (StorInfo, error) {
+	_, err := sw.getProcPair(layer, name)
+	if err != nil {
+		return StorInfo{}, err
+	}
+	return sw.Stor.GetStor(layer, name).Info(), nil
+}
+
+// FlushProcTable clears the tables of a process in the pipeline
+func (sw *Switch) FlushProcTable(layer int, name string) error {
+	pair, err := sw.getProcPair(layer, name)
+	if err != nil {
+		return err
+	}
+	if pair.Flush == nil {
+		return fmt.Errorf("%w: L%d:%s table can not be flushed", ErrNotSupported, layer, name)
+	}
+	logger.Info("flushing process table", "switch", sw.Name, "layer", layer, "process", name)
+	return pair.Flush(sw)
+}
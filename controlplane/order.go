@@ -0,0 +1,126 @@
+package controlplane
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/m-motawea/gSwitch/config"
+)
+
+// ProcPosition is where a process sits among the processes of its layer
+type ProcPosition int
+
+const (
+	PositionAny   ProcPosition = iota // anywhere in its layer
+	PositionFirst                     // before the other processes of its layer (filters)
+	PositionLast                      // after the other processes of its layer (adapters to the next layer)
+)
+
+var ErrProcOrder = errors.New("invalid control process order")
+
+func (p ProcPosition) String() string {
+	switch p {
+	case PositionFirst:
+		return "first"
+	case PositionLast:
+		return "last"
+	}
+	return "any"
+}
+
+// rank orders the positions inside a layer
+func (p ProcPosition) rank() int {
+	switch p {
+	case PositionFirst:
+		return 0
+	case PositionLast:
+		return 2
+	}
+	return 1
+}
+
+// providers returns the registered processes that provide capability
+func providers(capability string) []string {
+	names := []string{}
+	for layer, procs := range ControlProcs {
+		for name, pair := range procs {
+			if slices.Contains(pair.Provides, capability) {
+				names = append(names, procKey(layer, name))
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+/*
+checkOrder checks the chain against what the processes declare when they
+register:
+
+  - layers never go down: every L2 process comes before the L3 ones
+  - inside a layer PositionFirst processes come before the others and
+    PositionLast processes after them
+  - every capability a process Requires is provided by a process before it
+  - a capability is provided once (a pipeline has one Hub or L2Switch)
+
+egress runs the chain in reverse, so a process that needs the work of a
+later one on egress requires a capability of its own from the earlier one:
+Routing sets the next hop and requires arp, so ARP resolves it afterwards.
+*/
+func checkOrder(procs []config.ControlProcessConfig) error {
+	problems := []string{}
+	provided := map[string]string{} // capability -> process that provides it
+	for i, procConfig := range procs {
+		key := procKey(procConfig.Layer, procConfig.Name)
+		pair := ControlProcs[procConfig.Layer][procConfig.Name]
+		if i > 0 {
+			prevConfig := procs[i-1]
+			prevKey := procKey(prevConfig.Layer, prevConfig.Name)
+			prev := ControlProcs[prevConfig.Layer][prevConfig.Name]
+			switch {
+			case prevConfig.Layer > procConfig.Layer:
+				problems = append(problems, fmt.Sprintf("%s comes after %s of a higher layer", key, prevKey))
+			case prevConfig.Layer == procConfig.Layer && prev.Position.rank() > pair.Position.rank():
+				problems = append(problems, fmt.Sprintf("%s (position %s) comes after %s (position %s) in layer %d",
+					key, pair.Position, prevKey, prev.Position, procConfig.Layer))
+			}
+		}
+		for _, capability := range pair.Requires {
+			_, ok := provided[capability]
+			if ok {
+				continue
+			}
+			by := providerAfter(procs[i+1:], capability)
+			if by != "" {
+				problems = append(problems, fmt.Sprintf("%s requires %s provided by %s which comes after it", key, capability, by))
+				continue
+			}
+			problems = append(problems, fmt.Sprintf("%s requires %s. add one of %v before it", key, capability, providers(capability)))
+		}
+		for _, capability := range pair.Provides {
+			by, ok := provided[capability]
+			if ok {
+				problems = append(problems, fmt.Sprintf("%s and %s both provide %s", by, key, capability))
+				continue
+			}
+			provided[capability] = key
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: %s", ErrProcOrder, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// providerAfter returns the first process of procs that provides capability
+func providerAfter(procs []config.ControlProcessConfig, capability string) string {
+	for _, procConfig := range procs {
+		if slices.Contains(ControlProcs[procConfig.Layer][procConfig.Name].Provides, capability) {
+			return procKey(procConfig.Layer, procConfig.Name)
+		}
+	}
+	return ""
+}
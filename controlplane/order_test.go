@@ -0,0 +1,98 @@
+package controlplane_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/m-motawea/gSwitch/config"
+	"github.com/m-motawea/gSwitch/controlplane"
+
+	_ "github.com/m-motawea/gSwitch/l2"
+	_ "github.com/m-motawea/gSwitch/l3"
+)
+
+// chain builds a process list from L<layer>:<name> keys
+func chain(keys ...string) []config.ControlProcessConfig {
+	procs := []config.ControlProcessConfig{}
+	for _, key := range keys {
+		layer, name, _ := strings.Cut(key, ":")
+		procs = append(procs, config.ControlProcessConfig{Layer: int(layer[1] - '0'), Name: name})
+	}
+	return procs
+}
+
+func TestCheckOrderShippedConfig(t *testing.T) {
+	cfg, err := config.ReadConfig("../config.toml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.ControlProcess) == 0 {
+		t.Fatal("no control processes in config.toml")
+	}
+	err = controlplane.CheckOrder(cfg.ControlProcess)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCheckOrder(t *testing.T) {
+	tests := []struct {
+		name  string
+		procs []config.ControlProcessConfig
+		err   string // part of the error. empty if the order is valid
+	}{
+		{
+			name:  "full pipeline",
+			procs: chain("L2:STP", "L2:LLDP", "L2:MACFilter", "L2:L2Switch", "L2:ARP", "L2:L2Adapter", "L3:IPv4", "L3:Routing", "L3:ICMP", "L3:L3Adapter"),
+		},
+		{
+			name:  "hub",
+			procs: chain("L2:Hub"),
+		},
+		{
+			name:  "routing before ipv4",
+			procs: chain("L2:L2Switch", "L2:ARP", "L2:L2Adapter", "L3:Routing", "L3:IPv4"),
+			err:   "L3:Routing requires ipv4 provided by L3:IPv4 which comes after it",
+		},
+		{
+			name:  "adapter before arp",
+			procs: chain("L2:L2Switch", "L2:L2Adapter", "L2:ARP", "L3:IPv4"),
+			err:   "L2:ARP (position any) comes after L2:L2Adapter (position last)",
+		},
+		{
+			name:  "adapter before a first process",
+			procs: chain("L2:L2Switch", "L2:L2Adapter", "L2:STP"),
+			err:   "L2:STP (position first) comes after L2:L2Adapter (position last)",
+		},
+		{
+			name:  "l3 before l2",
+			procs: chain("L3:IPv4", "L2:L2Switch", "L2:L2Adapter"),
+			err:   "L2:L2Switch comes after L3:IPv4 of a higher layer",
+		},
+		{
+			name:  "hub and switch",
+			procs: chain("L2:Hub", "L2:L2Switch"),
+			err:   "L2:Hub and L2:L2Switch both provide forwarding",
+		},
+		{
+			name:  "nothing forwards",
+			procs: chain("L2:ARP"),
+			err:   "L2:ARP requires forwarding. add one of [L2:Hub L2:L2Switch] before it",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := controlplane.CheckOrder(test.procs)
+			if test.err == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if !errors.Is(err, controlplane.ErrProcOrder) || !strings.Contains(err.Error(), test.err) {
+				t.Fatalf("err = %v. want %v containing %q", err, controlplane.ErrProcOrder, test.err)
+			}
+		})
+	}
+}
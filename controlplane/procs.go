@@ -0,0 +1,244 @@
+package controlplane
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/m-motawea/gSwitch/config"
+	"github.com/m-motawea/pipeline"
+)
+
+var ErrProcExists = errors.New("process already in the pipeline")
+var ErrInvalidPosition = errors.New("invalid pipeline position")
+
+// DRAIN_TIMEOUT bounds how long a pipeline change waits for the frames in the
+// old pipeline when the caller has no deadline of its own
+const DRAIN_TIMEOUT = 5 * time.Second
+
+// procLife ties the goroutines of a process to the time it spends in the
+// pipeline. it is cancelled when the process is removed or the switch stops.
+type procLife struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     *sync.WaitGroup // goroutines of the process
+	loops  *sync.WaitGroup // goroutines of every process of the switch
+}
+
+func procKey(layer int, name string) string {
+	return fmt.Sprintf("L%d:%s", layer, name)
+}
+
+// validateProcs checks that every process is registered, appears once and
+// comes in an order that satisfies what the processes declare
+func validateProcs(procs []config.ControlProcessConfig) error {
+	seen := map[string]bool{}
+	for _, procConfig := range procs {
+		key := procKey(procConfig.Layer, procConfig.Name)
+		_, ok := ControlProcs[procConfig.Layer][procConfig.Name]
+		if !ok {
+			return fmt.Errorf("%w: %s", ErrUnknownProc, key)
+		}
+		if seen[key] {
+			return fmt.Errorf("%w: %s", ErrProcExists, key)
+		}
+		seen[key] = true
+	}
+	return checkOrder(procs)
+}
+
+func (sw *Switch) newPipelineProc(procConfig config.ControlProcessConfig, counters *procCounters) (*pipeline.PipelineProcess, error) {
+	pair := ControlProcs[procConfig.Layer][procConfig.Name]
+	procName := procKey(procConfig.Layer, procConfig.Name)
+	inFunc := sw.trackDrops(counters.in.instrument(pair.InFunc))
+	outFunc := sw.trackDrops(counters.out.instrument(pair.OutFunc))
+	proc, err := pipeline.NewPipelineProcess(procName, inFunc, outFunc)
+	if err != nil {
+		logger.Error("failed to create control process", "process", procName, "error", err)
+		return nil, err
+	}
+	return &proc, nil
+}
+
+// initProc sets up the storage of a process and runs its Init
+func (sw *Switch) initProc(procConfig config.ControlProcessConfig) {
+	ctx, cancel := context.WithCancel(sw.ctx)
+	life := &procLife{ctx: ctx, cancel: cancel, wg: &sync.WaitGroup{}, loops: sw.loops}
+	sw.Stor.resetStor(procConfig.Layer, procConfig.Name, procConfig.ConfigFile, life)
+	pair := ControlProcs[procConfig.Layer][procConfig.Name]
+	if pair.Init != nil {
+		pair.Init(sw)
+	}
+}
+
+// teardownProc stops the goroutines of a process that left the pipeline and
+// drops its storage
+func (sw *Switch) teardownProc(ctx context.Context, procConfig config.ControlProcessConfig) error {
+	var err error
+	stor, ok := sw.Stor.LookupStor(procConfig.Layer, procConfig.Name)
+	if ok && stor.life != nil {
+		stor.life.cancel()
+		err = wait(ctx, stor.life.wg)
+	}
+	sw.Stor.delStor(procConfig.Layer, procConfig.Name)
+	return err
+}
+
+/*
+SetProcs replaces the processes of the running pipeline with procs:
+
+- new processes are initialized before they see any frame
+- processes that stay keep their tables, counters and config file
+- removed processes have their goroutines stopped and their storage dropped
+
+frames keep arriving while the new pipeline is built. they are held at the
+ports for the moment the old pipeline drains and the new one takes over. if the
+old pipeline does not drain before ctx is done nothing changes.
+*/
+func (sw *Switch) SetProcs(ctx context.Context, procs []config.ControlProcessConfig) error {
+	defer sw.procsMutex.Unlock()
+	sw.procsMutex.Lock()
+	err := validateProcs(procs)
+	if err != nil {
+		return err
+	}
+	sw.mutex.RLock()
+	current := map[string]int{}
+	for i, procConfig := range sw.procConfigs {
+		current[procKey(procConfig.Layer, procConfig.Name)] = i
+	}
+	oldConfigs := append([]config.ControlProcessConfig{}, sw.procConfigs...)
+	oldCounters := append([]*procCounters{}, sw.procCounters...)
+	sw.mutex.RUnlock()
+
+	pipe, err := pipeline.NewPipeline("ControlPlanePipeline", true, sw.wg, sw.consumeChannel)
+	if err != nil {
+		return err
+	}
+	configs := []config.ControlProcessConfig{}
+	counters := []*procCounters{}
+	added := []config.ControlProcessConfig{}
+	for _, procConfig := range procs {
+		pc := &procCounters{layer: procConfig.Layer, name: procConfig.Name}
+		i, ok := current[procKey(procConfig.Layer, procConfig.Name)]
+		if ok {
+			procConfig = oldConfigs[i]
+			pc = oldCounters[i]
+			delete(current, procKey(procConfig.Layer, procConfig.Name))
+		} else {
+			added = append(added, procConfig)
+		}
+		proc, err := sw.newPipelineProc(procConfig, pc)
+		if err != nil {
+			return err
+		}
+		pipe.AddProcess(proc)
+		configs = append(configs, procConfig)
+		counters = append(counters, pc)
+	}
+	removed := []config.ControlProcessConfig{}
+	for _, i := range current {
+		removed = append(removed, oldConfigs[i])
+	}
+
+	for _, procConfig := range added {
+		logger.Info("starting process", "switch", sw.Name, "layer", procConfig.Layer, "process", procConfig.Name)
+		sw.initProc(procConfig)
+	}
+	err = sw.replacePipeline(ctx, &pipe, configs, counters)
+	if err != nil {
+		logger.Warn("pipeline not changed", "switch", sw.Name, "error", err)
+		for _, procConfig := range added {
+			sw.teardownProc(ctx, procConfig)
+		}
+		return err
+	}
+	errs := []error{}
+	for _, procConfig := range removed {
+		logger.Info("stopping process", "switch", sw.Name, "layer", procConfig.Layer, "process", procConfig.Name)
+		err := sw.teardownProc(ctx, procConfig)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", procKey(procConfig.Layer, procConfig.Name), err))
+		}
+	}
+	logger.Info("pipeline changed", "switch", sw.Name, "processes", len(configs), "added", len(added), "removed", len(removed))
+	return errors.Join(errs...)
+}
+
+// replacePipeline swaps in pipe once the frames in the current pipeline left it
+func (sw *Switch) replacePipeline(ctx context.Context, pipe *pipeline.Pipeline, configs []config.ControlProcessConfig, counters []*procCounters) error {
+	defer sw.pipeMutex.Unlock()
+	sw.pipeMutex.Lock()
+	err := sw.inflight.wait(ctx)
+	if err != nil {
+		return fmt.Errorf("pipeline did not drain: %w", err)
+	}
+	if sw.running {
+		sw.controlPipe.Stop()
+		go pipe.Start()
+	}
+	sw.controlPipe = pipe
+	sw.mutex.Lock()
+	sw.procConfigs = configs
+	sw.procCounters = counters
+	sw.mutex.Unlock()
+	return nil
+}
+
+func (sw *Switch) currentProcs() []config.ControlProcessConfig {
+	defer sw.mutex.RUnlock()
+	sw.mutex.RLock()
+	return append([]config.ControlProcessConfig{}, sw.procConfigs...)
+}
+
+func procIndex(procs []config.ControlProcessConfig, layer int, name string) int {
+	return slices.IndexFunc(procs, func(procConfig config.ControlProcessConfig) bool {
+		return procConfig.Layer == layer && procConfig.Name == name
+	})
+}
+
+// InsertProc adds a registered process to the pipeline at pos (0 is the first
+// process, len(Procs()) appends it)
+func (sw *Switch) InsertProc(ctx context.Context, pos int, procConfig config.ControlProcessConfig) error {
+	procs := sw.currentProcs()
+	if pos < 0 || pos > len(procs) {
+		return fmt.Errorf("%w: %d of %d processes", ErrInvalidPosition, pos, len(procs))
+	}
+	return sw.SetProcs(ctx, slices.Insert(procs, pos, procConfig))
+}
+
+// RemoveProc removes a process from the pipeline
+func (sw *Switch) RemoveProc(ctx context.Context, layer int, name string) error {
+	procs := sw.currentProcs()
+	i := procIndex(procs, layer, name)
+	if i < 0 {
+		return fmt.Errorf("%w: %s", ErrNoProc, procKey(layer, name))
+	}
+	return sw.SetProcs(ctx, slices.Delete(procs, i, i+1))
+}
+
+// SwapProc replaces a process of the pipeline with another one at the same
+// position, for example L2:Hub with L2:L2Switch. swapping a process with
+// itself reloads it with the new config file, like Reload does
+func (sw *Switch) SwapProc(ctx context.Context, layer int, name string, procConfig config.ControlProcessConfig) error {
+	procs := sw.currentProcs()
+	i := procIndex(procs, layer, name)
+	if i < 0 {
+		return fmt.Errorf("%w: %s", ErrNoProc, procKey(layer, name))
+	}
+	if procConfig.Layer == layer && procConfig.Name == name {
+		defer sw.reloadMutex.Unlock()
+		sw.reloadMutex.Lock()
+		old := sw.currentProcs()
+		i = procIndex(old, layer, name)
+		if i < 0 {
+			return fmt.Errorf("%w: %s", ErrNoProc, procKey(layer, name))
+		}
+		return sw.reloadProcConfig(procConfig, old[i].ConfigFile)
+	}
+	procs[i] = procConfig
+	return sw.SetProcs(ctx, procs)
+}
@@ -0,0 +1,169 @@
+package controlplane
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"sort"
+
+	"github.com/m-motawea/gSwitch/config"
+)
+
+var ErrRestartRequired = errors.New("change needs a restart")
+
+/*
+Reload applies a new config to the running switch without rebuilding it:
+
+- ports missing from the new config are removed and new ones added
+- ports with a changed backend are re-created
+- vlan membership, port security and Up changes are applied to the running port
+- the pipeline is replaced if processes were added, removed or reordered
+- every process that stays re-reads its config file. tables are kept
+
+a process that can not reload its config file returns ErrRestartRequired when
+the file changes. everything else is still applied.
+*/
+func (sw *Switch) Reload(cfg config.Config) error {
+	defer sw.reloadMutex.Unlock()
+	sw.reloadMutex.Lock()
+	logger.Info("reloading config", "switch", sw.Name)
+	errs := []error{}
+
+	sw.mutex.RLock()
+	current := map[string]config.SwitchPortConfig{}
+	for name, portCfg := range sw.portConfigs {
+		current[name] = portCfg
+	}
+	sw.mutex.RUnlock()
+
+	for name := range current {
+		_, ok := cfg.SwitchPorts[name]
+		if !ok {
+			logger.Info("removing port", "switch", sw.Name, "port", name)
+			sw.DelSwitchPort(name)
+		}
+	}
+	names := []string{}
+	for name := range cfg.SwitchPorts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		err := sw.reloadPort(name, current, cfg.SwitchPorts[name])
+		if err != nil {
+			errs = append(errs, fmt.Errorf("port %s: %w", name, err))
+		}
+	}
+
+	err := sw.reloadProcs(cfg.ControlProcess)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	err = errors.Join(errs...)
+	if err != nil {
+		logger.Warn("config reloaded with errors", "switch", sw.Name, "error", err)
+		return err
+	}
+	logger.Info("config reloaded", "switch", sw.Name)
+	return nil
+}
+
+func (sw *Switch) reloadPort(name string, current map[string]config.SwitchPortConfig, portCfg config.SwitchPortConfig) error {
+	old, ok := current[name]
+	if !ok {
+		_, err := sw.AddSwitchPort(name, portCfg)
+		return err
+	}
+	if old.Backend != portCfg.Backend || old.Tap != portCfg.Tap || old.Pcap != portCfg.Pcap {
+		logger.Info("port backend changed. re-creating port", "switch", sw.Name, "port", name)
+		sw.DelSwitchPort(name)
+		_, err := sw.AddSwitchPort(name, portCfg)
+		return err
+	}
+	if old.Trunk != portCfg.Trunk || !slices.Equal(old.AllowedVLANs, portCfg.AllowedVLANs) {
+		err := sw.SetPortVLANs(name, portCfg.Trunk, portCfg.AllowedVLANs...)
+		if err != nil {
+			return err
+		}
+	}
+	if !reflect.DeepEqual(old.Security, portCfg.Security) {
+		err := sw.SetPortSecurity(name, portCfg.Security)
+		if err != nil {
+			return err
+		}
+	}
+	if old.Up != portCfg.Up {
+		var err error
+		if portCfg.Up {
+			err = sw.UpPort(name)
+		} else {
+			err = sw.DownPort(name)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	sw.mutex.Lock()
+	sw.portConfigs[name] = portCfg
+	sw.mutex.Unlock()
+	return nil
+}
+
+func (sw *Switch) reloadProcs(procs []config.ControlProcessConfig) error {
+	errs := []error{}
+	current := sw.currentProcs()
+	sameOrder := slices.EqualFunc(current, procs, func(a, b config.ControlProcessConfig) bool {
+		return a.Layer == b.Layer && a.Name == b.Name
+	})
+	if !sameOrder {
+		logger.Info("control processes changed. replacing the pipeline", "switch", sw.Name)
+		ctx, cancel := context.WithTimeout(context.Background(), DRAIN_TIMEOUT)
+		err := sw.SetProcs(ctx, procs)
+		cancel()
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	running := sw.currentProcs()
+	for _, procConfig := range procs {
+		i := procIndex(current, procConfig.Layer, procConfig.Name)
+		if i < 0 || procIndex(running, procConfig.Layer, procConfig.Name) < 0 {
+			// new processes read their config file in Init
+			continue
+		}
+		err := sw.reloadProcConfig(procConfig, current[i].ConfigFile)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// reloadProcConfig makes a process of the pipeline re-read its config file,
+// now procConfig.ConfigFile. a process without a Reload func can only keep
+// its old file
+func (sw *Switch) reloadProcConfig(procConfig config.ControlProcessConfig, oldFile string) error {
+	pair := ControlProcs[procConfig.Layer][procConfig.Name]
+	if pair.Reload == nil {
+		if procConfig.ConfigFile != oldFile {
+			return fmt.Errorf("%w: L%d:%s can not reload its config file", ErrRestartRequired, procConfig.Layer, procConfig.Name)
+		}
+		return nil
+	}
+	logger.Info("reloading process config", "layer", procConfig.Layer, "process", procConfig.Name, "path", procConfig.ConfigFile)
+	err := pair.Reload(sw, procConfig.ConfigFile)
+	if err != nil {
+		return fmt.Errorf("L%d:%s: %w", procConfig.Layer, procConfig.Name, err)
+	}
+	sw.Stor.GetStor(procConfig.Layer, procConfig.Name).setConfigFile(procConfig.ConfigFile)
+	sw.mutex.Lock()
+	j := procIndex(sw.procConfigs, procConfig.Layer, procConfig.Name)
+	if j >= 0 {
+		sw.procConfigs[j] = procConfig
+	}
+	sw.mutex.Unlock()
+	return nil
+}
@@ -0,0 +1,169 @@
+package controlplane
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/m-motawea/gSwitch/config"
+	"github.com/m-motawea/pipeline"
+)
+
+// upper bounds in seconds of the pipeline latency histogram buckets
+var LatencyBuckets = []float64{0.00001, 0.00005, 0.0001, 0.0005, 0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5}
+
+type ProcGauge struct {
+	Name    string
+	Help    string
+	Labels  map[string]string
+	Value   float64
+	Counter bool // the value only grows. exported as a counter, name it *_total
+}
+
+type ProcDirectionStats struct {
+	Messages uint64
+	Dropped  uint64
+	Finished uint64
+	Seconds  float64 // total time spent in the process function
+}
+
+type ProcStats struct {
+	Layer int
+	Name  string
+	In    ProcDirectionStats
+	Out   ProcDirectionStats
+}
+
+type procDirectionCounters struct {
+	messages uint64
+	dropped  uint64
+	finished uint64
+	nanos    uint64
+}
+
+func (pc *procDirectionCounters) snapshot() ProcDirectionStats {
+	return ProcDirectionStats{
+		Messages: atomic.LoadUint64(&pc.messages),
+		Dropped:  atomic.LoadUint64(&pc.dropped),
+		Finished: atomic.LoadUint64(&pc.finished),
+		Seconds:  float64(atomic.LoadUint64(&pc.nanos)) / float64(time.Second),
+	}
+}
+
+type procCounters struct {
+	layer int
+	name  string
+	in    procDirectionCounters
+	out   procDirectionCounters
+}
+
+type procFunc func(proc pipeline.PipelineProcess, msg pipeline.PipelineMessage) pipeline.PipelineMessage
+
+// instrument wraps a process function to count the messages it handles and
+// how many it drops or finishes
+func (pc *procDirectionCounters) instrument(f procFunc) procFunc {
+	if f == nil {
+		return nil
+	}
+	return func(proc pipeline.PipelineProcess, msg pipeline.PipelineMessage) pipeline.PipelineMessage {
+		start := time.Now()
+		res := f(proc, msg)
+		atomic.AddUint64(&pc.nanos, uint64(time.Since(start)))
+		atomic.AddUint64(&pc.messages, 1)
+		if res.Drop {
+			atomic.AddUint64(&pc.dropped, 1)
+		} else if res.Finished {
+			atomic.AddUint64(&pc.finished, 1)
+		}
+		return res
+	}
+}
+
+type LatencyStats struct {
+	Count   uint64
+	Sum     float64
+	Buckets map[float64]uint64 // cumulative count of messages at or below each bound
+}
+
+type latencyHistogram struct {
+	count   uint64
+	sum     float64
+	buckets []uint64
+	mutex   *sync.Mutex
+}
+
+func newLatencyHistogram() *latencyHistogram {
+	return &latencyHistogram{
+		buckets: make([]uint64, len(LatencyBuckets)),
+		mutex:   &sync.Mutex{},
+	}
+}
+
+func (h *latencyHistogram) observe(d time.Duration) {
+	seconds := d.Seconds()
+	defer h.mutex.Unlock()
+	h.mutex.Lock()
+	h.count++
+	h.sum += seconds
+	for i, bound := range LatencyBuckets {
+		if seconds <= bound {
+			h.buckets[i]++
+		}
+	}
+}
+
+func (h *latencyHistogram) snapshot() LatencyStats {
+	defer h.mutex.Unlock()
+	h.mutex.Lock()
+	stats := LatencyStats{
+		Count:   h.count,
+		Sum:     h.sum,
+		Buckets: map[float64]uint64{},
+	}
+	for i, bound := range LatencyBuckets {
+		stats.Buckets[bound] = h.buckets[i]
+	}
+	return stats
+}
+
+// PipelineLatency is the time between a frame entering the pipeline and the
+// pipeline handing it back to be sent out. dropped messages are not included.
+func (sw *Switch) PipelineLatency() LatencyStats {
+	return sw.latency.snapshot()
+}
+
+func (sw *Switch) ProcStats() []ProcStats {
+	sw.mutex.RLock()
+	counters := append([]*procCounters{}, sw.procCounters...)
+	sw.mutex.RUnlock()
+	stats := []ProcStats{}
+	for _, pc := range counters {
+		stats = append(stats, pc.stats())
+	}
+	return stats
+}
+
+func (pc *procCounters) stats() ProcStats {
+	return ProcStats{
+		Layer: pc.layer,
+		Name:  pc.name,
+		In:    pc.in.snapshot(),
+		Out:   pc.out.snapshot(),
+	}
+}
+
+// ProcGauges collects the gauges of every process in the pipeline that reports any
+func (sw *Switch) ProcGauges() []ProcGauge {
+	gauges := []ProcGauge{}
+	sw.mutex.RLock()
+	procs := append([]config.ControlProcessConfig{}, sw.procConfigs...)
+	sw.mutex.RUnlock()
+	for _, procConfig := range procs {
+		pair := ControlProcs[procConfig.Layer][procConfig.Name]
+		if pair.Gauges == nil {
+			continue
+		}
+		gauges = append(gauges, pair.Gauges(sw)...)
+	}
+	return gauges
+}
@@ -0,0 +1,265 @@
+package controlplane
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+/*
+ProcStor is the state of a process in a switch. the pipeline, the goroutines
+of the process and the management api use it at the same time so every
+method is safe for concurrent use.
+
+values are read back with their type:
+
+	controlplane.Set(stor, "Table", table)
+	table, ok := controlplane.Get[*SwitchARPTable](stor, "Table")
+
+a value that is modified in place after it is stored (a map, a table) brings
+its own locking. Locked wraps one that has none.
+*/
+type ProcStor struct {
+	Layer      int
+	Name       string
+	mutex      *sync.RWMutex
+	values     map[string]interface{}
+	configFile string
+	config     interface{}
+	life       *procLife
+}
+
+// StorInfo describes the storage of a process for the management api
+type StorInfo struct {
+	Layer      int
+	Name       string
+	ConfigFile string
+	Config     interface{}
+	Values     map[string]string // key -> type of the value
+}
+
+func newProcStor(layer int, name string) *ProcStor {
+	return &ProcStor{
+		Layer:  layer,
+		Name:   name,
+		mutex:  &sync.RWMutex{},
+		values: map[string]interface{}{},
+	}
+}
+
+// ConfigFile returns the path of the config file of the process. empty if it has none
+func (ps *ProcStor) ConfigFile() string {
+	defer ps.mutex.RUnlock()
+	ps.mutex.RLock()
+	return ps.configFile
+}
+
+func (ps *ProcStor) setConfigFile(path string) {
+	ps.mutex.Lock()
+	ps.configFile = path
+	ps.mutex.Unlock()
+}
+
+// Config returns the parsed config file of the process. nil if none was loaded
+func (ps *ProcStor) Config() interface{} {
+	defer ps.mutex.RUnlock()
+	ps.mutex.RLock()
+	return ps.config
+}
+
+// SetConfig stores the parsed config file of the process. it is safe to call
+// while the switch is running.
+func (ps *ProcStor) SetConfig(value interface{}) {
+	ps.mutex.Lock()
+	ps.config = value
+	ps.mutex.Unlock()
+}
+
+// Value returns the value stored under key
+func (ps *ProcStor) Value(key string) (interface{}, bool) {
+	defer ps.mutex.RUnlock()
+	ps.mutex.RLock()
+	value, ok := ps.values[key]
+	return value, ok
+}
+
+// SetValue stores value under key. Set is the typed form
+func (ps *ProcStor) SetValue(key string, value interface{}) {
+	ps.mutex.Lock()
+	ps.values[key] = value
+	ps.mutex.Unlock()
+}
+
+func (ps *ProcStor) Delete(key string) {
+	ps.mutex.Lock()
+	delete(ps.values, key)
+	ps.mutex.Unlock()
+}
+
+func (ps *ProcStor) Info() StorInfo {
+	defer ps.mutex.RUnlock()
+	ps.mutex.RLock()
+	info := StorInfo{
+		Layer:      ps.Layer,
+		Name:       ps.Name,
+		ConfigFile: ps.configFile,
+		Config:     ps.config,
+		Values:     map[string]string{},
+	}
+	for key, value := range ps.values {
+		info.Values[key] = fmt.Sprintf("%T", value)
+	}
+	return info
+}
+
+// Get returns the value stored under key. ok is false when there is none or
+// it is not a T
+func Get[T any](ps *ProcStor, key string) (T, bool) {
+	value, ok := ps.Value(key)
+	if !ok {
+		var zero T
+		return zero, false
+	}
+	typed, ok := value.(T)
+	return typed, ok
+}
+
+// Set stores value under key
+func Set[T any](ps *ProcStor, key string, value T) {
+	ps.SetValue(key, value)
+}
+
+// GetConfig returns the parsed config file of the process. ok is false when
+// none was loaded or it is not a T
+func GetConfig[T any](ps *ProcStor) (T, bool) {
+	config, ok := ps.Config().(T)
+	return config, ok
+}
+
+// Locked guards a value shared by the pipeline and the goroutines of a process
+type Locked[T any] struct {
+	mutex *sync.RWMutex
+	value T
+}
+
+func NewLocked[T any](value T) *Locked[T] {
+	return &Locked[T]{mutex: &sync.RWMutex{}, value: value}
+}
+
+// Read calls f with the value under the read lock. f must not modify it
+func (l *Locked[T]) Read(f func(value T)) {
+	defer l.mutex.RUnlock()
+	l.mutex.RLock()
+	f(l.value)
+}
+
+// Write calls f with the value under the write lock
+func (l *Locked[T]) Write(f func(value *T)) {
+	defer l.mutex.Unlock()
+	l.mutex.Lock()
+	f(&l.value)
+}
+
+type procID struct {
+	layer int
+	name  string
+}
+
+// SwitchProcStor holds the storage of every process of a switch
+type SwitchProcStor struct {
+	mutex *sync.RWMutex
+	procs map[procID]*ProcStor
+}
+
+func newSwitchProcStor() *SwitchProcStor {
+	return &SwitchProcStor{mutex: &sync.RWMutex{}, procs: map[procID]*ProcStor{}}
+}
+
+// GetStor returns the storage of a process. it is created empty if the
+// process has none so it can be used before the process is in the pipeline
+func (swStor *SwitchProcStor) GetStor(layer int, name string) *ProcStor {
+	swStor.mutex.RLock()
+	ps, ok := swStor.procs[procID{layer, name}]
+	swStor.mutex.RUnlock()
+	if ok {
+		return ps
+	}
+	defer swStor.mutex.Unlock()
+	swStor.mutex.Lock()
+	ps, ok = swStor.procs[procID{layer, name}]
+	if !ok {
+		ps = newProcStor(layer, name)
+		swStor.procs[procID{layer, name}] = ps
+	}
+	return ps
+}
+
+// LookupStor returns the storage of a process without creating it
+func (swStor *SwitchProcStor) LookupStor(layer int, name string) (*ProcStor, bool) {
+	defer swStor.mutex.RUnlock()
+	swStor.mutex.RLock()
+	ps, ok := swStor.procs[procID{layer, name}]
+	return ps, ok
+}
+
+// Infos describes the storage of every process sorted by layer and name
+func (swStor *SwitchProcStor) Infos() []StorInfo {
+	swStor.mutex.RLock()
+	stors := make([]*ProcStor, 0, len(swStor.procs))
+	for _, ps := range swStor.procs {
+		stors = append(stors, ps)
+	}
+	swStor.mutex.RUnlock()
+	infos := []StorInfo{}
+	for _, ps := range stors {
+		infos = append(infos, ps.Info())
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		if infos[i].Layer != infos[j].Layer {
+			return infos[i].Layer < infos[j].Layer
+		}
+		return infos[i].Name < infos[j].Name
+	})
+	return infos
+}
+
+// resetStor replaces the storage of a process with an empty one for a new
+// run of the process
+func (swStor *SwitchProcStor) resetStor(layer int, name string, configFile string, life *procLife) *ProcStor {
+	ps := newProcStor(layer, name)
+	ps.configFile = configFile
+	ps.life = life
+	swStor.mutex.Lock()
+	swStor.procs[procID{layer, name}] = ps
+	swStor.mutex.Unlock()
+	return ps
+}
+
+func (swStor *SwitchProcStor) delStor(layer int, name string) {
+	swStor.mutex.Lock()
+	delete(swStor.procs, procID{layer, name})
+	swStor.mutex.Unlock()
+}
+
+// Go runs f in a goroutine of the process. ctx is cancelled when the process is
+// removed from the pipeline or the switch stops, and both wait for f to
+// return. processes start their background loops (table aging, ...) with it
+// from their Init.
+func (ps *ProcStor) Go(f func(ctx context.Context)) {
+	ps.mutex.RLock()
+	life := ps.life
+	ps.mutex.RUnlock()
+	if life == nil {
+		logger.Warn("process storage has no lifecycle. goroutine is never stopped", "layer", ps.Layer, "process", ps.Name)
+		go f(context.Background())
+		return
+	}
+	life.wg.Add(1)
+	life.loops.Add(1)
+	go func() {
+		defer life.loops.Done()
+		defer life.wg.Done()
+		f(life.ctx)
+	}()
+}
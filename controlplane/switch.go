@@ -1,139 +1,243 @@
 package controlplane
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"log"
 	"sync"
 	"time"
 
 	"github.com/m-motawea/gSwitch/config"
 	"github.com/m-motawea/gSwitch/dataplane"
+	"github.com/m-motawea/gSwitch/logging"
 	"github.com/m-motawea/pipeline"
 	"github.com/mdlayher/ethernet"
 )
 
-type ProcStor map[string]interface{} // Key to Val
-
-type LayerStor map[string]ProcStor // Proc Name to ProcStro
-
-type SwitchProcStor map[int]LayerStor // Layer Number to LayerStor
-
-func (swStor SwitchProcStor) getLayerStor(layer int) LayerStor {
-	ls, ok := swStor[layer]
-	if !ok {
-		ls = LayerStor{}
-		swStor[layer] = ls
-	}
-	return ls
-}
-
-func (ls LayerStor) getProcStor(name string) ProcStor {
-	ps, ok := ls[name]
-	if !ok {
-		ps = ProcStor{}
-		ls[name] = ps
-	}
-	return ps
-}
-
-func (swStor SwitchProcStor) GetStor(layer int, name string) ProcStor {
-	ls := swStor.getLayerStor(layer)
-	ps := ls.getProcStor(name)
-	return ps
-}
+var logger = logging.Logger("controlplane")
 
 type Switch struct {
 	Name           string
-	Ports          map[string]*dataplane.SwitchPort
-	Stor           SwitchProcStor
-	controlPipe    *pipeline.Pipeline
+	Ports          map[string]*dataplane.SwitchPort // replaced, never modified, when ports are added or removed. read it with PortMap
+	Stor           *SwitchProcStor
+	Events         *EventBus
+	controlPipe    *pipeline.Pipeline // replaced when processes are added or removed
+	pipeMutex      *sync.RWMutex      // held to send to controlPipe. locked to replace it
+	running        bool               // controlPipe is started
 	wg             *sync.WaitGroup
 	dataPlaneChan  chan dataplane.IncomingFrame
 	consumeChannel pipeline.PipelineChannel
-	closeChan      chan int
+	ctx            context.Context // cancelled when the switch stops
+	cancel         context.CancelFunc
+	loops          *sync.WaitGroup // goroutines of the processes
+	inflight       *msgCounter     // messages in the pipeline
+	stopIngress    context.CancelFunc
+	stopConsumer   context.CancelFunc
+	ingressDone    chan struct{}
+	consumerDone   chan struct{}
+	stopOnce       *sync.Once
+	mutex          *sync.RWMutex // guards portConfigs, procConfigs and replacing Ports
+	reloadMutex    *sync.Mutex
+	procsMutex     *sync.Mutex // serializes pipeline changes
+	portConfigs    map[string]config.SwitchPortConfig
+	procConfigs    []config.ControlProcessConfig
+	procCounters   []*procCounters
+	latency        *latencyHistogram
 }
 
-func NewSwitch(name string, cfg config.Config, wg *sync.WaitGroup) *Switch {
+// NewSwitch builds the control pipeline from cfg. it returns an error if a
+// process in cfg is not registered.
+func NewSwitch(name string, cfg config.Config, wg *sync.WaitGroup) (*Switch, error) {
 	sw := Switch{}
-	sw.initSwitch(name, cfg, wg)
-	return &sw
+	err := sw.initSwitch(name, cfg, wg)
+	if err != nil {
+		sw.cancel()
+		return nil, err
+	}
+	return &sw, nil
 }
 
-func (sw *Switch) initSwitch(name string, cfg config.Config, wg *sync.WaitGroup) {
-	log.Printf("intializing switch: %s", sw.Name)
+func (sw *Switch) initSwitch(name string, cfg config.Config, wg *sync.WaitGroup) error {
+	logger.Info("initializing switch", "switch", name)
 	sw.Name = name
 	sw.wg = wg
-	sw.Stor = SwitchProcStor{}
+	sw.Stor = newSwitchProcStor()
+	sw.Events = NewEventBus()
 	sw.Ports = map[string]*dataplane.SwitchPort{}
+	sw.mutex = &sync.RWMutex{}
+	sw.reloadMutex = &sync.Mutex{}
+	sw.procsMutex = &sync.Mutex{}
+	sw.pipeMutex = &sync.RWMutex{}
+	sw.portConfigs = map[string]config.SwitchPortConfig{}
 	sw.dataPlaneChan = make(chan dataplane.IncomingFrame)
 	sw.consumeChannel = make(pipeline.PipelineChannel)
+	sw.latency = newLatencyHistogram()
+	sw.ctx, sw.cancel = context.WithCancel(context.Background())
+	sw.loops = &sync.WaitGroup{}
+	sw.inflight = newMsgCounter()
+	sw.stopOnce = &sync.Once{}
 	pipe, _ := pipeline.NewPipeline("ControlPlanePipeline", true, sw.wg, sw.consumeChannel)
 	sw.controlPipe = &pipe
 	// add pipeline processes
+	err := validateProcs(cfg.ControlProcess)
+	if err != nil {
+		logger.Error("invalid control processes", "error", err)
+		return err
+	}
 	for _, procConfig := range cfg.ControlProcess {
-		// get the pair
-		pair, ok := ControlProcs[procConfig.Layer][procConfig.Name]
-		if !ok {
-			log.Fatalf("No process in layer %d named %s", procConfig.Layer, procConfig.Name)
-		}
-		// create pipeline process
-		procName := fmt.Sprintf("L%d:%s", procConfig.Layer, procConfig.Name)
-		proc, err := pipeline.NewPipelineProcess(procName, pair.InFunc, pair.OutFunc)
+		counters := &procCounters{layer: procConfig.Layer, name: procConfig.Name}
+		proc, err := sw.newPipelineProc(procConfig, counters)
 		if err != nil {
-			log.Fatalf("Failed to create process %s due to error %v", procName, err)
+			return err
 		}
 		// add the process to the contolplane pipline
-		sw.controlPipe.AddProcess(&proc)
-		if pair.Init != nil {
-			stor := sw.Stor.GetStor(procConfig.Layer, procConfig.Name)
-			stor["ConfigFile"] = procConfig.ConfigFile
-			pair.Init(sw)
+		sw.controlPipe.AddProcess(proc)
+		sw.procConfigs = append(sw.procConfigs, procConfig)
+		sw.procCounters = append(sw.procCounters, counters)
+		sw.initProc(procConfig)
+	}
+	return nil
+}
+
+// trackDrops marks a message dropped by a process as done so Stop does not
+// wait for it to reach the consumer loop
+func (sw *Switch) trackDrops(f procFunc) procFunc {
+	if f == nil {
+		return nil
+	}
+	return func(proc pipeline.PipelineProcess, msg pipeline.PipelineMessage) pipeline.PipelineMessage {
+		res := f(proc, msg)
+		if res.Drop {
+			sw.inflight.done()
 		}
+		return res
 	}
 }
 
 func (sw *Switch) AddSwitchPort(name string, swCfg config.SwitchPortConfig) (*dataplane.SwitchPort, error) {
-	log.Printf("Switch %s: adding port %s", sw.Name, name)
-	swPort, err := dataplane.NewSwitchPort(
+	logger.Info("adding port", "switch", sw.Name, "port", name)
+	err := sw.checkNewPort(name)
+	if err != nil {
+		return nil, err
+	}
+	backend, err := dataplane.NewBackend(name, swCfg)
+	if err != nil {
+		logger.Error("failed to create port backend", "switch", sw.Name, "port", name, "error", err)
+		return nil, err
+	}
+	return sw.AddSwitchPortWithBackend(name, swCfg, backend)
+}
+
+func (sw *Switch) checkNewPort(name string) error {
+	if _, ok := sw.PortMap()[name]; ok {
+		logger.Error("failed to add port", "switch", sw.Name, "port", name, "error", ErrPortExists)
+		return fmt.Errorf("%w: %s", ErrPortExists, name)
+	}
+	return nil
+}
+
+// AddSwitchPortWithBackend adds a port named name using backend. a port
+// that is configured up but fails to come up is added down and the error is
+// returned, so it can be brought up later
+func (sw *Switch) AddSwitchPortWithBackend(name string, swCfg config.SwitchPortConfig, backend dataplane.Iface) (*dataplane.SwitchPort, error) {
+	err := sw.checkNewPort(name)
+	if err != nil {
+		return nil, err
+	}
+	security, err := dataplane.NewPortSecurity(swCfg.Security)
+	if err != nil {
+		logger.Error("failed to add port", "switch", sw.Name, "port", name, "error", err)
+		return nil, err
+	}
+	swPort, err := dataplane.NewSwitchPortWithBackend(
 		name,
+		backend,
 		swCfg.Trunk,
 		swCfg.AllowedVLANs...,
 	)
 	if err != nil {
-		log.Printf("Switch %s: failed to add port %s due to erro %v", sw.Name, name, err)
+		logger.Error("failed to add port", "switch", sw.Name, "port", name, "error", err)
 		return &swPort, err
 	}
+	swPort.SetSecurity(security)
+	var upErr error
 	if swCfg.Up {
-		swPort.Up(sw.dataPlaneChan)
+		upErr = swPort.Up(sw.dataPlaneChan)
+	}
+	sw.mutex.Lock()
+	if _, ok := sw.Ports[name]; ok {
+		// added by someone else while this one was coming up
+		sw.mutex.Unlock()
+		swPort.Down()
+		logger.Error("failed to add port", "switch", sw.Name, "port", name, "error", ErrPortExists)
+		return nil, fmt.Errorf("%w: %s", ErrPortExists, name)
+	}
+	ports := sw.copyPorts()
+	ports[name] = &swPort
+	sw.Ports = ports
+	sw.portConfigs[name] = swCfg
+	sw.mutex.Unlock()
+	if upErr != nil {
+		logger.Error("port added down", "switch", sw.Name, "port", name, "error", upErr)
+		return &swPort, fmt.Errorf("port %s added down: %w", name, upErr)
+	}
+	if swCfg.Up {
+		// subscribers find the port in Ports
+		sw.Events.Publish(Event{Type: EventPortUp, Port: name})
 	}
-	sw.Ports[name] = &swPort
 	return &swPort, nil
 }
 
+// PortMap returns the ports. the map is replaced on every change, never
+// modified, so it can be used without the lock. it must not be modified
+func (sw *Switch) PortMap() map[string]*dataplane.SwitchPort {
+	defer sw.mutex.RUnlock()
+	sw.mutex.RLock()
+	return sw.Ports
+}
+
+// copyPorts returns a copy of the port map. readers use the map returned by
+// PortMap without locking so the map is replaced instead of modified.
+func (sw *Switch) copyPorts() map[string]*dataplane.SwitchPort {
+	ports := map[string]*dataplane.SwitchPort{}
+	for name, port := range sw.Ports {
+		ports[name] = port
+	}
+	return ports
+}
+
 func (sw *Switch) DelSwitchPort(name string) {
+	sw.mutex.Lock()
 	port, ok := sw.Ports[name]
 	if !ok {
-		log.Printf("No port named %s in switch %s!", name, sw.Name)
+		sw.mutex.Unlock()
+		logger.Warn("no port with this name", "switch", sw.Name, "port", name)
 		return
 	}
-	if port.Status {
+	ports := sw.copyPorts()
+	delete(ports, name)
+	sw.Ports = ports
+	delete(sw.portConfigs, name)
+	sw.mutex.Unlock()
+	if port.IsUp() {
 		port.Down()
+		sw.Events.Publish(Event{Type: EventPortDown, Port: name})
 	}
-	delete(sw.Ports, name)
 }
 
-func (sw *Switch) SwitchLoop() {
-	go sw.ConsumerLoop()
+// SwitchLoop sends the frames received on the ports to the pipeline until ctx is done
+func (sw *Switch) SwitchLoop(ctx context.Context) {
 	for {
 		select {
-		case <-sw.closeChan:
-			log.Println("Control Plane: stopping SwitchLoop..")
+		case <-ctx.Done():
+			logger.Info("stopping switch loop", "switch", sw.Name)
 			return
 		case inFrame := <-sw.dataPlaneChan:
 			// incoming frames from ports
-			log.Println("Control Plane: received dataplane message. sending to pipline...")
+			logger.Debug("received frame from dataplane. sending to pipeline", "port", inFrame.IN_PORT.Name)
 			ctrlMsg := ControlMessage{
 				InFrame:      &inFrame,
+				Received:     time.Now(),
 				OutPorts:     []*dataplane.SwitchPort{},
 				ParentSwitch: sw,
 				LayerPayload: []byte{},
@@ -142,71 +246,306 @@ func (sw *Switch) SwitchLoop() {
 				Direction: pipeline.PipelineInDirection{},
 				Content:   ctrlMsg,
 			}
+			sw.pipeMutex.RLock()
+			sw.inflight.add()
 			sw.controlPipe.SendMessage(pipeMsg)
-			log.Println("Control Plane: message sent to pipeline")
-			continue
+			sw.pipeMutex.RUnlock()
 		}
 	}
 }
 
-func (sw *Switch) ConsumerLoop() {
+// ConsumerLoop sends the frames that leave the pipeline out of their ports until ctx is done
+func (sw *Switch) ConsumerLoop(ctx context.Context) {
 	for {
 		select {
-		case <-sw.closeChan:
-			log.Println("Control Plane: stopping ConsumerLoop..")
+		case <-ctx.Done():
+			logger.Info("stopping consumer loop", "switch", sw.Name)
 			return
 		case pipeMsg := <-sw.consumeChannel:
-			// processed msg from pipeline
-			log.Println("Control Plane: received pipeline message. sending out to dataplane...")
-			ctrlMsg, ok := pipeMsg.Content.(ControlMessage)
-			if !ok {
-				log.Fatal("Switch Loop Received Incompatible Message!")
-			}
-			for _, port := range ctrlMsg.OutPorts {
-				log.Printf("Control Plane: sending msg to port %s...", port.Name)
-				port.Out(ctrlMsg.InFrame.FRAME)
-				log.Printf("Control Plane: msg send to port %s.", port.Name)
-			}
-			log.Println("Control Plane: message sent to dataplane")
+			sw.consume(pipeMsg)
 		}
 	}
 }
 
+func (sw *Switch) consume(pipeMsg pipeline.PipelineMessage) {
+	defer sw.inflight.done()
+	// processed msg from pipeline
+	ctrlMsg, ok := pipeMsg.Content.(ControlMessage)
+	if !ok {
+		logger.Error("consumer loop received incompatible message", "content", pipeMsg.Content)
+		return
+	}
+	if !ctrlMsg.Received.IsZero() {
+		sw.latency.observe(time.Since(ctrlMsg.Received))
+	}
+	for _, port := range ctrlMsg.OutPorts {
+		logger.Debug("sending frame out of port", "port", port.Name)
+		port.Out(ctrlMsg.InFrame.FRAME)
+	}
+}
+
 func (sw *Switch) Start() {
+	sw.pipeMutex.Lock()
 	go sw.controlPipe.Start()
-	time.Sleep(5 * time.Second)
-	go sw.SwitchLoop()
+	sw.running = true
+	sw.pipeMutex.Unlock()
+	var ingress, consumer context.Context
+	ingress, sw.stopIngress = context.WithCancel(sw.ctx)
+	consumer, sw.stopConsumer = context.WithCancel(sw.ctx)
+	sw.ingressDone = make(chan struct{})
+	sw.consumerDone = make(chan struct{})
+	go func() {
+		defer close(sw.consumerDone)
+		sw.ConsumerLoop(consumer)
+	}()
+	go func() {
+		defer close(sw.ingressDone)
+		sw.SwitchLoop(ingress)
+	}()
 }
 
-func (sw *Switch) Stop() {
-	for _, port := range sw.Ports {
-		port.Down()
+/*
+Stop shuts the switch down in order:
+
+- frames received on the ports are no longer sent to the pipeline
+- the frames already in the pipeline are sent out of their ports
+- the ports are brought down once their queues are written
+- the goroutines of the processes are stopped
+
+it returns when everything stopped, or with the error of ctx if it is done
+first. calling it again does nothing.
+*/
+func (sw *Switch) Stop(ctx context.Context) error {
+	var err error
+	sw.stopOnce.Do(func() {
+		err = sw.stop(ctx)
+	})
+	return err
+}
+
+func (sw *Switch) stop(ctx context.Context) error {
+	logger.Info("stopping switch", "switch", sw.Name)
+	errs := []error{}
+	if sw.stopIngress != nil {
+		sw.stopIngress()
+		<-sw.ingressDone
+		err := sw.inflight.wait(ctx)
+		if err != nil {
+			logger.Warn("frames left in the pipeline", "switch", sw.Name, "error", err)
+			errs = append(errs, err)
+		}
+		sw.stopConsumer()
+		<-sw.consumerDone
+		sw.pipeMutex.Lock()
+		sw.controlPipe.Stop()
+		sw.running = false
+		sw.pipeMutex.Unlock()
+	}
+
+	for name, port := range sw.PortMap() {
+		if !port.IsUp() {
+			continue
+		}
+		err := port.Down()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("port %s: %w", name, err))
+			continue
+		}
+		sw.Events.Publish(Event{Type: EventPortDown, Port: name})
 	}
-	sw.closeChan <- 1
-	sw.controlPipe.Stop()
+
+	sw.cancel()
+	err := wait(ctx, sw.loops)
+	if err != nil {
+		logger.Warn("process goroutines still running", "switch", sw.Name, "error", err)
+		errs = append(errs, err)
+	}
+	err = errors.Join(errs...)
+	if err == nil {
+		logger.Info("switch stopped", "switch", sw.Name)
+	}
+	return err
 }
 
-func (sw *Switch) UpPort(name string) {
-	port, ok := sw.Ports[name]
+// msgCounter counts the messages in the pipeline so it can be drained before
+// it is stopped or replaced
+type msgCounter struct {
+	mutex *sync.Mutex
+	count int
+	idle  chan struct{} // closed while count is 0
+}
+
+func newMsgCounter() *msgCounter {
+	idle := make(chan struct{})
+	close(idle)
+	return &msgCounter{mutex: &sync.Mutex{}, idle: idle}
+}
+
+func (c *msgCounter) add() {
+	defer c.mutex.Unlock()
+	c.mutex.Lock()
+	if c.count == 0 {
+		c.idle = make(chan struct{})
+	}
+	c.count++
+}
+
+func (c *msgCounter) done() {
+	defer c.mutex.Unlock()
+	c.mutex.Lock()
+	c.count--
+	if c.count == 0 {
+		close(c.idle)
+	}
+}
+
+// wait waits until there are no messages or returns the error of ctx if it is done first
+func (c *msgCounter) wait(ctx context.Context) error {
+	c.mutex.Lock()
+	idle := c.idle
+	c.mutex.Unlock()
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// wait waits for wg or returns the error of ctx if it is done first
+func wait(ctx context.Context, wg *sync.WaitGroup) error {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (sw *Switch) UpPort(name string) error {
+	port, err := sw.getPort(name)
+	if err != nil {
+		logger.Warn("no port with this name", "switch", sw.Name, "port", name)
+		return err
+	}
+	if port.IsUp() {
+		return nil
+	}
+	err = port.Up(sw.dataPlaneChan)
+	if err != nil {
+		return err
+	}
+	sw.Events.Publish(Event{Type: EventPortUp, Port: name})
+	return nil
+}
+
+func (sw *Switch) DownPort(name string) error {
+	port, err := sw.getPort(name)
+	if err != nil {
+		logger.Warn("no port with this name", "switch", sw.Name, "port", name)
+		return err
+	}
+	if !port.IsUp() {
+		// an err-disabled port stays down instead of recovering
+		return port.Down()
+	}
+	err = port.Down()
+	if err != nil {
+		return err
+	}
+	sw.Events.Publish(Event{Type: EventPortDown, Port: name})
+	return nil
+}
+
+// ErrDisablePort brings a port down because of an error. it is brought back
+// up after recovery unless it is 0 or the port is brought up or down before.
+// processes call it from a goroutine since the pipeline waits for the port
+// to go down.
+func (sw *Switch) ErrDisablePort(name string, reason string, recovery time.Duration) error {
+	port, err := sw.getPort(name)
+	if err != nil {
+		return err
+	}
+	info, ok, err := port.ErrDisable(reason)
 	if !ok {
-		log.Printf("No port named %s in switch %s!", name, sw.Name)
+		return nil
+	}
+	sw.Events.Publish(Event{Type: EventPortDown, Port: name, Reason: reason})
+	if err != nil {
+		return err
+	}
+	if recovery > 0 {
+		logger.Info("port recovers after", "switch", sw.Name, "port", name, "recovery", recovery)
+		time.AfterFunc(recovery, func() {
+			sw.recoverPort(port, info.Since)
+		})
+	}
+	return nil
+}
+
+func (sw *Switch) recoverPort(port *dataplane.SwitchPort, since time.Time) {
+	if sw.ctx.Err() != nil {
+		return
+	}
+	current := sw.PortMap()[port.Name]
+	if current != port {
+		// removed or re-created
 		return
 	}
-	if port.Status {
+	ok, err := port.Recover(since, sw.dataPlaneChan)
+	if err != nil {
+		logger.Error("failed to recover port", "switch", sw.Name, "port", port.Name, "error", err)
 		return
 	}
-	port.Up(sw.dataPlaneChan)
+	if ok {
+		sw.Events.Publish(Event{Type: EventPortUp, Port: port.Name})
+	}
 }
 
-func (sw *Switch) DownPort(name string) {
-	port, ok := sw.Ports[name]
-	if !ok {
-		log.Printf("No port named %s in switch %s!", name, sw.Name)
-		return
+func (sw *Switch) PortStats(name string) (dataplane.PortStats, error) {
+	port, err := sw.getPort(name)
+	if err != nil {
+		return dataplane.PortStats{}, err
 	}
-	if port.Status {
-		port.Down()
+	return port.Counters.Snapshot(), nil
+}
+
+func (sw *Switch) AllPortStats() map[string]dataplane.PortStats {
+	stats := map[string]dataplane.PortStats{}
+	for name, port := range sw.PortMap() {
+		stats[name] = port.Counters.Snapshot()
+	}
+	return stats
+}
+
+func (sw *Switch) ClearPortStats(name string) error {
+	port, err := sw.getPort(name)
+	if err != nil {
+		return err
+	}
+	port.Counters.Clear()
+	return nil
+}
+
+func (sw *Switch) StartCapture(name string, path string, filter string) error {
+	port, err := sw.getPort(name)
+	if err != nil {
+		return err
+	}
+	return port.StartCapture(path, filter)
+}
+
+func (sw *Switch) StopCapture(name string) (*dataplane.Capture, error) {
+	port, err := sw.getPort(name)
+	if err != nil {
+		return nil, err
 	}
+	return port.StopCapture()
 }
 
 func (sw *Switch) SendFrame(frame *ethernet.Frame, OutPorts ...*dataplane.SwitchPort) {
@@ -214,8 +553,7 @@ func (sw *Switch) SendFrame(frame *ethernet.Frame, OutPorts ...*dataplane.Switch
 		return
 	}
 	for _, port := range OutPorts {
-		log.Printf("Switch: Async Frame output to port %s...", port.Name)
+		logger.Debug("sending async frame out of port", "port", port.Name)
 		port.Out(frame)
-		log.Printf("Switch: Async Frame output to port %s.", port.Name)
 	}
 }
@@ -0,0 +1,178 @@
+package dataplane
+
+import (
+	"encoding/binary"
+	"net"
+	"os"
+	"syscall"
+	"unsafe"
+
+	"github.com/m-motawea/gSwitch/config"
+	"golang.org/x/sys/unix"
+)
+
+const ETH_P_ALL = 0x0003
+const ETH_HEADER_SIZE = 14
+const VLAN_TAG_SIZE = 4
+
+func init() {
+	RegisterBackend("afpacket", NewAFPacketBackend)
+}
+
+type PacketAddr struct {
+	HardwareAddr net.HardwareAddr
+}
+
+func (a *PacketAddr) Network() string {
+	return "packet"
+}
+
+func (a *PacketAddr) String() string {
+	return a.HardwareAddr.String()
+}
+
+type AFPacketBackend struct {
+	IFI  *net.Interface
+	file *os.File
+	conn syscall.RawConn
+	oob  []byte
+}
+
+func NewAFPacketBackend(ifname string, cfg config.SwitchPortConfig) (Iface, error) {
+	ifi, err := net.InterfaceByName(ifname)
+	if err != nil {
+		logger.Error("failed to get interface", "port", ifname, "error", err)
+		return nil, err
+	}
+	return &AFPacketBackend{IFI: ifi}, nil
+}
+
+func htons(i uint16) uint16 {
+	return (i<<8)&0xff00 | i>>8
+}
+
+func (b *AFPacketBackend) Open() error {
+	fd, err := unix.Socket(unix.AF_PACKET, unix.SOCK_RAW|unix.SOCK_NONBLOCK|unix.SOCK_CLOEXEC, int(htons(ETH_P_ALL)))
+	if err != nil {
+		logger.Error("failed to open packet socket", "port", b.IFI.Name, "error", err)
+		return err
+	}
+	addr := unix.SockaddrLinklayer{
+		Protocol: htons(ETH_P_ALL),
+		Ifindex:  b.IFI.Index,
+	}
+	err = unix.Bind(fd, &addr)
+	if err != nil {
+		logger.Error("failed to bind packet socket", "port", b.IFI.Name, "error", err)
+		unix.Close(fd)
+		return err
+	}
+	// the kernel strips 802.1Q tags before frames reach the socket.
+	// PACKET_AUXDATA hands the stripped tag back with every frame so trunk ports can rebuild it.
+	err = unix.SetsockoptInt(fd, unix.SOL_PACKET, unix.PACKET_AUXDATA, 1)
+	if err != nil {
+		logger.Error("failed to enable PACKET_AUXDATA", "port", b.IFI.Name, "error", err)
+		unix.Close(fd)
+		return err
+	}
+	b.file = os.NewFile(uintptr(fd), b.IFI.Name)
+	b.conn, err = b.file.SyscallConn()
+	if err != nil {
+		b.file.Close()
+		return err
+	}
+	b.oob = make([]byte, unix.CmsgSpace(int(unsafe.Sizeof(unix.TpacketAuxdata{}))))
+	return nil
+}
+
+func (b *AFPacketBackend) ReadFrame(buf []byte) (int, net.Addr, error) {
+	var n, oobn int
+	var from unix.Sockaddr
+	var recvErr error
+	for {
+		err := b.conn.Read(func(fd uintptr) bool {
+			// leave room to put back a stripped vlan tag
+			n, oobn, _, from, recvErr = unix.Recvmsg(int(fd), buf[:len(buf)-VLAN_TAG_SIZE], b.oob, 0)
+			return recvErr != unix.EAGAIN
+		})
+		if err != nil {
+			return 0, nil, err
+		}
+		if recvErr != nil {
+			return 0, nil, recvErr
+		}
+		sa, ok := from.(*unix.SockaddrLinklayer)
+		if ok && sa.Pkttype == unix.PACKET_OUTGOING {
+			// frames transmitted on this interface by someone else
+			continue
+		}
+		addr := &PacketAddr{}
+		if ok {
+			addr.HardwareAddr = net.HardwareAddr(sa.Addr[:sa.Halen])
+		}
+		n = b.restoreVLANTag(buf, n, b.oob[:oobn])
+		return n, addr, nil
+	}
+}
+
+func (b *AFPacketBackend) restoreVLANTag(buf []byte, n int, oob []byte) int {
+	msgs, err := unix.ParseSocketControlMessage(oob)
+	if err != nil {
+		logger.Debug("failed to parse socket control messages", "port", b.IFI.Name, "error", err)
+		return n
+	}
+	for _, msg := range msgs {
+		if msg.Header.Level != unix.SOL_PACKET || msg.Header.Type != unix.PACKET_AUXDATA {
+			continue
+		}
+		if len(msg.Data) < int(unsafe.Sizeof(unix.TpacketAuxdata{})) {
+			continue
+		}
+		aux := (*unix.TpacketAuxdata)(unsafe.Pointer(&msg.Data[0]))
+		if aux.Status&unix.TP_STATUS_VLAN_VALID == 0 && aux.Vlan_tci == 0 {
+			return n
+		}
+		tpid := uint16(unix.ETH_P_8021Q)
+		if aux.Status&unix.TP_STATUS_VLAN_TPID_VALID != 0 {
+			tpid = aux.Vlan_tpid
+		}
+		return insertVLANTag(buf, n, tpid, aux.Vlan_tci)
+	}
+	return n
+}
+
+func insertVLANTag(buf []byte, n int, tpid uint16, tci uint16) int {
+	if n < ETH_HEADER_SIZE || n+VLAN_TAG_SIZE > len(buf) {
+		return n
+	}
+	copy(buf[12+VLAN_TAG_SIZE:n+VLAN_TAG_SIZE], buf[12:n])
+	binary.BigEndian.PutUint16(buf[12:14], tpid)
+	binary.BigEndian.PutUint16(buf[14:16], tci)
+	return n + VLAN_TAG_SIZE
+}
+
+func (b *AFPacketBackend) WriteFrame(frame []byte) (int, error) {
+	var n int
+	var sendErr error
+	err := b.conn.Write(func(fd uintptr) bool {
+		n, sendErr = unix.Write(int(fd), frame)
+		return sendErr != unix.EAGAIN
+	})
+	if err != nil {
+		return 0, err
+	}
+	return n, sendErr
+}
+
+func (b *AFPacketBackend) Close() error {
+	if b.file == nil {
+		return nil
+	}
+	err := b.file.Close()
+	b.file = nil
+	return err
+}
+
+func (b *AFPacketBackend) MTU() int {
+	return b.IFI.MTU + ETH_HEADER_SIZE + VLAN_TAG_SIZE
+}
@@ -0,0 +1,47 @@
+package dataplane
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/m-motawea/gSwitch/config"
+)
+
+const DEFAULT_BACKEND = "afpacket"
+
+type Iface interface {
+	Open() error                                 // acquire the underlying device or socket
+	ReadFrame(buf []byte) (int, net.Addr, error) // read one raw ethernet frame into buf
+	WriteFrame(frame []byte) (int, error)        // write one raw ethernet frame
+	Close() error                                // release the underlying device or socket
+	MTU() int                                    // size of the receive buffer needed for one frame
+}
+
+// backends that batch written frames implement Flusher. SendLoop flushes
+// whenever the port out buffer runs empty.
+type Flusher interface {
+	Flush() error
+}
+
+type BackendFactory func(ifname string, cfg config.SwitchPortConfig) (Iface, error)
+
+// backends register themselves from init() in this package, so the map has
+// to exist before any init() runs
+var Backends = map[string]BackendFactory{}
+
+func RegisterBackend(name string, factory BackendFactory) {
+	Backends[name] = factory
+}
+
+func NewBackend(ifname string, cfg config.SwitchPortConfig) (Iface, error) {
+	name := cfg.Backend
+	if name == "" {
+		name = DEFAULT_BACKEND
+	}
+	factory, ok := Backends[name]
+	if !ok {
+		logger.Error("no port backend with this name", "backend", name, "port", ifname)
+		return nil, fmt.Errorf("no port backend named %s", name)
+	}
+	return factory(ifname, cfg)
+}
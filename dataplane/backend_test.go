@@ -0,0 +1,187 @@
+package dataplane
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+	"github.com/m-motawea/gSwitch/config"
+	"github.com/mdlayher/ethernet"
+)
+
+// benchFrame is a minimum size frame with a local experimental ethertype
+func benchFrame(b *testing.B) []byte {
+	src, _ := net.ParseMAC("02:00:00:00:be:01")
+	dst, _ := net.ParseMAC("02:00:00:00:be:02")
+	f := ethernet.Frame{Destination: dst, Source: src, EtherType: 0x88b5, Payload: make([]byte, 46)}
+	frame, err := f.MarshalBinary()
+	if err != nil {
+		b.Fatal(err)
+	}
+	return frame
+}
+
+// receive counts the frames read from rx until it is closed
+func receive(rx Iface, received *atomic.Int64) chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		buf := make([]byte, rx.MTU())
+		for {
+			_, _, err := rx.ReadFrame(buf)
+			if err != nil {
+				return
+			}
+			received.Add(1)
+		}
+	}()
+	return done
+}
+
+func BenchmarkMemoryBackend(b *testing.B) {
+	frame := benchFrame(b)
+	tx, rx := NewMemoryPair("tx", "rx")
+	tx.Open()
+	rx.Open()
+	defer tx.Close()
+	received := atomic.Int64{}
+	done := receive(rx, &received)
+
+	b.SetBytes(int64(len(frame)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := tx.WriteFrame(frame)
+		for errors.Is(err, ErrMemoryFull) {
+			runtime.Gosched()
+			_, err = tx.WriteFrame(frame)
+		}
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+	for received.Load() < int64(b.N) {
+		runtime.Gosched()
+	}
+	b.StopTimer()
+	rx.Close()
+	<-done
+}
+
+func BenchmarkPcapBackend(b *testing.B) {
+	frame := benchFrame(b)
+	dir := b.TempDir()
+	in := filepath.Join(dir, "in.pcap")
+	f, err := os.Create(in)
+	if err != nil {
+		b.Fatal(err)
+	}
+	w := pcapgo.NewWriter(f)
+	w.WriteFileHeader(PCAP_SNAPLEN, layers.LinkTypeEthernet)
+	for i := 0; i < b.N; i++ {
+		w.WritePacket(gopacket.CaptureInfo{Timestamp: time.Now(), CaptureLength: len(frame), Length: len(frame)}, frame)
+	}
+	f.Close()
+
+	// every replayed frame is recorded again, like a port that loops traffic back
+	backend, _ := NewPcapBackend("bench", config.SwitchPortConfig{Pcap: config.PcapPortConfig{In: in, Out: filepath.Join(dir, "out.pcap")}})
+	port := backend.(*PcapBackend)
+	err = port.Open()
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer port.Close()
+	buf := make([]byte, port.MTU())
+	b.SetBytes(int64(len(frame)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		n, _, err := port.ReadFrame(buf)
+		if err != nil {
+			b.Fatal(err)
+		}
+		_, err = port.WriteFrame(buf[:n])
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+	err = port.Flush()
+	if err != nil {
+		b.Fatal(err)
+	}
+}
+
+// BenchmarkRawBackends sends frames over a veth pair with the raw socket
+// backends and with rawconn, the raw.Conn path they replaced. it needs root and a pair whose both ends are up, named by
+// GSWITCH_BENCH_TX and GSWITCH_BENCH_RX (bench0 and bench1 by default):
+//
+//	ip link add bench0 type veth peer name bench1
+//	ip link set bench0 up && ip link set bench1 up
+//	sudo go test -run - -bench RawBackends ./dataplane
+func BenchmarkRawBackends(b *testing.B) {
+	if os.Geteuid() != 0 {
+		b.Skip("raw socket backends need root")
+	}
+	txName, rxName := os.Getenv("GSWITCH_BENCH_TX"), os.Getenv("GSWITCH_BENCH_RX")
+	if txName == "" || rxName == "" {
+		txName, rxName = "bench0", "bench1"
+	}
+	for _, name := range []string{"rawconn", "afpacket", "tpacket"} {
+		b.Run(name, func(b *testing.B) {
+			benchmarkRaw(b, name, txName, rxName)
+		})
+	}
+}
+
+func openRaw(b *testing.B, name string, ifname string) Iface {
+	backend, err := NewBackend(ifname, config.SwitchPortConfig{Backend: name})
+	if err != nil {
+		b.Skipf("no %s port on %s: %v", name, ifname, err)
+	}
+	err = backend.Open()
+	if err != nil {
+		b.Skipf("failed to open %s port on %s: %v", name, ifname, err)
+	}
+	return backend
+}
+
+func benchmarkRaw(b *testing.B, name string, txName string, rxName string) {
+	frame := benchFrame(b)
+	tx := openRaw(b, name, txName)
+	defer tx.Close()
+	rx := openRaw(b, name, rxName)
+	received := atomic.Int64{}
+	done := receive(rx, &received)
+
+	flusher, batched := tx.(Flusher)
+	b.SetBytes(int64(len(frame)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := tx.WriteFrame(frame)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if batched && i%IFACE_BUFFER_SIZE == 0 {
+			flusher.Flush()
+		}
+	}
+	if batched {
+		flusher.Flush()
+	}
+	// raw sockets drop frames under load. wait until nothing more arrives
+	last := int64(-1)
+	for received.Load() < int64(b.N) && received.Load() != last {
+		last = received.Load()
+		time.Sleep(50 * time.Millisecond)
+	}
+	b.StopTimer()
+	b.ReportMetric(float64(received.Load())/float64(b.N), "delivered/op")
+	rx.Close()
+	<-done
+}
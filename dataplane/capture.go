@@ -0,0 +1,112 @@
+package dataplane
+
+import (
+	"errors"
+	"os"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+	"github.com/mdlayher/ethernet"
+)
+
+const CAPTURE_IN = 0  // pcapng interface id of ingress frames
+const CAPTURE_OUT = 1 // pcapng interface id of egress frames
+
+var ErrCaptureRunning = errors.New("capture already running on port")
+var ErrNoCapture = errors.New("no capture running on port")
+
+// Capture records the frames a port hands to and receives from the control
+// plane to a pcapng file. ingress frames are recorded after the port vlan is
+// assigned and egress frames before the vlan tag is set for the wire, so the
+// file shows what the pipeline saw rather than what was on the link.
+type Capture struct {
+	Path    string
+	Filter  string
+	Started time.Time
+	Frames  uint64 // written under mutex. final once Close returns
+	match   FrameFilter
+	file    *os.File
+	writer  *pcapgo.NgWriter
+	mutex   *sync.Mutex
+}
+
+func NewCapture(portName string, path string, filter string) (*Capture, error) {
+	match, err := CompileFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	intf := pcapgo.NgInterface{
+		Name:     portName + " in",
+		Filter:   filter,
+		OS:       runtime.GOOS,
+		LinkType: layers.LinkTypeEthernet,
+	}
+	writer, err := pcapgo.NewNgWriterInterface(f, intf, pcapgo.DefaultNgWriterOptions)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	intf.Name = portName + " out"
+	_, err = writer.AddInterface(intf)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &Capture{
+		Path:    path,
+		Filter:  filter,
+		Started: time.Now(),
+		match:   match,
+		file:    f,
+		writer:  writer,
+		mutex:   &sync.Mutex{},
+	}, nil
+}
+
+func (c *Capture) Write(f *ethernet.Frame, direction int) {
+	if !c.match(f) {
+		return
+	}
+	b, err := f.MarshalBinary()
+	if err != nil {
+		logger.Warn("capture failed to marshal frame", "path", c.Path, "error", err)
+		return
+	}
+	ci := gopacket.CaptureInfo{
+		Timestamp:      time.Now(),
+		CaptureLength:  len(b),
+		Length:         len(b),
+		InterfaceIndex: direction,
+	}
+	defer c.mutex.Unlock()
+	c.mutex.Lock()
+	if c.writer == nil {
+		return
+	}
+	err = c.writer.WritePacket(ci, b)
+	if err != nil {
+		logger.Warn("capture failed to write frame", "path", c.Path, "error", err)
+		return
+	}
+	c.Frames++
+}
+
+func (c *Capture) Close() error {
+	defer c.mutex.Unlock()
+	c.mutex.Lock()
+	if c.writer == nil {
+		return nil
+	}
+	err := c.writer.Flush()
+	c.file.Close()
+	c.writer = nil
+	return err
+}
@@ -0,0 +1,75 @@
+package dataplane
+
+import (
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket/pcapgo"
+	"github.com/mdlayher/ethernet"
+)
+
+func TestStopCaptureWhileWriting(t *testing.T) {
+	port, err := NewSwitchPortWithBackend("eth1", &failingBackend{}, false, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "eth1.pcapng")
+	err = port.StartCapture(path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	src, _ := net.ParseMAC("02:00:00:00:00:0a")
+	frame := &ethernet.Frame{Destination: ethernet.Broadcast, Source: src, EtherType: 0x88b5, Payload: make([]byte, 46)}
+	wg := sync.WaitGroup{}
+	stop := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+					port.captureFrame(frame, CAPTURE_IN)
+				}
+			}
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+	c, err := port.StopCapture()
+	close(stop)
+	wg.Wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	r, err := pcapgo.NewNgReader(f, pcapgo.DefaultNgReaderOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := uint64(0)
+	for {
+		_, _, err := r.ReadPacketData()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		n++
+	}
+	if n != c.Frames {
+		t.Fatalf("file has %d frames, capture counted %d", n, c.Frames)
+	}
+}
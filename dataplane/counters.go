@@ -0,0 +1,150 @@
+package dataplane
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"github.com/mdlayher/ethernet"
+)
+
+// drop reasons counted per port
+const DROP_RECV_ERROR = "recv_error"             // backend failed to read a frame
+const DROP_INVALID_FRAME = "invalid_frame"       // received bytes are not an ethernet frame
+const DROP_VLAN_NOT_ALLOWED = "vlan_not_allowed" // vlan is not allowed on the port
+const DROP_MARSHAL_ERROR = "marshal_error"       // frame could not be encoded for the wire
+const DROP_SEND_ERROR = "send_error"             // backend failed to write a frame
+const DROP_OUT_BUFFER_FULL = "out_buffer_full"   // port egress queue is full
+const DROP_PORT_SECURITY = "port_security"       // source address is not allowed by port security
+const DROP_PORT_STATE = "port_state"             // received on a port the spanning tree does not forward on
+
+type TrafficCounters struct {
+	Packets   uint64
+	Bytes     uint64
+	Unicast   uint64
+	Multicast uint64
+	Broadcast uint64
+}
+
+func (tc *TrafficCounters) add(dst net.HardwareAddr, size int) {
+	tc.Packets++
+	tc.Bytes += uint64(size)
+	switch {
+	case isBroadcast(dst):
+		tc.Broadcast++
+	case len(dst) > 0 && dst[0]&0x01 == 1:
+		tc.Multicast++
+	default:
+		tc.Unicast++
+	}
+}
+
+func isBroadcast(addr net.HardwareAddr) bool {
+	if len(addr) != len(ethernet.Broadcast) {
+		return false
+	}
+	for i := range addr {
+		if addr[i] != ethernet.Broadcast[i] {
+			return false
+		}
+	}
+	return true
+}
+
+type VLANCounters struct {
+	Rx TrafficCounters
+	Tx TrafficCounters
+}
+
+// SecurityCounters counts the port security violations of a port. the
+// frames of the protect action are only counted as drops
+type SecurityCounters struct {
+	Violations    uint64
+	LastVLAN      int
+	LastMAC       string
+	LastViolation time.Time
+}
+
+type PortStats struct {
+	Rx       TrafficCounters
+	Tx       TrafficCounters
+	VLANs    map[int]VLANCounters
+	Drops    map[string]uint64
+	Security SecurityCounters
+	Cleared  time.Time // counters were last reset at
+}
+
+type PortCounters struct {
+	stats PortStats
+	mutex *sync.Mutex
+}
+
+func NewPortCounters() *PortCounters {
+	pc := PortCounters{mutex: &sync.Mutex{}}
+	pc.reset()
+	return &pc
+}
+
+func (pc *PortCounters) reset() {
+	pc.stats = PortStats{
+		VLANs:   map[int]VLANCounters{},
+		Drops:   map[string]uint64{},
+		Cleared: time.Now(),
+	}
+}
+
+func (pc *PortCounters) Rx(vlan int, dst net.HardwareAddr, size int) {
+	defer pc.mutex.Unlock()
+	pc.mutex.Lock()
+	pc.stats.Rx.add(dst, size)
+	vc := pc.stats.VLANs[vlan]
+	vc.Rx.add(dst, size)
+	pc.stats.VLANs[vlan] = vc
+}
+
+func (pc *PortCounters) Tx(vlan int, dst net.HardwareAddr, size int) {
+	defer pc.mutex.Unlock()
+	pc.mutex.Lock()
+	pc.stats.Tx.add(dst, size)
+	vc := pc.stats.VLANs[vlan]
+	vc.Tx.add(dst, size)
+	pc.stats.VLANs[vlan] = vc
+}
+
+func (pc *PortCounters) Drop(reason string) {
+	defer pc.mutex.Unlock()
+	pc.mutex.Lock()
+	pc.stats.Drops[reason]++
+}
+
+// Violation counts a port security violation of mac in vlan
+func (pc *PortCounters) Violation(vlan int, mac string) {
+	defer pc.mutex.Unlock()
+	pc.mutex.Lock()
+	pc.stats.Security.Violations++
+	pc.stats.Security.LastVLAN = vlan
+	pc.stats.Security.LastMAC = mac
+	pc.stats.Security.LastViolation = time.Now()
+}
+
+// Snapshot returns a copy of the counters that is safe to read while the port runs
+func (pc *PortCounters) Snapshot() PortStats {
+	defer pc.mutex.Unlock()
+	pc.mutex.Lock()
+	stats := pc.stats
+	stats.VLANs = map[int]VLANCounters{}
+	for vlan, vc := range pc.stats.VLANs {
+		stats.VLANs[vlan] = vc
+	}
+	stats.Drops = map[string]uint64{}
+	for reason, n := range pc.stats.Drops {
+		stats.Drops[reason] = n
+	}
+	return stats
+}
+
+func (pc *PortCounters) Clear() {
+	defer pc.mutex.Unlock()
+	pc.mutex.Lock()
+	pc.reset()
+}
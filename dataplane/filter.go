@@ -0,0 +1,228 @@
+package dataplane
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/mdlayher/ethernet"
+)
+
+/*
+	capture filters use a small subset of the tcpdump syntax:
+
+	primitives:
+		vlan <id>
+		ether src|dst|host <mac>
+		ether proto <number|arp|ip|ip6>
+		arp | ip | ip6 | broadcast | multicast
+		ip src|dst|host <ipv4>
+	combined with: not, and, or, ( )
+*/
+
+var ErrInvalidFilter = errors.New("invalid capture filter")
+
+type FrameFilter func(f *ethernet.Frame) bool
+
+type filterParser struct {
+	tokens []string
+	pos    int
+}
+
+func CompileFilter(expr string) (FrameFilter, error) {
+	expr = strings.NewReplacer("(", " ( ", ")", " ) ", "!", " not ", "&&", " and ", "||", " or ").Replace(expr)
+	p := filterParser{tokens: strings.Fields(strings.ToLower(expr))}
+	if len(p.tokens) == 0 {
+		return func(f *ethernet.Frame) bool { return true }, nil
+	}
+	filter, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("%w: unexpected %q", ErrInvalidFilter, p.tokens[p.pos])
+	}
+	return filter, nil
+}
+
+func (p *filterParser) peek() string {
+	if p.pos >= len(p.tokens) {
+		return ""
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *filterParser) next() (string, error) {
+	if p.pos >= len(p.tokens) {
+		return "", fmt.Errorf("%w: unexpected end of expression", ErrInvalidFilter)
+	}
+	tok := p.tokens[p.pos]
+	p.pos++
+	return tok, nil
+}
+
+func (p *filterParser) parseOr() (FrameFilter, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "or" {
+		p.pos++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(f *ethernet.Frame) bool { return l(f) || right(f) }
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseAnd() (FrameFilter, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "and" {
+		p.pos++
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(f *ethernet.Frame) bool { return l(f) && right(f) }
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseNot() (FrameFilter, error) {
+	if p.peek() == "not" {
+		p.pos++
+		inner, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return func(f *ethernet.Frame) bool { return !inner(f) }, nil
+	}
+	if p.peek() == "(" {
+		p.pos++
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		tok, err := p.next()
+		if err != nil || tok != ")" {
+			return nil, fmt.Errorf("%w: missing )", ErrInvalidFilter)
+		}
+		return inner, nil
+	}
+	return p.parsePrimitive()
+}
+
+func (p *filterParser) parsePrimitive() (FrameFilter, error) {
+	tok, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	switch tok {
+	case "vlan":
+		arg, err := p.next()
+		if err != nil {
+			return nil, err
+		}
+		id, err := strconv.Atoi(arg)
+		if err != nil || id < 0 || id > MAX_VLAN_ID {
+			return nil, fmt.Errorf("%w: invalid vlan %q", ErrInvalidFilter, arg)
+		}
+		return func(f *ethernet.Frame) bool { return f.VLAN != nil && int(f.VLAN.ID) == id }, nil
+	case "arp":
+		return etherTypeFilter(ethernet.EtherTypeARP), nil
+	case "ip":
+		if p.peek() == "src" || p.peek() == "dst" || p.peek() == "host" {
+			return p.parseIPHost()
+		}
+		return etherTypeFilter(ethernet.EtherTypeIPv4), nil
+	case "ip6":
+		return etherTypeFilter(ethernet.EtherTypeIPv6), nil
+	case "broadcast":
+		return func(f *ethernet.Frame) bool { return f.Destination.String() == ethernet.Broadcast.String() }, nil
+	case "multicast":
+		return func(f *ethernet.Frame) bool { return len(f.Destination) > 0 && f.Destination[0]&0x01 == 1 }, nil
+	case "ether":
+		return p.parseEther()
+	}
+	return nil, fmt.Errorf("%w: unknown primitive %q", ErrInvalidFilter, tok)
+}
+
+func etherTypeFilter(et ethernet.EtherType) FrameFilter {
+	return func(f *ethernet.Frame) bool { return f.EtherType == et }
+}
+
+func (p *filterParser) parseEther() (FrameFilter, error) {
+	qual, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	arg, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	if qual == "proto" {
+		names := map[string]ethernet.EtherType{
+			"arp": ethernet.EtherTypeARP,
+			"ip":  ethernet.EtherTypeIPv4,
+			"ip6": ethernet.EtherTypeIPv6,
+		}
+		et, ok := names[arg]
+		if !ok {
+			n, err := strconv.ParseUint(arg, 0, 16)
+			if err != nil {
+				return nil, fmt.Errorf("%w: invalid ether proto %q", ErrInvalidFilter, arg)
+			}
+			et = ethernet.EtherType(n)
+		}
+		return etherTypeFilter(et), nil
+	}
+	mac, err := net.ParseMAC(arg)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid mac %q", ErrInvalidFilter, arg)
+	}
+	addr := mac.String()
+	switch qual {
+	case "src":
+		return func(f *ethernet.Frame) bool { return f.Source.String() == addr }, nil
+	case "dst":
+		return func(f *ethernet.Frame) bool { return f.Destination.String() == addr }, nil
+	case "host":
+		return func(f *ethernet.Frame) bool { return f.Source.String() == addr || f.Destination.String() == addr }, nil
+	}
+	return nil, fmt.Errorf("%w: unknown ether qualifier %q", ErrInvalidFilter, qual)
+}
+
+func (p *filterParser) parseIPHost() (FrameFilter, error) {
+	qual, _ := p.next()
+	arg, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	ip := net.ParseIP(arg).To4()
+	if ip == nil {
+		return nil, fmt.Errorf("%w: invalid ipv4 address %q", ErrInvalidFilter, arg)
+	}
+	match := func(f *ethernet.Frame, offset int) bool {
+		// version 4 and a header of at least 20 bytes
+		if f.EtherType != ethernet.EtherTypeIPv4 || len(f.Payload) < 20 || f.Payload[0]>>4 != 4 || f.Payload[0]&0x0f < 5 {
+			return false
+		}
+		return net.IP(f.Payload[offset : offset+4]).Equal(ip)
+	}
+	switch qual {
+	case "src":
+		return func(f *ethernet.Frame) bool { return match(f, 12) }, nil
+	case "dst":
+		return func(f *ethernet.Frame) bool { return match(f, 16) }, nil
+	}
+	return func(f *ethernet.Frame) bool { return match(f, 12) || match(f, 16) }, nil
+}
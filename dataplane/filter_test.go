@@ -0,0 +1,110 @@
+package dataplane
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/mdlayher/ethernet"
+)
+
+var (
+	filterSrc = net.HardwareAddr{0x02, 0, 0, 0, 0, 0x0a}
+	filterDst = net.HardwareAddr{0x02, 0, 0, 0, 0, 0x0b}
+)
+
+// ipv4Payload is a 20 byte ipv4 header from src to dst
+func ipv4Payload(src string, dst string) []byte {
+	b := make([]byte, 20)
+	b[0] = 0x45
+	copy(b[12:16], net.ParseIP(src).To4())
+	copy(b[16:20], net.ParseIP(dst).To4())
+	return b
+}
+
+func TestCompileFilter(t *testing.T) {
+	arp := &ethernet.Frame{Destination: ethernet.Broadcast, Source: filterSrc, EtherType: ethernet.EtherTypeARP, VLAN: &ethernet.VLAN{ID: 10}}
+	ip := &ethernet.Frame{Destination: filterDst, Source: filterSrc, EtherType: ethernet.EtherTypeIPv4, VLAN: &ethernet.VLAN{ID: 20}, Payload: ipv4Payload("10.0.0.1", "10.0.0.2")}
+	untagged := &ethernet.Frame{Destination: filterDst, Source: filterSrc, EtherType: ethernet.EtherTypeIPv6}
+	short := &ethernet.Frame{Destination: filterDst, Source: filterSrc, EtherType: ethernet.EtherTypeIPv4, Payload: ipv4Payload("10.0.0.1", "10.0.0.2")[:19]}
+	ipv6 := &ethernet.Frame{Destination: filterDst, Source: filterSrc, EtherType: ethernet.EtherTypeIPv4, Payload: ipv4Payload("10.0.0.1", "10.0.0.2")}
+	ipv6.Payload[0] = 0x65
+	badIHL := &ethernet.Frame{Destination: filterDst, Source: filterSrc, EtherType: ethernet.EtherTypeIPv4, Payload: ipv4Payload("10.0.0.1", "10.0.0.2")}
+	badIHL.Payload[0] = 0x44
+
+	frames := map[string]*ethernet.Frame{"arp": arp, "ip": ip, "untagged": untagged, "short": short, "ipv6": ipv6, "bad_ihl": badIHL}
+	tests := []struct {
+		expr  string
+		match []string
+	}{
+		{"", []string{"arp", "ip", "untagged", "short", "ipv6", "bad_ihl"}},
+		{"arp", []string{"arp"}},
+		{"ARP", []string{"arp"}},
+		{"vlan 10", []string{"arp"}},
+		{"vlan 20", []string{"ip"}},
+		{"not vlan 10", []string{"ip", "untagged", "short", "ipv6", "bad_ihl"}},
+		{"not not arp", []string{"arp"}},
+		{"!arp", []string{"ip", "untagged", "short", "ipv6", "bad_ihl"}},
+		{"broadcast", []string{"arp"}},
+		{"multicast", []string{"arp"}},
+		{"ether dst 02:00:00:00:00:0b and vlan 20", []string{"ip"}},
+		{"ether host 02:00:00:00:00:0a and ether proto ip6", []string{"untagged"}},
+		{"ether proto 0x0806", []string{"arp"}},
+		// and binds tighter than or
+		{"arp or ip6 and vlan 20", []string{"arp"}},
+		{"(arp or ip6) and vlan 20", nil},
+		{"arp or vlan 20 and ip", []string{"arp", "ip"}},
+		{"not arp and vlan 20", []string{"ip"}},
+		{"not (arp or vlan 20)", []string{"untagged", "short", "ipv6", "bad_ihl"}},
+		{"vlan 10 || vlan 20 && ip", []string{"arp", "ip"}},
+		// src and dst are only read from complete ipv4 headers
+		{"ip host 10.0.0.1", []string{"ip"}},
+		{"ip src 10.0.0.1", []string{"ip"}},
+		{"ip dst 10.0.0.1", nil},
+		{"ip dst 10.0.0.2", []string{"ip"}},
+	}
+	for _, test := range tests {
+		filter, err := CompileFilter(test.expr)
+		if err != nil {
+			t.Errorf("%q: %v", test.expr, err)
+			continue
+		}
+		want := map[string]bool{}
+		for _, name := range test.match {
+			want[name] = true
+		}
+		for name, f := range frames {
+			if got := filter(f); got != want[name] {
+				t.Errorf("%q on %s frame = %v, want %v", test.expr, name, got, want[name])
+			}
+		}
+	}
+}
+
+func TestCompileFilterErrors(t *testing.T) {
+	for _, expr := range []string{
+		"vlan",
+		"vlan abc",
+		"vlan 5000",
+		"arp and",
+		"or arp",
+		"not",
+		"(arp",
+		"arp)",
+		"arp ip",
+		"bogus",
+		"ether",
+		"ether src",
+		"ether src 02:00",
+		"ether foo 02:00:00:00:00:0a",
+		"ether proto 0x10000",
+		"ip host",
+		"ip host 10.0.0",
+		"ip src ::1",
+	} {
+		_, err := CompileFilter(expr)
+		if !errors.Is(err, ErrInvalidFilter) {
+			t.Errorf("%q: error %v, want ErrInvalidFilter", expr, err)
+		}
+	}
+}
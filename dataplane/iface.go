@@ -1,35 +1,53 @@
 package dataplane
 
 import (
-	"log"
+	"context"
+	"errors"
+	"fmt"
 	"net"
+	"sync"
 	"time"
 
+	"github.com/m-motawea/gSwitch/config"
+	"github.com/m-motawea/gSwitch/logging"
 	"github.com/mdlayher/ethernet"
-	"github.com/mdlayher/raw"
 )
 
-const ETH_P_ALL = 0x0003
+var logger = logging.Logger("dataplane")
+
 const IFACE_BUFFER_SIZE = 50
 const TYPE_802_1Q = 0x8100
+const MAX_VLAN_ID = 4094
+const RECV_ERROR_BACKOFF = time.Millisecond // wait after a receive error. doubled on every error in a row
+const RECV_ERROR_MAX_BACKOFF = time.Second
 
-type Iface interface {
-	SendLoop(chan int)
-	RecvLoop(chan IncomingFrame, chan int)
-	Out([]byte) error
-}
+var ErrAccessVLAN = errors.New("access port needs exactly one vlan")
+var ErrInvalidVLAN = errors.New("invalid vlan id")
+var ErrTrunkVLANs = errors.New("trunk port needs at least one vlan")
 
 type SwitchPort struct {
-	Name         string
-	IFI          *net.Interface
-	Conn         *raw.Conn
-	VLAN         int
-	Status       bool
-	OutBuf       chan *ethernet.Frame
-	Trunk        bool
-	AllowedVLANs []int
-	closeSend    chan int
-	closeRecv    chan int
+	Name          string
+	Backend       Iface
+	VLAN          int
+	Status        bool // read with IsUp while the switch runs
+	OutBuf        chan *ethernet.Frame
+	Trunk         bool
+	AllowedVLANs  []int
+	Counters      *PortCounters
+	stop          context.CancelFunc // stops the loops of a port that is up
+	sendDone      chan struct{}
+	recvDone      chan struct{}
+	stateMutex    *sync.Mutex // serializes Up and Down. guards errDisabled
+	statusMutex   *sync.RWMutex
+	errDisabled   *ErrDisableInfo
+	capture       *Capture
+	captureMutex  *sync.RWMutex
+	vlanMutex     *sync.RWMutex // guards Trunk, VLAN and AllowedVLANs
+	security      *PortSecurity
+	securityMutex *sync.RWMutex
+	stpState      PortState
+	vlanStates    map[int]PortState // of the vlans of multiple spanning tree instances
+	stpMutex      *sync.RWMutex     // guards stpState and vlanStates
 }
 
 type IncomingFrame struct {
@@ -39,25 +57,44 @@ type IncomingFrame struct {
 }
 
 func (s *SwitchPort) setSendVlanTag(f *ethernet.Frame) []byte {
-	if s.Trunk {
-		log.Printf("sending out of trunk port %s", s.Name)
+	// flooded frames are shared by every out port so the tag is set on a copy
+	frame := *f
+	f = &frame
+	trunk, portVLAN, allowed := s.VLANConfig()
+	if trunk {
+		logger.Debug("sending out of trunk port", "port", s.Name)
 		// In case of Trunk Port
-		if f.VLAN == nil {
+		if f.VLAN == nil && IsLinkLocal(f.Destination) {
+			// control frames of the link (BPDUs, LLDP, ...) are not tagged
+			b, err := f.MarshalBinary()
+			if err != nil {
+				logger.Warn("failed to marshal frame", "port", s.Name, "error", err)
+				s.Counters.Drop(DROP_MARSHAL_ERROR)
+				return []byte{}
+			}
+			return b
+		} else if f.VLAN == nil {
+			if len(allowed) == 0 {
+				logger.Debug("no native vlan on trunk port. dropping", "port", s.Name)
+				s.Counters.Drop(DROP_VLAN_NOT_ALLOWED)
+				return []byte{}
+			}
 			// if no vlan tag added it will add the Native VLAN tag
-			log.Printf("trunk port %s sending: no vlan tag assigned. assigning native vlan %d", s.Name, s.AllowedVLANs[0])
-			vlan := ethernet.VLAN{ID: uint16(s.AllowedVLANs[0])}
+			logger.Debug("no vlan tag assigned. assigning native vlan", "port", s.Name, "vlan", allowed[0])
+			vlan := ethernet.VLAN{ID: uint16(allowed[0])}
 			f.VLAN = &vlan
 			b, err := f.MarshalBinary()
 			if err != nil {
-				log.Printf("failed to marshal frame after adding VLAN in trunk")
+				logger.Warn("failed to marshal frame", "port", s.Name, "error", err)
+				s.Counters.Drop(DROP_MARSHAL_ERROR)
 				return []byte{}
 			}
 			return b
 		} else {
 			// If there is VLAN Tag specified it will check whether it is allowed on this port or not
-			log.Printf("trunk port %s sending: vlan tag found. id: %d", s.Name, f.VLAN.ID)
+			logger.Debug("vlan tag found", "port", s.Name, "vlan", f.VLAN.ID)
 			var FOUND bool
-			for _, id := range s.AllowedVLANs {
+			for _, id := range allowed {
 				if f.VLAN == nil {
 					return []byte{}
 				}
@@ -69,73 +106,86 @@ func (s *SwitchPort) setSendVlanTag(f *ethernet.Frame) []byte {
 			if FOUND {
 				b, err := f.MarshalBinary()
 				if err != nil {
-					log.Printf("failed to marshal frame after adding VLAN in trunk")
+					logger.Warn("failed to marshal frame", "port", s.Name, "error", err)
+					s.Counters.Drop(DROP_MARSHAL_ERROR)
 					return []byte{}
 				}
 				return b
 			} else {
-				log.Printf("trunk port %s sending: vlan id: %d not allowed on port %s", s.Name, f.VLAN.ID, s.Name)
+				logger.Debug("vlan not allowed on port. dropping", "port", s.Name, "vlan", f.VLAN.ID)
+				s.Counters.Drop(DROP_VLAN_NOT_ALLOWED)
 				return []byte{}
 			}
 		}
 	} else {
 		// In case of Access Port
 		if f.VLAN != nil {
-			if int(f.VLAN.ID) != s.VLAN {
+			if int(f.VLAN.ID) != portVLAN {
 				// Discard
-				// log.Printf("access port %s sending: vlan tag found. id: %d. Discarding", s.Name, f.VLAN.ID)
+				logger.Debug("vlan not allowed on access port. dropping", "port", s.Name, "vlan", f.VLAN.ID)
+				s.Counters.Drop(DROP_VLAN_NOT_ALLOWED)
 				return []byte{}
 			}
 			// Strip VLAN Tag
-			log.Printf("access port %s sending: Stripping VLAN Tag.", s.Name)
+			logger.Debug("stripping vlan tag", "port", s.Name)
 			f.VLAN = nil
 			b, err := f.MarshalBinary()
 			if err != nil {
-				log.Printf("failed to marshal frame after adding VLAN in trunk")
+				logger.Warn("failed to marshal frame", "port", s.Name, "error", err)
+				s.Counters.Drop(DROP_MARSHAL_ERROR)
 				return []byte{}
 			}
 			return b
 		}
 		b, err := f.MarshalBinary()
 		if err != nil {
-			log.Printf("failed to marshal frame after adding VLAN in trunk")
+			logger.Warn("failed to marshal frame", "port", s.Name, "error", err)
+			s.Counters.Drop(DROP_MARSHAL_ERROR)
 			return []byte{}
 		}
 		return b
 	}
 	b, err := f.MarshalBinary()
 	if err != nil {
-		log.Printf("failed to marshal frame after adding VLAN in trunk")
+		logger.Warn("failed to marshal frame", "port", s.Name, "error", err)
+		s.Counters.Drop(DROP_MARSHAL_ERROR)
 		return []byte{}
 	}
 	return b
 }
 
 func (s *SwitchPort) setRecvVlanTag(frame []byte) *ethernet.Frame {
-	log.Printf("receiving on port %s, %v", s.Name, frame)
+	logger.Debug("receiving on port", "port", s.Name, "frame", frame)
+	trunk, portVLAN, allowed := s.VLANConfig()
 	var f ethernet.Frame
 	if err := (&f).UnmarshalBinary(frame); err != nil {
-		log.Printf("failed to unmarshal ethernet frame: %v", err)
-		return &f
+		logger.Debug("failed to unmarshal ethernet frame", "port", s.Name, "error", err)
+		s.Counters.Drop(DROP_INVALID_FRAME)
+		return nil
+	}
+	if f.VLAN != nil && f.VLAN.ID == 0 {
+		// priority tagged frame. treat it as untagged
+		f.VLAN = nil
 	}
 
-	if s.Trunk {
+	if trunk {
 		// In case of Trunk Port
-		log.Printf("receiving on trunk port %s", s.Name)
+		logger.Debug("receiving on trunk port", "port", s.Name)
 		if f.VLAN == nil {
 			// if no vlan tag added it will add the Native VLAN tag
-			log.Printf("trunk port %s receiving: no vlan tag assigned. assigning native vlan %d", s.Name, s.AllowedVLANs[0])
-			if len(s.AllowedVLANs) == 0 {
+			if len(allowed) == 0 {
+				s.Counters.Drop(DROP_VLAN_NOT_ALLOWED)
 				return nil
 			}
-			vlan := ethernet.VLAN{ID: uint16(s.AllowedVLANs[0])}
+			logger.Debug("no vlan tag assigned. assigning native vlan", "port", s.Name, "vlan", allowed[0])
+			vlan := ethernet.VLAN{ID: uint16(allowed[0])}
 			f.VLAN = &vlan
 			return &f
 		} else {
 			// If there is VLAN Tag specified it will check whether it is allowed on this port or not
-			log.Printf("trunk port %s receiving: vlan tag found. id: %d", s.Name, f.VLAN.ID)
+			logger.Debug("vlan tag found", "port", s.Name, "vlan", f.VLAN.ID)
 			var FOUND bool
-			for _, id := range s.AllowedVLANs {
+			for _, id := range allowed {
 				if id == int(f.VLAN.ID) {
 					FOUND = true
 					break
@@ -144,7 +194,8 @@ func (s *SwitchPort) setRecvVlanTag(frame []byte) *ethernet.Frame {
 			if FOUND {
 				return &f
 			} else {
-				log.Printf("trunk port %s receiving: vlan id: %d not allowed on port %s", s.Name, f.VLAN.ID, s.Name)
+				logger.Debug("vlan not allowed on port. dropping", "port", s.Name, "vlan", f.VLAN.ID)
+				s.Counters.Drop(DROP_VLAN_NOT_ALLOWED)
 				return nil
 			}
 		}
@@ -152,115 +203,315 @@ func (s *SwitchPort) setRecvVlanTag(frame []byte) *ethernet.Frame {
 		// In case of Access Port
 		if f.VLAN != nil {
 			// Discard
-			log.Printf("access port %s receiving: vlan tag found. id: %d. Discarding", s.Name, f.VLAN.ID)
+			logger.Debug("tagged frame on access port. dropping", "port", s.Name, "vlan", f.VLAN.ID)
+			s.Counters.Drop(DROP_VLAN_NOT_ALLOWED)
 			return nil
 		}
 		// Set VLAN Tag of the Port
-		vlan := ethernet.VLAN{ID: uint16(s.VLAN)}
+		vlan := ethernet.VLAN{ID: uint16(portVLAN)}
 		f.VLAN = &vlan
 		return &f
 	}
 }
 
-func (s *SwitchPort) SendLoop(close chan int) {
-	log.Printf("SWPORT: Staring SendLoop for Port: %s", s.Name)
-	defer log.Printf("Port: %s SendLoop Stopping..", s.Name)
+// SendLoop writes the frames queued by Out until ctx is done. the frames still
+// queued then are written before it returns.
+func (s *SwitchPort) SendLoop(ctx context.Context) {
+	logger.Info("starting send loop", "port", s.Name)
+	defer logger.Info("send loop stopping", "port", s.Name)
 	for {
 		select {
-		case <-close:
-			return
-		default:
-			frame := <-s.OutBuf
-			outFrame := s.setSendVlanTag(frame)
-			log.Printf("sending out of port %s, %v", s.Name, outFrame)
-			if len(outFrame) == 0 {
-				continue
-			}
-			n, err := s.Conn.WriteTo(outFrame, s.Conn.LocalAddr())
-			if err != nil {
-				log.Printf("Failed to send frame out of interface %s due toi error: %t", s.Name, err)
+		case <-ctx.Done():
+			for {
+				select {
+				case frame := <-s.OutBuf:
+					s.send(frame)
+				default:
+					return
+				}
 			}
-			log.Printf("%d bytes sent out of port %s", n, s.Name)
+		case frame := <-s.OutBuf:
+			s.send(frame)
+		}
+	}
+}
+func (s *SwitchPort) send(frame *ethernet.Frame) {
+	s.captureFrame(frame, CAPTURE_OUT)
+	_, vlan, _ := s.VLANConfig()
+	if frame.VLAN != nil {
+		vlan = int(frame.VLAN.ID)
+	}
+	outFrame := s.setSendVlanTag(frame)
+	logger.Debug("sending out of port", "port", s.Name, "frame", outFrame)
+	if len(outFrame) == 0 {
+		return
+	}
+	n, err := s.Backend.WriteFrame(outFrame)
+	if err != nil {
+		logger.Warn("failed to send frame", "port", s.Name, "error", err)
+		s.Counters.Drop(DROP_SEND_ERROR)
+	} else {
+		s.Counters.Tx(vlan, frame.Destination, n)
+	}
+	logger.Debug("frame sent", "port", s.Name, "bytes", n)
+	if flusher, ok := s.Backend.(Flusher); ok && len(s.OutBuf) == 0 {
+		err = flusher.Flush()
+		if err != nil {
+			logger.Warn("failed to flush frames", "port", s.Name, "error", err)
 		}
 	}
 }
 
-func (s *SwitchPort) RecvLoop(controlChannel chan IncomingFrame, close chan int) {
-	log.Printf("SWPORT: Staring RecvLoop for Port: %s", s.Name)
-	defer log.Printf("Port: %s RecvLoop Stopping..", s.Name)
+// RecvLoop hands received frames to controlChannel until ctx is done. a read
+// blocked on the backend returns when the backend is closed.
+func (s *SwitchPort) RecvLoop(ctx context.Context, controlChannel chan IncomingFrame) {
+	logger.Info("starting recv loop", "port", s.Name)
+	defer logger.Info("recv loop stopping", "port", s.Name)
+	// the frame is copied out when it is unmarshaled so the buffer is reused
+	buf := make([]byte, s.Backend.MTU())
+	errs := 0
+	backoff := time.Duration(0)
 	for {
-		select {
-		case <-close:
+		n, addr, err := s.Backend.ReadFrame(buf)
+		if ctx.Err() != nil {
 			return
-		default:
-			buf := make([]byte, s.IFI.MTU)
-			n, addr, err := s.Conn.ReadFrom(buf)
-			if err != nil {
-				log.Printf("Failed to receive on interface %s due to error: %t", s.Name, err)
-			} else {
-				log.Printf("%d bytes received on port %s", n, s.Name)
-				frame := s.setRecvVlanTag(buf[:n])
-				log.Printf("frame with VLAN %v", frame.VLAN)
-				if frame == nil {
-					continue
-				}
-				f_pair := IncomingFrame{
-					FRAME:    frame,
-					SRC_ADDR: addr,
-					IN_PORT:  s,
-				}
-				controlChannel <- f_pair
+		}
+		if err != nil {
+			// a backend that keeps failing is not polled in a busy loop and
+			// only logged after 1, 2, 4, ... errors in a row
+			errs++
+			s.Counters.Drop(DROP_RECV_ERROR)
+			if errs&(errs-1) == 0 {
+				logger.Warn("failed to receive frame", "port", s.Name, "error", err, "errors", errs)
+			}
+			backoff = min(max(2*backoff, RECV_ERROR_BACKOFF), RECV_ERROR_MAX_BACKOFF)
+			timer := time.NewTimer(backoff)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				return
 			}
+			continue
+		}
+		if errs > 0 {
+			logger.Info("receiving again", "port", s.Name, "errors", errs)
+			errs = 0
+			backoff = 0
+		}
+		logger.Debug("frame received", "port", s.Name, "bytes", n)
+		frame := s.setRecvVlanTag(buf[:n])
+		if frame == nil {
+			continue
+		}
+		logger.Debug("frame assigned vlan", "port", s.Name, "vlan", frame.VLAN.ID)
+		s.Counters.Rx(int(frame.VLAN.ID), frame.Destination, n)
+		s.captureFrame(frame, CAPTURE_IN)
+		f_pair := IncomingFrame{
+			FRAME:    frame,
+			SRC_ADDR: addr,
+			IN_PORT:  s,
+		}
+		select {
+		case controlChannel <- f_pair:
+		case <-ctx.Done():
+			return
 		}
 	}
 }
+func (s *SwitchPort) StartCapture(path string, filter string) error {
+	defer s.captureMutex.Unlock()
+	s.captureMutex.Lock()
+	if s.capture != nil {
+		return ErrCaptureRunning
+	}
+	c, err := NewCapture(s.Name, path, filter)
+	if err != nil {
+		logger.Error("failed to start capture", "port", s.Name, "path", path, "error", err)
+		return err
+	}
+	logger.Info("capture started", "port", s.Name, "path", path, "filter", filter)
+	s.capture = c
+	return nil
+}
+
+func (s *SwitchPort) StopCapture() (*Capture, error) {
+	defer s.captureMutex.Unlock()
+	s.captureMutex.Lock()
+	c := s.capture
+	if c == nil {
+		return nil, ErrNoCapture
+	}
+	s.capture = nil
+	err := c.Close()
+	logger.Info("capture stopped", "port", s.Name, "path", c.Path, "frames", c.Frames)
+	return c, err
+}
+
+func (s *SwitchPort) Capture() *Capture {
+	defer s.captureMutex.RUnlock()
+	s.captureMutex.RLock()
+	return s.capture
+}
+
+func (s *SwitchPort) captureFrame(frame *ethernet.Frame, direction int) {
+	c := s.Capture()
+	if c == nil {
+		return
+	}
+	c.Write(frame, direction)
+}
 
 func (s *SwitchPort) Out(frame *ethernet.Frame) {
-	s.OutBuf <- frame
+	select {
+	case s.OutBuf <- frame:
+	default:
+		// tail drop instead of stalling the control plane behind one slow port
+		logger.Debug("out buffer full. dropping frame", "port", s.Name)
+		s.Counters.Drop(DROP_OUT_BUFFER_FULL)
+	}
 }
 
 func NewSwitchPort(ifname string, isTrunk bool, vlans ...int) (SwitchPort, error) {
-	sendCloseChannel := make(chan int)
-	recvCloseChannel := make(chan int)
+	backend, err := NewAFPacketBackend(ifname, config.SwitchPortConfig{})
+	if err != nil {
+		return SwitchPort{Name: ifname}, err
+	}
+	return NewSwitchPortWithBackend(ifname, backend, isTrunk, vlans...)
+}
+
+func NewSwitchPortWithBackend(ifname string, backend Iface, isTrunk bool, vlans ...int) (SwitchPort, error) {
 	iface := SwitchPort{}
 	iface.Name = ifname
-	iface.closeSend = sendCloseChannel
-	iface.closeRecv = recvCloseChannel
-	ifi, err := net.InterfaceByName(ifname)
+	iface.stateMutex = &sync.Mutex{}
+	iface.statusMutex = &sync.RWMutex{}
+	iface.Backend = backend
+	iface.captureMutex = &sync.RWMutex{}
+	iface.vlanMutex = &sync.RWMutex{}
+	iface.securityMutex = &sync.RWMutex{}
+	iface.stpMutex = &sync.RWMutex{}
+	iface.Counters = NewPortCounters()
+	err := iface.SetVLANs(isTrunk, vlans...)
 	if err != nil {
-		log.Printf("Failed to get port %s due to error: %t\n", ifname, err)
 		return iface, err
 	}
-	iface.IFI = ifi
-	iface.Trunk = isTrunk
-	if iface.Trunk {
-		iface.AllowedVLANs = vlans
-	} else {
-		iface.VLAN = vlans[0]
-		iface.AllowedVLANs = vlans
-	}
 	iface.OutBuf = make(chan *ethernet.Frame, IFACE_BUFFER_SIZE)
 	return iface, nil
 }
 
+// SetVLANs changes the vlan membership of the port. it is safe to call while
+// the port is up; frames already queued are tagged with the new membership.
+func (s *SwitchPort) SetVLANs(isTrunk bool, vlans ...int) error {
+	if !isTrunk && len(vlans) != 1 {
+		return ErrAccessVLAN
+	}
+	if isTrunk && len(vlans) == 0 {
+		return ErrTrunkVLANs
+	}
+	for _, id := range vlans {
+		if id < 1 || id > MAX_VLAN_ID {
+			return fmt.Errorf("%w: %d", ErrInvalidVLAN, id)
+		}
+	}
+	allowed := make([]int, len(vlans))
+	copy(allowed, vlans)
+	defer s.vlanMutex.Unlock()
+	s.vlanMutex.Lock()
+	s.Trunk = isTrunk
+	s.AllowedVLANs = allowed
+	s.VLAN = 0
+	if !isTrunk {
+		s.VLAN = allowed[0]
+	}
+	return nil
+}
+
+// VLANConfig returns the vlan membership of the port. the allowed vlans
+// must not be modified.
+func (s *SwitchPort) VLANConfig() (trunk bool, vlan int, allowed []int) {
+	defer s.vlanMutex.RUnlock()
+	s.vlanMutex.RLock()
+	return s.Trunk, s.VLAN, s.AllowedVLANs
+}
+
+func (s *SwitchPort) AllowsVLAN(vlan int) bool {
+	trunk, portVLAN, allowed := s.VLANConfig()
+	if !trunk {
+		return portVLAN == vlan
+	}
+	for _, id := range allowed {
+		if id == vlan {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *SwitchPort) setStatus(up bool) {
+	s.statusMutex.Lock()
+	s.Status = up
+	s.statusMutex.Unlock()
+}
+
+// IsUp reports whether the port loops are running
+func (s *SwitchPort) IsUp() bool {
+	defer s.statusMutex.RUnlock()
+	s.statusMutex.RLock()
+	return s.Status
+}
+
+// Up starts the port loops. an err-disabled port is no longer err-disabled
 func (s *SwitchPort) Up(controlChannel chan IncomingFrame) error {
-	c, err := raw.ListenPacket(s.IFI, ETH_P_ALL, nil)
+	defer s.stateMutex.Unlock()
+	s.stateMutex.Lock()
+	s.errDisabled = nil
+	return s.up(controlChannel)
+}
+
+func (s *SwitchPort) up(controlChannel chan IncomingFrame) error {
+	if s.stop != nil {
+		return nil
+	}
+	err := s.Backend.Open()
 	if err != nil {
-		log.Printf("Failed to listen on port %s due to error %t", s.Name, err)
+		logger.Error("failed to open port backend", "port", s.Name, "error", err)
 		return err
 	}
-	s.Conn = c
-	time.Sleep(2 * time.Second)
-	go s.SendLoop(s.closeSend)
-	time.Sleep(2 * time.Second)
-	go s.RecvLoop(controlChannel, s.closeRecv)
-	s.Status = true
+	ctx, stop := context.WithCancel(context.Background())
+	s.stop = stop
+	s.sendDone = make(chan struct{})
+	s.recvDone = make(chan struct{})
+	go func() {
+		defer close(s.sendDone)
+		s.SendLoop(ctx)
+	}()
+	go func() {
+		defer close(s.recvDone)
+		s.RecvLoop(ctx, controlChannel)
+	}()
+	s.setStatus(true)
 	return nil
 }
 
+// Down stops the port loops. frames already queued to the port are sent
+// before the backend is closed. an err-disabled port stays down but no longer
+// recovers.
 func (s *SwitchPort) Down() error {
-	s.Status = false
-	s.closeRecv <- 1
-	s.closeSend <- 1
-	return s.Conn.Close()
+	defer s.stateMutex.Unlock()
+	s.stateMutex.Lock()
+	s.errDisabled = nil
+	return s.down()
+}
+
+func (s *SwitchPort) down() error {
+	if s.stop == nil {
+		return nil
+	}
+	s.setStatus(false)
+	s.stop()
+	s.stop = nil
+	<-s.sendDone
+	err := s.Backend.Close()
+	<-s.recvDone
+	return err
 }
@@ -0,0 +1,56 @@
+package dataplane
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// failingBackend fails every read
+type failingBackend struct {
+	reads atomic.Int64
+}
+
+func (b *failingBackend) Open() error  { return nil }
+func (b *failingBackend) Close() error { return nil }
+func (b *failingBackend) MTU() int     { return MEMORY_MTU }
+
+func (b *failingBackend) ReadFrame(buf []byte) (int, net.Addr, error) {
+	b.reads.Add(1)
+	return 0, nil, errors.New("device gone")
+}
+
+func (b *failingBackend) WriteFrame(frame []byte) (int, error) {
+	return len(frame), nil
+}
+
+func TestRecvLoopBacksOff(t *testing.T) {
+	backend := &failingBackend{}
+	port, err := NewSwitchPortWithBackend("eth1", backend, false, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		port.RecvLoop(ctx, make(chan IncomingFrame))
+	}()
+	time.Sleep(300 * time.Millisecond)
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("recv loop did not stop while backing off")
+	}
+	// 1+2+4+...+256ms covers the 300ms with about 10 reads
+	if reads := backend.reads.Load(); reads > 20 {
+		t.Fatalf("%d reads of a failing backend in 300ms", reads)
+	}
+	if drops := port.Counters.Snapshot().Drops[DROP_RECV_ERROR]; drops != uint64(backend.reads.Load()) {
+		t.Fatalf("recv error drops = %d, want %d", drops, backend.reads.Load())
+	}
+}
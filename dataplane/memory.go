@@ -0,0 +1,123 @@
+package dataplane
+
+import (
+	"errors"
+	"net"
+	"sync"
+)
+
+const MEMORY_BUFFER_SIZE = 1024
+const MEMORY_MTU = 1518
+
+var ErrMemoryClosed = errors.New("memory port is closed")
+var ErrMemoryFull = errors.New("memory port peer buffer is full")
+
+type MemoryAddr string
+
+func (a MemoryAddr) Network() string {
+	return "memory"
+}
+
+func (a MemoryAddr) String() string {
+	return string(a)
+}
+
+// one end of an in-process wire. frames written to one end are read from the other
+type MemoryBackend struct {
+	Name   string
+	peer   *MemoryBackend
+	in     chan []byte
+	closed chan struct{}
+	mutex  *sync.Mutex
+}
+
+func newMemoryBackend(name string) *MemoryBackend {
+	closed := make(chan struct{})
+	close(closed)
+	return &MemoryBackend{
+		Name:   name,
+		in:     make(chan []byte, MEMORY_BUFFER_SIZE),
+		closed: closed,
+		mutex:  &sync.Mutex{},
+	}
+}
+
+func NewMemoryPair(nameA string, nameB string) (*MemoryBackend, *MemoryBackend) {
+	a := newMemoryBackend(nameA)
+	b := newMemoryBackend(nameB)
+	a.peer = b
+	b.peer = a
+	return a, b
+}
+
+func (b *MemoryBackend) Peer() *MemoryBackend {
+	return b.peer
+}
+
+func (b *MemoryBackend) closedChan() chan struct{} {
+	defer b.mutex.Unlock()
+	b.mutex.Lock()
+	return b.closed
+}
+
+func (b *MemoryBackend) IsOpen() bool {
+	select {
+	case <-b.closedChan():
+		return false
+	default:
+		return true
+	}
+}
+
+func (b *MemoryBackend) Open() error {
+	defer b.mutex.Unlock()
+	b.mutex.Lock()
+	select {
+	case <-b.closed:
+		b.closed = make(chan struct{})
+	default:
+	}
+	return nil
+}
+
+func (b *MemoryBackend) ReadFrame(buf []byte) (int, net.Addr, error) {
+	select {
+	case frame := <-b.in:
+		return copy(buf, frame), MemoryAddr(b.peer.Name), nil
+	case <-b.closedChan():
+		return 0, nil, ErrMemoryClosed
+	}
+}
+
+func (b *MemoryBackend) WriteFrame(frame []byte) (int, error) {
+	if !b.IsOpen() {
+		return 0, ErrMemoryClosed
+	}
+	if !b.peer.IsOpen() {
+		// like a cable with nothing on the far end the frame is lost
+		return len(frame), nil
+	}
+	out := make([]byte, len(frame))
+	copy(out, frame)
+	select {
+	case b.peer.in <- out:
+		return len(frame), nil
+	default:
+		return 0, ErrMemoryFull
+	}
+}
+
+func (b *MemoryBackend) Close() error {
+	defer b.mutex.Unlock()
+	b.mutex.Lock()
+	select {
+	case <-b.closed:
+	default:
+		close(b.closed)
+	}
+	return nil
+}
+
+func (b *MemoryBackend) MTU() int {
+	return MEMORY_MTU
+}
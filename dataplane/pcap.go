@@ -0,0 +1,221 @@
+package dataplane
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+	"github.com/m-motawea/gSwitch/config"
+)
+
+const PCAP_SNAPLEN = 65535
+const PCAPNG_MAGIC = 0x0A0D0D0A
+
+var ErrPcapClosed = errors.New("pcap port is closed")
+
+func init() {
+	RegisterBackend("pcap", NewPcapBackend)
+}
+
+type PcapReader interface {
+	ReadPacketData() ([]byte, gopacket.CaptureInfo, error)
+	LinkType() layers.LinkType
+}
+
+// PcapBackend replays the frames of a pcap or pcapng file as ingress traffic
+// and records egress frames to a pcap file. either file is optional.
+type PcapBackend struct {
+	Name     string
+	In       string
+	Out      string
+	Realtime bool // keep the original gaps between replayed frames
+	inFile   *os.File
+	reader   PcapReader
+	outFile  *os.File
+	outBuf   *bufio.Writer
+	writer   *pcapgo.Writer
+	outMutex *sync.Mutex
+	closed   chan struct{}
+	done     chan struct{}
+	lastTS   time.Time
+}
+
+func NewPcapBackend(ifname string, cfg config.SwitchPortConfig) (Iface, error) {
+	closed := make(chan struct{})
+	close(closed)
+	return &PcapBackend{
+		Name:     ifname,
+		In:       cfg.Pcap.In,
+		Out:      cfg.Pcap.Out,
+		Realtime: cfg.Pcap.Realtime,
+		outMutex: &sync.Mutex{},
+		closed:   closed,
+		done:     make(chan struct{}),
+	}, nil
+}
+
+// NewPcapReader detects whether the capture is pcap or pcapng from its magic
+func NewPcapReader(f io.Reader) (PcapReader, error) {
+	r := bufio.NewReader(f)
+	magic, err := r.Peek(4)
+	if err != nil {
+		return nil, err
+	}
+	if binary.LittleEndian.Uint32(magic) == PCAPNG_MAGIC {
+		return pcapgo.NewNgReader(r, pcapgo.DefaultNgReaderOptions)
+	}
+	return pcapgo.NewReader(r)
+}
+
+func (b *PcapBackend) Open() error {
+	b.closed = make(chan struct{})
+	b.done = make(chan struct{})
+	b.lastTS = time.Time{}
+	if b.In != "" {
+		f, err := os.Open(b.In)
+		if err != nil {
+			logger.Error("pcap port failed to open input", "port", b.Name, "path", b.In, "error", err)
+			return err
+		}
+		reader, err := NewPcapReader(f)
+		if err != nil {
+			logger.Error("pcap port failed to read input", "port", b.Name, "path", b.In, "error", err)
+			f.Close()
+			return err
+		}
+		if reader.LinkType() != layers.LinkTypeEthernet {
+			logger.Error("pcap port input is not an ethernet capture", "port", b.Name, "path", b.In)
+		}
+		b.inFile = f
+		b.reader = reader
+	} else {
+		close(b.done)
+	}
+	if b.Out != "" {
+		f, err := os.Create(b.Out)
+		if err != nil {
+			logger.Error("pcap port failed to create output", "port", b.Name, "path", b.Out, "error", err)
+			b.closeInput()
+			return err
+		}
+		b.outFile = f
+		b.outBuf = bufio.NewWriter(f)
+		b.writer = pcapgo.NewWriter(b.outBuf)
+		err = b.writer.WriteFileHeader(PCAP_SNAPLEN, layers.LinkTypeEthernet)
+		if err != nil {
+			b.closeInput()
+			f.Close()
+			return err
+		}
+	}
+	return nil
+}
+
+// Done is closed once every frame of the input file has been replayed.
+func (b *PcapBackend) Done() <-chan struct{} {
+	return b.done
+}
+
+func (b *PcapBackend) ReadFrame(buf []byte) (int, net.Addr, error) {
+	select {
+	case <-b.closed:
+		b.closeInput()
+		return 0, nil, ErrPcapClosed
+	default:
+	}
+	if b.reader != nil {
+		data, ci, err := b.reader.ReadPacketData()
+		if err == nil {
+			if b.Realtime && !b.lastTS.IsZero() {
+				select {
+				case <-time.After(ci.Timestamp.Sub(b.lastTS)):
+				case <-b.closed:
+					return 0, nil, ErrPcapClosed
+				}
+			}
+			b.lastTS = ci.Timestamp
+			addr := &PacketAddr{}
+			if len(data) >= 12 {
+				addr.HardwareAddr = append(net.HardwareAddr{}, data[6:12]...)
+			}
+			return copy(buf, data), addr, nil
+		}
+		if err != io.EOF {
+			logger.Error("pcap port failed to read input", "port", b.Name, "path", b.In, "error", err)
+		}
+		logger.Info("pcap port finished replaying input", "port", b.Name, "path", b.In)
+		b.closeInput()
+		close(b.done)
+	}
+	// nothing left to replay. behave like an idle link until closed
+	<-b.closed
+	return 0, nil, ErrPcapClosed
+}
+
+func (b *PcapBackend) WriteFrame(frame []byte) (int, error) {
+	defer b.outMutex.Unlock()
+	b.outMutex.Lock()
+	if b.writer == nil {
+		// no output file. egress frames are discarded
+		return len(frame), nil
+	}
+	ci := gopacket.CaptureInfo{
+		Timestamp:     time.Now(),
+		CaptureLength: len(frame),
+		Length:        len(frame),
+	}
+	err := b.writer.WritePacket(ci, frame)
+	if err != nil {
+		return 0, err
+	}
+	return len(frame), nil
+}
+
+func (b *PcapBackend) Flush() error {
+	defer b.outMutex.Unlock()
+	b.outMutex.Lock()
+	if b.outBuf == nil {
+		return nil
+	}
+	return b.outBuf.Flush()
+}
+
+func (b *PcapBackend) closeInput() {
+	if b.inFile != nil {
+		b.inFile.Close()
+	}
+	b.inFile = nil
+	b.reader = nil
+}
+
+func (b *PcapBackend) Close() error {
+	select {
+	case <-b.closed:
+		return nil
+	default:
+		close(b.closed)
+	}
+	defer b.outMutex.Unlock()
+	b.outMutex.Lock()
+	var err error
+	if b.outBuf != nil {
+		err = b.outBuf.Flush()
+		b.outFile.Close()
+	}
+	b.outFile = nil
+	b.outBuf = nil
+	b.writer = nil
+	return err
+}
+
+func (b *PcapBackend) MTU() int {
+	return PCAP_SNAPLEN
+}
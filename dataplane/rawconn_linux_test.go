@@ -0,0 +1,56 @@
+package dataplane
+
+import (
+	"net"
+
+	"github.com/m-motawea/gSwitch/config"
+	"github.com/mdlayher/raw"
+)
+
+// rawConnPort is the raw.Conn path SwitchPort used before the port backends:
+// one ReadFrom into a fresh mtu sized buffer and one WriteTo per frame. it is
+// only registered in tests, as the baseline of BenchmarkRawBackends
+type rawConnPort struct {
+	ifi  *net.Interface
+	conn *raw.Conn
+}
+
+func init() {
+	RegisterBackend("rawconn", func(ifname string, cfg config.SwitchPortConfig) (Iface, error) {
+		ifi, err := net.InterfaceByName(ifname)
+		if err != nil {
+			return nil, err
+		}
+		return &rawConnPort{ifi: ifi}, nil
+	})
+}
+
+func (p *rawConnPort) Open() error {
+	conn, err := raw.ListenPacket(p.ifi, ETH_P_ALL, nil)
+	if err != nil {
+		return err
+	}
+	p.conn = conn
+	return nil
+}
+
+func (p *rawConnPort) ReadFrame(buf []byte) (int, net.Addr, error) {
+	frame := make([]byte, p.MTU())
+	n, addr, err := p.conn.ReadFrom(frame)
+	if err != nil {
+		return 0, nil, err
+	}
+	return copy(buf, frame[:n]), addr, nil
+}
+
+func (p *rawConnPort) WriteFrame(frame []byte) (int, error) {
+	return p.conn.WriteTo(frame, p.conn.LocalAddr())
+}
+
+func (p *rawConnPort) Close() error {
+	return p.conn.Close()
+}
+
+func (p *rawConnPort) MTU() int {
+	return p.ifi.MTU + ETH_HEADER_SIZE + VLAN_TAG_SIZE
+}
@@ -0,0 +1,125 @@
+package dataplane
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/m-motawea/gSwitch/config"
+)
+
+// port security violation actions
+const VIOLATION_PROTECT = "protect"   // drop the frames of the address
+const VIOLATION_RESTRICT = "restrict" // drop and count them and log the violation
+const VIOLATION_SHUTDOWN = "shutdown" // err-disable the port
+
+// reasons a port is err-disabled for
+const ERRDISABLE_PORT_SECURITY = "port-security"
+const ERRDISABLE_MAC_FLAP = "mac-flap"
+
+var ErrPortSecurity = errors.New("invalid port security config")
+
+// PortSecurity limits the source addresses the switch learns on a port
+type PortSecurity struct {
+	MaxMACs     int
+	AllowedMACs map[string]bool // empty allows every address
+	Violation   string
+	Recovery    time.Duration // 0 keeps an err-disabled port down
+}
+
+// NewPortSecurity checks cfg. it returns nil when port security is disabled
+func NewPortSecurity(cfg config.PortSecurityConfig) (*PortSecurity, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+	ps := &PortSecurity{MaxMACs: 1, AllowedMACs: map[string]bool{}, Violation: cfg.Violation, Recovery: time.Duration(cfg.RecoverySeconds) * time.Second}
+	if cfg.MaxMACs != nil {
+		if *cfg.MaxMACs < 1 {
+			return nil, fmt.Errorf("%w: MaxMACs %d is less than 1", ErrPortSecurity, *cfg.MaxMACs)
+		}
+		ps.MaxMACs = *cfg.MaxMACs
+	}
+	for _, mac := range cfg.AllowedMACs {
+		addr, err := net.ParseMAC(mac)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrPortSecurity, err)
+		}
+		ps.AllowedMACs[addr.String()] = true
+	}
+	switch ps.Violation {
+	case "":
+		ps.Violation = VIOLATION_SHUTDOWN
+	case VIOLATION_PROTECT, VIOLATION_RESTRICT, VIOLATION_SHUTDOWN:
+	default:
+		return nil, fmt.Errorf("%w: unknown violation action %q", ErrPortSecurity, ps.Violation)
+	}
+	if cfg.RecoverySeconds < 0 {
+		return nil, fmt.Errorf("%w: RecoverySeconds %d is negative", ErrPortSecurity, cfg.RecoverySeconds)
+	}
+	return ps, nil
+}
+
+// Allows reports whether addr is in the allowed addresses of the port
+func (ps *PortSecurity) Allows(addr string) bool {
+	return len(ps.AllowedMACs) == 0 || ps.AllowedMACs[addr]
+}
+
+// SetSecurity changes the port security of the port. nil disables it
+func (s *SwitchPort) SetSecurity(ps *PortSecurity) {
+	s.securityMutex.Lock()
+	s.security = ps
+	s.securityMutex.Unlock()
+}
+
+// Security returns the port security of the port. nil when it is disabled
+func (s *SwitchPort) Security() *PortSecurity {
+	defer s.securityMutex.RUnlock()
+	s.securityMutex.RLock()
+	return s.security
+}
+
+type ErrDisableInfo struct {
+	Reason string
+	Since  time.Time
+}
+
+/*
+ErrDisable brings the port down because of an error (a port security
+violation, ...). unlike Down the port remembers why, until it is brought up
+or down again or recovers. ok is false when it was already err-disabled.
+*/
+func (s *SwitchPort) ErrDisable(reason string) (info ErrDisableInfo, ok bool, err error) {
+	defer s.stateMutex.Unlock()
+	s.stateMutex.Lock()
+	if s.errDisabled != nil {
+		return *s.errDisabled, false, nil
+	}
+	logger.Warn("port err-disabled", "port", s.Name, "reason", reason)
+	info = ErrDisableInfo{Reason: reason, Since: time.Now()}
+	s.errDisabled = &info
+	return info, true, s.down()
+}
+
+// ErrDisabled returns why the port is err-disabled. ok is false when it is not
+func (s *SwitchPort) ErrDisabled() (ErrDisableInfo, bool) {
+	defer s.stateMutex.Unlock()
+	s.stateMutex.Lock()
+	if s.errDisabled == nil {
+		return ErrDisableInfo{}, false
+	}
+	return *s.errDisabled, true
+}
+
+// Recover brings up a port err-disabled at since. ok is false when the port
+// was brought up or down, or err-disabled again, in the meantime
+func (s *SwitchPort) Recover(since time.Time, controlChannel chan IncomingFrame) (ok bool, err error) {
+	defer s.stateMutex.Unlock()
+	s.stateMutex.Lock()
+	if s.errDisabled == nil || !s.errDisabled.Since.Equal(since) {
+		return false, nil
+	}
+	logger.Info("recovering err-disabled port", "port", s.Name, "reason", s.errDisabled.Reason)
+	s.errDisabled = nil
+	return true, s.up(controlChannel)
+}
@@ -0,0 +1,94 @@
+package dataplane
+
+import (
+	"bytes"
+	"net"
+)
+
+// PortState is the spanning tree state of a port. ports forward while no
+// spanning tree process runs
+type PortState int32
+
+const (
+	PortForwarding PortState = iota
+	PortLearning             // learns source addresses but does not forward
+	PortBlocking             // discarding in 802.1w
+)
+
+func (s PortState) String() string {
+	switch s {
+	case PortForwarding:
+		return "forwarding"
+	case PortLearning:
+		return "learning"
+	case PortBlocking:
+		return "blocking"
+	}
+	return "unknown"
+}
+
+// Learns reports whether source addresses are learned on a port in this state
+func (s PortState) Learns() bool {
+	return s != PortBlocking
+}
+
+// Forwards reports whether frames are received and sent on a port in this state
+func (s PortState) Forwards() bool {
+	return s == PortForwarding
+}
+
+// SetPortState changes the spanning tree state of the port
+func (s *SwitchPort) SetPortState(state PortState) {
+	s.stpMutex.Lock()
+	s.stpState = state
+	s.stpMutex.Unlock()
+}
+
+// PortState returns the spanning tree state of the port. the vlans of
+// multiple spanning tree instances may be in another state (VLANPortState)
+func (s *SwitchPort) PortState() PortState {
+	defer s.stpMutex.RUnlock()
+	s.stpMutex.RLock()
+	return s.stpState
+}
+
+// link local group addresses 01:80:c2:00:00:00 to 01:80:c2:00:00:0f (BPDUs,
+// LLDP, ...) are never forwarded by a bridge
+var linkLocalPrefix = net.HardwareAddr{0x01, 0x80, 0xc2, 0x00, 0x00}
+
+// IsLinkLocal reports whether addr is a link local group address
+func IsLinkLocal(addr net.HardwareAddr) bool {
+	return len(addr) == 6 && bytes.Equal(addr[:5], linkLocalPrefix) && addr[5] <= 0x0f
+}
+
+// SetVLANPortState changes the spanning tree state of the port for vlans.
+// the other vlans keep the state set with SetPortState
+func (s *SwitchPort) SetVLANPortState(vlans []int, state PortState) {
+	s.stpMutex.Lock()
+	if s.vlanStates == nil {
+		s.vlanStates = map[int]PortState{}
+	}
+	for _, vlan := range vlans {
+		s.vlanStates[vlan] = state
+	}
+	s.stpMutex.Unlock()
+}
+
+// ClearVLANPortStates puts every vlan of the port back on the state set with
+// SetPortState
+func (s *SwitchPort) ClearVLANPortStates() {
+	s.stpMutex.Lock()
+	s.vlanStates = nil
+	s.stpMutex.Unlock()
+}
+
+// VLANPortState returns the spanning tree state of the port for vlan
+func (s *SwitchPort) VLANPortState(vlan int) PortState {
+	defer s.stpMutex.RUnlock()
+	s.stpMutex.RLock()
+	state, ok := s.vlanStates[vlan]
+	if !ok {
+		return s.stpState
+	}
+	return state
+}
@@ -0,0 +1,142 @@
+package dataplane
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"unsafe"
+
+	"github.com/m-motawea/gSwitch/config"
+	"golang.org/x/sys/unix"
+)
+
+const TAP_DEFAULT_MTU = 1500
+
+func init() {
+	RegisterBackend("tap", NewTapBackend)
+}
+
+// TapBackend creates a tap interface named after the port when it is opened
+// and removes it when it is closed. the host network stack sees the tap as a
+// normal NIC attached to the switch, which lets local processes (ssh, dhcp
+// clients, ...) reach the switch vlans.
+type TapBackend struct {
+	Name string
+	MAC  net.HardwareAddr
+	file *os.File
+	mtu  int
+}
+
+func NewTapBackend(ifname string, cfg config.SwitchPortConfig) (Iface, error) {
+	if len(ifname) >= unix.IFNAMSIZ {
+		return nil, fmt.Errorf("tap port name %s is longer than %d characters", ifname, unix.IFNAMSIZ-1)
+	}
+	backend := TapBackend{Name: ifname, mtu: TAP_DEFAULT_MTU}
+	if cfg.Tap.MAC != "" {
+		mac, err := net.ParseMAC(cfg.Tap.MAC)
+		if err != nil {
+			logger.Error("invalid tap mac address", "port", ifname, "mac", cfg.Tap.MAC)
+			return nil, err
+		}
+		backend.MAC = mac
+	}
+	return &backend, nil
+}
+
+func (b *TapBackend) Open() error {
+	fd, err := unix.Open("/dev/net/tun", unix.O_RDWR|unix.O_NONBLOCK|unix.O_CLOEXEC, 0)
+	if err != nil {
+		logger.Error("failed to open /dev/net/tun", "port", b.Name, "error", err)
+		return err
+	}
+	ifr, err := unix.NewIfreq(b.Name)
+	if err != nil {
+		unix.Close(fd)
+		return err
+	}
+	ifr.SetUint16(unix.IFF_TAP | unix.IFF_NO_PI)
+	err = unix.IoctlIfreq(fd, unix.TUNSETIFF, ifr)
+	if err != nil {
+		logger.Error("failed to create tap interface", "port", b.Name, "error", err)
+		unix.Close(fd)
+		return err
+	}
+	err = b.setLink()
+	if err != nil {
+		logger.Error("failed to configure tap interface", "port", b.Name, "error", err)
+		unix.Close(fd)
+		return err
+	}
+	ifi, err := net.InterfaceByName(b.Name)
+	if err == nil {
+		b.mtu = ifi.MTU
+	}
+	b.file = os.NewFile(uintptr(fd), b.Name)
+	return nil
+}
+
+// setLink sets the configured mac address of the tap and brings it up
+func (b *TapBackend) setLink() error {
+	sock, err := unix.Socket(unix.AF_INET, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return err
+	}
+	defer unix.Close(sock)
+
+	if b.MAC != nil {
+		// struct ifreq with ifr_hwaddr set
+		req := struct {
+			Name   [unix.IFNAMSIZ]byte
+			Family uint16
+			Addr   [14]byte
+			_      [8]byte
+		}{Family: unix.ARPHRD_ETHER}
+		copy(req.Name[:], b.Name)
+		copy(req.Addr[:], b.MAC)
+		_, _, errno := unix.Syscall(unix.SYS_IOCTL, uintptr(sock), unix.SIOCSIFHWADDR, uintptr(unsafe.Pointer(&req)))
+		if errno != 0 {
+			return errno
+		}
+	}
+
+	ifr, err := unix.NewIfreq(b.Name)
+	if err != nil {
+		return err
+	}
+	err = unix.IoctlIfreq(sock, unix.SIOCGIFFLAGS, ifr)
+	if err != nil {
+		return err
+	}
+	ifr.SetUint16(ifr.Uint16() | unix.IFF_UP)
+	return unix.IoctlIfreq(sock, unix.SIOCSIFFLAGS, ifr)
+}
+
+func (b *TapBackend) ReadFrame(buf []byte) (int, net.Addr, error) {
+	n, err := b.file.Read(buf)
+	if err != nil {
+		return 0, nil, err
+	}
+	addr := &PacketAddr{}
+	if n >= 12 {
+		addr.HardwareAddr = append(net.HardwareAddr{}, buf[6:12]...)
+	}
+	return n, addr, nil
+}
+
+func (b *TapBackend) WriteFrame(frame []byte) (int, error) {
+	return b.file.Write(frame)
+}
+
+func (b *TapBackend) Close() error {
+	if b.file == nil {
+		return nil
+	}
+	// the tap is not persistent so the kernel removes it with the last fd
+	err := b.file.Close()
+	b.file = nil
+	return err
+}
+
+func (b *TapBackend) MTU() int {
+	return b.mtu + ETH_HEADER_SIZE + VLAN_TAG_SIZE
+}
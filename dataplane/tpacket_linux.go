@@ -0,0 +1,338 @@
+package dataplane
+
+import (
+	"errors"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"unsafe"
+
+	"github.com/m-motawea/gSwitch/config"
+	"golang.org/x/sys/unix"
+)
+
+const TPACKET_BLOCK_SIZE = 1 << 20 // must be a multiple of the page size
+const TPACKET_BLOCK_NR = 16
+const TPACKET_FRAME_SIZE = 1 << 11 // rx frame size. rx blocks hold frames of any size up to the block size
+const TPACKET_RETIRE_TIMEOUT = 2   // ms before a partly filled rx block is handed to user space
+
+var ErrTPacketClosed = errors.New("tpacket ring is closed")
+
+func init() {
+	RegisterBackend("tpacket", NewTPacketBackend)
+}
+
+// mmap'd TPACKET_V3 rx and tx rings. frames are read out of whole blocks
+// without a syscall per frame, and written frames are queued in the tx ring
+// until Flush hands the batch to the kernel with a single send.
+type TPacketBackend struct {
+	IFI         *net.Interface
+	file        *os.File
+	conn        syscall.RawConn
+	ring        []byte
+	rxRing      []byte
+	txRing      []byte
+	rxMutex     *sync.Mutex
+	txMutex     *sync.Mutex
+	rxBlock     int    // block currently being read
+	rxPkt       uint32 // packets already read from rxBlock
+	rxOffset    uint32 // offset of the next packet in rxBlock
+	txFrame     int    // next tx slot
+	txPending   int    // frames queued and not handed to the kernel yet
+	txFrameSize int    // tx slot size, one MTU sized frame plus its header
+	txFrameNr   int
+	hdrLen      int
+}
+
+func NewTPacketBackend(ifname string, cfg config.SwitchPortConfig) (Iface, error) {
+	ifi, err := net.InterfaceByName(ifname)
+	if err != nil {
+		logger.Error("failed to get interface", "port", ifname, "error", err)
+		return nil, err
+	}
+	hdrLen := int(unsafe.Sizeof(unix.Tpacket3Hdr{}))
+	hdrLen = (hdrLen + unix.TPACKET_ALIGNMENT - 1) &^ (unix.TPACKET_ALIGNMENT - 1)
+	return &TPacketBackend{
+		IFI:     ifi,
+		rxMutex: &sync.Mutex{},
+		txMutex: &sync.Mutex{},
+		hdrLen:  hdrLen,
+	}, nil
+}
+
+func (b *TPacketBackend) Open() error {
+	fd, err := unix.Socket(unix.AF_PACKET, unix.SOCK_RAW|unix.SOCK_NONBLOCK|unix.SOCK_CLOEXEC, int(htons(ETH_P_ALL)))
+	if err != nil {
+		logger.Error("failed to open packet socket", "port", b.IFI.Name, "error", err)
+		return err
+	}
+	err = b.setupRings(fd)
+	if err != nil {
+		logger.Error("failed to set up tpacket rings", "port", b.IFI.Name, "error", err)
+		unix.Close(fd)
+		return err
+	}
+	addr := unix.SockaddrLinklayer{
+		Protocol: htons(ETH_P_ALL),
+		Ifindex:  b.IFI.Index,
+	}
+	err = unix.Bind(fd, &addr)
+	if err != nil {
+		logger.Error("failed to bind packet socket", "port", b.IFI.Name, "error", err)
+		unix.Munmap(b.ring)
+		unix.Close(fd)
+		return err
+	}
+	b.file = os.NewFile(uintptr(fd), b.IFI.Name)
+	b.conn, err = b.file.SyscallConn()
+	if err != nil {
+		b.Close()
+		return err
+	}
+	return nil
+}
+
+func (b *TPacketBackend) setupRings(fd int) error {
+	err := unix.SetsockoptInt(fd, unix.SOL_PACKET, unix.PACKET_VERSION, unix.TPACKET_V3)
+	if err != nil {
+		return err
+	}
+	rxReq := unix.TpacketReq3{
+		Block_size:     TPACKET_BLOCK_SIZE,
+		Block_nr:       TPACKET_BLOCK_NR,
+		Frame_size:     TPACKET_FRAME_SIZE,
+		Frame_nr:       TPACKET_BLOCK_SIZE / TPACKET_FRAME_SIZE * TPACKET_BLOCK_NR,
+		Retire_blk_tov: TPACKET_RETIRE_TIMEOUT,
+	}
+	err = unix.SetsockoptTpacketReq3(fd, unix.SOL_PACKET, unix.PACKET_RX_RING, &rxReq)
+	if err != nil {
+		return err
+	}
+	// block transmit is not supported by the kernel so the tx ring is frame
+	// based. slots are sized from the interface mtu so jumbo frames fit
+	frameSize := b.hdrLen + b.MTU()
+	frameSize = (frameSize + unix.TPACKET_ALIGNMENT - 1) &^ (unix.TPACKET_ALIGNMENT - 1)
+	if frameSize > TPACKET_BLOCK_SIZE {
+		return unix.EMSGSIZE
+	}
+	b.txFrameSize = frameSize
+	b.txFrameNr = TPACKET_BLOCK_SIZE / frameSize * TPACKET_BLOCK_NR
+	txReq := unix.TpacketReq3{
+		Block_size: TPACKET_BLOCK_SIZE,
+		Block_nr:   TPACKET_BLOCK_NR,
+		Frame_size: uint32(b.txFrameSize),
+		Frame_nr:   uint32(b.txFrameNr),
+	}
+	err = unix.SetsockoptTpacketReq3(fd, unix.SOL_PACKET, unix.PACKET_TX_RING, &txReq)
+	if err != nil {
+		return err
+	}
+	size := TPACKET_BLOCK_SIZE * TPACKET_BLOCK_NR
+	ring, err := unix.Mmap(fd, 0, 2*size, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED)
+	if err != nil {
+		return err
+	}
+	b.ring = ring
+	b.rxRing = ring[:size]
+	b.txRing = ring[size:]
+	b.rxBlock = 0
+	b.rxPkt = 0
+	b.rxOffset = 0
+	b.txFrame = 0
+	b.txPending = 0
+	return nil
+}
+
+func (b *TPacketBackend) blockHeader(block int) *unix.TpacketHdrV1 {
+	desc := (*unix.TpacketBlockDesc)(unsafe.Pointer(&b.rxRing[block*TPACKET_BLOCK_SIZE]))
+	return (*unix.TpacketHdrV1)(unsafe.Pointer(&desc.Hdr[0]))
+}
+
+// nextFrame copies the next received frame into buf. ok is false when the
+// current block has not been handed over by the kernel yet.
+func (b *TPacketBackend) nextFrame(buf []byte) (n int, addr net.Addr, ok bool, err error) {
+	defer b.rxMutex.Unlock()
+	b.rxMutex.Lock()
+	if b.ring == nil {
+		return 0, nil, true, ErrTPacketClosed
+	}
+	for {
+		hdr := b.blockHeader(b.rxBlock)
+		if atomic.LoadUint32(&hdr.Block_status)&unix.TP_STATUS_USER == 0 {
+			return 0, nil, false, nil
+		}
+		if b.rxPkt >= hdr.Num_pkts {
+			// hand the block back and move to the next one
+			b.rxPkt = 0
+			b.rxOffset = 0
+			atomic.StoreUint32(&hdr.Block_status, unix.TP_STATUS_KERNEL)
+			b.rxBlock = (b.rxBlock + 1) % TPACKET_BLOCK_NR
+			continue
+		}
+		if b.rxPkt == 0 {
+			b.rxOffset = hdr.Offset_to_first_pkt
+		}
+		block := b.rxRing[b.rxBlock*TPACKET_BLOCK_SIZE : (b.rxBlock+1)*TPACKET_BLOCK_SIZE]
+		pkt := (*unix.Tpacket3Hdr)(unsafe.Pointer(&block[b.rxOffset]))
+		b.rxPkt++
+		offset := b.rxOffset
+		b.rxOffset += pkt.Next_offset
+
+		ll := (*unix.RawSockaddrLinklayer)(unsafe.Pointer(&block[offset+uint32(b.hdrLen)]))
+		if ll.Pkttype == unix.PACKET_OUTGOING {
+			// frames transmitted on this interface by someone else
+			continue
+		}
+		data := block[offset+uint32(pkt.Mac) : offset+uint32(pkt.Mac)+pkt.Snaplen]
+		n = copy(buf[:len(buf)-VLAN_TAG_SIZE], data)
+		if pkt.Status&unix.TP_STATUS_VLAN_VALID != 0 || pkt.Hv1.Vlan_tci != 0 {
+			tpid := uint16(unix.ETH_P_8021Q)
+			if pkt.Status&unix.TP_STATUS_VLAN_TPID_VALID != 0 {
+				tpid = pkt.Hv1.Vlan_tpid
+			}
+			n = insertVLANTag(buf, n, tpid, uint16(pkt.Hv1.Vlan_tci))
+		}
+		hwAddr := make(net.HardwareAddr, ll.Halen)
+		copy(hwAddr, ll.Addr[:ll.Halen])
+		return n, &PacketAddr{HardwareAddr: hwAddr}, true, nil
+	}
+}
+
+func (b *TPacketBackend) ReadFrame(buf []byte) (int, net.Addr, error) {
+	var n int
+	var addr net.Addr
+	var readErr error
+	err := b.conn.Read(func(fd uintptr) bool {
+		var ok bool
+		n, addr, ok, readErr = b.nextFrame(buf)
+		return ok
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+	return n, addr, readErr
+}
+
+func (b *TPacketBackend) txSlot(frame int) []byte {
+	perBlock := TPACKET_BLOCK_SIZE / b.txFrameSize
+	offset := (frame/perBlock)*TPACKET_BLOCK_SIZE + (frame%perBlock)*b.txFrameSize
+	return b.txRing[offset : offset+b.txFrameSize]
+}
+
+// queueFrame copies the frame into the next free tx slot. ok is false when
+// the ring is full and the kernel has to drain it first.
+func (b *TPacketBackend) queueFrame(frame []byte) (ok bool, err error) {
+	defer b.txMutex.Unlock()
+	b.txMutex.Lock()
+	if b.ring == nil {
+		return true, ErrTPacketClosed
+	}
+	if len(frame) > b.txFrameSize-b.hdrLen {
+		return true, unix.EMSGSIZE
+	}
+	slot := b.txSlot(b.txFrame)
+	hdr := (*unix.Tpacket3Hdr)(unsafe.Pointer(&slot[0]))
+	status := atomic.LoadUint32(&hdr.Status)
+	if status != unix.TP_STATUS_AVAILABLE && status&unix.TP_STATUS_WRONG_FORMAT == 0 {
+		_, err = b.flush()
+		return false, err
+	}
+	copy(slot[b.hdrLen:], frame)
+	hdr.Len = uint32(len(frame))
+	hdr.Snaplen = uint32(len(frame))
+	hdr.Next_offset = 0
+	atomic.StoreUint32(&hdr.Status, unix.TP_STATUS_SEND_REQUEST)
+	b.txFrame = (b.txFrame + 1) % b.txFrameNr
+	b.txPending++
+	return true, nil
+}
+
+func (b *TPacketBackend) WriteFrame(frame []byte) (int, error) {
+	var queueErr error
+	err := b.conn.Write(func(fd uintptr) bool {
+		var ok bool
+		ok, queueErr = b.queueFrame(frame)
+		return ok || queueErr != nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	if queueErr != nil {
+		return 0, queueErr
+	}
+	return len(frame), nil
+}
+
+// flush hands the queued frames to the kernel. ok is false when the socket
+// is busy and the frames are still pending. must be called with txMutex held
+func (b *TPacketBackend) flush() (ok bool, err error) {
+	if b.txPending == 0 {
+		return true, nil
+	}
+	var sendErr error
+	err = b.conn.Control(func(fd uintptr) {
+		sendErr = unix.Sendto(int(fd), nil, unix.MSG_DONTWAIT, nil)
+	})
+	if err != nil {
+		return true, err
+	}
+	if sendErr == unix.EAGAIN || sendErr == unix.ENOBUFS {
+		return false, nil
+	}
+	if sendErr != nil {
+		// the frames stay queued in the ring for the next flush
+		return true, sendErr
+	}
+	b.txPending = 0
+	return true, nil
+}
+
+// Flush waits for the socket to be writable and retries until the queued
+// frames are handed to the kernel
+func (b *TPacketBackend) Flush() error {
+	b.txMutex.Lock()
+	closed := b.ring == nil
+	b.txMutex.Unlock()
+	if closed {
+		return ErrTPacketClosed
+	}
+	var flushErr error
+	err := b.conn.Write(func(fd uintptr) bool {
+		defer b.txMutex.Unlock()
+		b.txMutex.Lock()
+		if b.ring == nil {
+			flushErr = ErrTPacketClosed
+			return true
+		}
+		var ok bool
+		ok, flushErr = b.flush()
+		return ok || flushErr != nil
+	})
+	if err != nil {
+		return err
+	}
+	return flushErr
+}
+
+func (b *TPacketBackend) Close() error {
+	if b.file == nil {
+		return nil
+	}
+	err := b.file.Close()
+	b.rxMutex.Lock()
+	b.txMutex.Lock()
+	unix.Munmap(b.ring)
+	b.ring = nil
+	b.rxRing = nil
+	b.txRing = nil
+	b.txMutex.Unlock()
+	b.rxMutex.Unlock()
+	b.file = nil
+	return err
+}
+
+func (b *TPacketBackend) MTU() int {
+	return b.IFI.MTU + ETH_HEADER_SIZE + VLAN_TAG_SIZE
+}
@@ -0,0 +1,352 @@
+package datastore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/m-motawea/gSwitch/config"
+	"github.com/m-motawea/gSwitch/controlplane"
+	"github.com/m-motawea/gSwitch/l2"
+	"github.com/m-motawea/gSwitch/l3"
+	"github.com/m-motawea/gSwitch/logging"
+	"github.com/redis/go-redis/v9"
+)
+
+var logger = logging.Logger("datastore")
+
+const DEFAULT_SYNC_INTERVAL = 60 * time.Second
+
+/*
+	keys written by the switch. everyone else only reads them:
+
+		<prefix>ports           hash  port name -> port state (json)
+		<prefix>mac:<vlan>      hash  mac -> port
+		<prefix>arp             hash  ip -> {"MAC": "...", "Port": "..."}
+		<prefix>routes          hash  prefix -> route (json)
+		<prefix>vlanifaces      hash  name -> vlan interface (json)
+
+	keys the switch reads and applies:
+
+		<prefix>config:ports    hash  port name -> "up" or "down"
+		<prefix>config:routes   hash  prefix -> route (json). removing the field removes the route
+
+	the mirror follows the switch events and is rewritten every sync interval.
+	config keys are applied every sync interval, or right away when anything
+	is published to the <prefix>config channel.
+*/
+
+type RedisStore struct {
+	sw       *controlplane.Switch
+	client   *redis.Client
+	prefix   string
+	interval time.Duration
+	routes   map[string]bool // prefixes of the routes added from config:routes
+}
+
+type arpValue struct {
+	MAC  string
+	Port string
+}
+
+// NewRedisStore connects to redis. it returns an error if the server can not be reached.
+func NewRedisStore(sw *controlplane.Switch, cfg config.RedisConfig) (*RedisStore, error) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     net.JoinHostPort(cfg.Address, strconv.Itoa(cfg.Port)),
+		Password: cfg.Password,
+		DB:       cfg.DB,
+	})
+	err := client.Ping(context.Background()).Err()
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+	interval := time.Duration(cfg.SyncSeconds) * time.Second
+	if interval <= 0 {
+		interval = DEFAULT_SYNC_INTERVAL
+	}
+	return &RedisStore{
+		sw:       sw,
+		client:   client,
+		prefix:   cfg.Prefix,
+		interval: interval,
+		routes:   map[string]bool{},
+	}, nil
+}
+
+func (s *RedisStore) key(name string) string {
+	return s.prefix + name
+}
+
+func (s *RedisStore) macKey(vlan int) string {
+	return s.key("mac:" + strconv.Itoa(vlan))
+}
+
+// Run mirrors the switch and applies the config keys. it blocks until ctx is
+// done or the redis connection is closed.
+func (s *RedisStore) Run(ctx context.Context) error {
+	events := s.sw.Events.Subscribe(0)
+	defer events.Close()
+	pubsub := s.client.Subscribe(ctx, s.key("config"))
+	defer pubsub.Close()
+	_, err := pubsub.Receive(ctx)
+	if err != nil {
+		return err
+	}
+	logger.Info("mirroring switch to redis", "address", s.client.Options().Addr, "db", s.client.Options().DB, "prefix", s.prefix)
+	s.applyAndSync(ctx)
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	updates := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case ev := <-events.C:
+			err := s.mirror(ctx, ev)
+			if err != nil {
+				logger.Warn("failed to mirror event", "type", ev.Type, "error", err)
+			}
+		case _, ok := <-updates:
+			if !ok {
+				return errors.New("redis subscription closed")
+			}
+			logger.Debug("config update published")
+			s.applyAndSync(ctx)
+		case <-ticker.C:
+			s.applyAndSync(ctx)
+		}
+	}
+}
+
+func (s *RedisStore) Close() error {
+	return s.client.Close()
+}
+
+func (s *RedisStore) applyAndSync(ctx context.Context) {
+	err := s.Apply(ctx)
+	if err != nil {
+		logger.Warn("failed to apply config from redis", "error", err)
+	}
+	err = s.Sync(ctx)
+	if err != nil {
+		logger.Warn("failed to sync switch to redis", "error", err)
+	}
+}
+
+func (s *RedisStore) macKeys(ctx context.Context) ([]string, error) {
+	keys := []string{}
+	iter := s.client.Scan(ctx, 0, s.key("mac:*"), 0).Iterator()
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+	}
+	return keys, iter.Err()
+}
+
+func toJSON(v interface{}) string {
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+func (s *RedisStore) routingTable() (l3.RoutingTable, error) {
+	table, err := s.sw.ProcTable(3, "Routing")
+	if err != nil {
+		return l3.RoutingTable{}, err
+	}
+	rt, ok := table.(l3.RoutingTable)
+	if !ok {
+		return l3.RoutingTable{}, fmt.Errorf("unexpected routing table %T", table)
+	}
+	return rt, nil
+}
+
+// Sync rewrites the mirror from the current state of the switch in one transaction
+func (s *RedisStore) Sync(ctx context.Context) error {
+	macKeys, err := s.macKeys(ctx)
+	if err != nil {
+		return err
+	}
+	ports := map[string]interface{}{}
+	for _, info := range s.sw.PortInfos() {
+		ports[info.Name] = toJSON(info)
+	}
+	// the tables of processes missing from the pipeline are left empty
+	macs := map[int]map[string]interface{}{}
+	entries, err := l2.MACEntries(s.sw, l2.MACQuery{})
+	if err != nil && !errors.Is(err, controlplane.ErrNoProc) {
+		return err
+	}
+	for _, ent := range entries {
+		if macs[ent.VLAN] == nil {
+			macs[ent.VLAN] = map[string]interface{}{}
+		}
+		macs[ent.VLAN][ent.MAC] = ent.Port
+	}
+	arps := map[string]interface{}{}
+	table, err := s.sw.ProcTable(2, "ARP")
+	if err != nil && !errors.Is(err, controlplane.ErrNoProc) {
+		return err
+	}
+	if err == nil {
+		arpEntries, ok := table.([]l2.ARPTableEntry)
+		if !ok {
+			return fmt.Errorf("unexpected arp table %T", table)
+		}
+		for _, ent := range arpEntries {
+			arps[ent.IP] = toJSON(arpValue{MAC: ent.MAC, Port: ent.Port})
+		}
+	}
+	routes := map[string]interface{}{}
+	ifaces := map[string]interface{}{}
+	rt, err := s.routingTable()
+	if err != nil && !errors.Is(err, controlplane.ErrNoProc) {
+		return err
+	}
+	for prefix, route := range rt.Routes {
+		routes[prefix] = toJSON(route)
+	}
+	for name, iface := range rt.VLANIfaces {
+		ifaces[name] = toJSON(iface)
+	}
+
+	_, err = s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		keys := append([]string{s.key("ports"), s.key("arp"), s.key("routes"), s.key("vlanifaces")}, macKeys...)
+		pipe.Del(ctx, keys...)
+		if len(ports) > 0 {
+			pipe.HSet(ctx, s.key("ports"), ports)
+		}
+		for vlan, entries := range macs {
+			pipe.HSet(ctx, s.macKey(vlan), entries)
+		}
+		if len(arps) > 0 {
+			pipe.HSet(ctx, s.key("arp"), arps)
+		}
+		if len(routes) > 0 {
+			pipe.HSet(ctx, s.key("routes"), routes)
+		}
+		if len(ifaces) > 0 {
+			pipe.HSet(ctx, s.key("vlanifaces"), ifaces)
+		}
+		return nil
+	})
+	return err
+}
+
+// mirror applies a single event to the mirror
+func (s *RedisStore) mirror(ctx context.Context, ev controlplane.Event) error {
+	switch ev.Type {
+	case controlplane.EventMACLearned, controlplane.EventMACMoved:
+		return s.client.HSet(ctx, s.macKey(ev.VLAN), ev.MAC, ev.Port).Err()
+	case controlplane.EventMACAged:
+		return s.client.HDel(ctx, s.macKey(ev.VLAN), ev.MAC).Err()
+	case controlplane.EventMACFlushed:
+		// static and sticky entries or the entries of other ports may be left
+		return s.Sync(ctx)
+	case controlplane.EventARPAdded:
+		return s.client.HSet(ctx, s.key("arp"), ev.IP, toJSON(arpValue{MAC: ev.MAC, Port: ev.Port})).Err()
+	case controlplane.EventARPExpired:
+		return s.client.HDel(ctx, s.key("arp"), ev.IP).Err()
+	case controlplane.EventARPFlushed:
+		return s.client.Del(ctx, s.key("arp")).Err()
+	case controlplane.EventPortUp, controlplane.EventPortDown:
+		info, err := s.sw.PortInfo(ev.Port)
+		if err != nil {
+			return s.client.HDel(ctx, s.key("ports"), ev.Port).Err()
+		}
+		return s.client.HSet(ctx, s.key("ports"), ev.Port, toJSON(info)).Err()
+	case controlplane.EventRouteAdded, controlplane.EventRouteRemoved:
+		rt, err := s.routingTable()
+		if err != nil {
+			return err
+		}
+		route, ok := rt.Routes[ev.Prefix]
+		if !ok {
+			return s.client.HDel(ctx, s.key("routes"), ev.Prefix).Err()
+		}
+		return s.client.HSet(ctx, s.key("routes"), ev.Prefix, toJSON(route)).Err()
+	}
+	return nil
+}
+
+// Apply brings the switch to the state in the config keys
+func (s *RedisStore) Apply(ctx context.Context) error {
+	ports, err := s.client.HGetAll(ctx, s.key("config:ports")).Result()
+	if err != nil {
+		return err
+	}
+	for name, state := range ports {
+		info, err := s.sw.PortInfo(name)
+		if err != nil {
+			logger.Warn("invalid port in redis config", "port", name, "error", err)
+			continue
+		}
+		switch {
+		case state == "up" && info.ErrDisabled != nil:
+			// bringing it up would undo a shutdown violation or flap block.
+			// it comes back with its recovery timer or from the api
+			logger.Debug("err-disabled port left down", "port", name, "reason", info.ErrDisabled.Reason)
+		case state == "up" && !info.Up:
+			logger.Info("bringing port up from redis config", "port", name)
+			err = s.sw.UpPort(name)
+		case state == "down" && info.Up:
+			logger.Info("bringing port down from redis config", "port", name)
+			err = s.sw.DownPort(name)
+		case state != "up" && state != "down":
+			logger.Warn("invalid port state in redis config", "port", name, "state", state)
+		}
+		if err != nil {
+			logger.Warn("failed to apply port state from redis config", "port", name, "state", state, "error", err)
+		}
+	}
+
+	routes, err := s.client.HGetAll(ctx, s.key("config:routes")).Result()
+	if err != nil {
+		return err
+	}
+	if len(routes) == 0 && len(s.routes) == 0 {
+		return nil
+	}
+	rt, err := s.routingTable()
+	if err != nil {
+		return err
+	}
+	current := rt.Routes
+	for prefix, value := range routes {
+		route := l3.Route{}
+		err := json.Unmarshal([]byte(value), &route)
+		if err != nil {
+			logger.Warn("invalid route in redis config", "prefix", prefix, "error", err)
+			continue
+		}
+		old, ok := current[prefix]
+		if ok && reflect.DeepEqual(old, route) {
+			s.routes[prefix] = true
+			continue
+		}
+		err = l3.AddRoute(s.sw, prefix, route)
+		if err != nil {
+			logger.Warn("failed to add route from redis config", "prefix", prefix, "error", err)
+			continue
+		}
+		s.routes[prefix] = true
+	}
+	for prefix := range s.routes {
+		_, ok := routes[prefix]
+		if ok {
+			continue
+		}
+		err := l3.DelRoute(s.sw, prefix)
+		if err != nil && !errors.Is(err, l3.ErrNoRoute) {
+			logger.Warn("failed to remove route from redis config", "prefix", prefix, "error", err)
+			continue
+		}
+		delete(s.routes, prefix)
+	}
+	return nil
+}
@@ -0,0 +1,276 @@
+package datastore
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/m-motawea/gSwitch/config"
+	"github.com/m-motawea/gSwitch/controlplane"
+	"github.com/m-motawea/gSwitch/dataplane"
+	"github.com/m-motawea/gSwitch/l2"
+	"github.com/m-motawea/gSwitch/l3"
+	"github.com/m-motawea/gSwitch/switchtest"
+	"github.com/mdlayher/arp"
+	"github.com/mdlayher/ethernet"
+)
+
+const testPrefix = "gswitch:"
+
+var (
+	hostA = net.HardwareAddr{0x02, 0, 0, 0, 0, 0x0a}
+	hostB = net.HardwareAddr{0x02, 0, 0, 0, 0, 0x0b}
+)
+
+func writeConfig(t *testing.T, name string, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	err := os.WriteFile(path, []byte(content), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// newTestStore starts a switch with a mac table, an arp table and a routing
+// table, and a store mirroring it to miniredis
+func newTestStore(t *testing.T) (*RedisStore, *miniredis.Miniredis, *switchtest.Harness) {
+	t.Helper()
+	arpConf := writeConfig(t, "ARPConfig.toml", "[LocalAddresses.VLAN10]\nIP = \"10.10.1.1\"\nMAC = \"52:e1:47:de:21:2a\"\n")
+	routingConf := writeConfig(t, "RoutingTable.toml", `
+[VLANIfaces.VLAN10]
+IP = "10.10.1.1"
+MAC = "52:e1:47:de:21:2a"
+VLAN = 10
+[[Routes."10.10.0.0/16".Ports]]
+Name = "VLAN10"
+`)
+	h, err := switchtest.NewHarness(config.Config{
+		SwitchPorts: map[string]config.SwitchPortConfig{
+			"p1": {AllowedVLANs: []int{10}, Up: true},
+			"p2": {AllowedVLANs: []int{10}, Up: true},
+		},
+		ControlProcess: []config.ControlProcessConfig{
+			{Layer: 2, Name: "L2Switch"},
+			{Layer: 2, Name: "ARP", ConfigFile: arpConf},
+			{Layer: 2, Name: "L2Adapter"},
+			{Layer: 3, Name: "IPv4"},
+			{Layer: 3, Name: "Routing", ConfigFile: routingConf},
+		},
+	})
+	if h != nil {
+		t.Cleanup(func() {
+			h.Stop(5 * time.Second)
+		})
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mr := miniredis.RunT(t)
+	port, _ := strconv.Atoi(mr.Port())
+	s, err := NewRedisStore(h.Switch, config.RedisConfig{Address: mr.Host(), Port: port, Prefix: testPrefix})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		s.Close()
+	})
+	return s, mr, h
+}
+
+// learn injects an arp request from hostA on p1 so the switch learns its
+// mac and adds it to the arp table
+func learn(t *testing.T, h *switchtest.Harness) {
+	t.Helper()
+	p, err := arp.NewPacket(arp.OperationRequest, hostA, net.ParseIP("10.10.1.5"), ethernet.Broadcast, net.ParseIP("10.10.1.9"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pb, err := p.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = h.Inject("p1", &ethernet.Frame{Destination: ethernet.Broadcast, Source: hostA, EtherType: ethernet.EtherTypeARP, Payload: pb})
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "hostA to be learned", func() bool {
+		entries, err := l2.MACEntries(h.Switch, l2.MACQuery{MAC: hostA.String()})
+		if err != nil || len(entries) == 0 {
+			return false
+		}
+		table, err := h.Switch.ProcTable(2, "ARP")
+		return err == nil && len(table.([]l2.ARPTableEntry)) > 0
+	})
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSync(t *testing.T) {
+	s, mr, h := newTestStore(t)
+	learn(t, h)
+	// a stale entry the sync must remove
+	mr.HSet(testPrefix+"mac:20", hostB.String(), "p9")
+
+	err := s.Sync(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info := controlplane.PortInfo{}
+	err = json.Unmarshal([]byte(mr.HGet(testPrefix+"ports", "p1")), &info)
+	if err != nil || info.Name != "p1" || !info.Up {
+		t.Fatalf("port p1 = %+v %v", info, err)
+	}
+	if port := mr.HGet(testPrefix+"mac:10", hostA.String()); port != "p1" {
+		t.Fatalf("mac of hostA on %q. want p1", port)
+	}
+	if mr.Exists(testPrefix + "mac:20") {
+		t.Fatal("stale mac key left after sync")
+	}
+	value := arpValue{}
+	err = json.Unmarshal([]byte(mr.HGet(testPrefix+"arp", "10.10.1.5")), &value)
+	if err != nil || value.MAC != hostA.String() {
+		t.Fatalf("arp entry = %+v %v", value, err)
+	}
+	route := l3.Route{}
+	err = json.Unmarshal([]byte(mr.HGet(testPrefix+"routes", "10.10.0.0/16")), &route)
+	if err != nil || len(route.Ports) != 1 || route.Ports[0].Name != "VLAN10" {
+		t.Fatalf("route = %+v %v", route, err)
+	}
+	if mr.HGet(testPrefix+"vlanifaces", "VLAN10") == "" {
+		t.Fatal("no vlan interface in mirror")
+	}
+}
+
+func TestMirror(t *testing.T) {
+	s, mr, h := newTestStore(t)
+	ctx := context.Background()
+	key := testPrefix + "mac:10"
+
+	err := s.mirror(ctx, controlplane.Event{Type: controlplane.EventMACLearned, VLAN: 10, MAC: hostB.String(), Port: "p2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if port := mr.HGet(key, hostB.String()); port != "p2" {
+		t.Fatalf("learned mac on %q. want p2", port)
+	}
+	err = s.mirror(ctx, controlplane.Event{Type: controlplane.EventMACAged, VLAN: 10, MAC: hostB.String(), Port: "p2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mr.HGet(key, hostB.String()) != "" {
+		t.Fatal("aged mac left in mirror")
+	}
+
+	// a flush rewrites the mirror from the table
+	learn(t, h)
+	mr.HSet(key, hostB.String(), "p2")
+	_, err = l2.ClearMACs(h.Switch, l2.MACQuery{Port: "p1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.mirror(ctx, controlplane.Event{Type: controlplane.EventMACFlushed, Port: "p1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mr.Exists(key) {
+		keys, _ := mr.HKeys(key)
+		t.Fatalf("flushed macs left in mirror: %v", keys)
+	}
+}
+
+func TestApplyPorts(t *testing.T) {
+	s, mr, h := newTestStore(t)
+	ctx := context.Background()
+
+	mr.HSet(testPrefix+"config:ports", "p2", "down")
+	err := s.Apply(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := h.Switch.PortInfo("p2")
+	if err != nil || info.Up {
+		t.Fatalf("port p2 = %+v %v. want down", info, err)
+	}
+
+	mr.HSet(testPrefix+"config:ports", "p2", "up")
+	err = s.Apply(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err = h.Switch.PortInfo("p2")
+	if err != nil || !info.Up {
+		t.Fatalf("port p2 = %+v %v. want up", info, err)
+	}
+}
+
+func TestApplyKeepsErrDisabledPortDown(t *testing.T) {
+	s, mr, h := newTestStore(t)
+	ctx := context.Background()
+
+	err := h.Switch.ErrDisablePort("p2", dataplane.ERRDISABLE_PORT_SECURITY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mr.HSet(testPrefix+"config:ports", "p2", "up")
+	err = s.Apply(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := h.Switch.PortInfo("p2")
+	if err != nil || info.Up || info.ErrDisabled == nil {
+		t.Fatalf("port p2 = %+v %v. want err-disabled", info, err)
+	}
+}
+
+func TestApplyRoutes(t *testing.T) {
+	s, mr, h := newTestStore(t)
+	ctx := context.Background()
+	routes := func() map[string]l3.Route {
+		table, err := h.Switch.ProcTable(3, "Routing")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return table.(l3.RoutingTable).Routes
+	}
+
+	mr.HSet(testPrefix+"config:routes", "10.20.0.0/16", `{"Ports": [{"Name": "VLAN10", "NextHop": "10.10.1.254"}]}`)
+	err := s.Apply(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	route, ok := routes()["10.20.0.0/16"]
+	if !ok || len(route.Ports) != 1 || route.Ports[0].NextHop != "10.10.1.254" {
+		t.Fatalf("route from redis = %+v %v", route, ok)
+	}
+
+	mr.HDel(testPrefix+"config:routes", "10.20.0.0/16")
+	err = s.Apply(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	current := routes()
+	if _, ok := current["10.20.0.0/16"]; ok {
+		t.Fatal("route removed from config:routes is still in the table")
+	}
+	if _, ok := current["10.10.0.0/16"]; !ok {
+		t.Fatal("route of the config file removed")
+	}
+}
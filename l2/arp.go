@@ -1,20 +1,27 @@
 package l2
 
 import (
+	"bytes"
+	"context"
+	"fmt"
 	"io/ioutil"
-	"log"
+	"log/slog"
 	"net"
+	"sort"
 	"sync"
 	"time"
 
 	"github.com/BurntSushi/toml"
 	"github.com/m-motawea/gSwitch/controlplane"
 	"github.com/m-motawea/gSwitch/dataplane"
+	"github.com/m-motawea/gSwitch/logging"
 	"github.com/m-motawea/pipeline"
 	"github.com/mdlayher/arp"
 	"github.com/mdlayher/ethernet"
 )
 
+var arpLog = logging.ProcLogger(2, "ARP")
+
 const ARP_EXPIRE_TIME = 60 * time.Second
 const ARP_REQUEST_WAIT_TIME = 3 * time.Second
 
@@ -47,10 +54,11 @@ type SwitchARPTable struct {
 	ARPTable        map[string]*ARPEntry   // IP to one ARP Entry
 	InverseARPTable map[string][]*ARPEntry // MAC to multiple ARP Entries
 	rwMutex         *sync.RWMutex
+	events          *controlplane.EventBus
 }
 
 func (at *SwitchARPTable) SetEntry(ip net.IP, mac net.HardwareAddr, port *dataplane.SwitchPort) *ARPEntry {
-	log.Printf("ARP Process: Setting Entry for IP: %v, MAC: %v, PORT: %v", ip, mac, port)
+	arpLog.Debug("setting entry", "ip", ip, "mac", mac, "port", port.Name)
 	t := time.Now()
 	ent := ARPEntry{
 		IP:            ip,
@@ -64,6 +72,14 @@ func (at *SwitchARPTable) SetEntry(ip net.IP, mac net.HardwareAddr, port *datapl
 	defer at.rwMutex.Unlock()
 	at.rwMutex.Lock()
 
+	old, ok := at.ARPTable[ip.String()]
+	if ok {
+		if bytes.Equal(old.MAC, mac) && old.Port == port {
+			old.Refresh()
+			return old
+		}
+		at.delEntry(ip.String())
+	}
 	at.ARPTable[ip.String()] = &ent
 	val, ok := at.InverseARPTable[strMAc]
 	if !ok {
@@ -71,6 +87,12 @@ func (at *SwitchARPTable) SetEntry(ip net.IP, mac net.HardwareAddr, port *datapl
 	}
 	val = append(val, &ent)
 	at.InverseARPTable[strMAc] = val
+	at.events.Publish(controlplane.Event{
+		Type: controlplane.EventARPAdded,
+		Port: port.Name,
+		MAC:  strMAc,
+		IP:   ip.String(),
+	})
 	return &ent
 }
 
@@ -86,47 +108,131 @@ func (at *SwitchARPTable) GetEntry(ip net.IP) *ARPEntry {
 }
 
 func (at *SwitchARPTable) DelEntry(ip net.IP) {
-	ipStr := ip.String()
 	defer at.rwMutex.Unlock()
 	at.rwMutex.Lock()
+	at.delEntry(ip.String())
+}
+
+// delEntry removes the entry of ipStr from both tables. the caller holds the lock
+func (at *SwitchARPTable) delEntry(ipStr string) *ARPEntry {
 	ent, ok := at.ARPTable[ipStr]
 	if !ok {
-		return
+		return nil
 	}
 	mac := ent.MAC
 	invMacList := at.InverseARPTable[mac.String()]
 
-	var index int
 	for i, invEnt := range invMacList {
 		if ent == invEnt {
-			index = i
+			invMacList = append(invMacList[:i], invMacList[i+1:]...)
 			break
 		}
 	}
-	invMacList = append(invMacList[:index], invMacList[index+1:]...)
+	if len(invMacList) == 0 {
+		delete(at.InverseARPTable, mac.String())
+	} else {
+		at.InverseARPTable[mac.String()] = invMacList
+	}
 	delete(at.ARPTable, ipStr)
+	return ent
 }
 
 func (at *SwitchARPTable) ClearExpired() {
+	expired := []net.IP{}
+	at.rwMutex.RLock()
 	for _, ent := range at.ARPTable {
-		log.Printf("ARP Process: Checking Entry %v", ent)
+		arpLog.Debug("checking entry", "ip", ent.IP, "mac", ent.MAC)
 		if ent.IsExpired() {
-			log.Printf("ARP Process: Entry %v Expired. Clearing..", ent)
-			at.DelEntry(ent.IP)
+			expired = append(expired, ent.IP)
+		}
+	}
+	at.rwMutex.RUnlock()
+	for _, ip := range expired {
+		arpLog.Debug("entry expired. clearing", "ip", ip)
+		at.rwMutex.Lock()
+		ent := at.delEntry(ip.String())
+		at.rwMutex.Unlock()
+		if ent == nil {
+			continue
 		}
+		port := ""
+		if ent.Port != nil {
+			port = ent.Port.Name
+		}
+		at.events.Publish(controlplane.Event{
+			Type: controlplane.EventARPExpired,
+			Port: port,
+			MAC:  ent.MAC.String(),
+			IP:   ip.String(),
+		})
 	}
 }
 
-func (at *SwitchARPTable) CheckAndClear() {
-	log.Println("ARP Process: Starting ARP Table Check and Clear Routine..")
+func (at *SwitchARPTable) CheckAndClear(ctx context.Context) {
+	arpLog.Info("starting arp table aging routine")
+	defer arpLog.Info("arp table aging routine stopped")
+	ticker := time.NewTicker(MAC_EXPIRE_TIME)
+	defer ticker.Stop()
 	for {
-		timer := time.NewTimer(MAC_EXPIRE_TIME)
-		<-timer.C
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
 		at.ClearExpired()
-		log.Printf("ARP Process: current ARP Table %v", at.ARPTable)
+		arpLog.Debug("arp table aged", "entries", at.Size())
 	}
 }
 
+func (at *SwitchARPTable) Size() int {
+	defer at.rwMutex.RUnlock()
+	at.rwMutex.RLock()
+	return len(at.ARPTable)
+}
+
+type ARPTableEntry struct {
+	IP   string
+	MAC  string
+	Port string
+	Age  float64 // seconds since the entry was last refreshed
+}
+
+// Entries lists the entries sorted by ip
+func (at *SwitchARPTable) Entries() []ARPTableEntry {
+	defer at.rwMutex.RUnlock()
+	at.rwMutex.RLock()
+	entries := []ARPTableEntry{}
+	for ip, ent := range at.ARPTable {
+		port := ""
+		if ent.Port != nil {
+			port = ent.Port.Name
+		}
+		entries = append(entries, ARPTableEntry{
+			IP:   ip,
+			MAC:  ent.MAC.String(),
+			Port: port,
+			Age:  time.Since(ent.LastRefreshed).Seconds(),
+		})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return bytes.Compare(net.ParseIP(entries[i].IP), net.ParseIP(entries[j].IP)) < 0
+	})
+	return entries
+}
+
+func (at *SwitchARPTable) Flush() {
+	defer at.rwMutex.Unlock()
+	at.rwMutex.Lock()
+	// the table is stored by value so the maps are cleared in place
+	for ip := range at.ARPTable {
+		delete(at.ARPTable, ip)
+	}
+	for mac := range at.InverseARPTable {
+		delete(at.InverseARPTable, mac)
+	}
+	at.events.Publish(controlplane.Event{Type: controlplane.EventARPFlushed})
+}
+
 func (at *SwitchARPTable) Init() {
 	at.ARPTable = make(map[string]*ARPEntry)
 	at.InverseARPTable = make(map[string][]*ARPEntry)
@@ -136,13 +242,13 @@ func readConfig(path string) (ARPConfig, error) {
 	confBin, err := ioutil.ReadFile(path)
 	var config ARPConfig
 	if err != nil {
-		log.Println("ARP Process failed to open config file: ", path)
+		arpLog.Error("failed to open config file", "path", path, "error", err)
 		return config, err
 	}
 	confStr := string(confBin)
 	_, err = toml.Decode(confStr, &config)
 	if err != nil {
-		log.Printf("ARP Process failed to decode config: %s due to error %v", path, err)
+		arpLog.Error("failed to decode config", "path", path, "error", err)
 		return config, err
 	}
 	return config, nil
@@ -150,43 +256,88 @@ func readConfig(path string) (ARPConfig, error) {
 
 func init() {
 	ARPProcFuncPair := controlplane.ControlProcessFuncPair{
-		InFunc:  ReplyARPIn,
-		OutFunc: ResolveARPOut,
-		Init:    InitARP,
+		InFunc:   ReplyARPIn,
+		OutFunc:  ResolveARPOut,
+		Init:     InitARP,
+		Gauges:   ARPGauges,
+		Dump:     ARPDump,
+		Flush:    ARPFlush,
+		Reload:   ReloadARP,
+		Requires: []string{"forwarding"}, // replies are sent out by the forwarding process
+		Provides: []string{"arp"},
 	}
 
 	controlplane.RegisterLayerProc(2, "ARP", ARPProcFuncPair)
 }
 
 func InitARP(sw *controlplane.Switch) {
-	log.Println("Starting ARP Process")
+	arpLog.Info("starting process")
 	stor := sw.Stor.GetStor(2, "ARP")
-	log.Printf("ARP Process Config file path: %v", stor["ConfigFile"])
-	if stor["ConfigFile"] == nil {
-		stor["CONFIG"] = ARPConfig{
-			LocalAddresses: map[string]LocalAddress{},
-		}
-	} else {
-		path, ok := stor["ConfigFile"].(string)
-		if !ok {
-			stor["CONFIG"] = ARPConfig{
-				LocalAddresses: map[string]LocalAddress{},
-			}
-		} else {
-			conf, err := readConfig(path)
-			if err != nil {
-				stor["CONFIG"] = ARPConfig{
-					LocalAddresses: map[string]LocalAddress{},
-				}
-			} else {
-				stor["CONFIG"] = conf
-			}
+	path := stor.ConfigFile()
+	arpLog.Info("config file", "path", path)
+	conf := ARPConfig{}
+	if path != "" {
+		var err error
+		conf, err = readConfig(path)
+		if err != nil {
+			conf = ARPConfig{}
 		}
 	}
-	arpTable := SwitchARPTable{rwMutex: &sync.RWMutex{}}
+	if conf.LocalAddresses == nil {
+		conf.LocalAddresses = map[string]LocalAddress{}
+	}
+	stor.SetConfig(conf)
+	arpTable := &SwitchARPTable{rwMutex: &sync.RWMutex{}, events: sw.Events}
 	arpTable.Init()
-	stor["Table"] = arpTable
-	go arpTable.CheckAndClear()
+	controlplane.Set(stor, "Table", arpTable)
+	stor.Go(arpTable.CheckAndClear)
+}
+
+// ReloadARP re-reads the local addresses. the ARP table is kept
+func ReloadARP(sw *controlplane.Switch, path string) error {
+	conf := ARPConfig{}
+	if path != "" {
+		var err error
+		conf, err = readConfig(path)
+		if err != nil {
+			return err
+		}
+	}
+	if conf.LocalAddresses == nil {
+		conf.LocalAddresses = map[string]LocalAddress{}
+	}
+	arpLog.Info("config reloaded", "config", conf)
+	sw.Stor.GetStor(2, "ARP").SetConfig(conf)
+	return nil
+}
+
+func ARPGauges(sw *controlplane.Switch) []controlplane.ProcGauge {
+	table, ok := controlplane.Get[*SwitchARPTable](sw.Stor.GetStor(2, "ARP"), "Table")
+	if !ok {
+		return nil
+	}
+	return []controlplane.ProcGauge{{
+		Name:  "arp_table_entries",
+		Help:  "Number of entries in the ARP table.",
+		Value: float64(table.Size()),
+	}}
+}
+
+func ARPDump(sw *controlplane.Switch) interface{} {
+	table, ok := controlplane.Get[*SwitchARPTable](sw.Stor.GetStor(2, "ARP"), "Table")
+	if !ok {
+		return []ARPTableEntry{}
+	}
+	return table.Entries()
+}
+
+func ARPFlush(sw *controlplane.Switch) error {
+	table, ok := controlplane.Get[*SwitchARPTable](sw.Stor.GetStor(2, "ARP"), "Table")
+	if !ok {
+		return fmt.Errorf("%w: L2:ARP", controlplane.ErrNoProc)
+	}
+	table.Flush()
+	return nil
 }
 
 func ReplyARPIn(proc pipeline.PipelineProcess, msg pipeline.PipelineMessage) pipeline.PipelineMessage {
@@ -200,34 +351,40 @@ func ReplyARPIn(proc pipeline.PipelineProcess, msg pipeline.PipelineMessage) pip
 
 	msgContent, _ := msg.Content.(controlplane.ControlMessage)
 	stor := msgContent.ParentSwitch.Stor.GetStor(2, "ARP")
-	config, ok := stor["CONFIG"].(ARPConfig)
+	config, ok := controlplane.GetConfig[ARPConfig](stor)
 	if !ok {
-		log.Println("ARP Config is not correct")
+		arpLog.Error("config is not correct", "config", stor.Config())
 		return msg
 	}
 
 	frame := msgContent.InFrame.FRAME
-	log.Printf("ARP Reply proc Frame of Type %v", frame.EtherType.String())
+	// every frame passes here. only format it when it is logged
+	if arpLog.Enabled(context.Background(), slog.LevelDebug) {
+		arpLog.Debug("ingress frame", "ethertype", frame.EtherType.String())
+	}
 	if frame.EtherType == ethernet.EtherTypeARP {
-		log.Println("ARP Process: this is arp frame.")
 		p := new(arp.Packet)
 		if err := p.UnmarshalBinary(frame.Payload); err != nil {
-			log.Println("ARP Process Received invalid ARP Packet")
+			arpLog.Debug("received invalid arp packet", "error", err)
 			return msg
 		}
 
-		table := stor["Table"].(SwitchARPTable)
+		table, ok := controlplane.Get[*SwitchARPTable](stor, "Table")
+		if !ok {
+			arpLog.Error("no arp table")
+			return msg
+		}
 		targetIP := p.TargetIP.String()
 		sender := p.SenderIP.String()
 
 		if p.Operation == arp.OperationReply {
-			log.Println("ARP Process: This is ARP Request")
+			arpLog.Debug("received arp reply", "sender", sender)
 			// ARP Reply
 			// if it is from a local address drop
 			Valid := true
 			for _, addr := range config.LocalAddresses {
 				if addr.IP == sender {
-					log.Printf("ARP Process: This is ARP Request from My IP: %v", addr.IP)
+					arpLog.Debug("arp packet from a local address. dropping", "ip", addr.IP)
 					Valid = false
 					msg.Drop = true
 				}
@@ -241,11 +398,11 @@ func ReplyARPIn(proc pipeline.PipelineProcess, msg pipeline.PipelineMessage) pip
 			// ARP Request
 			// Add Sender MAC and IP to ARP table
 			// if arp request from me drop it
-			log.Println("ARP Process: This is ARP Request")
+			arpLog.Debug("received arp request", "sender", sender)
 			Valid := true
 			for _, addr := range config.LocalAddresses {
 				if addr.IP == sender {
-					log.Printf("ARP Process: This is ARP Request from My IP: %v", addr.IP)
+					arpLog.Debug("arp packet from a local address. dropping", "ip", addr.IP)
 					Valid = false
 					msg.Drop = true
 				}
@@ -256,18 +413,17 @@ func ReplyARPIn(proc pipeline.PipelineProcess, msg pipeline.PipelineMessage) pip
 			}
 		}
 
-		log.Printf("ARP Process: Target IP: %s", targetIP)
+		arpLog.Debug("arp target", "ip", targetIP)
 
 		for iface, addr := range config.LocalAddresses {
-			log.Printf("ARP Process: checking addr: %s", addr.IP)
 			mac, err := net.ParseMAC(addr.MAC)
 			if err != nil {
-				log.Printf("ARP Process: invalid local mac %s", addr.MAC)
+				arpLog.Error("invalid local mac", "interface", iface, "mac", addr.MAC)
 				// msg.Drop = true
 				return msg
 			}
 			if addr.IP == targetIP {
-				log.Printf("ARP Process replying with address of %s", iface)
+				arpLog.Debug("replying with local address", "interface", iface)
 				replyPacket, err := arp.NewPacket(
 					arp.OperationReply,
 					mac,
@@ -276,14 +432,14 @@ func ReplyARPIn(proc pipeline.PipelineProcess, msg pipeline.PipelineMessage) pip
 					net.ParseIP(targetIP),
 				)
 				if err != nil {
-					log.Printf("ARP Process: Failed to create the reply packet err: %v", err)
+					arpLog.Warn("failed to create reply packet", "error", err)
 					msg.Drop = true
 					return msg
 				}
 
 				pb, err := replyPacket.MarshalBinary()
 				if err != nil {
-					log.Printf("ARP Process: Failed to marshal reply packet err: %v", err)
+					arpLog.Warn("failed to marshal reply packet", "error", err)
 					msg.Drop = true
 					return msg
 				}
@@ -294,16 +450,14 @@ func ReplyARPIn(proc pipeline.PipelineProcess, msg pipeline.PipelineMessage) pip
 					Payload:     pb,
 					VLAN:        frame.VLAN,
 				}
-				log.Printf("ARP Process preparing result msg....")
 				msgContent.InFrame.FRAME = f
 				msgContent.InFrame.IN_PORT = &dataplane.SwitchPort{}
 				msg.Content = msgContent
 				msg.Finished = true
-				log.Printf("ARP Process sending result")
 				return msg
 			}
 		}
-		log.Printf("ARP Process: IP %s not a local address", targetIP)
+		arpLog.Debug("target is not a local address", "ip", targetIP)
 		msg.Finished = true
 	}
 	return msg
@@ -311,18 +465,16 @@ func ReplyARPIn(proc pipeline.PipelineProcess, msg pipeline.PipelineMessage) pip
 
 func ResolveARPOut(proc pipeline.PipelineProcess, msg pipeline.PipelineMessage) pipeline.PipelineMessage {
 	// This Processes sets the appropriate SRC and DST MAC Address for all IPv4 internal frames
-	log.Println("ARP Resolve proc...")
 	msgContent, _ := msg.Content.(controlplane.ControlMessage)
 	if msgContent.InFrame.FRAME.EtherType != ethernet.EtherTypeIPv4 {
 		return msg
 	}
-	log.Println("ARP Process: Received IPv4 Frame")
+	arpLog.Debug("resolving egress ipv4 frame")
 
 	ipPayload := msgContent.InFrame.FRAME.Payload
-	log.Printf("ARP Resolve Proc: out frame %+v", msgContent.InFrame.FRAME)
 	if len(ipPayload) < 20 {
 		// invalid IPv4 payload
-		log.Printf("ARP Process got invalid IPv4 payload")
+		arpLog.Debug("invalid ipv4 payload. dropping")
 		msg.Drop = true
 		return msg
 	}
@@ -336,27 +488,29 @@ func ResolveARPOut(proc pipeline.PipelineProcess, msg pipeline.PipelineMessage)
 	} else {
 		dstIP = net.IP(ipPayload[16:20])
 	}
-	log.Printf("ARP Process: SRC IP: %v, DST IP: %v", srcIP, dstIP)
+	arpLog.Debug("egress addresses", "src", srcIP, "dst", dstIP)
 	// if srcIP is mine set src mac and send ARP Request to get destination mac
 	stor := msgContent.ParentSwitch.Stor.GetStor(2, "ARP")
-	config, ok := stor["CONFIG"].(ARPConfig)
+	config, ok := controlplane.GetConfig[ARPConfig](stor)
 	if !ok {
-		log.Println("ARP Config is not correct")
+		arpLog.Error("config is not correct", "config", stor.Config())
 		return msg
 	}
 
 	srcIPStr := srcIP.String()
 	srcMACStr := msgContent.InFrame.FRAME.Source.String()
-	table := stor["Table"].(SwitchARPTable)
+	table, ok := controlplane.Get[*SwitchARPTable](stor, "Table")
+	if !ok {
+		arpLog.Error("no arp table")
+		return msg
+	}
 	for iface, addr := range config.LocalAddresses {
-		log.Printf("ARP Resolve Out: Comparing %s with %s", addr.IP, srcIPStr)
-		log.Printf("ARP Resolve Out: Comparing %s with %s", addr.MAC, srcMACStr)
 		if addr.IP == srcIPStr {
 			// Send ARP and wait for result before setting the destination mac
-			log.Printf("ARP Process: Setting Proper Source & Destination MAC for interface %v", iface)
+			arpLog.Debug("setting source and destination mac", "interface", iface)
 			byteMAC, err := net.ParseMAC(addr.MAC)
 			if err != nil {
-				log.Printf("ARP Process: Failed to parse mac addr of local address %v", addr)
+				arpLog.Error("invalid local mac", "interface", iface, "mac", addr.MAC)
 				msg.Drop = true
 				return msg
 			}
@@ -364,15 +518,15 @@ func ResolveARPOut(proc pipeline.PipelineProcess, msg pipeline.PipelineMessage)
 			// Search for ARP Entry for the destination IP
 			ent := table.GetEntry(dstIP)
 			if ent != nil {
-				log.Printf("ARP Process: Found ARP Entry for IP: %v, MAC: %v", dstIP, ent.MAC)
+				arpLog.Debug("found arp entry", "ip", dstIP, "mac", ent.MAC)
 				msgContent.InFrame.FRAME.Destination = ent.MAC
 				msg.Content = msgContent
 				return msg
 			}
-			log.Printf("ARP Process: Couldn't Find ARP Entry for IP: %v. trying to resolve it...", dstIP)
+			arpLog.Debug("no arp entry. resolving", "ip", dstIP)
 			dstMac := ResolveIP(srcIP, dstIP, byteMAC, msgContent.ParentSwitch, table)
 			if dstMac == nil {
-				log.Printf("ARP Process: Unable to resolve IP: %v", dstIP)
+				arpLog.Info("unable to resolve ip", "ip", dstIP)
 				msg.Drop = true
 				return msg
 			}
@@ -380,26 +534,26 @@ func ResolveARPOut(proc pipeline.PipelineProcess, msg pipeline.PipelineMessage)
 			msg.Content = msgContent
 			return msg
 		} else if addr.MAC == srcMACStr {
-			log.Printf("ARP Process: (Rotuing) Setting Proper Destination MAC and VLAN for interface %v", iface)
+			arpLog.Debug("setting destination mac of routed frame", "interface", iface)
 			// Search for ARP Entry for the destination IP
 			byteMAC, err := net.ParseMAC(addr.MAC)
 			if err != nil {
-				log.Printf("ARP Process: Failed to parse mac addr of local address %v", addr)
+				arpLog.Error("invalid local mac", "interface", iface, "mac", addr.MAC)
 				msg.Drop = true
 				return msg
 			}
 			ent := table.GetEntry(dstIP)
 			if ent != nil {
-				log.Printf("ARP Process: Found ARP Entry for IP: %v, MAC: %v", dstIP, ent.MAC)
+				arpLog.Debug("found arp entry", "ip", dstIP, "mac", ent.MAC)
 				msgContent.InFrame.FRAME.Destination = ent.MAC
 				msg.Content = msgContent
 				return msg
 			}
-			log.Printf("ARP Process: Couldn't Find ARP Entry for IP: %v. trying to resolve it...", dstIP)
+			arpLog.Debug("no arp entry. resolving", "ip", dstIP)
 			mySrcIP := net.ParseIP(addr.IP)
 			dstMac := ResolveIP(mySrcIP, dstIP, byteMAC, msgContent.ParentSwitch, table)
 			if dstMac == nil {
-				log.Printf("ARP Process: Unable to resolve IP: %v", dstIP)
+				arpLog.Info("unable to resolve ip", "ip", dstIP)
 				msg.Drop = true
 				return msg
 			}
@@ -408,11 +562,11 @@ func ResolveARPOut(proc pipeline.PipelineProcess, msg pipeline.PipelineMessage)
 			return msg
 		}
 	}
-	log.Println("ARP Resolv out: frame is not originated by me. returning msg")
+	arpLog.Debug("frame is not originated by the switch")
 	return msg
 }
 
-func ResolveIP(srcIP net.IP, dstIP net.IP, srcMAC net.HardwareAddr, sw *controlplane.Switch, table SwitchARPTable) *net.HardwareAddr {
+func ResolveIP(srcIP net.IP, dstIP net.IP, srcMAC net.HardwareAddr, sw *controlplane.Switch, table *SwitchARPTable) *net.HardwareAddr {
 	// build arp frame
 	p, err := arp.NewPacket(
 		arp.OperationRequest,
@@ -422,12 +576,12 @@ func ResolveIP(srcIP net.IP, dstIP net.IP, srcMAC net.HardwareAddr, sw *controlp
 		dstIP,
 	)
 	if err != nil {
-		log.Printf("ARP Process: Failed to build ARP Request due to error %v", err)
+		arpLog.Warn("failed to build arp request", "error", err)
 		return nil
 	}
 	pb, err := p.MarshalBinary()
 	if err != nil {
-		log.Printf("ARP Process: Failed to Marshal ARP Request due to error %v", err)
+		arpLog.Warn("failed to marshal arp request", "error", err)
 		return nil
 	}
 	f := &ethernet.Frame{
@@ -438,7 +592,7 @@ func ResolveIP(srcIP net.IP, dstIP net.IP, srcMAC net.HardwareAddr, sw *controlp
 	}
 	// send it out of all switch ports
 	ports := []*dataplane.SwitchPort{}
-	for _, p := range sw.Ports {
+	for _, p := range sw.PortMap() {
 		ports = append(ports, p)
 	}
 	go sw.SendFrame(f, ports...)
@@ -446,7 +600,7 @@ func ResolveIP(srcIP net.IP, dstIP net.IP, srcMAC net.HardwareAddr, sw *controlp
 	timeout := time.Now().Add(ARP_REQUEST_WAIT_TIME)
 	for {
 		if time.Now().Sub(timeout) > time.Second {
-			log.Printf("ARP Process: ARP Request for IP: %v Timedout.", dstIP)
+			arpLog.Debug("arp request timed out", "ip", dstIP)
 			return nil
 		}
 		ent := table.GetEntry(dstIP)
@@ -1,39 +1,46 @@
 package l2
 
 import (
-	"log"
-
 	"github.com/m-motawea/gSwitch/controlplane"
+	"github.com/m-motawea/gSwitch/dataplane"
+	"github.com/m-motawea/gSwitch/logging"
 	"github.com/m-motawea/pipeline"
 )
 
+var hubLog = logging.ProcLogger(2, "Hub")
+
 func init() {
 	HubProcFuncPair := controlplane.ControlProcessFuncPair{
-		InFunc:  HubInProc,
-		OutFunc: HubOutProc,
+		InFunc:   HubInProc,
+		OutFunc:  HubOutProc,
+		Provides: []string{"forwarding"},
 	}
 
 	controlplane.RegisterLayerProc(2, "Hub", HubProcFuncPair)
 }
 
 func HubInProc(proc pipeline.PipelineProcess, msg pipeline.PipelineMessage) pipeline.PipelineMessage {
+	msgContent, ok := msg.Content.(controlplane.ControlMessage)
+	if ok && !msgContent.InFrame.IN_PORT.VLANPortState(frameVLAN(msgContent.InFrame.FRAME)).Forwards() {
+		msgContent.InFrame.IN_PORT.Counters.Drop(dataplane.DROP_PORT_STATE)
+		msg.Drop = true
+	}
 	return msg
 }
 
 func HubOutProc(proc pipeline.PipelineProcess, msg pipeline.PipelineMessage) pipeline.PipelineMessage {
 	msgContent, ok := msg.Content.(controlplane.ControlMessage)
 	if !ok {
-		log.Println("Hub Proc Received Incompatible Message. Discarding..")
+		hubLog.Warn("received incompatible message. dropping", "content", msg.Content)
 		msg.Drop = true
 		return msg
 	}
-	log.Println("Hub Proc Received a Message.")
-	for _, port := range msgContent.ParentSwitch.Ports {
+	vlan := frameVLAN(msgContent.InFrame.FRAME)
+	for _, port := range msgContent.ParentSwitch.PortMap() {
 		if port == msgContent.InFrame.IN_PORT {
-			log.Println("Hub Proc Excluded IN PORT")
 			continue
 		}
-		if !port.Status {
+		if !port.IsUp() || !port.VLANPortState(vlan).Forwards() {
 			continue
 		}
 		msgContent.OutPorts = append(msgContent.OutPorts, port)
@@ -1,18 +1,23 @@
 package l2
 
 import (
-	"log"
-
 	"github.com/m-motawea/gSwitch/config"
 	"github.com/m-motawea/gSwitch/controlplane"
+	"github.com/m-motawea/gSwitch/logging"
 	"github.com/m-motawea/pipeline"
 )
 
+var l2AdapterLog = logging.ProcLogger(2, "L2Adapter")
+
 func init() {
 	FuncPair := controlplane.ControlProcessFuncPair{
-		InFunc:  IngressAdapter,
-		OutFunc: EgressAdapter,
-		Init:    InitL2Adapter,
+		InFunc:   IngressAdapter,
+		OutFunc:  EgressAdapter,
+		Init:     InitL2Adapter,
+		Reload:   ReloadL2Adapter,
+		Position: controlplane.PositionLast,
+		Requires: []string{"forwarding"},
+		Provides: []string{"l3-payload"},
 	}
 
 	controlplane.RegisterLayerProc(2, "L2Adapter", FuncPair)
@@ -28,36 +33,49 @@ type L2AdapterConfig struct {
 }
 
 func InitL2Adapter(sw *controlplane.Switch) {
-	log.Println("Starting L2Adapter Process")
+	l2AdapterLog.Info("starting process")
 	stor := sw.Stor.GetStor(2, "L2Adapter")
-	log.Printf("L2Adapter Process Config file path: %v", stor["ConfigFile"])
+	path := stor.ConfigFile()
+	l2AdapterLog.Info("config file", "path", path)
 	configObj := L2AdapterConfig{}
-	if stor["ConfigFile"] != nil {
-		path, ok := stor["ConfigFile"].(string)
-		if ok {
-			err := config.ReadConfigFile(path, &configObj)
-			if err != nil {
-				log.Printf("L2Adapter Process Failed to read config file due to error %v", err)
-			} else {
-				log.Printf("L2Adapter Config: %+v", configObj)
-				stor["CONFIG"] = configObj
-			}
+	if path != "" {
+		err := config.ReadConfigFile(path, &configObj)
+		if err != nil {
+			l2AdapterLog.Error("failed to read config file", "path", path, "error", err)
 		} else {
-			log.Printf("L2Adapter invalid config path specified")
+			l2AdapterLog.Info("config loaded", "config", configObj)
+			stor.SetConfig(configObj)
 		}
 	}
 }
 
+// ReloadL2Adapter re-reads the allowed addresses
+func ReloadL2Adapter(sw *controlplane.Switch, path string) error {
+	stor := sw.Stor.GetStor(2, "L2Adapter")
+	if path == "" {
+		stor.SetConfig(nil)
+		return nil
+	}
+	configObj := L2AdapterConfig{}
+	err := config.ReadConfigFile(path, &configObj)
+	if err != nil {
+		return err
+	}
+	l2AdapterLog.Info("config reloaded", "config", configObj)
+	stor.SetConfig(configObj)
+	return nil
+}
+
 func IngressAdapter(proc pipeline.PipelineProcess, msg pipeline.PipelineMessage) pipeline.PipelineMessage {
 	msgContent, _ := msg.Content.(controlplane.ControlMessage)
 	msgContent.PreMessage = msg
 	msgContent.LayerPayload = msgContent.InFrame.FRAME.Payload
-	log.Printf("L2 Adapter Ingress Next Layer Payload: %v", msgContent.LayerPayload)
+	l2AdapterLog.Debug("ingress next layer payload", "bytes", len(msgContent.InFrame.FRAME.Payload))
 	msg.Content = msgContent
 	stor := msgContent.ParentSwitch.Stor.GetStor(2, "L2Adapter")
-	config, ok := stor["CONFIG"].(L2AdapterConfig)
+	config, ok := controlplane.GetConfig[L2AdapterConfig](stor)
 	if !ok {
-		log.Printf("L2 Adapter Config is not correct %+v", stor["CONFIG"])
+		l2AdapterLog.Debug("no valid config", "config", stor.Config())
 		return msg
 	}
 	// if dst mac is not mine finish msg
@@ -73,7 +91,7 @@ func EgressAdapter(proc pipeline.PipelineProcess, msg pipeline.PipelineMessage)
 	msgContent, _ := msg.Content.(controlplane.ControlMessage)
 	lp, ok := msgContent.LayerPayload.([]byte)
 	if !ok {
-		log.Println("L2 Adapter Egress recieved invalid payload from previous process")
+		l2AdapterLog.Warn("egress received invalid payload from previous process")
 		msg.Drop = true
 		return msg
 	}
@@ -83,9 +101,9 @@ func EgressAdapter(proc pipeline.PipelineProcess, msg pipeline.PipelineMessage)
 	// msg.Content = *msgContent.PreMessage
 	msg.Content = msgContent
 	stor := msgContent.ParentSwitch.Stor.GetStor(2, "L2Adapter")
-	config, ok := stor["CONFIG"].(L2AdapterConfig)
+	config, ok := controlplane.GetConfig[L2AdapterConfig](stor)
 	if !ok {
-		log.Printf("L2 Adapter Config is not correct %+v", stor["CONFIG"])
+		l2AdapterLog.Debug("no valid config", "config", stor.Config())
 		return msg
 	}
 	// if dst mac is mine drop msg
@@ -1,208 +1,1132 @@
 package l2
 
 import (
-	"log"
+	"context"
+	"errors"
+	"fmt"
+	"hash/maphash"
 	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/m-motawea/gSwitch/config"
 	"github.com/m-motawea/gSwitch/controlplane"
 	"github.com/m-motawea/gSwitch/dataplane"
+	"github.com/m-motawea/gSwitch/logging"
 	"github.com/m-motawea/pipeline"
 	"github.com/mdlayher/ethernet"
 )
 
-const MAC_EXPIRE_TIME = 300 * time.Second
+var switchLog = logging.ProcLogger(2, "L2Switch")
+
+const MAC_EXPIRE_TIME = 300 * time.Second // aging time of vlans without one in the config
+const MAC_TABLE_SHARDS = 64
+const MAC_FLAP_MOVES = 5                 // moves of an address within MAC_FLAP_WINDOW that raise a flap alarm
+const MAC_FLAP_WINDOW = 10 * time.Second // flap detection window
+
+const MAC_DOWN_PORT_SWEEP = 5 * time.Second // how often addresses of down ports are flushed if their port_down event was dropped
+
+var ErrInvalidMAC = errors.New("invalid mac address")
+
+type MACEntryType string
+
+const (
+	MACDynamic MACEntryType = "dynamic" // learned. ages out and moves with the address
+	MACSticky  MACEntryType = "sticky"  // learned on a sticky port. kept like a static entry
+	MACStatic  MACEntryType = "static"  // configured. never ages out or moves
+)
 
 type MACEntry struct {
-	Addr          net.HardwareAddr
-	Port          *dataplane.SwitchPort
-	TimeCreated   time.Time
-	LastRefreshed time.Time
+	VLAN        int
+	Addr        string
+	Port        string // resolved on every lookup so entries outlive a re-created port
+	Type        MACEntryType
+	TimeCreated time.Time
+	lastSeen    atomic.Int64 // unix nanoseconds. refreshed without the shard write lock
+}
+
+func newMACEntry(vlan int, addr string, port string, entType MACEntryType) *MACEntry {
+	now := time.Now()
+	ent := &MACEntry{VLAN: vlan, Addr: addr, Port: port, Type: entType, TimeCreated: now}
+	ent.lastSeen.Store(now.UnixNano())
+	return ent
 }
 
 func (me *MACEntry) Refresh() {
-	me.LastRefreshed = time.Now()
+	me.lastSeen.Store(time.Now().UnixNano())
+}
+
+func (me *MACEntry) LastSeen() time.Time {
+	return time.Unix(0, me.lastSeen.Load())
+}
+
+// IsExpired reports whether a dynamic entry was not seen for aging. an aging
+// of 0 never expires
+func (me *MACEntry) IsExpired(aging time.Duration) bool {
+	if me.Type != MACDynamic || aging <= 0 {
+		return false
+	}
+	return time.Since(me.LastSeen()) >= aging
+}
+
+type macKey struct {
+	vlan int
+	addr string
 }
 
-func (me *MACEntry) IsExpired() bool {
-	return me.LastRefreshed.Add(MAC_EXPIRE_TIME).Sub(time.Now()) < time.Second
+type macShard struct {
+	mutex   *sync.RWMutex
+	entries map[macKey]*MACEntry
+	flaps   map[macKey]*macFlap // addresses that moved in their flap window
 }
 
-type MACTable struct {
-	Table map[string]*MACEntry
-	VLAN  int
+// macFlap counts the moves of an address in a flap window
+type macFlap struct {
+	start   time.Time
+	moves   int
+	alarmed bool
+	port    string // port the address last moved to
+	oldPort string
 }
 
-func (mt *MACTable) Init() {
-	mt.Table = map[string]*MACEntry{}
+// FlapSettings raise an alarm when an address moves Moves times within Window
+type FlapSettings struct {
+	Moves         int // 0 disables flap detection
+	Window        time.Duration
+	Block         bool          // err-disable the port the address moved to
+	BlockRecovery time.Duration // 0 keeps the blocked port down
 }
 
-func (mt *MACTable) GetEntry(addr string) *MACEntry {
-	ent, ok := mt.Table[addr]
+// moved counts a move of key in its flap window. alarm is set the first time
+// the moves of the window reach the threshold, and flapping while they are over it
+func (sh *macShard) moved(key macKey, port string, oldPort string, fs *FlapSettings) (moves int, alarm bool, flapping bool) {
+	if fs.Moves <= 0 {
+		return 0, false, false
+	}
+	now := time.Now()
+	flap, ok := sh.flaps[key]
+	if !ok || now.Sub(flap.start) > fs.Window {
+		flap = &macFlap{start: now}
+		sh.flaps[key] = flap
+	}
+	flap.moves++
+	flap.port, flap.oldPort = port, oldPort
+	if flap.moves < fs.Moves {
+		return flap.moves, false, false
+	}
+	if flap.alarmed {
+		return flap.moves, false, true
+	}
+	flap.alarmed = true
+	return flap.moves, true, true
+}
+
+/*
+SwitchMACTable is the MAC address table of a switch. the pipeline learns and
+looks addresses up while the aging and port flush goroutines remove them, so
+the table is split in MAC_TABLE_SHARDS shards by vlan and address, each with
+its own lock:
+
+- a lookup takes the read lock of one shard
+- refreshing an address that did not move takes the read lock too
+- learning, moving and removing an address take the write lock of its shard
+
+events are published after the shard lock is released. the learned entries
+of every port are counted for port security, under a lock taken inside the
+shard lock.
+*/
+type SwitchMACTable struct {
+	seed         maphash.Seed
+	shards       []*macShard
+	events       *controlplane.EventBus
+	learnedMutex *sync.Mutex
+	learned      map[string]int // port -> dynamic and sticky entries
+	flap         atomic.Pointer[FlapSettings]
+	moves        atomic.Uint64
+	flapAlarms   atomic.Uint64
+	onFlap       func(ev controlplane.Event) // called with every MAC_FLAP event
+}
+
+func NewSwitchMACTable(events *controlplane.EventBus) *SwitchMACTable {
+	st := &SwitchMACTable{seed: maphash.MakeSeed(), events: events, learnedMutex: &sync.Mutex{}, learned: map[string]int{}}
+	for i := 0; i < MAC_TABLE_SHARDS; i++ {
+		st.shards = append(st.shards, &macShard{mutex: &sync.RWMutex{}, entries: map[macKey]*MACEntry{}, flaps: map[macKey]*macFlap{}})
+	}
+	st.flap.Store(&FlapSettings{Moves: MAC_FLAP_MOVES, Window: MAC_FLAP_WINDOW})
+	return st
+}
+
+// SetFlapSettings changes the flap detection of the table
+func (st *SwitchMACTable) SetFlapSettings(fs FlapSettings) {
+	st.flap.Store(&fs)
+}
+
+// OnFlap sets a function called from Learn with every flap alarm. unlike
+// the MAC_FLAP event it is never dropped. it must be set before the table
+// is used
+func (st *SwitchMACTable) OnFlap(f func(ev controlplane.Event)) {
+	st.onFlap = f
+}
+
+func (st *SwitchMACTable) shard(key macKey) *macShard {
+	h := maphash.String(st.seed, key.addr) ^ uint64(key.vlan)
+	return st.shards[h%MAC_TABLE_SHARDS]
+}
+
+// countLearned adds delta to the learned entries of the port of ent. static
+// entries are not counted
+func (st *SwitchMACTable) countLearned(ent *MACEntry, delta int) {
+	if ent.Type == MACStatic {
+		return
+	}
+	defer st.learnedMutex.Unlock()
+	st.learnedMutex.Lock()
+	st.learned[ent.Port] += delta
+	if st.learned[ent.Port] <= 0 {
+		delete(st.learned, ent.Port)
+	}
+}
+
+// reserve counts one more learned entry on port unless it has limit entries
+// already. a limit of 0 has no limit
+func (st *SwitchMACTable) reserve(port string, limit int) bool {
+	defer st.learnedMutex.Unlock()
+	st.learnedMutex.Lock()
+	if limit > 0 && st.learned[port] >= limit {
+		return false
+	}
+	st.learned[port]++
+	return true
+}
+
+// Learned returns the number of dynamic and sticky entries of port
+func (st *SwitchMACTable) Learned(port string) int {
+	defer st.learnedMutex.Unlock()
+	st.learnedMutex.Lock()
+	return st.learned[port]
+}
+
+// Lookup returns the port and type of the entry of addr in vlan
+func (st *SwitchMACTable) Lookup(vlan int, addr string) (string, MACEntryType, bool) {
+	key := macKey{vlan, addr}
+	sh := st.shard(key)
+	defer sh.mutex.RUnlock()
+	sh.mutex.RLock()
+	ent, ok := sh.entries[key]
 	if !ok {
-		return nil
+		return "", "", false
 	}
-	return ent
+	return ent.Port, ent.Type, true
 }
 
-func (mt *MACTable) SetEntry(addr string, port *dataplane.SwitchPort) *MACEntry {
-	ent := mt.GetEntry(addr)
-	if ent != nil {
-		ent.Port = port
+// Learn records that addr was seen on port. the address becomes sticky if
+// sticky is set. static and sticky entries do not move to another port.
+// it returns false without learning when port has limit learned entries
+// already (0 has no limit)
+func (st *SwitchMACTable) Learn(vlan int, addr string, port string, sticky bool, limit int) bool {
+	key := macKey{vlan, addr}
+	sh := st.shard(key)
+	sh.mutex.RLock()
+	ent, ok := sh.entries[key]
+	if ok && ent.Port == port && (!sticky || ent.Type != MACDynamic) {
 		ent.Refresh()
-		return ent
+		sh.mutex.RUnlock()
+		return true
 	}
-	t := time.Now()
-	ent = &MACEntry{
-		Addr:          net.HardwareAddr(addr),
-		Port:          port,
-		TimeCreated:   t,
-		LastRefreshed: t,
+	sh.mutex.RUnlock()
+
+	entType := MACDynamic
+	if sticky {
+		entType = MACSticky
 	}
-	mt.Table[addr] = ent
-	return ent
+	ev := controlplane.Event{Type: controlplane.EventMACLearned, Port: port, VLAN: vlan, MAC: addr}
+	moves, alarm, flapping := 0, false, false
+	sh.mutex.Lock()
+	ent, ok = sh.entries[key]
+	if ok && ent.Port == port {
+		// a dynamic entry on a port that became sticky
+		ent.Refresh()
+		if ent.Type == MACDynamic && sticky {
+			ent.Type = MACSticky
+		}
+		sh.mutex.Unlock()
+		return true
+	}
+	if ok && ent.Type != MACDynamic {
+		sh.mutex.Unlock()
+		switchLog.Debug("address of a static entry seen on another port", "mac", addr, "vlan", vlan, "port", port, "entry_port", ent.Port, "type", ent.Type)
+		return true
+	}
+	// a new or moved address counts against the limit of port
+	reserved := st.reserve(port, limit)
+	switch {
+	case !reserved:
+		sh.mutex.Unlock()
+		return false
+	case !ok:
+		sh.entries[key] = newMACEntry(vlan, addr, port, entType)
+	default:
+		ev.Type = controlplane.EventMACMoved
+		ev.OldPort = ent.Port
+		st.countLearned(ent, -1)
+		sh.entries[key] = newMACEntry(vlan, addr, port, entType)
+		moves, alarm, flapping = sh.moved(key, port, ent.Port, st.flap.Load())
+	}
+	sh.mutex.Unlock()
+	st.events.Publish(ev)
+	if ev.Type == controlplane.EventMACMoved {
+		st.moves.Add(1)
+		if !flapping {
+			// a flapping address would log every frame
+			switchLog.Info("mac moved", "mac", addr, "vlan", vlan, "port", port, "old_port", ev.OldPort)
+		}
+	}
+	if alarm {
+		st.flapAlarms.Add(1)
+		switchLog.Warn("mac flapping between ports. check for a loop", "mac", addr, "vlan", vlan, "port", port, "old_port", ev.OldPort, "moves", moves)
+		flapEv := controlplane.Event{Type: controlplane.EventMACFlap, Port: port, OldPort: ev.OldPort, VLAN: vlan, MAC: addr, Moves: moves}
+		st.events.Publish(flapEv)
+		if st.onFlap != nil {
+			st.onFlap(flapEv)
+		}
+	}
+	return true
+}
+
+// ClearFlaps forgets the moves of addresses whose flap window is over
+func (st *SwitchMACTable) ClearFlaps() {
+	window := st.flap.Load().Window
+	for _, sh := range st.shards {
+		sh.mutex.Lock()
+		for key, flap := range sh.flaps {
+			if time.Since(flap.start) > window {
+				delete(sh.flaps, key)
+			}
+		}
+		sh.mutex.Unlock()
+	}
+}
+
+type FlappingMAC struct {
+	VLAN    int
+	MAC     string
+	Port    string // port the address last moved to
+	OldPort string
+	Moves   int // moves in the current window
+	Since   time.Time
+}
+
+// Flapping lists the addresses over the flap threshold in their current window
+func (st *SwitchMACTable) Flapping() []FlappingMAC {
+	window := st.flap.Load().Window
+	flapping := []FlappingMAC{}
+	for _, sh := range st.shards {
+		sh.mutex.RLock()
+		for key, flap := range sh.flaps {
+			if !flap.alarmed || time.Since(flap.start) > window {
+				continue
+			}
+			flapping = append(flapping, FlappingMAC{VLAN: key.vlan, MAC: key.addr, Port: flap.port, OldPort: flap.oldPort, Moves: flap.moves, Since: flap.start})
+		}
+		sh.mutex.RUnlock()
+	}
+	sort.Slice(flapping, func(i, j int) bool {
+		if flapping[i].VLAN != flapping[j].VLAN {
+			return flapping[i].VLAN < flapping[j].VLAN
+		}
+		return flapping[i].MAC < flapping[j].MAC
+	})
+	return flapping
 }
 
-func (mt *MACTable) DelEntry(addr string) {
-	delete(mt.Table, addr)
+// Moves returns the number of address moves and flap alarms since the table was created
+func (st *SwitchMACTable) Moves() (moves uint64, flapAlarms uint64) {
+	return st.moves.Load(), st.flapAlarms.Load()
 }
 
-func (mt *MACTable) Clear() {
-	for addr := range mt.Table {
-		mt.DelEntry(addr)
+// SetStatic adds a static entry for addr or turns its entry into one
+func (st *SwitchMACTable) SetStatic(vlan int, addr string, port string) {
+	key := macKey{vlan, addr}
+	sh := st.shard(key)
+	sh.mutex.Lock()
+	ent, ok := sh.entries[key]
+	if ok {
+		st.countLearned(ent, -1)
 	}
+	sh.entries[key] = newMACEntry(vlan, addr, port, MACStatic)
+	sh.mutex.Unlock()
+	st.events.Publish(controlplane.Event{Type: controlplane.EventMACLearned, Port: port, VLAN: vlan, MAC: addr})
 }
 
-func (mt *MACTable) ClearExpired() {
-	for addr, ent := range mt.Table {
-		if ent.IsExpired() {
-			log.Printf("Clearing entry for address %s", addr)
-			mt.DelEntry(addr)
+// ClearExpired removes the dynamic entries not seen for the aging time of their vlan
+func (st *SwitchMACTable) ClearExpired(aging func(vlan int) time.Duration) int {
+	expired := []*MACEntry{}
+	for _, sh := range st.shards {
+		sh.mutex.Lock()
+		for key, ent := range sh.entries {
+			if ent.IsExpired(aging(key.vlan)) {
+				delete(sh.entries, key)
+				st.countLearned(ent, -1)
+				expired = append(expired, ent)
+			}
 		}
+		sh.mutex.Unlock()
 	}
+	for _, ent := range expired {
+		switchLog.Debug("mac entry expired. clearing", "vlan", ent.VLAN, "mac", ent.Addr)
+		st.events.Publish(controlplane.Event{
+			Type: controlplane.EventMACAged,
+			Port: ent.Port,
+			VLAN: ent.VLAN,
+			MAC:  ent.Addr,
+		})
+	}
+	return len(expired)
 }
 
-type SwitchMACTable map[int]*MACTable
+// MACQuery selects MAC table entries. empty fields match every entry
+type MACQuery struct {
+	VLAN int // 0 for every vlan
+	Port string
+	MAC  string
+	Type MACEntryType
+}
 
-func (st SwitchMACTable) GetVlanEntry(vlan int, addr string) *MACEntry {
-	vlanTable, ok := st[vlan]
-	if !ok {
-		st[vlan] = &MACTable{VLAN: vlan}
-		st[vlan].Init()
-		return nil
+func (q MACQuery) matches(ent *MACEntry) bool {
+	return (q.VLAN == 0 || ent.VLAN == q.VLAN) &&
+		(q.Port == "" || ent.Port == q.Port) &&
+		(q.MAC == "" || ent.Addr == q.MAC) &&
+		(q.Type == "" || ent.Type == q.Type)
+}
+
+// Clear removes the entries matching q and returns how many were removed
+func (st *SwitchMACTable) Clear(q MACQuery) int {
+	n := 0
+	for _, sh := range st.shards {
+		sh.mutex.Lock()
+		for key, ent := range sh.entries {
+			if q.matches(ent) {
+				delete(sh.entries, key)
+				st.countLearned(ent, -1)
+				n++
+			}
+		}
+		sh.mutex.Unlock()
 	}
-	return vlanTable.GetEntry(addr)
+	return n
 }
 
-func (st SwitchMACTable) GetOutPort(frame *ethernet.Frame, sw *controlplane.Switch, inPort *dataplane.SwitchPort) []*dataplane.SwitchPort {
-	outPorts := []*dataplane.SwitchPort{}
-	vlanObj := frame.VLAN
-	vlan := 0
-	if vlanObj != nil {
-		vlan = int(vlanObj.ID)
+// FlushPort removes the dynamic addresses learned on a port and returns how many were removed
+func (st *SwitchMACTable) FlushPort(port string) int {
+	return st.Clear(MACQuery{Port: port, Type: MACDynamic})
+}
+
+// FlushDownPorts removes the dynamic addresses of every port isUp reports
+// down and returns how many were removed per port
+func (st *SwitchMACTable) FlushDownPorts(isUp func(port string) bool) map[string]int {
+	ports := []string{}
+	st.learnedMutex.Lock()
+	for port := range st.learned {
+		ports = append(ports, port)
+	}
+	st.learnedMutex.Unlock()
+	down := map[string]bool{}
+	for _, port := range ports {
+		if !isUp(port) {
+			down[port] = true
+		}
+	}
+	flushed := map[string]int{}
+	if len(down) == 0 {
+		return flushed
+	}
+	for _, sh := range st.shards {
+		sh.mutex.Lock()
+		for key, ent := range sh.entries {
+			if ent.Type == MACDynamic && down[ent.Port] {
+				delete(sh.entries, key)
+				st.countLearned(ent, -1)
+				flushed[ent.Port]++
+			}
+		}
+		sh.mutex.Unlock()
 	}
+	return flushed
+}
+
+// Flush removes the dynamic addresses
+func (st *SwitchMACTable) Flush() int {
+	return st.Clear(MACQuery{Type: MACDynamic})
+}
+
+type MACTableEntry struct {
+	VLAN int
+	MAC  string
+	Port string
+	Type MACEntryType
+	Age  float64 // seconds since the address was last seen
+}
+
+// Entries lists the entries matching q sorted by vlan and mac
+func (st *SwitchMACTable) Entries(q MACQuery) []MACTableEntry {
+	entries := []MACTableEntry{}
+	for _, sh := range st.shards {
+		sh.mutex.RLock()
+		for _, ent := range sh.entries {
+			if !q.matches(ent) {
+				continue
+			}
+			entries = append(entries, MACTableEntry{
+				VLAN: ent.VLAN,
+				MAC:  ent.Addr,
+				Port: ent.Port,
+				Type: ent.Type,
+				Age:  time.Since(ent.LastSeen()).Seconds(),
+			})
+		}
+		sh.mutex.RUnlock()
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].VLAN != entries[j].VLAN {
+			return entries[i].VLAN < entries[j].VLAN
+		}
+		return entries[i].MAC < entries[j].MAC
+	})
+	return entries
+}
+
+// Sizes returns the number of entries per vlan
+func (st *SwitchMACTable) Sizes() map[int]int {
+	sizes := map[int]int{}
+	for _, sh := range st.shards {
+		sh.mutex.RLock()
+		for key := range sh.entries {
+			sizes[key.vlan]++
+		}
+		sh.mutex.RUnlock()
+	}
+	return sizes
+}
+
+func frameVLAN(frame *ethernet.Frame) int {
+	if frame.VLAN == nil {
+		return 0
+	}
+	return int(frame.VLAN.ID)
+}
+
+// GetOutPort returns the port of the destination address of the frame, or
+// the forwarding ports of its vlan when the address is unknown or its port
+// does not forward in the vlan. frames to a static address whose port is
+// gone or does not forward are dropped.
+func (st *SwitchMACTable) GetOutPort(frame *ethernet.Frame, sw *controlplane.Switch, inPort *dataplane.SwitchPort) []*dataplane.SwitchPort {
+	vlan := frameVLAN(frame)
 	addr := frame.Destination.String()
-	log.Printf("Getting OutPort for addr %s, vlan %d", addr, vlan)
-	entry := st.GetVlanEntry(vlan, addr)
-	if entry != nil {
-		outPorts = append(outPorts, entry.Port)
-	} else {
-		log.Println("Couldn't find Entry!")
-		outPorts = getVlanPorts(vlan, sw.Ports, inPort)
+	switchLog.Debug("looking up out port", "mac", addr, "vlan", vlan)
+	name, entType, ok := st.Lookup(vlan, addr)
+	if ok {
+		port, found := sw.PortMap()[name]
+		if found && port.VLANPortState(vlan).Forwards() {
+			return []*dataplane.SwitchPort{port}
+		}
+		if entType != MACDynamic {
+			switchLog.Debug("port of static entry not found or not forwarding. dropping", "mac", addr, "vlan", vlan, "port", name)
+			return []*dataplane.SwitchPort{}
+		}
 	}
-	log.Printf("Out Ports: %v", outPorts)
-	return outPorts
+	switchLog.Debug("no mac entry. flooding vlan", "mac", addr, "vlan", vlan)
+	return getVlanPorts(vlan, sw.PortMap(), inPort)
 }
 
 func getVlanPorts(vlan int, ports map[string]*dataplane.SwitchPort, inPort *dataplane.SwitchPort) []*dataplane.SwitchPort {
 	res := []*dataplane.SwitchPort{}
 	for _, port := range ports {
-		if port == inPort {
-			log.Printf("L2 Switch excluded IN_Port %v", inPort)
+		if port == inPort || !port.VLANPortState(vlan).Forwards() {
 			continue
 		}
-		if port.Trunk {
-			for _, id := range port.AllowedVLANs {
-				if vlan == id {
-					res = append(res, port)
-				}
-			}
-		} else {
-			if port.VLAN == vlan {
-				res = append(res, port)
-			}
+		if port.AllowsVLAN(vlan) {
+			res = append(res, port)
 		}
 	}
 	return res
 }
 
-func (st SwitchMACTable) SetInPort(frame *ethernet.Frame, inPort *dataplane.SwitchPort) *MACEntry {
-	vlanObj := frame.VLAN
-	vlan := 0
-	if vlanObj != nil {
-		vlan = int(vlanObj.ID)
+// SetInPort learns the source address of the frame. an event is published
+// when the address is new or moved to another port. it returns false when
+// the port security of inPort does not allow the address
+func (st *SwitchMACTable) SetInPort(frame *ethernet.Frame, inPort *dataplane.SwitchPort, sticky bool) bool {
+	vlan := frameVLAN(frame)
+	addr := frame.Source.String()
+	switchLog.Debug("learning mac", "port", inPort.Name, "mac", addr, "vlan", vlan)
+	limit := 0
+	security := inPort.Security()
+	if security != nil {
+		if !security.Allows(addr) {
+			return false
+		}
+		limit = security.MaxMACs
 	}
+	return st.Learn(vlan, addr, inPort.Name, sticky, limit)
+}
+
+// securityViolation applies the violation action of the port security of
+// inPort to a frame whose source address it does not allow
+func securityViolation(sw *controlplane.Switch, inPort *dataplane.SwitchPort, frame *ethernet.Frame) {
+	security := inPort.Security()
+	vlan := frameVLAN(frame)
 	addr := frame.Source.String()
-	log.Printf("Setting MAC Entry for in Frame port %s, addr %s, vlan %d", inPort.Name, addr, vlan)
-	vlanTable, ok := st[vlan]
-	if !ok {
-		vlanTable = &MACTable{}
-		st[vlan] = vlanTable
-		st[vlan].Init()
+	inPort.Counters.Drop(dataplane.DROP_PORT_SECURITY)
+	if security == nil || security.Violation == dataplane.VIOLATION_PROTECT {
+		return
+	}
+	inPort.Counters.Violation(vlan, addr)
+	switchLog.Warn("port security violation", "port", inPort.Name, "mac", addr, "vlan", vlan, "action", security.Violation)
+	sw.Events.Publish(controlplane.Event{Type: controlplane.EventPortSecurity, Port: inPort.Name, VLAN: vlan, MAC: addr})
+	if security.Violation == dataplane.VIOLATION_SHUTDOWN {
+		// the port waits for the pipeline to take its frames before it goes down
+		go func() {
+			err := sw.ErrDisablePort(inPort.Name, dataplane.ERRDISABLE_PORT_SECURITY, security.Recovery)
+			if err != nil {
+				switchLog.Error("failed to err-disable port", "port", inPort.Name, "error", err)
+			}
+		}()
 	}
-	return vlanTable.SetEntry(addr, inPort)
 }
 
-func (st SwitchMACTable) CheckAndClearLoop() {
-	log.Println("starting MACTable Check Routine")
+// CheckAndClearLoop ages the dynamic entries out. it checks the table twice
+// within the shortest aging time of the config
+func (st *SwitchMACTable) CheckAndClearLoop(ctx context.Context, settings func() *MACSettings) {
+	switchLog.Info("starting mac table aging routine")
+	defer switchLog.Info("mac table aging routine stopped")
 	for {
-		timer := time.NewTimer(MAC_EXPIRE_TIME)
-		<-timer.C
-		for _, t := range st {
-			t.ClearExpired() // TODO use go?
+		s := settings()
+		timer := time.NewTimer(s.checkInterval())
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		st.ClearExpired(s.AgingTime)
+		st.ClearFlaps()
+	}
+}
+
+// FlushDownPortsLoop removes the dynamic addresses of ports that go down or
+// are removed so their frames are flooded instead of sent to a dead port.
+// port_down events can be dropped so the ports isUp reports down are also
+// swept every MAC_DOWN_PORT_SWEEP
+func (st *SwitchMACTable) FlushDownPortsLoop(ctx context.Context, isUp func(port string) bool) {
+	sub := st.events.Subscribe(0, controlplane.EventPortDown)
+	defer sub.Close()
+	ticker := time.NewTicker(MAC_DOWN_PORT_SWEEP)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ev := <-sub.C:
+			st.portFlushed(ev.Port, st.FlushPort(ev.Port))
+		case <-ticker.C:
+			for port, n := range st.FlushDownPorts(isUp) {
+				st.portFlushed(port, n)
+			}
+		}
+	}
+}
+
+func (st *SwitchMACTable) portFlushed(port string, n int) {
+	if n > 0 {
+		switchLog.Info("flushed addresses of down port", "port", port, "entries", n)
+		st.events.Publish(controlplane.Event{Type: controlplane.EventMACFlushed, Port: port})
+	}
+}
+
+type VLANAgingConfig struct {
+	VLAN         int
+	AgingSeconds int // 0 disables aging in the vlan
+}
+
+type StaticMACConfig struct {
+	VLAN int
+	MAC  string
+	Port string
+}
+
+type MACFlapConfig struct {
+	Moves         *int // moves of an address within WindowSeconds that raise an alarm. 0 disables detection. MAC_FLAP_MOVES if not set
+	WindowSeconds int  // MAC_FLAP_WINDOW if not set
+	BlockPort     bool // err-disable the port the address moved to when the alarm is raised
+	BlockSeconds  int  // bring the blocked port back up after this. 0 keeps it down
+}
+
+type L2SwitchConfig struct {
+	AgingSeconds *int // aging time of the vlans not in VLANAging. 0 disables aging. MAC_EXPIRE_TIME if not set
+	VLANAging    []VLANAgingConfig
+	StickyPorts  []string // addresses learned on these ports become sticky
+	Static       []StaticMACConfig
+	Flap         MACFlapConfig
+}
+
+// MACSettings is the L2SwitchConfig in the form the pipeline reads it
+type MACSettings struct {
+	Aging       time.Duration
+	VLANAging   map[int]time.Duration
+	StickyPorts map[string]bool
+	Static      []StaticMACConfig
+	Flap        FlapSettings
+}
+
+func defaultMACSettings() *MACSettings {
+	return &MACSettings{
+		Aging:       MAC_EXPIRE_TIME,
+		VLANAging:   map[int]time.Duration{},
+		StickyPorts: map[string]bool{},
+		Flap:        FlapSettings{Moves: MAC_FLAP_MOVES, Window: MAC_FLAP_WINDOW},
+	}
+}
+
+// AgingTime returns the aging time of vlan. 0 if its entries never age
+func (s *MACSettings) AgingTime(vlan int) time.Duration {
+	aging, ok := s.VLANAging[vlan]
+	if ok {
+		return aging
+	}
+	return s.Aging
+}
+
+func (s *MACSettings) checkInterval() time.Duration {
+	shortest := s.Aging
+	for _, aging := range s.VLANAging {
+		if aging > 0 && (shortest <= 0 || aging < shortest) {
+			shortest = aging
 		}
 	}
+	if shortest <= 0 {
+		shortest = MAC_EXPIRE_TIME
+	}
+	return max(shortest/2, time.Second)
+}
+
+func normalizeMAC(mac string) (string, error) {
+	addr, err := net.ParseMAC(mac)
+	if err != nil || len(addr) != 6 {
+		return "", fmt.Errorf("%w: %q", ErrInvalidMAC, mac)
+	}
+	return addr.String(), nil
+}
+
+func parseL2SwitchConfig(conf L2SwitchConfig) (*MACSettings, error) {
+	s := defaultMACSettings()
+	if conf.AgingSeconds != nil {
+		if *conf.AgingSeconds < 0 {
+			return nil, fmt.Errorf("invalid aging time %d", *conf.AgingSeconds)
+		}
+		s.Aging = time.Duration(*conf.AgingSeconds) * time.Second
+	}
+	for _, vlanAging := range conf.VLANAging {
+		if vlanAging.AgingSeconds < 0 {
+			return nil, fmt.Errorf("invalid aging time %d of vlan %d", vlanAging.AgingSeconds, vlanAging.VLAN)
+		}
+		s.VLANAging[vlanAging.VLAN] = time.Duration(vlanAging.AgingSeconds) * time.Second
+	}
+	for _, port := range conf.StickyPorts {
+		s.StickyPorts[port] = true
+	}
+	if conf.Flap.Moves != nil {
+		if *conf.Flap.Moves < 0 {
+			return nil, fmt.Errorf("invalid flap moves %d", *conf.Flap.Moves)
+		}
+		s.Flap.Moves = *conf.Flap.Moves
+	}
+	if conf.Flap.WindowSeconds < 0 || conf.Flap.BlockSeconds < 0 {
+		return nil, fmt.Errorf("invalid flap window %d or block time %d", conf.Flap.WindowSeconds, conf.Flap.BlockSeconds)
+	}
+	if conf.Flap.WindowSeconds > 0 {
+		s.Flap.Window = time.Duration(conf.Flap.WindowSeconds) * time.Second
+	}
+	s.Flap.Block = conf.Flap.BlockPort
+	s.Flap.BlockRecovery = time.Duration(conf.Flap.BlockSeconds) * time.Second
+	for _, static := range conf.Static {
+		mac, err := normalizeMAC(static.MAC)
+		if err != nil {
+			return nil, err
+		}
+		if static.Port == "" {
+			return nil, fmt.Errorf("static entry %s of vlan %d has no port", mac, static.VLAN)
+		}
+		s.Static = append(s.Static, StaticMACConfig{VLAN: static.VLAN, MAC: mac, Port: static.Port})
+	}
+	return s, nil
+}
+
+func readL2SwitchConfig(path string) (*MACSettings, error) {
+	if path == "" {
+		return defaultMACSettings(), nil
+	}
+	conf := L2SwitchConfig{}
+	err := config.ReadConfigFile(path, &conf)
+	if err != nil {
+		return nil, err
+	}
+	return parseL2SwitchConfig(conf)
+}
+
+// applyStatic replaces the static entries of the table with the ones in s
+func applyStatic(sw *controlplane.Switch, st *SwitchMACTable, s *MACSettings) {
+	n := st.Clear(MACQuery{Type: MACStatic})
+	if n > 0 {
+		sw.Events.Publish(controlplane.Event{Type: controlplane.EventMACFlushed})
+	}
+	ports := sw.PortMap()
+	for _, static := range s.Static {
+		_, ok := ports[static.Port]
+		if !ok {
+			switchLog.Warn("port of static entry not found. frames to it are dropped until it is added", "mac", static.MAC, "vlan", static.VLAN, "port", static.Port)
+		}
+		st.SetStatic(static.VLAN, static.MAC, static.Port)
+	}
 }
 
 func init() {
 	L2SwitchProcFuncPair := controlplane.ControlProcessFuncPair{
-		InFunc:  L2SwitchInFunc,
-		OutFunc: L2SwitchOutFunc,
-		Init:    InitL2Switch,
+		InFunc:   L2SwitchInFunc,
+		OutFunc:  L2SwitchOutFunc,
+		Init:     InitL2Switch,
+		Gauges:   L2SwitchGauges,
+		Dump:     L2SwitchDump,
+		Flush:    L2SwitchFlush,
+		Reload:   ReloadL2Switch,
+		Provides: []string{"forwarding"},
 	}
 
 	controlplane.RegisterLayerProc(2, "L2Switch", L2SwitchProcFuncPair)
 }
 
 func InitL2Switch(sw *controlplane.Switch) {
-	st := SwitchMACTable{}
+	switchLog.Info("starting process")
 	stor := sw.Stor.GetStor(2, "L2Switch")
-	stor["SwitchTable"] = st
-	go st.CheckAndClearLoop()
+	path := stor.ConfigFile()
+	switchLog.Info("config file", "path", path)
+	settings, err := readL2SwitchConfig(path)
+	if err != nil {
+		switchLog.Error("failed to read config file", "path", path, "error", err)
+		settings = defaultMACSettings()
+	}
+	stor.SetConfig(settings)
+	st := NewSwitchMACTable(sw.Events)
+	st.SetFlapSettings(settings.Flap)
+	st.OnFlap(func(ev controlplane.Event) {
+		blockFlappingPort(sw, ev)
+	})
+	controlplane.Set(stor, "SwitchTable", st)
+	applyStatic(sw, st, settings)
+	stor.Go(func(ctx context.Context) {
+		st.CheckAndClearLoop(ctx, func() *MACSettings {
+			return getMACSettings(sw)
+		})
+	})
+	stor.Go(func(ctx context.Context) {
+		st.FlushDownPortsLoop(ctx, func(name string) bool {
+			port, ok := sw.PortMap()[name]
+			return ok && port.IsUp()
+		})
+	})
+}
+
+// blockFlappingPort err-disables the port a flapping address moved to when
+// the config asks for it
+func blockFlappingPort(sw *controlplane.Switch, ev controlplane.Event) {
+	fs := getMACSettings(sw).Flap
+	if !fs.Block {
+		return
+	}
+	switchLog.Warn("blocking port of flapping mac", "port", ev.Port, "mac", ev.MAC, "vlan", ev.VLAN)
+	// the port waits for the pipeline to take its frames before it goes down
+	go func() {
+		err := sw.ErrDisablePort(ev.Port, dataplane.ERRDISABLE_MAC_FLAP, fs.BlockRecovery)
+		if err != nil {
+			switchLog.Error("failed to block port", "port", ev.Port, "error", err)
+		}
+	}()
+}
+
+// ReloadL2Switch re-reads the aging times, sticky ports and static entries.
+// static entries added at runtime are replaced by the ones in the file.
+// learned and sticky entries are kept
+func ReloadL2Switch(sw *controlplane.Switch, path string) error {
+	st, err := getSwitchTable(sw)
+	if err != nil {
+		return err
+	}
+	settings, err := readL2SwitchConfig(path)
+	if err != nil {
+		return err
+	}
+	sw.Stor.GetStor(2, "L2Switch").SetConfig(settings)
+	st.SetFlapSettings(settings.Flap)
+	applyStatic(sw, st, settings)
+	switchLog.Info("config reloaded", "config", settings)
+	return nil
+}
+
+func getSwitchTable(sw *controlplane.Switch) (*SwitchMACTable, error) {
+	st, ok := controlplane.Get[*SwitchMACTable](sw.Stor.GetStor(2, "L2Switch"), "SwitchTable")
+	if !ok {
+		return nil, fmt.Errorf("%w: L2:L2Switch", controlplane.ErrNoProc)
+	}
+	return st, nil
+}
+
+func getMACSettings(sw *controlplane.Switch) *MACSettings {
+	settings, ok := controlplane.GetConfig[*MACSettings](sw.Stor.GetStor(2, "L2Switch"))
+	if !ok {
+		return defaultMACSettings()
+	}
+	return settings
+}
+
+func (q MACQuery) normalize() (MACQuery, error) {
+	if q.MAC == "" {
+		return q, nil
+	}
+	mac, err := normalizeMAC(q.MAC)
+	q.MAC = mac
+	return q, err
+}
+
+// MACEntries lists the MAC table entries matching q
+func MACEntries(sw *controlplane.Switch, q MACQuery) ([]MACTableEntry, error) {
+	st, err := getSwitchTable(sw)
+	if err != nil {
+		return nil, err
+	}
+	q, err = q.normalize()
+	if err != nil {
+		return nil, err
+	}
+	return st.Entries(q), nil
+}
+
+// ClearMACs removes the MAC table entries matching q and returns how many were removed
+func ClearMACs(sw *controlplane.Switch, q MACQuery) (int, error) {
+	st, err := getSwitchTable(sw)
+	if err != nil {
+		return 0, err
+	}
+	q, err = q.normalize()
+	if err != nil {
+		return 0, err
+	}
+	n := st.Clear(q)
+	switchLog.Info("mac entries cleared", "vlan", q.VLAN, "port", q.Port, "mac", q.MAC, "type", q.Type, "entries", n)
+	if n > 0 {
+		sw.Events.Publish(controlplane.Event{Type: controlplane.EventMACFlushed, Port: q.Port, VLAN: q.VLAN, MAC: q.MAC})
+	}
+	return n, nil
+}
+
+// AddStaticMAC adds a static entry while the switch is running. it is
+// replaced by the static entries of the config file on reload
+func AddStaticMAC(sw *controlplane.Switch, vlan int, mac string, port string) error {
+	st, err := getSwitchTable(sw)
+	if err != nil {
+		return err
+	}
+	mac, err = normalizeMAC(mac)
+	if err != nil {
+		return err
+	}
+	_, err = sw.PortInfo(port)
+	if err != nil {
+		return err
+	}
+	st.SetStatic(vlan, mac, port)
+	switchLog.Info("static mac added", "vlan", vlan, "mac", mac, "port", port)
+	return nil
+}
+
+type MACMoveInfo struct {
+	Moves      uint64
+	FlapAlarms uint64
+	Flapping   []FlappingMAC
+}
+
+// MACMoves returns the address moves and flap alarms of the MAC table and the
+// addresses flapping now
+func MACMoves(sw *controlplane.Switch) (MACMoveInfo, error) {
+	st, err := getSwitchTable(sw)
+	if err != nil {
+		return MACMoveInfo{}, err
+	}
+	info := MACMoveInfo{Flapping: st.Flapping()}
+	info.Moves, info.FlapAlarms = st.Moves()
+	return info, nil
+}
+
+type PortSecurityStatus struct {
+	Port            string
+	Enabled         bool
+	MaxMACs         int      `json:",omitempty"`
+	AllowedMACs     []string `json:",omitempty"`
+	Violation       string   `json:",omitempty"`
+	RecoverySeconds int      `json:",omitempty"`
+	LearnedMACs     int
+	Counters        dataplane.SecurityCounters
+	ErrDisabled     *dataplane.ErrDisableInfo `json:",omitempty"`
+}
+
+// PortSecurity returns the port security status of the ports sorted by name.
+// every port when port is empty. no address is counted as learned when
+// L2Switch is not in the pipeline
+func PortSecurity(sw *controlplane.Switch, port string) ([]PortSecurityStatus, error) {
+	st, _ := getSwitchTable(sw)
+	infos := sw.PortInfos()
+	if port != "" {
+		info, err := sw.PortInfo(port)
+		if err != nil {
+			return nil, err
+		}
+		infos = []controlplane.PortInfo{info}
+	}
+	ports := sw.PortMap()
+	statuses := []PortSecurityStatus{}
+	for _, info := range infos {
+		swPort, ok := ports[info.Name]
+		if !ok {
+			continue
+		}
+		status := PortSecurityStatus{
+			Port:        info.Name,
+			Counters:    swPort.Counters.Snapshot().Security,
+			ErrDisabled: info.ErrDisabled,
+		}
+		if st != nil {
+			status.LearnedMACs = st.Learned(info.Name)
+		}
+		security := swPort.Security()
+		if security != nil {
+			status.Enabled = true
+			status.MaxMACs = security.MaxMACs
+			status.Violation = security.Violation
+			status.RecoverySeconds = int(security.Recovery.Seconds())
+			for mac := range security.AllowedMACs {
+				status.AllowedMACs = append(status.AllowedMACs, mac)
+			}
+			sort.Strings(status.AllowedMACs)
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+type MACAgingInfo struct {
+	AgingSeconds     int         // aging time of the vlans not in VLANAgingSeconds. 0 when entries never age
+	VLANAgingSeconds map[int]int // vlan -> aging time
+	StickyPorts      []string
+}
+
+// MACAging returns the aging times and sticky ports of the MAC table
+func MACAging(sw *controlplane.Switch) (MACAgingInfo, error) {
+	_, err := getSwitchTable(sw)
+	if err != nil {
+		return MACAgingInfo{}, err
+	}
+	s := getMACSettings(sw)
+	info := MACAgingInfo{
+		AgingSeconds:     int(s.Aging.Seconds()),
+		VLANAgingSeconds: map[int]int{},
+		StickyPorts:      []string{},
+	}
+	for vlan, aging := range s.VLANAging {
+		info.VLANAgingSeconds[vlan] = int(aging.Seconds())
+	}
+	for port := range s.StickyPorts {
+		info.StickyPorts = append(info.StickyPorts, port)
+	}
+	sort.Strings(info.StickyPorts)
+	return info, nil
+}
+
+func L2SwitchGauges(sw *controlplane.Switch) []controlplane.ProcGauge {
+	st, err := getSwitchTable(sw)
+	if err != nil {
+		return nil
+	}
+	gauges := []controlplane.ProcGauge{}
+	for vlan, size := range st.Sizes() {
+		gauges = append(gauges, controlplane.ProcGauge{
+			Name:   "mac_table_entries",
+			Help:   "Number of MAC addresses learned per VLAN.",
+			Labels: map[string]string{"vlan": strconv.Itoa(vlan)},
+			Value:  float64(size),
+		})
+	}
+	moves, flapAlarms := st.Moves()
+	gauges = append(gauges,
+		controlplane.ProcGauge{Name: "mac_moves_total", Help: "MAC addresses moved to another port since L2Switch started.", Value: float64(moves), Counter: true},
+		controlplane.ProcGauge{Name: "mac_flap_alarms_total", Help: "MAC flap alarms raised since L2Switch started.", Value: float64(flapAlarms), Counter: true},
+	)
+	return gauges
+}
+
+func L2SwitchDump(sw *controlplane.Switch) interface{} {
+	entries, err := MACEntries(sw, MACQuery{})
+	if err != nil {
+		return []MACTableEntry{}
+	}
+	return entries
+}
+
+// L2SwitchFlush removes the dynamic entries. static and sticky entries are
+// removed with ClearMACs
+func L2SwitchFlush(sw *controlplane.Switch) error {
+	_, err := ClearMACs(sw, MACQuery{Type: MACDynamic})
+	return err
 }
 
 func L2SwitchInFunc(proc pipeline.PipelineProcess, msg pipeline.PipelineMessage) pipeline.PipelineMessage {
 	// This process is used to populate the SwitchMACTable Only
 	msgContent, _ := msg.Content.(controlplane.ControlMessage)
-	stor := msgContent.ParentSwitch.Stor.GetStor(2, "L2Switch")
-	st := stor["SwitchTable"].(SwitchMACTable)
-
+	sw := msgContent.ParentSwitch
+	st, err := getSwitchTable(sw)
+	if err != nil {
+		switchLog.Error("no mac table")
+		return msg
+	}
 	inPort := msgContent.InFrame.IN_PORT
-	frame := msgContent.InFrame.FRAME
-	st.SetInPort(frame, inPort)
+	state := inPort.VLANPortState(frameVLAN(msgContent.InFrame.FRAME))
+	if !state.Learns() {
+		inPort.Counters.Drop(dataplane.DROP_PORT_STATE)
+		msg.Drop = true
+		return msg
+	}
+	if !st.SetInPort(msgContent.InFrame.FRAME, inPort, getMACSettings(sw).StickyPorts[inPort.Name]) {
+		securityViolation(sw, inPort, msgContent.InFrame.FRAME)
+		msg.Drop = true
+		return msg
+	}
+	if !state.Forwards() {
+		// a learning port only learns
+		inPort.Counters.Drop(dataplane.DROP_PORT_STATE)
+		msg.Drop = true
+	}
 	return msg
 }
 
 func L2SwitchOutFunc(proc pipeline.PipelineProcess, msg pipeline.PipelineMessage) pipeline.PipelineMessage {
 	// Selection Process for out ports
 	msgContent, _ := msg.Content.(controlplane.ControlMessage)
-	stor := msgContent.ParentSwitch.Stor.GetStor(2, "L2Switch")
-	st := stor["SwitchTable"].(SwitchMACTable)
-	frame := msgContent.InFrame.FRAME
-	inPort := msgContent.InFrame.IN_PORT
-	outPorts := st.GetOutPort(frame, msgContent.ParentSwitch, inPort)
-
-	msgContent.OutPorts = outPorts
+	st, err := getSwitchTable(msgContent.ParentSwitch)
+	if err != nil {
+		switchLog.Error("no mac table")
+		msg.Drop = true
+		return msg
+	}
+	msgContent.OutPorts = st.GetOutPort(msgContent.InFrame.FRAME, msgContent.ParentSwitch, msgContent.InFrame.IN_PORT)
 	msg.Content = msgContent
 	return msg
 }
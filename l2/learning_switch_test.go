@@ -0,0 +1,220 @@
+package l2
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/m-motawea/gSwitch/controlplane"
+)
+
+func testMAC(i int) string {
+	return fmt.Sprintf("02:00:00:00:%02x:%02x", i>>8, i&0xff)
+}
+
+func TestLearnConcurrent(t *testing.T) {
+	st := NewSwitchMACTable(controlplane.NewEventBus())
+	const workers = 16
+	const addrs = 256
+	wg := sync.WaitGroup{}
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			port := fmt.Sprintf("eth%d", w%4)
+			for i := 0; i < addrs; i++ {
+				// every worker learns the same addresses of its vlan so
+				// refreshes race with the first learn
+				if !st.Learn(10+w%2, testMAC(i), port, false, 0) {
+					t.Errorf("learn of %s on %s refused without a limit", testMAC(i), port)
+				}
+				st.Lookup(10+w%2, testMAC(i))
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	sizes := st.Sizes()
+	if sizes[10] != addrs || sizes[11] != addrs {
+		t.Fatalf("sizes = %v, want %d entries in vlans 10 and 11", sizes, addrs)
+	}
+	learned := 0
+	for w := 0; w < 4; w++ {
+		learned += st.Learned(fmt.Sprintf("eth%d", w))
+	}
+	if learned != 2*addrs {
+		t.Fatalf("learned = %d, want %d", learned, 2*addrs)
+	}
+}
+
+func TestLearnMove(t *testing.T) {
+	events := controlplane.NewEventBus()
+	sub := events.Subscribe(16, controlplane.EventMACMoved)
+	defer sub.Close()
+	st := NewSwitchMACTable(events)
+	mac := testMAC(1)
+
+	st.Learn(10, mac, "eth1", false, 0)
+	st.Learn(10, mac, "eth2", false, 0)
+
+	port, entType, ok := st.Lookup(10, mac)
+	if !ok || port != "eth2" || entType != MACDynamic {
+		t.Fatalf("lookup = %s %s %v, want eth2 dynamic", port, entType, ok)
+	}
+	if st.Learned("eth1") != 0 || st.Learned("eth2") != 1 {
+		t.Fatalf("learned eth1 = %d eth2 = %d, want 0 and 1", st.Learned("eth1"), st.Learned("eth2"))
+	}
+	if moves, _ := st.Moves(); moves != 1 {
+		t.Fatalf("moves = %d, want 1", moves)
+	}
+	select {
+	case ev := <-sub.C:
+		if ev.Port != "eth2" || ev.OldPort != "eth1" || ev.MAC != mac {
+			t.Fatalf("move event = %+v", ev)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no move event")
+	}
+}
+
+func TestLearnFlapAlarm(t *testing.T) {
+	st := NewSwitchMACTable(controlplane.NewEventBus())
+	st.SetFlapSettings(FlapSettings{Moves: 3, Window: time.Minute})
+	mac := testMAC(1)
+	for i := 0; i < 6; i++ {
+		st.Learn(10, mac, fmt.Sprintf("eth%d", i%2), false, 0)
+	}
+	moves, alarms := st.Moves()
+	if moves != 5 || alarms != 1 {
+		t.Fatalf("moves = %d alarms = %d, want 5 and 1", moves, alarms)
+	}
+	flapping := st.Flapping()
+	if len(flapping) != 1 || flapping[0].MAC != mac || flapping[0].Moves != 5 {
+		t.Fatalf("flapping = %+v", flapping)
+	}
+}
+
+func TestClearExpiredVLANAging(t *testing.T) {
+	st := NewSwitchMACTable(controlplane.NewEventBus())
+	s := defaultMACSettings()
+	s.VLANAging[10] = 50 * time.Millisecond
+	s.VLANAging[30] = 0
+
+	st.Learn(10, testMAC(1), "eth1", false, 0)
+	st.Learn(20, testMAC(2), "eth1", false, 0)
+	st.Learn(30, testMAC(3), "eth1", false, 0)
+	time.Sleep(100 * time.Millisecond)
+
+	n := st.ClearExpired(s.AgingTime)
+	if n != 1 {
+		t.Fatalf("expired = %d, want 1", n)
+	}
+	if _, _, ok := st.Lookup(10, testMAC(1)); ok {
+		t.Fatal("entry of vlan 10 not aged out")
+	}
+	if _, _, ok := st.Lookup(20, testMAC(2)); !ok {
+		t.Fatal("entry of vlan 20 aged out before the default aging time")
+	}
+	if _, _, ok := st.Lookup(30, testMAC(3)); !ok {
+		t.Fatal("entry of vlan 30 aged out with aging disabled")
+	}
+	if st.Learned("eth1") != 2 {
+		t.Fatalf("learned = %d, want 2", st.Learned("eth1"))
+	}
+}
+
+func TestStaticAndStickySurviveAging(t *testing.T) {
+	st := NewSwitchMACTable(controlplane.NewEventBus())
+	aging := func(int) time.Duration { return time.Millisecond }
+
+	st.SetStatic(10, testMAC(1), "eth1")
+	st.Learn(10, testMAC(2), "eth2", true, 0)
+	st.Learn(10, testMAC(3), "eth3", false, 0)
+	time.Sleep(10 * time.Millisecond)
+
+	if n := st.ClearExpired(aging); n != 1 {
+		t.Fatalf("expired = %d, want 1", n)
+	}
+	if _, entType, ok := st.Lookup(10, testMAC(1)); !ok || entType != MACStatic {
+		t.Fatalf("static entry = %s %v", entType, ok)
+	}
+	if _, entType, ok := st.Lookup(10, testMAC(2)); !ok || entType != MACSticky {
+		t.Fatalf("sticky entry = %s %v", entType, ok)
+	}
+	if n := st.Flush(); n != 0 {
+		t.Fatalf("flush removed %d static or sticky entries", n)
+	}
+
+	// static and sticky addresses do not move
+	st.Learn(10, testMAC(1), "eth4", false, 0)
+	st.Learn(10, testMAC(2), "eth4", false, 0)
+	if port, _, _ := st.Lookup(10, testMAC(1)); port != "eth1" {
+		t.Fatalf("static entry moved to %s", port)
+	}
+	if port, _, _ := st.Lookup(10, testMAC(2)); port != "eth2" {
+		t.Fatalf("sticky entry moved to %s", port)
+	}
+}
+
+func TestLearnMaxMACs(t *testing.T) {
+	st := NewSwitchMACTable(controlplane.NewEventBus())
+	const limit = 8
+	wg := sync.WaitGroup{}
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 32; i++ {
+				st.Learn(10, testMAC(w*32+i), "eth1", false, limit)
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	if st.Learned("eth1") != limit || st.Sizes()[10] != limit {
+		t.Fatalf("learned = %d entries = %d, want %d", st.Learned("eth1"), st.Sizes()[10], limit)
+	}
+	learned := st.Entries(MACQuery{Port: "eth1"})
+	if !st.Learn(10, learned[0].MAC, "eth1", false, limit) {
+		t.Fatal("refresh of a learned address refused at the limit")
+	}
+	if st.Learn(10, testMAC(1000), "eth1", false, limit) {
+		t.Fatal("address learned over the limit")
+	}
+	// a move counts against the limit of the new port
+	st.Learn(10, testMAC(2000), "eth2", false, 0)
+	if st.Learn(10, testMAC(2000), "eth1", false, limit) {
+		t.Fatal("address moved to a port at its limit")
+	}
+
+	if n := st.FlushPort("eth1"); n != limit {
+		t.Fatalf("flushed %d, want %d", n, limit)
+	}
+	if !st.Learn(10, testMAC(1000), "eth1", false, limit) {
+		t.Fatal("address refused after the port was flushed")
+	}
+	if st.Learned("eth1") != 1 {
+		t.Fatalf("learned = %d, want 1", st.Learned("eth1"))
+	}
+}
+
+func TestFlushDownPorts(t *testing.T) {
+	st := NewSwitchMACTable(controlplane.NewEventBus())
+	st.Learn(10, testMAC(1), "eth1", false, 0)
+	st.Learn(20, testMAC(2), "eth1", false, 0)
+	st.Learn(10, testMAC(3), "eth2", false, 0)
+	st.Learn(10, testMAC(4), "eth3", true, 0)
+	up := map[string]bool{"eth2": true}
+
+	flushed := st.FlushDownPorts(func(port string) bool { return up[port] })
+	if len(flushed) != 1 || flushed["eth1"] != 2 {
+		t.Fatalf("flushed = %v, want 2 entries of eth1", flushed)
+	}
+	if st.Learned("eth1") != 0 || st.Learned("eth2") != 1 {
+		t.Fatalf("learned eth1 = %d eth2 = %d, want 0 and 1", st.Learned("eth1"), st.Learned("eth2"))
+	}
+	if _, entType, ok := st.Lookup(10, testMAC(4)); !ok || entType != MACSticky {
+		t.Fatalf("sticky entry of a down port = %s %v", entType, ok)
+	}
+}
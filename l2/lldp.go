@@ -0,0 +1,791 @@
+package l2
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/m-motawea/gSwitch/config"
+	"github.com/m-motawea/gSwitch/controlplane"
+	"github.com/m-motawea/gSwitch/dataplane"
+	"github.com/m-motawea/gSwitch/logging"
+	"github.com/m-motawea/pipeline"
+	"github.com/mdlayher/ethernet"
+)
+
+var lldpLog = logging.ProcLogger(2, "LLDP")
+
+// LLDPMulticast is the nearest bridge address LLDPDUs are sent to
+var LLDPMulticast = net.HardwareAddr{0x01, 0x80, 0xc2, 0x00, 0x00, 0x0e}
+
+const EtherTypeLLDP ethernet.EtherType = 0x88cc
+
+const LLDP_TX_INTERVAL = 30 * time.Second
+const LLDP_TX_HOLD = 4        // the neighbors keep the information of an LLDPDU for TX_HOLD intervals
+const LLDP_MAX_NEIGHBORS = 16 // per port. LLDPDUs of more neighbors are ignored
+const LLDP_TICK = time.Second
+
+var ErrInvalidLLDPDU = errors.New("invalid lldpdu")
+var ErrLLDPConfig = errors.New("invalid lldp config")
+
+// TLV types
+const (
+	lldpTLVEnd               = 0
+	lldpTLVChassisID         = 1
+	lldpTLVPortID            = 2
+	lldpTLVTTL               = 3
+	lldpTLVPortDescription   = 4
+	lldpTLVSystemName        = 5
+	lldpTLVSystemDescription = 6
+	lldpTLVManagementAddress = 8
+)
+
+// chassis and port id subtypes. the other subtypes carry a name
+const (
+	LLDP_CHASSIS_ID_MAC       = 4
+	LLDP_CHASSIS_ID_ADDRESS   = 5
+	LLDP_PORT_ID_MAC          = 3
+	LLDP_PORT_ID_ADDRESS      = 4
+	LLDP_PORT_ID_IFACE_NAME   = 5
+	lldpAddressFamilyIPv4     = 1 // IANA address family numbers
+	lldpAddressFamilyIPv6     = 2
+	lldpIfaceNumberingUnknown = 1
+)
+
+// LLDPDU is the payload of an LLDP frame. the mandatory TLVs are the chassis
+// id, the port id and the TTL
+type LLDPDU struct {
+	ChassisIDSubtype    uint8
+	ChassisID           []byte
+	PortIDSubtype       uint8
+	PortID              []byte
+	TTL                 time.Duration // 0 tells the neighbor to forget the sender
+	PortDescription     string
+	SystemName          string
+	SystemDescription   string
+	ManagementAddresses []net.IP
+}
+
+func appendTLV(d []byte, typ uint8, value []byte) []byte {
+	d = binary.BigEndian.AppendUint16(d, uint16(typ)<<9|uint16(len(value)))
+	return append(d, value...)
+}
+
+// lldpString cuts s to the 255 bytes of a string TLV
+func lldpString(s string) []byte {
+	if len(s) > 255 {
+		s = s[:255]
+	}
+	return []byte(s)
+}
+
+func (du *LLDPDU) MarshalBinary() ([]byte, error) {
+	if len(du.ChassisID) == 0 || len(du.ChassisID) > 255 {
+		return nil, fmt.Errorf("%w: chassis id of %d bytes", ErrInvalidLLDPDU, len(du.ChassisID))
+	}
+	if len(du.PortID) == 0 || len(du.PortID) > 255 {
+		return nil, fmt.Errorf("%w: port id of %d bytes", ErrInvalidLLDPDU, len(du.PortID))
+	}
+	d := []byte{}
+	d = appendTLV(d, lldpTLVChassisID, append([]byte{du.ChassisIDSubtype}, du.ChassisID...))
+	d = appendTLV(d, lldpTLVPortID, append([]byte{du.PortIDSubtype}, du.PortID...))
+	ttl := min(du.TTL/time.Second, 0xffff)
+	d = appendTLV(d, lldpTLVTTL, binary.BigEndian.AppendUint16(nil, uint16(ttl)))
+	if du.PortDescription != "" {
+		d = appendTLV(d, lldpTLVPortDescription, lldpString(du.PortDescription))
+	}
+	if du.SystemName != "" {
+		d = appendTLV(d, lldpTLVSystemName, lldpString(du.SystemName))
+	}
+	if du.SystemDescription != "" {
+		d = appendTLV(d, lldpTLVSystemDescription, lldpString(du.SystemDescription))
+	}
+	for _, ip := range du.ManagementAddresses {
+		family, addr := uint8(lldpAddressFamilyIPv4), ip.To4()
+		if addr == nil {
+			family, addr = lldpAddressFamilyIPv6, ip.To16()
+		}
+		if addr == nil {
+			return nil, fmt.Errorf("%w: management address %v", ErrInvalidLLDPDU, ip)
+		}
+		// address string length and address, interface number (unknown) and
+		// an empty object identifier
+		v := append([]byte{uint8(1 + len(addr)), family}, addr...)
+		v = append(v, lldpIfaceNumberingUnknown, 0, 0, 0, 0, 0)
+		d = appendTLV(d, lldpTLVManagementAddress, v)
+	}
+	return appendTLV(d, lldpTLVEnd, nil), nil
+}
+
+// UnmarshalBinary parses an LLDPDU. the TLVs it does not know are skipped
+// and the padding after the end TLV is ignored
+func (du *LLDPDU) UnmarshalBinary(d []byte) error {
+	*du = LLDPDU{}
+	for i := 0; ; i++ {
+		if len(d) == 0 {
+			// the end TLV is optional since 802.1AB-2009
+			break
+		}
+		if len(d) < 2 {
+			return fmt.Errorf("%w: truncated tlv header", ErrInvalidLLDPDU)
+		}
+		header := binary.BigEndian.Uint16(d)
+		typ, n := uint8(header>>9), int(header&0x1ff)
+		if len(d) < 2+n {
+			return fmt.Errorf("%w: tlv %d of %d bytes in %d", ErrInvalidLLDPDU, typ, n, len(d)-2)
+		}
+		v := d[2 : 2+n]
+		d = d[2+n:]
+		// the first three TLVs are the mandatory ones in order
+		if i < 3 && typ != uint8(i+1) {
+			return fmt.Errorf("%w: tlv %d at %d", ErrInvalidLLDPDU, typ, i)
+		}
+		switch typ {
+		case lldpTLVEnd:
+			return nil
+		case lldpTLVChassisID, lldpTLVPortID:
+			if n < 2 || n > 256 {
+				return fmt.Errorf("%w: id tlv %d of %d bytes", ErrInvalidLLDPDU, typ, n)
+			}
+			if typ == lldpTLVChassisID {
+				du.ChassisIDSubtype, du.ChassisID = v[0], bytes.Clone(v[1:])
+			} else {
+				du.PortIDSubtype, du.PortID = v[0], bytes.Clone(v[1:])
+			}
+		case lldpTLVTTL:
+			if n < 2 {
+				return fmt.Errorf("%w: ttl of %d bytes", ErrInvalidLLDPDU, n)
+			}
+			du.TTL = time.Duration(binary.BigEndian.Uint16(v)) * time.Second
+		case lldpTLVPortDescription:
+			du.PortDescription = string(v)
+		case lldpTLVSystemName:
+			du.SystemName = string(v)
+		case lldpTLVSystemDescription:
+			du.SystemDescription = string(v)
+		case lldpTLVManagementAddress:
+			if n < 2 || int(v[0]) < 2 || int(v[0]) >= n {
+				continue
+			}
+			addr := v[2 : 1+int(v[0])]
+			switch {
+			case v[1] == lldpAddressFamilyIPv4 && len(addr) == net.IPv4len,
+				v[1] == lldpAddressFamilyIPv6 && len(addr) == net.IPv6len:
+				du.ManagementAddresses = append(du.ManagementAddresses, net.IP(bytes.Clone(addr)))
+			}
+		}
+	}
+	if du.ChassisID == nil || du.PortID == nil {
+		return fmt.Errorf("%w: missing mandatory tlvs", ErrInvalidLLDPDU)
+	}
+	return nil
+}
+
+// lldpID formats a chassis or port id. addresses are shown as addresses,
+// names as they are and anything else in hex
+func lldpID(subtype uint8, id []byte, macSubtype uint8, addressSubtype uint8) string {
+	switch {
+	case subtype == macSubtype && len(id) == 6:
+		return net.HardwareAddr(id).String()
+	case subtype == addressSubtype && len(id) == 1+net.IPv4len && id[0] == lldpAddressFamilyIPv4,
+		subtype == addressSubtype && len(id) == 1+net.IPv6len && id[0] == lldpAddressFamilyIPv6:
+		return net.IP(id[1:]).String()
+	}
+	for _, r := range string(id) {
+		if r == unicode.ReplacementChar || !unicode.IsPrint(r) {
+			return hex.EncodeToString(id)
+		}
+	}
+	return string(id)
+}
+
+func (du *LLDPDU) ChassisIDString() string {
+	return lldpID(du.ChassisIDSubtype, du.ChassisID, LLDP_CHASSIS_ID_MAC, LLDP_CHASSIS_ID_ADDRESS)
+}
+
+func (du *LLDPDU) PortIDString() string {
+	return lldpID(du.PortIDSubtype, du.PortID, LLDP_PORT_ID_MAC, LLDP_PORT_ID_ADDRESS)
+}
+
+type LLDPPortConfig struct {
+	Disabled bool // LLDPDUs are neither sent nor received on the port
+}
+
+type LLDPConfig struct {
+	MAC               string // chassis id. a random locally administered address if not set
+	ManagementAddress string // the first local address of ARP if not set
+	TxIntervalSeconds int    // 1 to 3600. LLDP_TX_INTERVAL if not set
+	TxHold            int    // 1 to 100. the TTL sent is TxHold intervals. LLDP_TX_HOLD if not set
+	Ports             map[string]LLDPPortConfig
+}
+
+// LLDPSettings is the LLDPConfig in the form the agent reads it
+type LLDPSettings struct {
+	MAC               net.HardwareAddr // nil for a random address
+	ManagementAddress net.IP           // nil for the first local address of ARP
+	TxInterval        time.Duration
+	TxHold            int
+	Ports             map[string]LLDPPortConfig
+}
+
+func defaultLLDPSettings() *LLDPSettings {
+	return &LLDPSettings{TxInterval: LLDP_TX_INTERVAL, TxHold: LLDP_TX_HOLD, Ports: map[string]LLDPPortConfig{}}
+}
+
+func (s *LLDPSettings) ttl() time.Duration {
+	return s.TxInterval * time.Duration(s.TxHold)
+}
+
+func parseLLDPConfig(conf LLDPConfig) (*LLDPSettings, error) {
+	s := defaultLLDPSettings()
+	if conf.MAC != "" {
+		mac, err := net.ParseMAC(conf.MAC)
+		if err != nil || len(mac) != 6 {
+			return nil, fmt.Errorf("%w: mac %q", ErrLLDPConfig, conf.MAC)
+		}
+		s.MAC = mac
+	}
+	if conf.ManagementAddress != "" {
+		s.ManagementAddress = net.ParseIP(conf.ManagementAddress)
+		if s.ManagementAddress == nil {
+			return nil, fmt.Errorf("%w: management address %q", ErrLLDPConfig, conf.ManagementAddress)
+		}
+	}
+	if conf.TxIntervalSeconds != 0 {
+		if conf.TxIntervalSeconds < 1 || conf.TxIntervalSeconds > 3600 {
+			return nil, fmt.Errorf("%w: tx interval %ds is not 1 to 3600", ErrLLDPConfig, conf.TxIntervalSeconds)
+		}
+		s.TxInterval = time.Duration(conf.TxIntervalSeconds) * time.Second
+	}
+	if conf.TxHold != 0 {
+		if conf.TxHold < 1 || conf.TxHold > 100 {
+			return nil, fmt.Errorf("%w: tx hold %d is not 1 to 100", ErrLLDPConfig, conf.TxHold)
+		}
+		s.TxHold = conf.TxHold
+	}
+	if conf.Ports != nil {
+		s.Ports = conf.Ports
+	}
+	return s, nil
+}
+
+func readLLDPConfig(path string) (*LLDPSettings, error) {
+	if path == "" {
+		return defaultLLDPSettings(), nil
+	}
+	conf := LLDPConfig{}
+	err := config.ReadConfigFile(path, &conf)
+	if err != nil {
+		return nil, err
+	}
+	return parseLLDPConfig(conf)
+}
+
+type lldpPort struct {
+	port    *dataplane.SwitchPort
+	up      bool
+	txDue   time.Time
+	rx      uint64
+	tx      uint64
+	agedOut uint64
+}
+
+// lldpNeighborKey identifies a neighbor. a port can have more than one
+// neighbor behind a hub or a switch that does not take the LLDPDUs
+type lldpNeighborKey struct {
+	port      string
+	chassisID string
+	portID    string
+}
+
+type lldpNeighbor struct {
+	du      *LLDPDU
+	seen    time.Time // first LLDPDU
+	expires time.Time
+}
+
+// LLDPAgent sends LLDPDUs on the ports and keeps the neighbors heard on them
+type LLDPAgent struct {
+	sw        *controlplane.Switch
+	mutex     *sync.Mutex
+	settings  *LLDPSettings
+	mac       net.HardwareAddr
+	ports     map[string]*lldpPort
+	neighbors map[lldpNeighborKey]*lldpNeighbor
+	stopped   bool
+}
+
+func NewLLDPAgent(sw *controlplane.Switch, settings *LLDPSettings) *LLDPAgent {
+	a := &LLDPAgent{sw: sw, mutex: &sync.Mutex{}, ports: map[string]*lldpPort{}, neighbors: map[lldpNeighborKey]*lldpNeighbor{}}
+	a.setSettings(settings)
+	return a
+}
+
+func (a *LLDPAgent) setSettings(s *LLDPSettings) {
+	if s.MAC != nil {
+		a.mac = s.MAC
+	} else if a.mac == nil {
+		a.mac = randomMAC()
+	}
+	a.settings = s
+}
+
+func (a *LLDPAgent) disabled(name string) bool {
+	return a.settings.Ports[name].Disabled
+}
+
+// syncPorts follows the ports added to and removed from the switch. the
+// neighbors of a removed port are forgotten
+func (a *LLDPAgent) syncPorts() {
+	ports := a.sw.PortMap()
+	for name, port := range ports {
+		p, ok := a.ports[name]
+		if ok && p.port == port {
+			continue
+		}
+		a.ports[name] = &lldpPort{port: port}
+		a.forget(name)
+	}
+	for name := range a.ports {
+		_, ok := ports[name]
+		if !ok {
+			delete(a.ports, name)
+			a.forget(name)
+		}
+	}
+}
+
+// forget removes the neighbors of port
+func (a *LLDPAgent) forget(port string) {
+	for key := range a.neighbors {
+		if key.port == port {
+			delete(a.neighbors, key)
+		}
+	}
+}
+
+// managementAddress is the configured address or the first local address
+// of ARP by interface name
+func (a *LLDPAgent) managementAddress() net.IP {
+	if a.settings.ManagementAddress != nil {
+		return a.settings.ManagementAddress
+	}
+	conf, ok := controlplane.GetConfig[ARPConfig](a.sw.Stor.GetStor(2, "ARP"))
+	if !ok {
+		return nil
+	}
+	names := []string{}
+	for name := range conf.LocalAddresses {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		ip := net.ParseIP(conf.LocalAddresses[name].IP)
+		if ip != nil {
+			return ip
+		}
+	}
+	return nil
+}
+
+func (a *LLDPAgent) lldpdu(name string, ttl time.Duration) *LLDPDU {
+	du := &LLDPDU{
+		ChassisIDSubtype: LLDP_CHASSIS_ID_MAC,
+		ChassisID:        a.mac,
+		PortIDSubtype:    LLDP_PORT_ID_IFACE_NAME,
+		PortID:           []byte(name),
+		TTL:              ttl,
+		SystemName:       a.sw.Name,
+	}
+	ip := a.managementAddress()
+	if ip != nil {
+		du.ManagementAddresses = []net.IP{ip}
+	}
+	return du
+}
+
+func (a *LLDPAgent) send(name string, p *lldpPort, du *LLDPDU) {
+	payload, err := du.MarshalBinary()
+	if err != nil {
+		lldpLog.Warn("failed to marshal lldpdu", "port", name, "error", err)
+		return
+	}
+	p.port.Out(&ethernet.Frame{
+		Destination: LLDPMulticast,
+		Source:      a.mac,
+		EtherType:   EtherTypeLLDP,
+		Payload:     payload,
+	})
+	p.tx++
+}
+
+// Tick sends an LLDPDU on the ports whose interval passed and ages the
+// neighbors out. a port that comes up sends right away and a port that goes
+// down forgets its neighbors
+func (a *LLDPAgent) Tick() {
+	defer a.mutex.Unlock()
+	a.mutex.Lock()
+	if a.stopped {
+		return
+	}
+	now := time.Now()
+	a.syncPorts()
+	for name, p := range a.ports {
+		up := p.port.IsUp()
+		if up && !p.up {
+			p.txDue = now
+		}
+		if !up && p.up {
+			a.forget(name)
+		}
+		p.up = up
+		if !up || a.disabled(name) || now.Before(p.txDue) {
+			continue
+		}
+		a.send(name, p, a.lldpdu(name, a.settings.ttl()))
+		p.txDue = now.Add(a.settings.TxInterval)
+	}
+	for key, n := range a.neighbors {
+		if now.Before(n.expires) {
+			continue
+		}
+		lldpLog.Info("neighbor aged out", "port", key.port, "chassis_id", key.chassisID, "port_id", key.portID)
+		delete(a.neighbors, key)
+		if p, ok := a.ports[key.port]; ok {
+			p.agedOut++
+		}
+	}
+}
+
+// Receive keeps the sender of du as a neighbor of port for its TTL. an
+// LLDPDU with a TTL of 0 removes it
+func (a *LLDPAgent) Receive(port *dataplane.SwitchPort, du *LLDPDU) {
+	defer a.mutex.Unlock()
+	a.mutex.Lock()
+	if a.stopped {
+		return
+	}
+	a.syncPorts()
+	name := port.Name
+	p, ok := a.ports[name]
+	if !ok || p.port != port || a.disabled(name) {
+		return
+	}
+	p.rx++
+	key := lldpNeighborKey{port: name, chassisID: du.ChassisIDString(), portID: du.PortIDString()}
+	n, ok := a.neighbors[key]
+	if du.TTL == 0 {
+		if ok {
+			lldpLog.Info("neighbor shut down", "port", name, "chassis_id", key.chassisID, "port_id", key.portID)
+			delete(a.neighbors, key)
+		}
+		return
+	}
+	now := time.Now()
+	if !ok {
+		count := 0
+		for other := range a.neighbors {
+			if other.port == name {
+				count++
+			}
+		}
+		if count >= LLDP_MAX_NEIGHBORS {
+			lldpLog.Debug("too many neighbors. ignoring lldpdu", "port", name, "chassis_id", key.chassisID)
+			return
+		}
+		lldpLog.Info("neighbor discovered", "port", name, "system", du.SystemName, "chassis_id", key.chassisID, "port_id", key.portID)
+		n = &lldpNeighbor{seen: now}
+		a.neighbors[key] = n
+		// a new neighbor hears about this switch right away instead of
+		// waiting for the next interval
+		a.send(name, p, a.lldpdu(name, a.settings.ttl()))
+		p.txDue = now.Add(a.settings.TxInterval)
+	}
+	n.du = du
+	n.expires = now.Add(du.TTL)
+}
+
+// Reload applies new settings. every port sends its new information right away
+func (a *LLDPAgent) Reload(settings *LLDPSettings) {
+	defer a.mutex.Unlock()
+	a.mutex.Lock()
+	a.setSettings(settings)
+	for name, p := range a.ports {
+		p.txDue = time.Time{}
+		if a.disabled(name) {
+			a.forget(name)
+		}
+	}
+}
+
+// Flush forgets every neighbor. they come back with their next LLDPDU
+func (a *LLDPAgent) Flush() {
+	defer a.mutex.Unlock()
+	a.mutex.Lock()
+	clear(a.neighbors)
+}
+
+// Loop sends the LLDPDUs and follows the ports going up and down on sub
+// until ctx is done
+func (a *LLDPAgent) Loop(ctx context.Context, sub *controlplane.Subscription) {
+	defer sub.Close()
+	ticker := time.NewTicker(LLDP_TICK)
+	defer ticker.Stop()
+	defer a.stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-sub.C:
+		}
+		a.Tick()
+	}
+}
+
+// stop tells the neighbors to forget this switch with an LLDPDU of TTL 0
+func (a *LLDPAgent) stop() {
+	defer a.mutex.Unlock()
+	a.mutex.Lock()
+	a.stopped = true
+	for name, p := range a.ports {
+		if p.up && p.port.IsUp() && !a.disabled(name) {
+			a.send(name, p, a.lldpdu(name, 0))
+		}
+	}
+	lldpLog.Info("lldp stopped")
+}
+
+type LLDPNeighbor struct {
+	Port                string // the local port
+	ChassisID           string
+	PortID              string
+	PortDescription     string   `json:",omitempty"`
+	SystemName          string   `json:",omitempty"`
+	SystemDescription   string   `json:",omitempty"`
+	ManagementAddresses []string `json:",omitempty"`
+	TTL                 float64  // seconds the neighbor asked to be kept for
+	Expires             float64  // seconds until it ages out
+	Age                 float64  // seconds since it was discovered
+}
+
+type LLDPPortStatus struct {
+	Name            string
+	Enabled         bool
+	Neighbors       int
+	LLDPDUsReceived uint64
+	LLDPDUsSent     uint64
+	AgedOut         uint64
+}
+
+type LLDPStatus struct {
+	ChassisID         string
+	SystemName        string
+	ManagementAddress string `json:",omitempty"`
+	TxIntervalSeconds float64
+	TTLSeconds        float64
+	Ports             []LLDPPortStatus
+	Neighbors         []LLDPNeighbor
+}
+
+// Status returns the local information, the ports sorted by name and the
+// neighbors sorted by port
+func (a *LLDPAgent) Status() LLDPStatus {
+	defer a.mutex.Unlock()
+	a.mutex.Lock()
+	now := time.Now()
+	status := LLDPStatus{
+		ChassisID:         a.mac.String(),
+		SystemName:        a.sw.Name,
+		TxIntervalSeconds: a.settings.TxInterval.Seconds(),
+		TTLSeconds:        a.settings.ttl().Seconds(),
+		Ports:             []LLDPPortStatus{},
+		Neighbors:         []LLDPNeighbor{},
+	}
+	ip := a.managementAddress()
+	if ip != nil {
+		status.ManagementAddress = ip.String()
+	}
+	counts := map[string]int{}
+	for key, n := range a.neighbors {
+		counts[key.port]++
+		neighbor := LLDPNeighbor{
+			Port:              key.port,
+			ChassisID:         key.chassisID,
+			PortID:            key.portID,
+			PortDescription:   n.du.PortDescription,
+			SystemName:        n.du.SystemName,
+			SystemDescription: n.du.SystemDescription,
+			TTL:               n.du.TTL.Seconds(),
+			Expires:           n.expires.Sub(now).Seconds(),
+			Age:               now.Sub(n.seen).Seconds(),
+		}
+		for _, ip := range n.du.ManagementAddresses {
+			neighbor.ManagementAddresses = append(neighbor.ManagementAddresses, ip.String())
+		}
+		status.Neighbors = append(status.Neighbors, neighbor)
+	}
+	sort.Slice(status.Neighbors, func(i, j int) bool {
+		ni, nj := status.Neighbors[i], status.Neighbors[j]
+		if ni.Port != nj.Port {
+			return ni.Port < nj.Port
+		}
+		if ni.ChassisID != nj.ChassisID {
+			return ni.ChassisID < nj.ChassisID
+		}
+		return ni.PortID < nj.PortID
+	})
+	for name, p := range a.ports {
+		status.Ports = append(status.Ports, LLDPPortStatus{
+			Name:            name,
+			Enabled:         !a.disabled(name),
+			Neighbors:       counts[name],
+			LLDPDUsReceived: p.rx,
+			LLDPDUsSent:     p.tx,
+			AgedOut:         p.agedOut,
+		})
+	}
+	sort.Slice(status.Ports, func(i, j int) bool {
+		return status.Ports[i].Name < status.Ports[j].Name
+	})
+	return status
+}
+
+func init() {
+	LLDPProcFuncPair := controlplane.ControlProcessFuncPair{
+		InFunc:   LLDPInFunc,
+		OutFunc:  LLDPOutFunc,
+		Init:     InitLLDP,
+		Gauges:   LLDPGauges,
+		Dump:     LLDPDump,
+		Flush:    LLDPFlush,
+		Reload:   ReloadLLDP,
+		Position: controlplane.PositionFirst, // takes the LLDPDUs before they are learned or forwarded
+	}
+
+	controlplane.RegisterLayerProc(2, "LLDP", LLDPProcFuncPair)
+}
+
+func InitLLDP(sw *controlplane.Switch) {
+	lldpLog.Info("starting process")
+	stor := sw.Stor.GetStor(2, "LLDP")
+	path := stor.ConfigFile()
+	lldpLog.Info("config file", "path", path)
+	settings, err := readLLDPConfig(path)
+	if err != nil {
+		lldpLog.Error("failed to read config file", "path", path, "error", err)
+		settings = defaultLLDPSettings()
+	}
+	stor.SetConfig(settings)
+	a := NewLLDPAgent(sw, settings)
+	controlplane.Set(stor, "Agent", a)
+	lldpLog.Info("chassis id", "mac", a.mac.String())
+	// ports added right after Init are not missed
+	sub := sw.Events.Subscribe(0, controlplane.EventPortUp, controlplane.EventPortDown)
+	a.Tick()
+	stor.Go(func(ctx context.Context) {
+		a.Loop(ctx, sub)
+	})
+}
+
+// ReloadLLDP re-reads the settings. the neighbors are kept
+func ReloadLLDP(sw *controlplane.Switch, path string) error {
+	a, err := getLLDPAgent(sw)
+	if err != nil {
+		return err
+	}
+	settings, err := readLLDPConfig(path)
+	if err != nil {
+		return err
+	}
+	sw.Stor.GetStor(2, "LLDP").SetConfig(settings)
+	a.Reload(settings)
+	lldpLog.Info("config reloaded", "config", settings)
+	return nil
+}
+
+func getLLDPAgent(sw *controlplane.Switch) (*LLDPAgent, error) {
+	a, ok := controlplane.Get[*LLDPAgent](sw.Stor.GetStor(2, "LLDP"), "Agent")
+	if !ok {
+		return nil, fmt.Errorf("%w: L2:LLDP", controlplane.ErrNoProc)
+	}
+	return a, nil
+}
+
+// LLDP returns the local information and the neighbors heard on the ports
+func LLDP(sw *controlplane.Switch) (LLDPStatus, error) {
+	a, err := getLLDPAgent(sw)
+	if err != nil {
+		return LLDPStatus{}, err
+	}
+	return a.Status(), nil
+}
+
+func LLDPGauges(sw *controlplane.Switch) []controlplane.ProcGauge {
+	status, err := LLDP(sw)
+	if err != nil {
+		return nil
+	}
+	gauges := []controlplane.ProcGauge{}
+	for _, port := range status.Ports {
+		gauges = append(gauges, controlplane.ProcGauge{
+			Name:   "lldp_port_neighbors",
+			Help:   "Number of LLDP neighbors heard on the port.",
+			Labels: map[string]string{"port": port.Name},
+			Value:  float64(port.Neighbors),
+		})
+	}
+	return gauges
+}
+
+func LLDPDump(sw *controlplane.Switch) interface{} {
+	status, err := LLDP(sw)
+	if err != nil {
+		return LLDPStatus{}
+	}
+	return status
+}
+
+func LLDPFlush(sw *controlplane.Switch) error {
+	a, err := getLLDPAgent(sw)
+	if err != nil {
+		return err
+	}
+	a.Flush()
+	return nil
+}
+
+func LLDPInFunc(proc pipeline.PipelineProcess, msg pipeline.PipelineMessage) pipeline.PipelineMessage {
+	msgContent, _ := msg.Content.(controlplane.ControlMessage)
+	frame := msgContent.InFrame.FRAME
+	if !bytes.Equal(frame.Destination, LLDPMulticast) || frame.EtherType != EtherTypeLLDP {
+		return msg
+	}
+	// LLDPDUs end here
+	msg.Drop = true
+	a, err := getLLDPAgent(msgContent.ParentSwitch)
+	if err != nil {
+		lldpLog.Error("no agent")
+		return msg
+	}
+	du := &LLDPDU{}
+	err = du.UnmarshalBinary(frame.Payload)
+	if err != nil {
+		lldpLog.Debug("received invalid lldpdu", "port", msgContent.InFrame.IN_PORT.Name, "error", err)
+		return msg
+	}
+	a.Receive(msgContent.InFrame.IN_PORT, du)
+	return msg
+}
+
+func LLDPOutFunc(proc pipeline.PipelineProcess, msg pipeline.PipelineMessage) pipeline.PipelineMessage {
+	return msg
+}
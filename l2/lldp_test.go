@@ -0,0 +1,253 @@
+package l2_test
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/m-motawea/gSwitch/config"
+	"github.com/m-motawea/gSwitch/l2"
+	"github.com/m-motawea/gSwitch/switchtest"
+	"github.com/mdlayher/ethernet"
+)
+
+func tlv(typ uint8, value ...byte) []byte {
+	return append(binary.BigEndian.AppendUint16(nil, uint16(typ)<<9|uint16(len(value))), value...)
+}
+
+func lldpdu(tlvs ...[]byte) []byte {
+	d := []byte{}
+	for _, t := range tlvs {
+		d = append(d, t...)
+	}
+	return d
+}
+
+var (
+	chassisTLV = tlv(1, l2.LLDP_CHASSIS_ID_MAC, 0x02, 0, 0, 0, 0, 0x01)
+	portTLV    = tlv(2, l2.LLDP_PORT_ID_IFACE_NAME, 'p', '1')
+	ttlTLV     = tlv(3, 0, 120)
+	endTLV     = tlv(0)
+)
+
+func TestLLDPDURoundTrip(t *testing.T) {
+	du := l2.LLDPDU{
+		ChassisIDSubtype:    l2.LLDP_CHASSIS_ID_MAC,
+		ChassisID:           []byte{0x02, 0, 0, 0, 0, 0x01},
+		PortIDSubtype:       l2.LLDP_PORT_ID_IFACE_NAME,
+		PortID:              []byte("sw1"),
+		TTL:                 120 * time.Second,
+		PortDescription:     "uplink",
+		SystemName:          "core",
+		SystemDescription:   "gSwitch",
+		ManagementAddresses: []net.IP{net.ParseIP("10.0.0.1").To4(), net.ParseIP("2001:db8::1")},
+	}
+	d, err := du.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// frames are padded to the minimum size after the end TLV
+	d = append(d, make([]byte, 16)...)
+	got := l2.LLDPDU{}
+	err = got.UnmarshalBinary(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, du) {
+		t.Fatalf("round trip = %+v. want %+v", got, du)
+	}
+	if got.ChassisIDString() != "02:00:00:00:00:01" || got.PortIDString() != "sw1" {
+		t.Fatalf("ids = %s %s", got.ChassisIDString(), got.PortIDString())
+	}
+}
+
+func TestLLDPDUMandatoryOrder(t *testing.T) {
+	tests := []struct {
+		name string
+		d    []byte
+	}{
+		{"port id first", lldpdu(portTLV, chassisTLV, ttlTLV, endTLV)},
+		{"ttl before port id", lldpdu(chassisTLV, ttlTLV, portTLV, endTLV)},
+		{"system name before ttl", lldpdu(chassisTLV, portTLV, tlv(5, 'a'), ttlTLV, endTLV)},
+		{"no ttl", lldpdu(chassisTLV, portTLV, endTLV)},
+		{"end first", lldpdu(endTLV)},
+		{"empty", nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			du := l2.LLDPDU{}
+			err := du.UnmarshalBinary(test.d)
+			if !errors.Is(err, l2.ErrInvalidLLDPDU) {
+				t.Fatalf("err = %v. want %v", err, l2.ErrInvalidLLDPDU)
+			}
+		})
+	}
+
+	du := l2.LLDPDU{}
+	err := du.UnmarshalBinary(lldpdu(chassisTLV, portTLV, ttlTLV))
+	if err != nil || string(du.PortID) != "p1" || du.TTL != 120*time.Second {
+		t.Fatalf("lldpdu without an end tlv = %+v, %v", du, err)
+	}
+}
+
+func TestLLDPDUTruncated(t *testing.T) {
+	full := lldpdu(chassisTLV, portTLV, ttlTLV, tlv(5, 'c', 'o', 'r', 'e'), endTLV)
+	tests := []struct {
+		name string
+		d    []byte
+	}{
+		{"half a header", full[:1]},
+		{"chassis id", full[:len(chassisTLV)-2]},
+		{"ttl", full[:len(chassisTLV)+len(portTLV)+3]},
+		{"system name header", full[:len(chassisTLV)+len(portTLV)+len(ttlTLV)+1]},
+		{"system name", full[:len(full)-len(endTLV)-1]},
+		{"one byte id", lldpdu(tlv(1, l2.LLDP_CHASSIS_ID_MAC), portTLV, ttlTLV)},
+		{"one byte ttl", lldpdu(chassisTLV, portTLV, tlv(3, 120))},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			du := l2.LLDPDU{}
+			err := du.UnmarshalBinary(test.d)
+			if !errors.Is(err, l2.ErrInvalidLLDPDU) {
+				t.Fatalf("err = %v. want %v", err, l2.ErrInvalidLLDPDU)
+			}
+		})
+	}
+}
+
+// newLLDPSwitch starts a switch running LLDP and L2Switch with a host port h1
+func newLLDPSwitch(t *testing.T, lldpConf string) *switchtest.Harness {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "LLDP.toml")
+	err := os.WriteFile(path, []byte(lldpConf), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := switchtest.NewHarness(config.Config{
+		SwitchPorts: map[string]config.SwitchPortConfig{
+			"h1": {AllowedVLANs: []int{10}, Up: true},
+		},
+		ControlProcess: []config.ControlProcessConfig{
+			{Layer: 2, Name: "LLDP", ConfigFile: path},
+			{Layer: 2, Name: "L2Switch"},
+		},
+	})
+	if h != nil {
+		t.Cleanup(func() {
+			h.Stop(5 * time.Second)
+		})
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+// neighbor returns the neighbor of h heard on port, if any
+func neighbor(t *testing.T, h *switchtest.Harness, port string) (l2.LLDPNeighbor, bool) {
+	t.Helper()
+	st, err := l2.LLDP(h.Switch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range st.Neighbors {
+		if n.Port == port {
+			return n, true
+		}
+	}
+	return l2.LLDPNeighbor{}, false
+}
+
+func lldpFrame(t *testing.T, du l2.LLDPDU) *ethernet.Frame {
+	t.Helper()
+	payload, err := du.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &ethernet.Frame{Destination: l2.LLDPMulticast, Source: net.HardwareAddr(du.ChassisID), EtherType: l2.EtherTypeLLDP, Payload: payload}
+}
+
+func TestLLDPNeighbors(t *testing.T) {
+	const timers = "TxIntervalSeconds = 1\nTxHold = 2\n"
+	a := newLLDPSwitch(t, timers+"ManagementAddress = \"10.0.0.1\"\n")
+	b := newLLDPSwitch(t, timers)
+	link(t, a, "ab", b, "ba")
+
+	var fromB, fromA l2.LLDPNeighbor
+	waitFor(t, 5*time.Second, "neighbors", func() bool {
+		var okA, okB bool
+		fromB, okB = neighbor(t, a, "ab")
+		fromA, okA = neighbor(t, b, "ba")
+		return okA && okB
+	})
+	if fromB.PortID != "ba" || fromB.SystemName != "test switch" || fromB.TTL != 2 {
+		t.Fatalf("neighbor of a = %+v", fromB)
+	}
+	if fromA.PortID != "ab" || !reflect.DeepEqual(fromA.ManagementAddresses, []string{"10.0.0.1"}) {
+		t.Fatalf("neighbor of b = %+v", fromA)
+	}
+
+	// an LLDPDU of TTL 0 removes the sender right away
+	host := l2.LLDPDU{
+		ChassisIDSubtype: l2.LLDP_CHASSIS_ID_MAC,
+		ChassisID:        []byte{0x02, 0, 0, 0, 0, 0x99},
+		PortIDSubtype:    l2.LLDP_PORT_ID_IFACE_NAME,
+		PortID:           []byte("eth0"),
+		TTL:              120 * time.Second,
+		SystemName:       "host",
+	}
+	err := a.Inject("h1", lldpFrame(t, host))
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, 2*time.Second, "host neighbor", func() bool {
+		n, ok := neighbor(t, a, "h1")
+		return ok && n.SystemName == "host" && n.ChassisID == "02:00:00:00:00:99"
+	})
+	host.TTL = 0
+	err = a.Inject("h1", lldpFrame(t, host))
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, 500*time.Millisecond, "host neighbor to be removed", func() bool {
+		_, ok := neighbor(t, a, "h1")
+		return !ok
+	})
+	// the LLDPDUs of the host are not forwarded to b
+	st, err := l2.LLDP(b.Switch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(st.Neighbors) != 1 {
+		t.Fatalf("neighbors of b = %+v", st.Neighbors)
+	}
+
+	// b stops sending when its port goes down. a keeps the information of
+	// the last LLDPDU for its TTL of TxHold intervals
+	err = b.Switch.DownPort("ba")
+	if err != nil {
+		t.Fatal(err)
+	}
+	down := time.Now()
+	waitFor(t, 4*time.Second, "neighbor to age out", func() bool {
+		_, ok := neighbor(t, a, "ab")
+		return !ok
+	})
+	if aged := time.Since(down); aged < 900*time.Millisecond {
+		t.Fatalf("neighbor aged out after %v. want about TxHold x TxInterval", aged)
+	}
+	st, err = l2.LLDP(a.Switch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range st.Ports {
+		if p.Name == "ab" && p.AgedOut != 1 {
+			t.Fatalf("port ab aged out %d neighbors", p.AgedOut)
+		}
+	}
+}
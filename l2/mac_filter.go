@@ -1,19 +1,22 @@
 package l2
 
 import (
-	"log"
-
 	"github.com/m-motawea/gSwitch/config"
 	"github.com/m-motawea/gSwitch/controlplane"
 	"github.com/m-motawea/gSwitch/dataplane"
+	"github.com/m-motawea/gSwitch/logging"
 	"github.com/m-motawea/pipeline"
 )
 
+var filterLog = logging.ProcLogger(2, "MACFilter")
+
 func init() {
 	FuncPair := controlplane.ControlProcessFuncPair{
-		InFunc:  IngressMacFilter,
-		OutFunc: EgressMacFilter,
-		Init:    InitMacFilter,
+		InFunc:   IngressMacFilter,
+		OutFunc:  EgressMacFilter,
+		Init:     InitMacFilter,
+		Reload:   ReloadMacFilter,
+		Position: controlplane.PositionFirst, // filters ingress frames before they are learned and egress ports after they are picked
 	}
 
 	controlplane.RegisterLayerProc(2, "MACFilter", FuncPair)
@@ -153,38 +156,51 @@ func (conf *MACFilterConfig) GetEgressAction(src string, dst string, port string
 }
 
 func InitMacFilter(sw *controlplane.Switch) {
-	log.Println("Starting MAC Filter Process")
+	filterLog.Info("starting process")
 	stor := sw.Stor.GetStor(2, "MACFilter")
-	log.Printf("MAC Filter Process Config file path: %v", stor["ConfigFile"])
+	path := stor.ConfigFile()
+	filterLog.Info("config file", "path", path)
 	configObj := MACFilterConfig{}
-	if stor["ConfigFile"] != nil {
-		path, ok := stor["ConfigFile"].(string)
-		if ok {
-			err := config.ReadConfigFile(path, &configObj)
-			if err != nil {
-				log.Printf("MAC Filter Failed to read config file due to error %v", err)
-			} else {
-				log.Printf("MAC Filter Config: %v", configObj)
-				stor["CONFIG"] = configObj
-			}
+	if path != "" {
+		err := config.ReadConfigFile(path, &configObj)
+		if err != nil {
+			filterLog.Error("failed to read config file", "path", path, "error", err)
 		} else {
-			log.Printf("MAC Filter invalid config path specified")
+			filterLog.Info("config loaded", "config", configObj)
+			stor.SetConfig(configObj)
 		}
 	}
 }
 
+// ReloadMacFilter re-reads the filter rules
+func ReloadMacFilter(sw *controlplane.Switch, path string) error {
+	stor := sw.Stor.GetStor(2, "MACFilter")
+	if path == "" {
+		stor.SetConfig(nil)
+		return nil
+	}
+	configObj := MACFilterConfig{}
+	err := config.ReadConfigFile(path, &configObj)
+	if err != nil {
+		return err
+	}
+	filterLog.Info("config reloaded", "config", configObj)
+	stor.SetConfig(configObj)
+	return nil
+}
+
 func IngressMacFilter(proc pipeline.PipelineProcess, msg pipeline.PipelineMessage) pipeline.PipelineMessage {
 	msgContent, _ := msg.Content.(controlplane.ControlMessage)
 	stor := msgContent.ParentSwitch.Stor.GetStor(2, "MACFilter")
-	configObj, ok := stor["CONFIG"].(MACFilterConfig)
+	configObj, ok := controlplane.GetConfig[MACFilterConfig](stor)
 	if !ok {
-		log.Println("MAC Filter Config is not correct")
+		filterLog.Debug("no valid config", "config", stor.Config())
 		return msg
 	}
 
 	frame := msgContent.InFrame.FRAME
 	action := configObj.GetIngressAction(frame.Source.String(), frame.Destination.String(), msgContent.InFrame.IN_PORT.Name)
-	log.Printf("Process MACFilter: Ingress Action=%v", action)
+	filterLog.Debug("ingress action", "action", action, "src", frame.Source, "dst", frame.Destination)
 	if action == DenyAction {
 		msg.Drop = true
 	}
@@ -194,9 +210,9 @@ func IngressMacFilter(proc pipeline.PipelineProcess, msg pipeline.PipelineMessag
 func EgressMacFilter(proc pipeline.PipelineProcess, msg pipeline.PipelineMessage) pipeline.PipelineMessage {
 	msgContent, _ := msg.Content.(controlplane.ControlMessage)
 	stor := msgContent.ParentSwitch.Stor.GetStor(2, "MACFilter")
-	configObj, ok := stor["CONFIG"].(MACFilterConfig)
+	configObj, ok := controlplane.GetConfig[MACFilterConfig](stor)
 	if !ok {
-		log.Println("MAC Filter Config is not correct")
+		filterLog.Debug("no valid config", "config", stor.Config())
 		return msg
 	}
 
@@ -204,7 +220,7 @@ func EgressMacFilter(proc pipeline.PipelineProcess, msg pipeline.PipelineMessage
 	frame := msgContent.InFrame.FRAME
 	for _, port := range msgContent.OutPorts {
 		action := configObj.GetEgressAction(frame.Source.String(), frame.Destination.String(), port.Name)
-		log.Printf("Process MACFilter: Egress Action=%v for Port: %v", action, port.Name)
+		filterLog.Debug("egress action", "action", action, "port", port.Name)
 		if action == AllowAction {
 			outPorts = append(outPorts, port)
 		}
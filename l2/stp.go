@@ -0,0 +1,1904 @@
+package l2
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"slices"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/m-motawea/gSwitch/config"
+	"github.com/m-motawea/gSwitch/controlplane"
+	"github.com/m-motawea/gSwitch/dataplane"
+	"github.com/m-motawea/gSwitch/logging"
+	"github.com/m-motawea/pipeline"
+	"github.com/mdlayher/ethernet"
+)
+
+var stpLog = logging.ProcLogger(2, "STP")
+
+// STPMulticast is the destination address of BPDUs
+var STPMulticast = net.HardwareAddr{0x01, 0x80, 0xc2, 0x00, 0x00, 0x00}
+
+const STP_PRIORITY = 32768
+const STP_PORT_PRIORITY = 128
+const STP_PATH_COST = 20000 // 1 Gb/s
+const STP_HELLO_TIME = 2 * time.Second
+const STP_MAX_AGE = 20 * time.Second
+const STP_FORWARD_DELAY = 15 * time.Second
+const STP_MAX_HOPS = 20      // bridges the information of an MST region crosses
+const STP_TICK = time.Second // port timers are checked once a tick
+const MST_MAX_INSTANCES = 64
+
+var ErrInvalidBPDU = errors.New("invalid bpdu")
+var ErrSTPConfig = errors.New("invalid stp config")
+
+// BPDU protocol versions and types
+const (
+	STP_VERSION      = 0
+	RSTP_VERSION     = 2
+	MSTP_VERSION     = 3
+	BPDU_TYPE_CONFIG = 0x00
+	BPDU_TYPE_RST    = 0x02 // MST BPDUs too
+	BPDU_TYPE_TCN    = 0x80
+)
+
+// BPDU flags. config BPDUs only use TC and TC_ACK
+const (
+	BPDU_FLAG_TC         = 0x01
+	BPDU_FLAG_PROPOSAL   = 0x02
+	BPDU_FLAG_LEARNING   = 0x10
+	BPDU_FLAG_FORWARDING = 0x20
+	BPDU_FLAG_AGREEMENT  = 0x40
+	BPDU_FLAG_TC_ACK     = 0x80
+	BPDU_FLAG_MASTER     = 0x80 // in the flags of MSTI messages
+)
+
+// port role in bits 2 and 3 of the flags of RST BPDUs and MSTI messages
+const (
+	bpduRoleUnknown    = 0 // or master in MSTI messages
+	bpduRoleAlternate  = 1 // or backup
+	bpduRoleRoot       = 2
+	bpduRoleDesignated = 3
+)
+
+// BPDUs are sent in 802.3 frames with an llc header: DSAP and SSAP 0x42,
+// unnumbered information
+var bpduLLC = []byte{0x42, 0x42, 0x03}
+
+const bpduTCNLen = 4
+const bpduConfigLen = 35
+const bpduRSTLen = 36
+const bpduMSTLen = 102 // without MSTI messages
+const mstiMessageLen = 16
+
+// the key of the HMAC-MD5 digest of the vlan to instance mapping (802.1Q 13.7)
+var mstDigestKey = []byte{0x13, 0xac, 0x06, 0xa6, 0x2e, 0x47, 0xfd, 0x51, 0xf9, 0x5d, 0x2b, 0xa2, 0x43, 0xcd, 0x03, 0x46}
+
+// BridgeID is the priority of a bridge in the upper 16 bits and its address
+// in the lower 48. lower ids are better. the lower 12 bits of the priority
+// of an MSTI bridge id are its instance
+type BridgeID uint64
+
+func NewBridgeID(priority uint16, mac net.HardwareAddr) BridgeID {
+	id := BridgeID(priority) << 48
+	for i, b := range mac[:6] {
+		id |= BridgeID(b) << (8 * (5 - i))
+	}
+	return id
+}
+
+func (id BridgeID) Priority() uint16 {
+	return uint16(id >> 48)
+}
+
+func (id BridgeID) MAC() net.HardwareAddr {
+	mac := make(net.HardwareAddr, 6)
+	for i := range mac {
+		mac[i] = byte(id >> (8 * (5 - i)))
+	}
+	return mac
+}
+
+func (id BridgeID) String() string {
+	return fmt.Sprintf("%d.%s", id.Priority(), id.MAC())
+}
+
+// MSTConfigID names the MST region of a bridge. bridges with the same name,
+// revision and vlan to instance mapping are in the same region
+type MSTConfigID struct {
+	Name     string
+	Revision uint16
+	Digest   [16]byte // of the vlan to instance mapping
+}
+
+// MSTIMessage is the information of one instance in an MST BPDU
+type MSTIMessage struct {
+	Flags          uint8
+	RegionalRootID BridgeID
+	InternalCost   uint32
+	BridgePriority uint8 // upper 4 bits of the priority of the designated bridge
+	PortPriority   uint8 // upper 4 bits of the priority of the designated port
+	RemainingHops  uint8
+}
+
+// MSTI returns the instance of the message
+func (m *MSTIMessage) MSTI() uint16 {
+	return m.RegionalRootID.Priority() & 0x0fff
+}
+
+/*
+BPDU is a configuration, topology change notification, rapid or multiple
+spanning tree BPDU without its llc header. RootCost of an MST BPDU is the
+external root path cost of the common tree and its BridgeID is sent after
+the fields of RST BPDUs, where it has the regional root. other BPDUs name
+their designated bridge as the regional root, the way an MST bridge reads
+them.
+*/
+type BPDU struct {
+	Version        uint8
+	Type           uint8
+	Flags          uint8
+	RootID         BridgeID
+	RootCost       uint32
+	RegionalRootID BridgeID
+	BridgeID       BridgeID
+	PortID         uint16
+	MessageAge     time.Duration
+	MaxAge         time.Duration
+	HelloTime      time.Duration
+	ForwardDelay   time.Duration
+	MSTConfigID    MSTConfigID // MST BPDUs only
+	InternalCost   uint32
+	RemainingHops  uint8
+	MSTIs          []MSTIMessage
+}
+
+// BPDU times are sent in 1/256 of a second
+func bpduTime(d time.Duration) uint16 {
+	return uint16(d * 256 / time.Second)
+}
+
+func bpduDuration(t uint16) time.Duration {
+	return time.Duration(t) * time.Second / 256
+}
+
+// Role returns the port role in the flags of an RST BPDU
+func (b *BPDU) Role() uint8 {
+	return (b.Flags >> 2) & 0x03
+}
+
+// MST reports whether b is an MST BPDU
+func (b *BPDU) MST() bool {
+	return b.Type == BPDU_TYPE_RST && b.Version >= MSTP_VERSION
+}
+
+func (b *BPDU) MarshalBinary() ([]byte, error) {
+	n := 0
+	switch b.Type {
+	case BPDU_TYPE_TCN:
+		n = bpduTCNLen
+	case BPDU_TYPE_CONFIG:
+		n = bpduConfigLen
+	case BPDU_TYPE_RST:
+		n = bpduRSTLen
+		if b.MST() {
+			if len(b.MSTIs) > MST_MAX_INSTANCES {
+				return nil, fmt.Errorf("%w: %d msti messages", ErrInvalidBPDU, len(b.MSTIs))
+			}
+			n = bpduMSTLen + len(b.MSTIs)*mstiMessageLen
+		}
+	default:
+		return nil, fmt.Errorf("%w: unknown type %#x", ErrInvalidBPDU, b.Type)
+	}
+	p := make([]byte, len(bpduLLC)+n)
+	copy(p, bpduLLC)
+	d := p[len(bpduLLC):]
+	// protocol identifier 0
+	d[2] = b.Version
+	d[3] = b.Type
+	if b.Type == BPDU_TYPE_TCN {
+		return p, nil
+	}
+	d[4] = b.Flags
+	binary.BigEndian.PutUint64(d[5:], uint64(b.RootID))
+	binary.BigEndian.PutUint32(d[13:], b.RootCost)
+	if b.MST() {
+		binary.BigEndian.PutUint64(d[17:], uint64(b.RegionalRootID))
+	} else {
+		binary.BigEndian.PutUint64(d[17:], uint64(b.BridgeID))
+	}
+	binary.BigEndian.PutUint16(d[25:], b.PortID)
+	binary.BigEndian.PutUint16(d[27:], bpduTime(b.MessageAge))
+	binary.BigEndian.PutUint16(d[29:], bpduTime(b.MaxAge))
+	binary.BigEndian.PutUint16(d[31:], bpduTime(b.HelloTime))
+	binary.BigEndian.PutUint16(d[33:], bpduTime(b.ForwardDelay))
+	// the version 1 length of RST BPDUs is 0
+	if !b.MST() {
+		return p, nil
+	}
+	binary.BigEndian.PutUint16(d[36:], uint16(n-bpduMSTLen+64))
+	// configuration identifier format selector 0
+	copy(d[39:71], b.MSTConfigID.Name)
+	binary.BigEndian.PutUint16(d[71:], b.MSTConfigID.Revision)
+	copy(d[73:89], b.MSTConfigID.Digest[:])
+	binary.BigEndian.PutUint32(d[89:], b.InternalCost)
+	binary.BigEndian.PutUint64(d[93:], uint64(b.BridgeID))
+	d[101] = b.RemainingHops
+	for i, m := range b.MSTIs {
+		o := d[bpduMSTLen+i*mstiMessageLen:]
+		o[0] = m.Flags
+		binary.BigEndian.PutUint64(o[1:], uint64(m.RegionalRootID))
+		binary.BigEndian.PutUint32(o[9:], m.InternalCost)
+		o[13] = m.BridgePriority
+		o[14] = m.PortPriority
+		o[15] = m.RemainingHops
+	}
+	return p, nil
+}
+
+// UnmarshalBinary parses the payload of an 802.3 frame. the padding of short
+// frames is ignored
+func (b *BPDU) UnmarshalBinary(p []byte) error {
+	if len(p) < len(bpduLLC)+bpduTCNLen || !bytes.Equal(p[:len(bpduLLC)], bpduLLC) {
+		return fmt.Errorf("%w: no llc header", ErrInvalidBPDU)
+	}
+	d := p[len(bpduLLC):]
+	if binary.BigEndian.Uint16(d) != 0 {
+		return fmt.Errorf("%w: unknown protocol %#x", ErrInvalidBPDU, binary.BigEndian.Uint16(d))
+	}
+	b.Version = d[2]
+	b.Type = d[3]
+	switch b.Type {
+	case BPDU_TYPE_TCN:
+		return nil
+	case BPDU_TYPE_CONFIG:
+		if len(d) < bpduConfigLen {
+			return fmt.Errorf("%w: config bpdu of %d bytes", ErrInvalidBPDU, len(d))
+		}
+	case BPDU_TYPE_RST:
+		// MST BPDUs carry the same fields for the common tree
+		if len(d) < bpduRSTLen {
+			return fmt.Errorf("%w: rst bpdu of %d bytes", ErrInvalidBPDU, len(d))
+		}
+	default:
+		return fmt.Errorf("%w: unknown type %#x", ErrInvalidBPDU, b.Type)
+	}
+	b.Flags = d[4]
+	if b.Type == BPDU_TYPE_CONFIG {
+		b.Flags &= BPDU_FLAG_TC | BPDU_FLAG_TC_ACK
+	}
+	b.RootID = BridgeID(binary.BigEndian.Uint64(d[5:]))
+	b.RootCost = binary.BigEndian.Uint32(d[13:])
+	b.BridgeID = BridgeID(binary.BigEndian.Uint64(d[17:]))
+	b.RegionalRootID = b.BridgeID
+	b.PortID = binary.BigEndian.Uint16(d[25:])
+	b.MessageAge = bpduDuration(binary.BigEndian.Uint16(d[27:]))
+	b.MaxAge = bpduDuration(binary.BigEndian.Uint16(d[29:]))
+	b.HelloTime = bpduDuration(binary.BigEndian.Uint16(d[31:]))
+	b.ForwardDelay = bpduDuration(binary.BigEndian.Uint16(d[33:]))
+	b.MSTConfigID = MSTConfigID{}
+	b.InternalCost = 0
+	b.RemainingHops = 0
+	b.MSTIs = nil
+	if b.MST() && !b.unmarshalMST(d) {
+		// 802.1Q reads a BPDU of a later version that is not a valid MST BPDU
+		// as an RST BPDU
+		b.Version = RSTP_VERSION
+	}
+	return nil
+}
+
+func (b *BPDU) unmarshalMST(d []byte) bool {
+	if len(d) < bpduMSTLen {
+		return false
+	}
+	v3 := int(binary.BigEndian.Uint16(d[36:]))
+	if v3 < 64 || (v3-64)%mstiMessageLen != 0 || (v3-64)/mstiMessageLen > MST_MAX_INSTANCES || len(d) < bpduMSTLen-64+v3 {
+		return false
+	}
+	b.MSTConfigID.Name = string(bytes.TrimRight(d[39:71], "\x00"))
+	b.MSTConfigID.Revision = binary.BigEndian.Uint16(d[71:])
+	copy(b.MSTConfigID.Digest[:], d[73:89])
+	b.InternalCost = binary.BigEndian.Uint32(d[89:])
+	b.BridgeID = BridgeID(binary.BigEndian.Uint64(d[93:]))
+	b.RemainingHops = d[101]
+	for i := 0; i < (v3-64)/mstiMessageLen; i++ {
+		o := d[bpduMSTLen+i*mstiMessageLen:]
+		b.MSTIs = append(b.MSTIs, MSTIMessage{
+			Flags:          o[0],
+			RegionalRootID: BridgeID(binary.BigEndian.Uint64(o[1:])),
+			InternalCost:   binary.BigEndian.Uint32(o[9:]),
+			BridgePriority: o[13],
+			PortPriority:   o[14],
+			RemainingHops:  o[15],
+		})
+	}
+	return true
+}
+
+/*
+priorityVector is the spanning tree information a port sends or receives.
+lower vectors are better. RootCost of the common tree is the external root
+path cost. RegionalRoot and InternalCost are only set for the common tree:
+outside of an MST region the designated bridge is its own regional root.
+the vectors of an MSTI have the regional root in RootID and the internal
+root path cost in RootCost.
+*/
+type priorityVector struct {
+	RootID       BridgeID
+	RootCost     uint32
+	RegionalRoot BridgeID
+	InternalCost uint32
+	BridgeID     BridgeID // designated bridge
+	PortID       uint16   // designated port
+}
+
+func (v priorityVector) better(o priorityVector) bool {
+	if v.RootID != o.RootID {
+		return v.RootID < o.RootID
+	}
+	if v.RootCost != o.RootCost {
+		return v.RootCost < o.RootCost
+	}
+	if v.RegionalRoot != o.RegionalRoot {
+		return v.RegionalRoot < o.RegionalRoot
+	}
+	if v.InternalCost != o.InternalCost {
+		return v.InternalCost < o.InternalCost
+	}
+	if v.BridgeID != o.BridgeID {
+		return v.BridgeID < o.BridgeID
+	}
+	return v.PortID < o.PortID
+}
+
+type bpduTimes struct {
+	MessageAge   time.Duration
+	MaxAge       time.Duration
+	HelloTime    time.Duration
+	ForwardDelay time.Duration
+}
+
+type PortRole int
+
+const (
+	RoleDisabled PortRole = iota
+	RoleRoot
+	RoleDesignated
+	RoleAlternate
+	RoleBackup
+	RoleMaster // a region boundary port of an MSTI that is the root port of the common tree
+)
+
+func (r PortRole) String() string {
+	switch r {
+	case RoleDisabled:
+		return "disabled"
+	case RoleRoot:
+		return "root"
+	case RoleDesignated:
+		return "designated"
+	case RoleAlternate:
+		return "alternate"
+	case RoleBackup:
+		return "backup"
+	case RoleMaster:
+		return "master"
+	}
+	return "unknown"
+}
+
+func (r PortRole) bpduRole() uint8 {
+	switch r {
+	case RoleRoot:
+		return bpduRoleRoot
+	case RoleDesignated:
+		return bpduRoleDesignated
+	case RoleAlternate, RoleBackup:
+		return bpduRoleAlternate
+	}
+	return bpduRoleUnknown
+}
+
+// STPInstancePortConfig sets the priority and cost of a port in an MST
+// instance
+type STPInstancePortConfig struct {
+	Instance int
+	Priority *int // the priority of the port if not set
+	Cost     int  // the cost of the port if not set
+}
+
+type STPPortConfig struct {
+	Priority  *int // 0 to 240 in steps of 16. STP_PORT_PRIORITY if not set
+	Cost      int  // path cost of the port. STP_PATH_COST if not set
+	Edge      bool // no bridge is behind the port. it forwards right away until it receives a BPDU
+	Disabled  bool // BPDUs are neither sent nor received on the port and it always forwards
+	Instances []STPInstancePortConfig
+}
+
+type MSTInstanceConfig struct {
+	ID       int   // 1 to 4094
+	VLANs    []int // the vlans that follow the instance. the others follow the common tree
+	Priority *int  // 0 to 61440 in steps of 4096. STP_PRIORITY if not set
+}
+
+type STPConfig struct {
+	Priority            *int   // 0 to 61440 in steps of 4096. STP_PRIORITY if not set
+	MAC                 string // address of the bridge id. a random locally administered address if not set
+	Version             string // "rstp", "stp" to leave out proposals and agreements or "mstp". rstp if not set
+	HelloSeconds        int    // STP_HELLO_TIME if not set
+	MaxAgeSeconds       int    // STP_MAX_AGE if not set
+	ForwardDelaySeconds int    // STP_FORWARD_DELAY if not set
+	Region              string // MST region name. the address of the bridge if not set
+	Revision            int    // MST region revision
+	MaxHops             int    // STP_MAX_HOPS if not set
+	Instances           []MSTInstanceConfig
+	Ports               map[string]STPPortConfig
+}
+
+type MSTInstance struct {
+	ID       uint16
+	VLANs    []int // sorted
+	Priority uint16
+}
+
+// STPSettings is the STPConfig in the form the bridge reads it
+type STPSettings struct {
+	Priority     uint16
+	MAC          net.HardwareAddr // nil for a random address
+	ForceSTP     bool
+	MSTP         bool
+	HelloTime    time.Duration
+	MaxAge       time.Duration
+	ForwardDelay time.Duration
+	Region       string
+	Revision     uint16
+	MaxHops      uint8
+	Instances    []MSTInstance // sorted by id
+	Ports        map[string]STPPortConfig
+}
+
+func defaultSTPSettings() *STPSettings {
+	return &STPSettings{
+		Priority:     STP_PRIORITY,
+		HelloTime:    STP_HELLO_TIME,
+		MaxAge:       STP_MAX_AGE,
+		ForwardDelay: STP_FORWARD_DELAY,
+		MaxHops:      STP_MAX_HOPS,
+		Ports:        map[string]STPPortConfig{},
+	}
+}
+
+func (s *STPSettings) times() bpduTimes {
+	return bpduTimes{MaxAge: s.MaxAge, HelloTime: s.HelloTime, ForwardDelay: s.ForwardDelay}
+}
+
+func (s *STPSettings) protocol() string {
+	switch {
+	case s.ForceSTP:
+		return "stp"
+	case s.MSTP:
+		return "mstp"
+	}
+	return "rstp"
+}
+
+// port returns the port id priority and the path cost of a port in the
+// common tree (msti 0) or an MST instance
+func (s *STPSettings) port(name string, msti uint16) (priority uint16, cost uint32) {
+	cfg := s.Ports[name]
+	priority = STP_PORT_PRIORITY
+	if cfg.Priority != nil {
+		priority = uint16(*cfg.Priority)
+	}
+	cost = STP_PATH_COST
+	if cfg.Cost > 0 {
+		cost = uint32(cfg.Cost)
+	}
+	for _, inst := range cfg.Instances {
+		if inst.Instance != int(msti) {
+			continue
+		}
+		if inst.Priority != nil {
+			priority = uint16(*inst.Priority)
+		}
+		if inst.Cost > 0 {
+			cost = uint32(inst.Cost)
+		}
+	}
+	return priority, cost
+}
+
+// configID returns the MST configuration identifier of a bridge with the
+// address mac
+func (s *STPSettings) configID(mac net.HardwareAddr) MSTConfigID {
+	id := MSTConfigID{Name: s.Region, Revision: s.Revision, Digest: mstDigest(s.Instances)}
+	if id.Name == "" {
+		id.Name = mac.String()
+	}
+	return id
+}
+
+// mstDigest returns the digest of the table of the instance of every vlan
+func mstDigest(instances []MSTInstance) [16]byte {
+	table := make([]byte, 4096*2)
+	for _, inst := range instances {
+		for _, vlan := range inst.VLANs {
+			binary.BigEndian.PutUint16(table[vlan*2:], inst.ID)
+		}
+	}
+	mac := hmac.New(md5.New, mstDigestKey)
+	mac.Write(table)
+	digest := [16]byte{}
+	copy(digest[:], mac.Sum(nil))
+	return digest
+}
+
+func validPriority(priority *int) bool {
+	return priority == nil || (*priority >= 0 && *priority <= 61440 && *priority%4096 == 0)
+}
+
+func validPortPriority(priority *int) bool {
+	return priority == nil || (*priority >= 0 && *priority <= 240 && *priority%16 == 0)
+}
+
+func parseSTPConfig(conf STPConfig) (*STPSettings, error) {
+	s := defaultSTPSettings()
+	if !validPriority(conf.Priority) {
+		return nil, fmt.Errorf("%w: priority %d is not 0 to 61440 in steps of 4096", ErrSTPConfig, *conf.Priority)
+	}
+	if conf.Priority != nil {
+		s.Priority = uint16(*conf.Priority)
+	}
+	if conf.MAC != "" {
+		mac, err := net.ParseMAC(conf.MAC)
+		if err != nil || len(mac) != 6 {
+			return nil, fmt.Errorf("%w: mac %q", ErrSTPConfig, conf.MAC)
+		}
+		s.MAC = mac
+	}
+	switch conf.Version {
+	case "", "rstp":
+	case "stp":
+		s.ForceSTP = true
+	case "mstp":
+		s.MSTP = true
+	default:
+		return nil, fmt.Errorf("%w: unknown version %q", ErrSTPConfig, conf.Version)
+	}
+	if conf.HelloSeconds != 0 {
+		s.HelloTime = time.Duration(conf.HelloSeconds) * time.Second
+	}
+	if conf.MaxAgeSeconds != 0 {
+		s.MaxAge = time.Duration(conf.MaxAgeSeconds) * time.Second
+	}
+	if conf.ForwardDelaySeconds != 0 {
+		s.ForwardDelay = time.Duration(conf.ForwardDelaySeconds) * time.Second
+	}
+	// the timers of 802.1D
+	if s.HelloTime < time.Second || s.HelloTime > 10*time.Second ||
+		s.MaxAge < 6*time.Second || s.MaxAge > 40*time.Second ||
+		s.ForwardDelay < 4*time.Second || s.ForwardDelay > 30*time.Second ||
+		s.MaxAge > 2*(s.ForwardDelay-time.Second) || s.MaxAge < 2*(s.HelloTime+time.Second) {
+		return nil, fmt.Errorf("%w: hello %s, max age %s and forward delay %s do not fit together", ErrSTPConfig, s.HelloTime, s.MaxAge, s.ForwardDelay)
+	}
+	if len(conf.Region) > 32 {
+		return nil, fmt.Errorf("%w: region name %q is longer than 32 bytes", ErrSTPConfig, conf.Region)
+	}
+	s.Region = conf.Region
+	if conf.Revision < 0 || conf.Revision > 0xffff {
+		return nil, fmt.Errorf("%w: region revision %d", ErrSTPConfig, conf.Revision)
+	}
+	s.Revision = uint16(conf.Revision)
+	if conf.MaxHops != 0 {
+		if conf.MaxHops < 6 || conf.MaxHops > 40 {
+			return nil, fmt.Errorf("%w: max hops %d is not 6 to 40", ErrSTPConfig, conf.MaxHops)
+		}
+		s.MaxHops = uint8(conf.MaxHops)
+	}
+	if len(conf.Instances) > 0 && !s.MSTP {
+		return nil, fmt.Errorf("%w: instances need version mstp", ErrSTPConfig)
+	}
+	if len(conf.Instances) > MST_MAX_INSTANCES {
+		return nil, fmt.Errorf("%w: %d instances. at most %d", ErrSTPConfig, len(conf.Instances), MST_MAX_INSTANCES)
+	}
+	instances := map[int]bool{}
+	vlans := map[int]int{}
+	for _, inst := range conf.Instances {
+		if inst.ID < 1 || inst.ID > 4094 || instances[inst.ID] {
+			return nil, fmt.Errorf("%w: instance %d is not 1 to 4094 or set twice", ErrSTPConfig, inst.ID)
+		}
+		instances[inst.ID] = true
+		if !validPriority(inst.Priority) {
+			return nil, fmt.Errorf("%w: priority %d of instance %d is not 0 to 61440 in steps of 4096", ErrSTPConfig, *inst.Priority, inst.ID)
+		}
+		mst := MSTInstance{ID: uint16(inst.ID), Priority: STP_PRIORITY}
+		if inst.Priority != nil {
+			mst.Priority = uint16(*inst.Priority)
+		}
+		if len(inst.VLANs) == 0 {
+			return nil, fmt.Errorf("%w: instance %d has no vlans", ErrSTPConfig, inst.ID)
+		}
+		for _, vlan := range inst.VLANs {
+			if vlan < 1 || vlan > 4094 {
+				return nil, fmt.Errorf("%w: vlan %d of instance %d", ErrSTPConfig, vlan, inst.ID)
+			}
+			other, ok := vlans[vlan]
+			if ok {
+				return nil, fmt.Errorf("%w: vlan %d is in instances %d and %d", ErrSTPConfig, vlan, other, inst.ID)
+			}
+			vlans[vlan] = inst.ID
+			mst.VLANs = append(mst.VLANs, vlan)
+		}
+		sort.Ints(mst.VLANs)
+		s.Instances = append(s.Instances, mst)
+	}
+	sort.Slice(s.Instances, func(i, j int) bool {
+		return s.Instances[i].ID < s.Instances[j].ID
+	})
+	for name, port := range conf.Ports {
+		if !validPortPriority(port.Priority) {
+			return nil, fmt.Errorf("%w: priority %d of port %s is not 0 to 240 in steps of 16", ErrSTPConfig, *port.Priority, name)
+		}
+		if port.Cost < 0 {
+			return nil, fmt.Errorf("%w: cost %d of port %s", ErrSTPConfig, port.Cost, name)
+		}
+		for _, inst := range port.Instances {
+			if !instances[inst.Instance] {
+				return nil, fmt.Errorf("%w: port %s has settings for unknown instance %d", ErrSTPConfig, name, inst.Instance)
+			}
+			if !validPortPriority(inst.Priority) {
+				return nil, fmt.Errorf("%w: priority %d of port %s in instance %d is not 0 to 240 in steps of 16", ErrSTPConfig, *inst.Priority, name, inst.Instance)
+			}
+			if inst.Cost < 0 {
+				return nil, fmt.Errorf("%w: cost %d of port %s in instance %d", ErrSTPConfig, inst.Cost, name, inst.Instance)
+			}
+		}
+		s.Ports[name] = port
+	}
+	return s, nil
+}
+
+func readSTPConfig(path string) (*STPSettings, error) {
+	if path == "" {
+		return defaultSTPSettings(), nil
+	}
+	conf := STPConfig{}
+	err := config.ReadConfigFile(path, &conf)
+	if err != nil {
+		return nil, err
+	}
+	return parseSTPConfig(conf)
+}
+
+// stpPort is a port of the bridge. its role and state in every tree are in
+// the treePort of the tree
+type stpPort struct {
+	port        *dataplane.SwitchPort
+	number      uint16
+	adminEdge   bool
+	edge        bool // lost when a BPDU is received
+	disabled    bool
+	up          bool
+	tcAck       bool // the next config BPDU of the port acknowledges a topology change notification
+	stpNeighbor bool // the bridge behind the port only speaks 802.1D
+	internal    bool // the bridge behind the port is in the MST region of this bridge
+	newInfo     bool // a BPDU is sent on the port right away
+	rx          uint64
+	tx          uint64
+}
+
+type treePort struct {
+	id          uint16
+	cost        uint32
+	role        PortRole
+	boundary    bool // the role of an MSTI port was given at the boundary of the region
+	state       dataplane.PortState
+	info        *priorityVector // best information received from the designated bridge of the port. nil when it aged out
+	infoTimes   bpduTimes
+	infoHops    uint8
+	infoExpires time.Time
+	stateTimer  time.Time // a root or designated port that is not forwarding moves on to the next state then
+	proposing   bool      // a designated port asks the bridge behind it to agree to its forwarding
+	agreed      bool      // the bridge behind a designated port agreed
+	agree       bool      // the next BPDU of the port agrees to the proposal it received
+	tcWhile     time.Time // BPDUs of the port carry a topology change until then
+}
+
+// flags returns the flags of the RST BPDU or MSTI message of the port
+func (tp *treePort) flags(tc bool) uint8 {
+	flags := tp.role.bpduRole() << 2
+	if tc {
+		flags |= BPDU_FLAG_TC
+	}
+	if tp.proposing && tp.role == RoleDesignated {
+		flags |= BPDU_FLAG_PROPOSAL
+	}
+	if tp.agree {
+		flags |= BPDU_FLAG_AGREEMENT
+		tp.agree = false
+	}
+	if tp.state.Learns() {
+		flags |= BPDU_FLAG_LEARNING
+	}
+	if tp.state.Forwards() {
+		flags |= BPDU_FLAG_FORWARDING
+	}
+	return flags
+}
+
+// stpTree is the common spanning tree (msti 0) or a multiple spanning tree
+// instance of the bridge
+type stpTree struct {
+	msti               uint16
+	vlans              []int // of an MSTI
+	id                 BridgeID
+	root               priorityVector // the best of the bridge's own vector and the ones received on its ports
+	rootPort           string
+	rootTimes          bpduTimes // of the common tree
+	hops               uint8     // remaining hops of the root information
+	ports              map[string]*treePort
+	topologyChanges    uint64
+	lastTopologyChange time.Time
+	log                *slog.Logger
+}
+
+func newSTPTree(msti uint16, vlans []int) *stpTree {
+	t := &stpTree{msti: msti, vlans: vlans, ports: map[string]*treePort{}, log: stpLog}
+	if msti != 0 {
+		t.log = stpLog.With("instance", msti)
+	}
+	return t
+}
+
+/*
+STPBridge runs the rapid or multiple spanning tree of the switch. the
+pipeline gives it the BPDUs it receives, the loop of the process runs its
+timers and follows the ports going up and down, and the management api reads
+its status.
+
+The ports of the switch forward until the process starts. it blocks them and
+moves the root and designated ports to forwarding: right away when the
+bridge behind a port agrees to its proposal, after twice the forward delay
+otherwise. the ports forward again when the process is removed.
+
+With MSTP the common tree sets the state of the ports for the vlans that are
+in no instance and every instance sets it for its vlans. inside a region the
+instances build their own trees. on the ports at the boundary of the region
+they follow the common tree.
+*/
+type STPBridge struct {
+	sw       *controlplane.Switch
+	mutex    *sync.Mutex
+	settings *STPSettings
+	mac      net.HardwareAddr
+	id       BridgeID
+	mcid     MSTConfigID
+	ports    map[string]*stpPort
+	numbers  uint16
+	cist     *stpTree
+	mstis    []*stpTree // sorted by instance
+	helloDue time.Time
+	stopped  bool // the ports are left alone once the process is removed
+}
+
+func NewSTPBridge(sw *controlplane.Switch, settings *STPSettings) *STPBridge {
+	b := &STPBridge{sw: sw, mutex: &sync.Mutex{}, ports: map[string]*stpPort{}, cist: newSTPTree(0, nil)}
+	b.setSettings(settings, time.Now())
+	b.cist.root = b.ownVector(b.cist)
+	b.cist.rootTimes = settings.times()
+	b.cist.hops = settings.MaxHops
+	return b
+}
+
+// randomMAC returns a locally administered unicast address
+func randomMAC() net.HardwareAddr {
+	mac := make(net.HardwareAddr, 6)
+	rand.Read(mac)
+	mac[0] = (mac[0] | 0x02) &^ 0x01
+	return mac
+}
+
+func (b *STPBridge) setSettings(s *STPSettings, now time.Time) {
+	if s.MAC != nil {
+		b.mac = s.MAC
+	} else if b.mac == nil {
+		b.mac = randomMAC()
+	}
+	b.settings = s
+	b.id = NewBridgeID(s.Priority, b.mac)
+	b.cist.id = b.id
+	mcid := s.configID(b.mac)
+	if mcid != b.mcid {
+		// the ports find out again whether the bridges behind them are in the region
+		for _, p := range b.ports {
+			p.internal = false
+		}
+		b.mcid = mcid
+	}
+	if !b.sameInstances(s.Instances) {
+		b.buildMSTIs(now)
+	}
+	for i, inst := range s.Instances {
+		b.mstis[i].id = NewBridgeID(inst.Priority|inst.ID, b.mac)
+	}
+	for name, p := range b.ports {
+		b.configurePort(name, p)
+	}
+}
+
+func (b *STPBridge) sameInstances(instances []MSTInstance) bool {
+	if len(instances) != len(b.mstis) {
+		return false
+	}
+	for i, inst := range instances {
+		if inst.ID != b.mstis[i].msti || !slices.Equal(inst.VLANs, b.mstis[i].vlans) {
+			return false
+		}
+	}
+	return true
+}
+
+// buildMSTIs replaces the instances after the vlan to instance mapping
+// changed. their ports start blocking like new ports
+func (b *STPBridge) buildMSTIs(now time.Time) {
+	for _, p := range b.ports {
+		p.port.ClearVLANPortStates()
+	}
+	b.mstis = nil
+	for _, inst := range b.settings.Instances {
+		t := newSTPTree(inst.ID, inst.VLANs)
+		t.id = NewBridgeID(inst.Priority|inst.ID, b.mac)
+		t.root = b.ownVector(t)
+		t.hops = b.settings.MaxHops
+		b.mstis = append(b.mstis, t)
+		for name, p := range b.ports {
+			// the vlans of the instance follow the common tree until then
+			tp := &treePort{state: p.port.PortState()}
+			t.ports[name] = tp
+			if !p.disabled {
+				b.setState(t, name, p, tp, dataplane.PortBlocking, now)
+			}
+		}
+		stpLog.Info("instance created", "instance", inst.ID, "vlans", inst.VLANs)
+	}
+}
+
+func (b *STPBridge) trees() []*stpTree {
+	return append([]*stpTree{b.cist}, b.mstis...)
+}
+
+func (b *STPBridge) instance(msti uint16) *stpTree {
+	for _, t := range b.mstis {
+		if t.msti == msti {
+			return t
+		}
+	}
+	return nil
+}
+
+func (b *STPBridge) configurePort(name string, p *stpPort) {
+	for _, t := range b.trees() {
+		tp := t.ports[name]
+		priority, cost := b.settings.port(name, t.msti)
+		tp.id = priority<<8 | p.number
+		tp.cost = cost
+	}
+	cfg := b.settings.Ports[name]
+	if p.adminEdge != cfg.Edge {
+		p.adminEdge = cfg.Edge
+		p.edge = cfg.Edge
+	}
+	p.disabled = cfg.Disabled
+}
+
+func (b *STPBridge) rapid(p *stpPort) bool {
+	return !b.settings.ForceSTP && !p.stpNeighbor
+}
+
+// boundary reports whether the port of an MSTI follows the common tree
+func (b *STPBridge) boundary(t *stpTree, p *stpPort) bool {
+	return t.msti != 0 && !p.internal
+}
+
+func (b *STPBridge) setInternal(name string, p *stpPort, internal bool) {
+	if p.internal == internal {
+		return
+	}
+	p.internal = internal
+	if internal {
+		stpLog.Info("bridge behind port is in the region", "port", name, "region", b.mcid.Name)
+	} else {
+		stpLog.Info("port is at the boundary of the region", "port", name, "region", b.mcid.Name)
+	}
+}
+
+// syncPorts follows the ports added to and removed from the switch
+func (b *STPBridge) syncPorts(now time.Time) {
+	ports := b.sw.PortMap()
+	names := []string{}
+	for name := range ports {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		port := ports[name]
+		p, ok := b.ports[name]
+		if ok && p.port == port {
+			continue
+		}
+		if b.numbers < 0xfff {
+			b.numbers++
+		}
+		p = &stpPort{port: port, number: b.numbers}
+		b.ports[name] = p
+		for _, t := range b.trees() {
+			t.ports[name] = &treePort{state: port.PortState()}
+		}
+		b.configurePort(name, p)
+		p.edge = p.adminEdge
+		if p.disabled {
+			continue
+		}
+		for _, t := range b.trees() {
+			b.setState(t, name, p, t.ports[name], dataplane.PortBlocking, now)
+		}
+	}
+	for name := range b.ports {
+		_, ok := ports[name]
+		if ok {
+			continue
+		}
+		delete(b.ports, name)
+		for _, t := range b.trees() {
+			delete(t.ports, name)
+		}
+	}
+}
+
+func (b *STPBridge) sortedPorts() []string {
+	names := []string{}
+	for name := range b.ports {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ownVector is the vector of the bridge as the root of the tree
+func (b *STPBridge) ownVector(t *stpTree) priorityVector {
+	if t.msti != 0 {
+		return priorityVector{RootID: t.id, BridgeID: t.id}
+	}
+	return priorityVector{RootID: b.id, RegionalRoot: b.id, BridgeID: b.id}
+}
+
+// designatedVector is the vector the bridge sends on a port of the tree
+func (b *STPBridge) designatedVector(t *stpTree, tp *treePort) priorityVector {
+	return priorityVector{
+		RootID:       t.root.RootID,
+		RootCost:     t.root.RootCost,
+		RegionalRoot: t.root.RegionalRoot,
+		InternalCost: t.root.InternalCost,
+		BridgeID:     t.id,
+		PortID:       tp.id,
+	}
+}
+
+// update ages the received information out, elects the root port of every
+// tree and gives the ports their roles
+func (b *STPBridge) update(now time.Time) {
+	b.syncPorts(now)
+	names := b.sortedPorts()
+	for _, name := range names {
+		p := b.ports[name]
+		up := p.port.IsUp()
+		if !up && p.up {
+			for _, t := range b.trees() {
+				t.ports[name].info = nil
+			}
+			p.stpNeighbor = false
+			p.internal = false
+			p.edge = p.adminEdge
+		}
+		p.up = up
+		for _, t := range b.trees() {
+			tp := t.ports[name]
+			if p.disabled {
+				tp.info = nil
+				continue
+			}
+			if tp.info != nil && !now.Before(tp.infoExpires) {
+				t.log.Info("bpdu information aged out", "port", name, "bridge", tp.info.BridgeID)
+				tp.info = nil
+			}
+		}
+	}
+	for _, t := range b.trees() {
+		b.updateTree(t, names, now)
+	}
+}
+
+func (b *STPBridge) updateTree(t *stpTree, names []string, now time.Time) {
+	best, bestPort, times, hops := b.ownVector(t), "", b.settings.times(), b.settings.MaxHops
+	for _, name := range names {
+		p, tp := b.ports[name], t.ports[name]
+		if !p.up || p.disabled || tp.info == nil || tp.info.BridgeID == t.id || b.boundary(t, p) {
+			// our own BPDUs come back on a port behind the same segment as another port
+			continue
+		}
+		v := *tp.info
+		switch {
+		case t.msti != 0:
+			v.RootCost += tp.cost
+		case p.internal:
+			v.InternalCost += tp.cost
+		default:
+			// the root is outside of the region. this bridge is the regional root
+			v.RootCost += tp.cost
+			v.RegionalRoot = b.id
+			v.InternalCost = 0
+		}
+		if v.better(best) || (v == best && bestPort != "" && tp.id < t.ports[bestPort].id) {
+			best, bestPort, times, hops = v, name, tp.infoTimes, tp.infoHops-1
+		}
+	}
+	if bestPort != "" && !b.ports[bestPort].internal {
+		// the message age only grows outside of a region
+		times.MessageAge += time.Second
+		hops = b.settings.MaxHops
+	}
+	if best.RootID != t.root.RootID {
+		t.log.Info("root bridge changed", "root", best.RootID, "cost", best.RootCost, "port", bestPort, "old", t.root.RootID)
+	}
+	if best.RootID != t.root.RootID || best.RootCost != t.root.RootCost ||
+		best.RegionalRoot != t.root.RegionalRoot || best.InternalCost != t.root.InternalCost {
+		// the bridges behind the ports hear about the new root right away
+		for name, tp := range t.ports {
+			tp.agreed = false
+			b.ports[name].newInfo = true
+		}
+	}
+	newRoot := bestPort != t.rootPort
+	t.root, t.rootPort, t.hops = best, bestPort, hops
+	if t.msti == 0 {
+		t.rootTimes = times
+	}
+
+	roles := map[string]PortRole{}
+	for _, name := range names {
+		roles[name] = b.portRole(t, name, b.ports[name], t.ports[name])
+	}
+	// ports stop forwarding before others start so the new root port never
+	// forwards together with the old one
+	for _, name := range names {
+		switch roles[name] {
+		case RoleDisabled, RoleAlternate, RoleBackup:
+			b.setRole(t, name, b.ports[name], t.ports[name], roles[name], now)
+		}
+	}
+	if newRoot && bestPort != "" {
+		b.sync(t, now)
+	}
+	for _, name := range names {
+		p, tp := b.ports[name], t.ports[name]
+		b.setRole(t, name, p, tp, roles[name], now)
+		switch {
+		case p.disabled:
+			b.setState(t, name, p, tp, dataplane.PortForwarding, now)
+		case b.boundary(t, p) && tp.role != RoleDisabled:
+			b.setState(t, name, p, tp, b.cist.ports[name].state, now)
+		}
+	}
+}
+
+func (b *STPBridge) portRole(t *stpTree, name string, p *stpPort, tp *treePort) PortRole {
+	if !p.up || p.disabled {
+		return RoleDisabled
+	}
+	if b.boundary(t, p) {
+		role := b.cist.ports[name].role
+		if role == RoleRoot {
+			return RoleMaster
+		}
+		return role
+	}
+	if name == t.rootPort {
+		return RoleRoot
+	}
+	if tp.info != nil && tp.info.better(b.designatedVector(t, tp)) {
+		if tp.info.BridgeID == t.id {
+			return RoleBackup
+		}
+		return RoleAlternate
+	}
+	return RoleDesignated
+}
+
+// setRole gives a port its role. a port of an MSTI that moves into or out
+// of the region starts over in its role
+func (b *STPBridge) setRole(t *stpTree, name string, p *stpPort, tp *treePort, role PortRole, now time.Time) {
+	boundary := b.boundary(t, p)
+	if tp.role == role && tp.boundary == boundary {
+		return
+	}
+	if tp.role != role {
+		t.log.Info("port role changed", "port", name, "role", role, "old", tp.role)
+	}
+	tp.role = role
+	tp.boundary = boundary
+	tp.proposing = false
+	tp.agreed = false
+	tp.agree = false
+	if boundary && role != RoleDisabled {
+		b.setState(t, name, p, tp, b.cist.ports[name].state, now)
+		return
+	}
+	switch role {
+	case RoleDisabled, RoleAlternate, RoleBackup:
+		b.setState(t, name, p, tp, dataplane.PortBlocking, now)
+	case RoleRoot:
+		if b.rapid(p) {
+			b.setState(t, name, p, tp, dataplane.PortForwarding, now)
+			return
+		}
+		if tp.state != dataplane.PortForwarding {
+			tp.stateTimer = now.Add(b.cist.rootTimes.ForwardDelay)
+		}
+	case RoleDesignated:
+		if p.edge {
+			b.setState(t, name, p, tp, dataplane.PortForwarding, now)
+			return
+		}
+		// the bridge behind the port may still forward towards the old root
+		b.setState(t, name, p, tp, dataplane.PortBlocking, now)
+		tp.stateTimer = now.Add(b.cist.rootTimes.ForwardDelay)
+		tp.proposing = b.rapid(p)
+		p.newInfo = true
+	}
+}
+
+func (b *STPBridge) setState(t *stpTree, name string, p *stpPort, tp *treePort, state dataplane.PortState, now time.Time) {
+	if tp.state == state {
+		return
+	}
+	tp.state = state
+	if t.msti == 0 {
+		p.port.SetPortState(state)
+	} else {
+		p.port.SetVLANPortState(t.vlans, state)
+	}
+	if state != dataplane.PortForwarding {
+		tp.stateTimer = now.Add(b.cist.rootTimes.ForwardDelay)
+	}
+	t.log.Info("port state changed", "port", name, "state", state, "role", tp.role)
+	b.sw.Events.Publish(controlplane.Event{Type: controlplane.EventSTPPortState, Port: name, Role: tp.role.String(), State: state.String(), Instance: int(t.msti)})
+	if state == dataplane.PortForwarding && !p.edge && !p.disabled && !b.boundary(t, p) {
+		b.topologyChange(t, name, now)
+	}
+	if t.msti != 0 {
+		return
+	}
+	// the boundary ports of the instances follow
+	for _, mt := range b.mstis {
+		mp := mt.ports[name]
+		if mp != nil && b.boundary(mt, p) && mp.role != RoleDisabled {
+			b.setState(mt, name, p, mp, state, now)
+		}
+	}
+}
+
+// sync blocks the designated ports the bridges behind them did not agree on
+// before a new root port forwards or the root port agrees to a proposal
+func (b *STPBridge) sync(t *stpTree, now time.Time) {
+	for name, tp := range t.ports {
+		p := b.ports[name]
+		if tp.role != RoleDesignated || p.edge || tp.agreed || b.boundary(t, p) {
+			continue
+		}
+		if tp.state != dataplane.PortBlocking {
+			b.setState(t, name, p, tp, dataplane.PortBlocking, now)
+		}
+		tp.proposing = b.rapid(p)
+		p.newInfo = true
+	}
+}
+
+// advance moves the root and designated ports that are not forwarding to
+// the next state once their forward delay passed
+func (b *STPBridge) advance(now time.Time) {
+	for _, t := range b.trees() {
+		for _, name := range b.sortedPorts() {
+			p, tp := b.ports[name], t.ports[name]
+			if (tp.role != RoleRoot && tp.role != RoleDesignated) || tp.state == dataplane.PortForwarding || now.Before(tp.stateTimer) || b.boundary(t, p) {
+				continue
+			}
+			if tp.state == dataplane.PortBlocking {
+				b.setState(t, name, p, tp, dataplane.PortLearning, now)
+			} else {
+				b.setState(t, name, p, tp, dataplane.PortForwarding, now)
+			}
+		}
+	}
+}
+
+// topologyChange is called when port starts forwarding in the tree
+func (b *STPBridge) topologyChange(t *stpTree, port string, now time.Time) {
+	t.topologyChanges++
+	t.lastTopologyChange = now
+	t.log.Info("topology changed", "port", port)
+	b.sw.Events.Publish(controlplane.Event{Type: controlplane.EventSTPTopology, Port: port, Instance: int(t.msti)})
+	b.propagateTC(t, port, true, now)
+}
+
+/*
+propagateTC tells the other bridges about a topology change of the tree
+detected on or received from port and flushes the addresses learned on the
+other ports since they may be behind another port now. an instance only
+flushes its vlans, the common tree every vlan.
+*/
+func (b *STPBridge) propagateTC(t *stpTree, port string, detected bool, now time.Time) {
+	tcWhile := now.Add(b.cist.rootTimes.HelloTime + time.Second)
+	if b.settings.ForceSTP {
+		tcWhile = now.Add(b.cist.rootTimes.MaxAge + b.cist.rootTimes.ForwardDelay)
+	}
+	flush := []string{}
+	for name, tp := range t.ports {
+		p := b.ports[name]
+		if p.edge || p.disabled || (tp.role != RoleRoot && tp.role != RoleDesignated && tp.role != RoleMaster) {
+			continue
+		}
+		if name == port && !detected {
+			continue
+		}
+		if !now.Before(tp.tcWhile) {
+			// a port already telling the bridge behind it does not start over.
+			// the changes of trees with different topologies would bounce
+			// between the bridges
+			tp.tcWhile = tcWhile
+			p.newInfo = true
+		}
+		if name != port {
+			flush = append(flush, name)
+		}
+	}
+	st, err := getSwitchTable(b.sw)
+	if err != nil {
+		return
+	}
+	n := 0
+	for _, name := range flush {
+		if t.msti == 0 {
+			n += st.Clear(MACQuery{Port: name, Type: MACDynamic})
+			continue
+		}
+		for _, vlan := range t.vlans {
+			n += st.Clear(MACQuery{VLAN: vlan, Port: name, Type: MACDynamic})
+		}
+	}
+	if n > 0 {
+		t.log.Debug("flushed addresses after topology change", "port", port, "entries", n)
+		b.sw.Events.Publish(controlplane.Event{Type: controlplane.EventMACFlushed})
+	}
+}
+
+// treeMessage is the information of a BPDU for one tree
+type treeMessage struct {
+	tree   *stpTree
+	vector priorityVector
+	flags  uint8
+	hops   uint8
+}
+
+// designated reports whether the message comes from the designated port of
+// the segment. config BPDUs always do
+func (m *treeMessage) designated(rst bool) bool {
+	return !rst || (m.flags>>2)&0x03 == bpduRoleDesignated
+}
+
+// Receive handles a BPDU received on port
+func (b *STPBridge) Receive(port *dataplane.SwitchPort, bpdu *BPDU) {
+	defer b.mutex.Unlock()
+	b.mutex.Lock()
+	if b.stopped {
+		return
+	}
+	now := time.Now()
+	b.syncPorts(now)
+	name := port.Name
+	p, ok := b.ports[name]
+	if !ok || p.port != port || p.disabled {
+		return
+	}
+	p.rx++
+	if p.edge {
+		stpLog.Info("bpdu received on edge port. it is no longer an edge port", "port", name)
+		p.edge = false
+	}
+	if bpdu.Type == BPDU_TYPE_TCN {
+		p.stpNeighbor = true
+		b.setInternal(name, p, false)
+		if b.cist.ports[name].role == RoleDesignated {
+			p.tcAck = true
+			p.newInfo = true
+			b.propagateTC(b.cist, name, false, now)
+		}
+		b.transmit(now)
+		return
+	}
+	rst := bpdu.Type == BPDU_TYPE_RST && bpdu.Version >= RSTP_VERSION
+	p.stpNeighbor = !rst
+	b.setInternal(name, p, b.settings.MSTP && bpdu.MST() && bpdu.MSTConfigID == b.mcid)
+	if bpdu.MessageAge >= bpdu.MaxAge {
+		stpLog.Debug("bpdu is too old. ignoring", "port", name, "age", bpdu.MessageAge, "max_age", bpdu.MaxAge)
+		return
+	}
+	// outside of the region this bridge sees the regional root of the
+	// bridge behind the port as its designated bridge
+	cist := treeMessage{tree: b.cist, flags: bpdu.Flags, hops: bpdu.RemainingHops, vector: priorityVector{
+		RootID:       bpdu.RootID,
+		RootCost:     bpdu.RootCost,
+		RegionalRoot: bpdu.RegionalRootID,
+		BridgeID:     bpdu.RegionalRootID,
+		PortID:       bpdu.PortID,
+	}}
+	msgs := []treeMessage{cist}
+	if p.internal {
+		msgs[0].vector.InternalCost = bpdu.InternalCost
+		msgs[0].vector.BridgeID = bpdu.BridgeID
+		for _, m := range bpdu.MSTIs {
+			t := b.instance(m.MSTI())
+			if t == nil {
+				continue
+			}
+			msgs = append(msgs, treeMessage{tree: t, flags: m.Flags, hops: m.RemainingHops, vector: priorityVector{
+				RootID:   m.RegionalRootID,
+				RootCost: m.InternalCost,
+				BridgeID: NewBridgeID(uint16(m.BridgePriority&0xf0)<<8|t.msti, bpdu.BridgeID.MAC()),
+				PortID:   uint16(m.PortPriority&0xf0)<<8 | bpdu.PortID&0x0fff,
+			}})
+		}
+	}
+	times := bpduTimes{MessageAge: bpdu.MessageAge, MaxAge: bpdu.MaxAge, HelloTime: bpdu.HelloTime, ForwardDelay: bpdu.ForwardDelay}
+	expires := now.Add(bpdu.MaxAge - bpdu.MessageAge)
+	if rst {
+		expires = now.Add(3 * max(bpdu.HelloTime, time.Second))
+	}
+	received := map[*stpTree]bool{}
+	for i := range msgs {
+		m := &msgs[i]
+		received[m.tree] = true
+		tp := m.tree.ports[name]
+		// the port of the bridge behind this one is not designated
+		tp.info = nil
+		if !m.designated(rst) {
+			continue
+		}
+		if p.internal && m.hops == 0 {
+			m.tree.log.Debug("bpdu ran out of hops. ignoring", "port", name)
+			continue
+		}
+		v := m.vector
+		tp.info = &v
+		tp.infoTimes = times
+		tp.infoHops = m.hops
+		tp.infoExpires = expires
+	}
+	for _, t := range b.mstis {
+		if !received[t] {
+			t.ports[name].info = nil
+		}
+	}
+	b.update(now)
+	for i := range msgs {
+		b.receiveMessage(name, p, &msgs[i], rst, now)
+	}
+	b.transmit(now)
+}
+
+// receiveMessage handles the proposal, agreement and topology change flags
+// of a message once the roles are updated
+func (b *STPBridge) receiveMessage(name string, p *stpPort, m *treeMessage, rst bool, now time.Time) {
+	t := m.tree
+	tp := t.ports[name]
+	if m.designated(rst) {
+		switch {
+		case rst && m.flags&BPDU_FLAG_PROPOSAL != 0 && tp.role == RoleRoot:
+			// the designated bridge waits for the designated ports of this bridge to block
+			b.sync(t, now)
+			tp.agree = true
+			p.newInfo = true
+		case rst && m.flags&BPDU_FLAG_PROPOSAL != 0 && (tp.role == RoleAlternate || tp.role == RoleBackup):
+			// a port that does not forward agrees right away
+			tp.agree = true
+			p.newInfo = true
+		case tp.role == RoleDesignated:
+			// the bridge behind the port has worse information. it gets ours
+			p.newInfo = true
+		}
+	} else if m.flags&BPDU_FLAG_AGREEMENT != 0 && tp.role == RoleDesignated && m.vector.RootID == t.root.RootID && m.vector.RootCost >= t.root.RootCost {
+		tp.agreed = true
+		tp.proposing = false
+		b.setState(t, name, p, tp, dataplane.PortForwarding, now)
+	}
+	if t.msti == 0 && m.flags&BPDU_FLAG_TC_ACK != 0 && tp.role == RoleRoot && p.stpNeighbor {
+		tp.tcWhile = time.Time{}
+	}
+	if m.flags&BPDU_FLAG_TC != 0 && (tp.role == RoleRoot || tp.role == RoleDesignated) {
+		t.log.Debug("topology change received", "port", name)
+		b.propagateTC(t, name, false, now)
+	}
+}
+
+// transmit sends a BPDU on the ports that have new information
+func (b *STPBridge) transmit(now time.Time) {
+	for _, name := range b.sortedPorts() {
+		p := b.ports[name]
+		if !p.newInfo {
+			continue
+		}
+		p.newInfo = false
+		b.send(name, p, now)
+	}
+}
+
+func (b *STPBridge) send(name string, p *stpPort, now time.Time) {
+	cist := b.cist.ports[name]
+	if !p.up || p.disabled || cist.role == RoleDisabled {
+		return
+	}
+	root, times := b.cist.root, b.cist.rootTimes
+	// outside of the region it looks like one bridge, its regional root
+	bpdu := BPDU{
+		RootID:         root.RootID,
+		RootCost:       root.RootCost,
+		RegionalRootID: root.RegionalRoot,
+		BridgeID:       root.RegionalRoot,
+		PortID:         cist.id,
+		MessageAge:     times.MessageAge,
+		MaxAge:         times.MaxAge,
+		HelloTime:      times.HelloTime,
+		ForwardDelay:   times.ForwardDelay,
+	}
+	tc := now.Before(cist.tcWhile)
+	if b.rapid(p) {
+		bpdu.Version = RSTP_VERSION
+		bpdu.Type = BPDU_TYPE_RST
+		bpdu.Flags = cist.flags(tc)
+		if b.settings.MSTP {
+			bpdu.Version = MSTP_VERSION
+			bpdu.BridgeID = b.id
+			bpdu.MSTConfigID = b.mcid
+			bpdu.InternalCost = root.InternalCost
+			bpdu.RemainingHops = b.cist.hops
+			for _, t := range b.mstis {
+				tp := t.ports[name]
+				m := MSTIMessage{
+					Flags:          tp.flags(now.Before(tp.tcWhile)),
+					RegionalRootID: t.root.RootID,
+					InternalCost:   t.root.RootCost,
+					BridgePriority: uint8(t.id.Priority()>>8) & 0xf0,
+					PortPriority:   uint8(tp.id>>8) & 0xf0,
+					RemainingHops:  t.hops,
+				}
+				if tp.role == RoleMaster {
+					m.Flags |= BPDU_FLAG_MASTER
+				}
+				bpdu.MSTIs = append(bpdu.MSTIs, m)
+			}
+		}
+	} else {
+		switch {
+		case cist.role == RoleRoot && tc:
+			// 802.1D bridges hear about topology changes from their root port
+			bpdu = BPDU{Type: BPDU_TYPE_TCN}
+		case cist.role == RoleDesignated:
+			bpdu.Type = BPDU_TYPE_CONFIG
+			if tc {
+				bpdu.Flags |= BPDU_FLAG_TC
+			}
+			if p.tcAck {
+				bpdu.Flags |= BPDU_FLAG_TC_ACK
+				p.tcAck = false
+			}
+		default:
+			return
+		}
+	}
+	payload, err := bpdu.MarshalBinary()
+	if err != nil {
+		stpLog.Warn("failed to marshal bpdu", "port", name, "error", err)
+		return
+	}
+	p.port.Out(&ethernet.Frame{
+		Destination: STPMulticast,
+		Source:      b.mac,
+		EtherType:   ethernet.EtherType(len(payload)),
+		Payload:     payload,
+	})
+	p.tx++
+}
+
+// Tick runs the timers of the bridge. a BPDU is sent every hello time on
+// the ports that are designated in a tree
+func (b *STPBridge) Tick() {
+	defer b.mutex.Unlock()
+	b.mutex.Lock()
+	if b.stopped {
+		return
+	}
+	now := time.Now()
+	b.update(now)
+	b.advance(now)
+	if !now.Before(b.helloDue) {
+		b.helloDue = now.Add(b.settings.HelloTime)
+		for name, p := range b.ports {
+			for _, t := range b.trees() {
+				tp := t.ports[name]
+				if tp.role == RoleDesignated || (tp.role == RoleRoot && now.Before(tp.tcWhile)) {
+					p.newInfo = true
+				}
+			}
+		}
+	}
+	b.transmit(now)
+}
+
+// PortsChanged gives the ports that went up or down their roles right away
+func (b *STPBridge) PortsChanged() {
+	defer b.mutex.Unlock()
+	b.mutex.Lock()
+	if b.stopped {
+		return
+	}
+	now := time.Now()
+	b.update(now)
+	b.transmit(now)
+}
+
+// Reload applies new settings. a new bridge or port id is sent right away.
+// the instances are rebuilt when the vlan to instance mapping changed
+func (b *STPBridge) Reload(settings *STPSettings) {
+	defer b.mutex.Unlock()
+	b.mutex.Lock()
+	if b.stopped {
+		return
+	}
+	now := time.Now()
+	b.setSettings(settings, now)
+	b.update(now)
+	for name, p := range b.ports {
+		for _, t := range b.trees() {
+			if t.ports[name].role == RoleDesignated {
+				p.newInfo = true
+			}
+		}
+	}
+	b.transmit(now)
+}
+
+// Loop runs the timers of the bridge and follows the ports going up and
+// down on sub until ctx is done. the ports forward again when it returns
+func (b *STPBridge) Loop(ctx context.Context, sub *controlplane.Subscription) {
+	defer sub.Close()
+	ticker := time.NewTicker(STP_TICK)
+	defer ticker.Stop()
+	defer b.stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			b.Tick()
+		case <-sub.C:
+			b.PortsChanged()
+		}
+	}
+}
+
+func (b *STPBridge) stop() {
+	defer b.mutex.Unlock()
+	b.mutex.Lock()
+	b.stopped = true
+	for _, p := range b.ports {
+		p.port.SetPortState(dataplane.PortForwarding)
+		p.port.ClearVLANPortStates()
+	}
+	stpLog.Info("spanning tree stopped. all ports forward")
+}
+
+type STPPortStatus struct {
+	Name             string
+	ID               string // priority.number
+	Cost             uint32
+	Role             string
+	State            string
+	Edge             bool
+	Disabled         bool   // spanning tree is disabled on the port
+	Boundary         bool   // MSTP: the bridge behind the port is not in the region
+	Protocol         string // spoken on the port
+	DesignatedRoot   string `json:",omitempty"`
+	DesignatedBridge string `json:",omitempty"`
+	DesignatedPort   string `json:",omitempty"`
+	DesignatedCost   uint32
+	BPDUsReceived    uint64
+	BPDUsSent        uint64
+}
+
+// MSTIStatus is an MST instance. its root is the regional root of the
+// instance and its root cost the internal root path cost
+type MSTIStatus struct {
+	Instance           uint16
+	VLANs              []int
+	BridgeID           string
+	RootID             string
+	RootCost           uint32
+	RootPort           string `json:",omitempty"`
+	IsRoot             bool
+	TopologyChanges    uint64
+	LastTopologyChange time.Time
+	Ports              []STPPortStatus
+}
+
+type STPStatus struct {
+	BridgeID            string
+	RootID              string
+	RootCost            uint32 // external root path cost with MSTP
+	RootPort            string `json:",omitempty"`
+	IsRoot              bool
+	Protocol            string
+	HelloSeconds        float64 // of the root bridge
+	MaxAgeSeconds       float64
+	ForwardDelaySeconds float64
+	TopologyChanges     uint64
+	LastTopologyChange  time.Time
+	Ports               []STPPortStatus
+	Region              string       `json:",omitempty"` // MSTP
+	Revision            uint16       `json:",omitempty"`
+	Digest              string       `json:",omitempty"`
+	RegionalRootID      string       `json:",omitempty"`
+	InternalCost        uint32       `json:",omitempty"`
+	Instances           []MSTIStatus `json:",omitempty"`
+}
+
+func portID(id uint16) string {
+	return fmt.Sprintf("%d.%d", id>>8&0xf0, id&0xfff)
+}
+
+func (b *STPBridge) portStatus(t *stpTree, name string) STPPortStatus {
+	p, tp := b.ports[name], t.ports[name]
+	ps := STPPortStatus{
+		Name:          name,
+		ID:            portID(tp.id),
+		Cost:          tp.cost,
+		Role:          tp.role.String(),
+		State:         tp.state.String(),
+		Edge:          p.edge,
+		Disabled:      p.disabled,
+		Boundary:      b.settings.MSTP && !p.internal,
+		Protocol:      b.settings.protocol(),
+		BPDUsReceived: p.rx,
+		BPDUsSent:     p.tx,
+	}
+	if !b.rapid(p) {
+		ps.Protocol = "stp"
+	}
+	designated := tp.info
+	if tp.role == RoleDesignated {
+		v := b.designatedVector(t, tp)
+		designated = &v
+	}
+	if designated != nil && tp.role != RoleDisabled && !b.boundary(t, p) {
+		ps.DesignatedRoot = designated.RootID.String()
+		ps.DesignatedBridge = designated.BridgeID.String()
+		ps.DesignatedPort = portID(designated.PortID)
+		ps.DesignatedCost = designated.RootCost
+	}
+	return ps
+}
+
+// Status returns the bridge, its root, its ports sorted by name and its MST
+// instances
+func (b *STPBridge) Status() STPStatus {
+	defer b.mutex.Unlock()
+	b.mutex.Lock()
+	cist := b.cist
+	status := STPStatus{
+		BridgeID:            b.id.String(),
+		RootID:              cist.root.RootID.String(),
+		RootCost:            cist.root.RootCost,
+		RootPort:            cist.rootPort,
+		IsRoot:              cist.root.RootID == b.id,
+		Protocol:            b.settings.protocol(),
+		HelloSeconds:        cist.rootTimes.HelloTime.Seconds(),
+		MaxAgeSeconds:       cist.rootTimes.MaxAge.Seconds(),
+		ForwardDelaySeconds: cist.rootTimes.ForwardDelay.Seconds(),
+		TopologyChanges:     cist.topologyChanges,
+		LastTopologyChange:  cist.lastTopologyChange,
+		Ports:               []STPPortStatus{},
+	}
+	if b.settings.MSTP {
+		status.Region = b.mcid.Name
+		status.Revision = b.mcid.Revision
+		status.Digest = fmt.Sprintf("%x", b.mcid.Digest)
+		status.RegionalRootID = cist.root.RegionalRoot.String()
+		status.InternalCost = cist.root.InternalCost
+	}
+	names := b.sortedPorts()
+	for _, name := range names {
+		status.Ports = append(status.Ports, b.portStatus(cist, name))
+	}
+	for _, t := range b.mstis {
+		msti := MSTIStatus{
+			Instance:           t.msti,
+			VLANs:              t.vlans,
+			BridgeID:           t.id.String(),
+			RootID:             t.root.RootID.String(),
+			RootCost:           t.root.RootCost,
+			RootPort:           t.rootPort,
+			IsRoot:             t.root.RootID == t.id,
+			TopologyChanges:    t.topologyChanges,
+			LastTopologyChange: t.lastTopologyChange,
+			Ports:              []STPPortStatus{},
+		}
+		for _, name := range names {
+			msti.Ports = append(msti.Ports, b.portStatus(t, name))
+		}
+		status.Instances = append(status.Instances, msti)
+	}
+	return status
+}
+
+func init() {
+	STPProcFuncPair := controlplane.ControlProcessFuncPair{
+		InFunc:   STPInFunc,
+		OutFunc:  STPOutFunc,
+		Init:     InitSTP,
+		Gauges:   STPGauges,
+		Dump:     STPDump,
+		Reload:   ReloadSTP,
+		Position: controlplane.PositionFirst, // takes the BPDUs before frames are learned or filtered
+	}
+
+	controlplane.RegisterLayerProc(2, "STP", STPProcFuncPair)
+}
+
+func InitSTP(sw *controlplane.Switch) {
+	stpLog.Info("starting process")
+	stor := sw.Stor.GetStor(2, "STP")
+	path := stor.ConfigFile()
+	stpLog.Info("config file", "path", path)
+	settings, err := readSTPConfig(path)
+	if err != nil {
+		stpLog.Error("failed to read config file", "path", path, "error", err)
+		settings = defaultSTPSettings()
+	}
+	stor.SetConfig(settings)
+	b := NewSTPBridge(sw, settings)
+	controlplane.Set(stor, "Bridge", b)
+	stpLog.Info("bridge id", "id", b.id)
+	// ports added right after Init are not missed
+	sub := sw.Events.Subscribe(0, controlplane.EventPortUp, controlplane.EventPortDown)
+	b.PortsChanged()
+	stor.Go(func(ctx context.Context) {
+		b.Loop(ctx, sub)
+	})
+}
+
+// ReloadSTP re-reads the bridge and port settings. the bridge keeps its
+// random address when the config has none
+func ReloadSTP(sw *controlplane.Switch, path string) error {
+	b, err := getSTPBridge(sw)
+	if err != nil {
+		return err
+	}
+	settings, err := readSTPConfig(path)
+	if err != nil {
+		return err
+	}
+	sw.Stor.GetStor(2, "STP").SetConfig(settings)
+	b.Reload(settings)
+	stpLog.Info("config reloaded", "config", settings)
+	return nil
+}
+
+func getSTPBridge(sw *controlplane.Switch) (*STPBridge, error) {
+	b, ok := controlplane.Get[*STPBridge](sw.Stor.GetStor(2, "STP"), "Bridge")
+	if !ok {
+		return nil, fmt.Errorf("%w: L2:STP", controlplane.ErrNoProc)
+	}
+	return b, nil
+}
+
+// SpanningTree returns the status of the spanning tree
+func SpanningTree(sw *controlplane.Switch) (STPStatus, error) {
+	b, err := getSTPBridge(sw)
+	if err != nil {
+		return STPStatus{}, err
+	}
+	return b.Status(), nil
+}
+
+func STPGauges(sw *controlplane.Switch) []controlplane.ProcGauge {
+	status, err := SpanningTree(sw)
+	if err != nil {
+		return nil
+	}
+	isRoot := 0.0
+	if status.IsRoot {
+		isRoot = 1
+	}
+	gauges := []controlplane.ProcGauge{
+		{Name: "stp_root_bridge", Help: "1 if this switch is the root bridge.", Value: isRoot},
+		{Name: "stp_root_cost", Help: "Path cost to the root bridge.", Value: float64(status.RootCost)},
+		{Name: "stp_topology_changes", Help: "Topology changes detected since STP started.", Value: float64(status.TopologyChanges)},
+	}
+	gauges = append(gauges, stpPortGauges(0, status.Ports)...)
+	for _, msti := range status.Instances {
+		gauges = append(gauges, stpPortGauges(msti.Instance, msti.Ports)...)
+	}
+	return gauges
+}
+
+func stpPortGauges(instance uint16, ports []STPPortStatus) []controlplane.ProcGauge {
+	gauges := []controlplane.ProcGauge{}
+	for _, port := range ports {
+		forwarding := 0.0
+		if port.State == dataplane.PortForwarding.String() {
+			forwarding = 1
+		}
+		gauges = append(gauges, controlplane.ProcGauge{
+			Name:   "stp_port_forwarding",
+			Help:   "1 if the spanning tree instance forwards on the port. instance 0 is the common tree.",
+			Labels: map[string]string{"port": port.Name, "role": port.Role, "instance": strconv.Itoa(int(instance))},
+			Value:  forwarding,
+		})
+	}
+	return gauges
+}
+
+func STPDump(sw *controlplane.Switch) interface{} {
+	status, err := SpanningTree(sw)
+	if err != nil {
+		return STPStatus{}
+	}
+	return status
+}
+
+func STPInFunc(proc pipeline.PipelineProcess, msg pipeline.PipelineMessage) pipeline.PipelineMessage {
+	msgContent, _ := msg.Content.(controlplane.ControlMessage)
+	frame := msgContent.InFrame.FRAME
+	if !bytes.Equal(frame.Destination, STPMulticast) {
+		return msg
+	}
+	// BPDUs end here
+	msg.Drop = true
+	b, err := getSTPBridge(msgContent.ParentSwitch)
+	if err != nil {
+		stpLog.Error("no bridge")
+		return msg
+	}
+	bpdu := &BPDU{}
+	err = bpdu.UnmarshalBinary(frame.Payload)
+	if err != nil {
+		stpLog.Debug("received invalid bpdu", "port", msgContent.InFrame.IN_PORT.Name, "error", err)
+		return msg
+	}
+	b.Receive(msgContent.InFrame.IN_PORT, bpdu)
+	return msg
+}
+
+func STPOutFunc(proc pipeline.PipelineProcess, msg pipeline.PipelineMessage) pipeline.PipelineMessage {
+	return msg
+}
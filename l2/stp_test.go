@@ -0,0 +1,241 @@
+package l2_test
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/m-motawea/gSwitch/config"
+	"github.com/m-motawea/gSwitch/l2"
+	"github.com/m-motawea/gSwitch/switchtest"
+	"github.com/mdlayher/ethernet"
+)
+
+const stpTimers = "HelloSeconds = 1\nMaxAgeSeconds = 6\nForwardDelaySeconds = 4\n"
+
+var trunk = config.SwitchPortConfig{Trunk: true, AllowedVLANs: []int{10, 20}, Up: true}
+
+// newSTPSwitch starts a switch running STP with the given config and an
+// edge host port h<vlan> in each of vlans
+func newSTPSwitch(t *testing.T, stpConf string, vlans ...int) *switchtest.Harness {
+	t.Helper()
+	ports := map[string]config.SwitchPortConfig{}
+	for _, vlan := range vlans {
+		name := fmt.Sprintf("h%d", vlan)
+		ports[name] = config.SwitchPortConfig{AllowedVLANs: []int{vlan}, Up: true}
+		stpConf += fmt.Sprintf("[Ports.%s]\nEdge = true\n", name)
+	}
+	path := filepath.Join(t.TempDir(), "STP.toml")
+	err := os.WriteFile(path, []byte(stpConf), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := switchtest.NewHarness(config.Config{
+		SwitchPorts: ports,
+		ControlProcess: []config.ControlProcessConfig{
+			{Layer: 2, Name: "STP", ConfigFile: path},
+			{Layer: 2, Name: "L2Switch"},
+		},
+	})
+	if h != nil {
+		t.Cleanup(func() {
+			h.Stop(5 * time.Second)
+		})
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+func link(t *testing.T, a *switchtest.Harness, aPort string, b *switchtest.Harness, bPort string) {
+	t.Helper()
+	err := a.Link(aPort, trunk, b, bPort, trunk)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// waitFor polls cond until it holds or the timeout expires
+func waitFor(t *testing.T, timeout time.Duration, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func stpStatus(t *testing.T, h *switchtest.Harness) l2.STPStatus {
+	t.Helper()
+	st, err := l2.SpanningTree(h.Switch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return st
+}
+
+func portStatus(ports []l2.STPPortStatus, name string) l2.STPPortStatus {
+	for _, p := range ports {
+		if p.Name == name {
+			return p
+		}
+	}
+	return l2.STPPortStatus{}
+}
+
+// blocking returns the blocking ports of the switches named switch/port
+func blocking(ports map[string][]l2.STPPortStatus) []string {
+	res := []string{}
+	for sw, swPorts := range ports {
+		for _, p := range swPorts {
+			if p.State == "blocking" {
+				res = append(res, sw+"/"+p.Name)
+			}
+		}
+	}
+	return res
+}
+
+func TestSTPRedundantLinks(t *testing.T) {
+	a := newSTPSwitch(t, "Priority = 4096\n"+stpTimers, 10)
+	b := newSTPSwitch(t, "Priority = 8192\n"+stpTimers, 10)
+	link(t, a, "ab1", b, "ba1")
+	link(t, a, "ab2", b, "ba2")
+
+	var stA, stB l2.STPStatus
+	waitFor(t, 5*time.Second, "convergence", func() bool {
+		stA, stB = stpStatus(t, a), stpStatus(t, b)
+		root := portStatus(stB.Ports, stB.RootPort)
+		return stB.RootID == stA.BridgeID && root.State == "forwarding" &&
+			len(blocking(map[string][]l2.STPPortStatus{"a": stA.Ports, "b": stB.Ports})) == 1
+	})
+	if !stA.IsRoot || stB.IsRoot {
+		t.Fatalf("root bridge is %s. want the lower id %s", stB.RootID, stA.BridgeID)
+	}
+	if !strings.HasPrefix(stA.BridgeID, "4096.") {
+		t.Fatalf("bridge id of a = %s", stA.BridgeID)
+	}
+	blocked := blocking(map[string][]l2.STPPortStatus{"a": stA.Ports, "b": stB.Ports})
+	alternate := "ba1"
+	if stB.RootPort == "ba1" {
+		alternate = "ba2"
+	}
+	if blocked[0] != "b/"+alternate || portStatus(stB.Ports, alternate).Role != "alternate" {
+		t.Fatalf("blocking ports = %v. want the alternate port b/%s", blocked, alternate)
+	}
+	for _, p := range stA.Ports {
+		if p.State != "forwarding" {
+			t.Fatalf("port %s of the root bridge is %s", p.Name, p.State)
+		}
+	}
+
+	// take the active link down at both ends
+	active := stB.RootPort
+	activeA := "ab" + strings.TrimPrefix(active, "ba")
+	err := a.Switch.DownPort(activeA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = b.Switch.DownPort(active)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, 10*time.Second, "the alternate port to forward", func() bool {
+		stB = stpStatus(t, b)
+		return stB.RootPort == alternate && portStatus(stB.Ports, alternate).State == "forwarding"
+	})
+	stA = stpStatus(t, a)
+	if !stA.IsRoot || portStatus(stA.Ports, "ab"+strings.TrimPrefix(alternate, "ba")).State != "forwarding" {
+		t.Fatalf("root bridge does not forward on the remaining link: %+v", stA.Ports)
+	}
+}
+
+func instanceStatus(st l2.STPStatus, id uint16) l2.MSTIStatus {
+	for _, m := range st.Instances {
+		if m.Instance == id {
+			return m
+		}
+	}
+	return l2.MSTIStatus{}
+}
+
+// copies counts the frames from src the switch sends out of port within d
+func copies(h *switchtest.Harness, port string, src net.HardwareAddr, d time.Duration) int {
+	n := 0
+	deadline := time.Now().Add(d)
+	for time.Now().Before(deadline) {
+		f, err := h.Receive(port, 20*time.Millisecond)
+		if err == nil && bytes.Equal(f.Source, src) {
+			n++
+		}
+	}
+	return n
+}
+
+func TestMSTPInstances(t *testing.T) {
+	// a is the root of the cist (vlan 10) and b the root of instance 1 (vlan 20)
+	const region = "Version = \"mstp\"\nRegion = \"r1\"\n"
+	a := newSTPSwitch(t, "Priority = 4096\n"+region+stpTimers+"[[Instances]]\nID = 1\nVLANs = [20]\nPriority = 32768\n", 10, 20)
+	b := newSTPSwitch(t, "Priority = 8192\n"+region+stpTimers+"[[Instances]]\nID = 1\nVLANs = [20]\nPriority = 0\n", 10, 20)
+	link(t, a, "ab1", b, "ba1")
+	link(t, a, "ab2", b, "ba2")
+
+	var cist, msti []string
+	waitFor(t, 5*time.Second, "convergence", func() bool {
+		stA, stB := stpStatus(t, a), stpStatus(t, b)
+		cist = blocking(map[string][]l2.STPPortStatus{"a": stA.Ports, "b": stB.Ports})
+		msti = blocking(map[string][]l2.STPPortStatus{"a": instanceStatus(stA, 1).Ports, "b": instanceStatus(stB, 1).Ports})
+		return stB.RootID == stA.BridgeID && instanceStatus(stA, 1).RootID == instanceStatus(stB, 1).BridgeID &&
+			len(cist) == 1 && len(msti) == 1
+	})
+	if !strings.HasPrefix(cist[0], "b/") || !strings.HasPrefix(msti[0], "a/") {
+		t.Fatalf("cist blocks %v and instance 1 blocks %v. want a port of b and a port of a", cist, msti)
+	}
+
+	// the port state of each vlan follows its instance
+	cistBlocked := b.Switch.PortMap()[strings.TrimPrefix(cist[0], "b/")]
+	if cistBlocked.VLANPortState(10).Forwards() || !cistBlocked.VLANPortState(20).Forwards() {
+		t.Fatalf("port %s: vlan 10 %s vlan 20 %s. want blocking and forwarding", cistBlocked.Name, cistBlocked.VLANPortState(10), cistBlocked.VLANPortState(20))
+	}
+	mstiBlocked := a.Switch.PortMap()[strings.TrimPrefix(msti[0], "a/")]
+	if !mstiBlocked.VLANPortState(10).Forwards() || mstiBlocked.VLANPortState(20).Forwards() {
+		t.Fatalf("port %s: vlan 10 %s vlan 20 %s. want forwarding and blocking", mstiBlocked.Name, mstiBlocked.VLANPortState(10), mstiBlocked.VLANPortState(20))
+	}
+
+	// a flood crosses one link per vlan: a port blocked in the vlan is skipped
+	for _, vlan := range []int{10, 20} {
+		host := fmt.Sprintf("h%d", vlan)
+		for _, h := range []*switchtest.Harness{a, b} {
+			h.Flush(host)
+		}
+		src := net.HardwareAddr{0x02, 0, 0, 0, byte(vlan), 0x0a}
+		err := a.Inject(host, &ethernet.Frame{Destination: ethernet.Broadcast, Source: src, EtherType: 0x88b5, Payload: make([]byte, 46)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n := copies(b, host, src, 300*time.Millisecond); n != 1 {
+			t.Fatalf("vlan %d: %d copies of a broadcast. want 1", vlan, n)
+		}
+		if n := copies(a, host, src, 50*time.Millisecond); n != 0 {
+			t.Fatalf("vlan %d: broadcast looped back %d times", vlan, n)
+		}
+
+		// unicast back to the learned address takes the forwarding link
+		dst := net.HardwareAddr{0x02, 0, 0, 0, byte(vlan), 0x0b}
+		err = b.Inject(host, &ethernet.Frame{Destination: src, Source: dst, EtherType: 0x88b5, Payload: make([]byte, 46)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n := copies(a, host, dst, 300*time.Millisecond); n != 1 {
+			t.Fatalf("vlan %d: %d copies of a unicast. want 1", vlan, n)
+		}
+	}
+}
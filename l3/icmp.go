@@ -1,15 +1,16 @@
 package l3
 
 import (
-	"log"
-
 	"github.com/m-motawea/gSwitch/config"
 	"github.com/m-motawea/gSwitch/controlplane"
+	"github.com/m-motawea/gSwitch/logging"
 	"github.com/m-motawea/icmp"
 	"github.com/m-motawea/ip"
 	"github.com/m-motawea/pipeline"
 )
 
+var icmpLog = logging.ProcLogger(3, "ICMP")
+
 type LocalAddress struct {
 	Address string
 }
@@ -20,46 +21,61 @@ type ICMPConfig struct {
 
 func init() {
 	FuncPair := controlplane.ControlProcessFuncPair{
-		InFunc:  ICMPProcessIn,
-		OutFunc: controlplane.DummyProc,
-		Init:    InitICMP,
+		InFunc:   ICMPProcessIn,
+		OutFunc:  controlplane.DummyProc,
+		Init:     InitICMP,
+		Reload:   ReloadICMP,
+		Requires: []string{"ipv4"},
 	}
 
 	controlplane.RegisterLayerProc(3, "ICMP", FuncPair)
 }
 
 func InitICMP(sw *controlplane.Switch) {
-	log.Println("Starting ICMP Process")
+	icmpLog.Info("starting process")
 	stor := sw.Stor.GetStor(3, "ICMP")
-	log.Printf("ICMP Process Config file path: %v", stor["ConfigFile"])
+	path := stor.ConfigFile()
+	icmpLog.Info("config file", "path", path)
 	configObj := ICMPConfig{}
-	if stor["ConfigFile"] != nil {
-		path, ok := stor["ConfigFile"].(string)
-		if ok {
-			err := config.ReadConfigFile(path, &configObj)
-			if err != nil {
-				log.Printf("ICMP Failed to read config file due to error %v", err)
-			} else {
-				log.Printf("ICMP Config: %v", configObj)
-				stor["CONFIG"] = configObj
-			}
+	if path != "" {
+		err := config.ReadConfigFile(path, &configObj)
+		if err != nil {
+			icmpLog.Error("failed to read config file", "path", path, "error", err)
 		} else {
-			log.Printf("ICMP invalid config path specified")
+			icmpLog.Info("config loaded", "config", configObj)
+			stor.SetConfig(configObj)
 		}
 	}
 }
 
+// ReloadICMP re-reads the local addresses
+func ReloadICMP(sw *controlplane.Switch, path string) error {
+	stor := sw.Stor.GetStor(3, "ICMP")
+	if path == "" {
+		stor.SetConfig(nil)
+		return nil
+	}
+	configObj := ICMPConfig{}
+	err := config.ReadConfigFile(path, &configObj)
+	if err != nil {
+		return err
+	}
+	icmpLog.Info("config reloaded", "config", configObj)
+	stor.SetConfig(configObj)
+	return nil
+}
+
 func ICMPProcessIn(proc pipeline.PipelineProcess, msg pipeline.PipelineMessage) pipeline.PipelineMessage {
 	msgContent, _ := msg.Content.(controlplane.ControlMessage)
 	stor := msgContent.ParentSwitch.Stor.GetStor(3, "ICMP")
-	config, ok := stor["CONFIG"].(ICMPConfig)
+	config, ok := controlplane.GetConfig[ICMPConfig](stor)
 	if !ok {
-		log.Printf("ICMP Config is not correct %+v", stor["CONFIG"])
+		icmpLog.Debug("no valid config", "config", stor.Config())
 		return msg
 	}
 	i, _ := msgContent.LayerPayload.(ip.IPv4)
 	if i.Protocol != ip.PROTO_ICMP {
-		log.Printf("ICMP Process not icmp protocol %+v", i.Protocol)
+		icmpLog.Debug("not an icmp packet", "protocol", i.Protocol)
 		return msg
 	}
 	// 1- check if i.Destination matches one of my VLAN interfaces in config
@@ -67,15 +83,15 @@ func ICMPProcessIn(proc pipeline.PipelineProcess, msg pipeline.PipelineMessage)
 	// 3- if icmp request create a reply
 	for key, val := range config.LocalAddresses {
 		if i.Destination.String() == val.Address {
-			log.Printf("ICMP Proc: ip destination is my interface: %s, IP: %s", key, val.Address)
+			icmpLog.Debug("icmp packet to a local address", "interface", key, "ip", val.Address)
 			ic := icmp.ICMP{}
 			err := ic.UnmarshalBinary(i.Data)
 			if err != nil {
-				log.Printf("ICMP failed to unmarshal icmp data due to error %v", err)
+				icmpLog.Debug("failed to unmarshal icmp packet", "error", err)
 				msg.Drop = true
 				return msg
 			}
-			log.Printf("icmp: %+v", ic)
+			icmpLog.Debug("icmp packet", "type", ic.Type)
 			if ic.Type == icmp.TYPE_ICMP_ECHO_REPQUEST {
 				dst := i.Source
 				src := i.Destination
@@ -85,7 +101,7 @@ func ICMPProcessIn(proc pipeline.PipelineProcess, msg pipeline.PipelineMessage)
 				ic.Type = icmp.TYPE_ICMP_ECHO_REPLY
 				data, err := ic.MarshalBinary()
 				if err != nil {
-					log.Printf("Failed to marshal resposne icmp due to error %v", err)
+					icmpLog.Warn("failed to marshal icmp reply", "error", err)
 					msg.Drop = true
 					return msg
 				}
@@ -94,8 +110,7 @@ func ICMPProcessIn(proc pipeline.PipelineProcess, msg pipeline.PipelineMessage)
 				msg.Content = msgContent
 				msg.Finished = true
 				msgContent.InFrame.FRAME.Destination = nil
-				log.Printf("ICMP Proc result ICMP: %+v", ic)
-				log.Printf("ICMP Proc result IP: %+v", i)
+				icmpLog.Debug("replying to echo request", "src", i.Source.String(), "dst", i.Destination.String())
 				return msg
 			} else {
 				msg.Drop = true
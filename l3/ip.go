@@ -1,18 +1,24 @@
 package l3
 
 import (
-	"log"
+	"context"
+	"log/slog"
 
 	"github.com/m-motawea/gSwitch/controlplane"
+	"github.com/m-motawea/gSwitch/logging"
 	"github.com/m-motawea/ip"
 	"github.com/m-motawea/pipeline"
 	"github.com/mdlayher/ethernet"
 )
 
+var ipLog = logging.ProcLogger(3, "IPv4")
+
 func init() {
 	FuncPair := controlplane.ControlProcessFuncPair{
-		InFunc:  IngressIpDecoder,
-		OutFunc: EgressIpEncoder,
+		InFunc:   IngressIpDecoder,
+		OutFunc:  EgressIpEncoder,
+		Requires: []string{"l3-payload"},
+		Provides: []string{"ipv4"},
 	}
 
 	controlplane.RegisterLayerProc(3, "IPv4", FuncPair)
@@ -27,19 +33,21 @@ func IngressIpDecoder(proc pipeline.PipelineProcess, msg pipeline.PipelineMessag
 	}
 	payload, ok := msgContent.LayerPayload.([]byte)
 	if !ok {
-		log.Println("IP Process recieved invalid payload")
+		ipLog.Warn("ingress received invalid payload")
 		msg.Drop = true
 		return msg
 	}
 	ip4 := ip.IPv4{}
 	err := ip4.UnmarshalBinary(payload)
 	if err != nil {
-		log.Printf("IP process Failed to marshal payload due to error %v.\nPayload: %v", err, payload)
+		ipLog.Debug("failed to decode ipv4 packet", "error", err)
 		msg.Finished = true
 		return msg
 	}
 
-	log.Printf("IP Process: decoded IPv4: %+v", ip4)
+	if ipLog.Enabled(context.Background(), slog.LevelDebug) {
+		ipLog.Debug("decoded ipv4 packet", "src", ip4.Source.String(), "dst", ip4.Destination.String(), "protocol", ip4.Protocol)
+	}
 	msgContent.LayerPayload = ip4
 	msg.Content = msgContent
 	return msg
@@ -53,13 +61,13 @@ func EgressIpEncoder(proc pipeline.PipelineProcess, msg pipeline.PipelineMessage
 	}
 	ip, ok := msgContent.LayerPayload.(ip.IPv4)
 	if !ok {
-		log.Println("IP Process Egress recieved invalid payload")
+		ipLog.Warn("egress received invalid payload")
 		msg.Drop = true
 		return msg
 	}
 	payload, err := ip.MarshalBinary()
 	if err != nil {
-		log.Printf("IP Process egress failed to encode IP packet due to error %v", err)
+		ipLog.Warn("failed to encode ipv4 packet", "error", err)
 		msg.Drop = true
 		return msg
 	}
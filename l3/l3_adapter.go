@@ -1,17 +1,21 @@
 package l3
 
 import (
-	"log"
-
 	"github.com/m-motawea/gSwitch/controlplane"
+	"github.com/m-motawea/gSwitch/logging"
 	"github.com/m-motawea/ip"
 	"github.com/m-motawea/pipeline"
 )
 
+var l3AdapterLog = logging.ProcLogger(3, "L3Adapter")
+
 func init() {
 	FuncPair := controlplane.ControlProcessFuncPair{
-		InFunc:  IngressAdapter,
-		OutFunc: EgressAdapter,
+		InFunc:   IngressAdapter,
+		OutFunc:  EgressAdapter,
+		Position: controlplane.PositionLast,
+		Requires: []string{"ipv4"},
+		Provides: []string{"l4-payload"},
 	}
 
 	controlplane.RegisterLayerProc(3, "L3Adapter", FuncPair)
@@ -23,14 +27,13 @@ func IngressAdapter(proc pipeline.PipelineProcess, msg pipeline.PipelineMessage)
 	msgContent, _ := newmsg.Content.(controlplane.ControlMessage)
 	ip, ok := msgContent.LayerPayload.(ip.IPv4)
 	if !ok {
-		log.Println("IP Process Ingress recieved invalid payload")
+		l3AdapterLog.Warn("ingress received invalid payload")
 		msg.Drop = true
 		return msg
 	}
 	msgContent.PreMessage = msg
 	msgContent.LayerPayload = ip.Data
 	newmsg.Content = msgContent
-	log.Printf("L3 Adapter Ingress Msg %+v", newmsg)
 	return newmsg
 }
 
@@ -38,26 +41,25 @@ func EgressAdapter(proc pipeline.PipelineProcess, msg pipeline.PipelineMessage)
 	msgContent, _ := msg.Content.(controlplane.ControlMessage)
 	premsg, ok := msgContent.PreMessage.(pipeline.PipelineMessage)
 	if !ok {
-		log.Println("L3 Adapter Egress Recieved invalid message")
+		l3AdapterLog.Warn("egress received message without the ingress ip packet")
 		msg.Drop = true
 		return msg
 	}
 	premsgContent, _ := premsg.Content.(controlplane.ControlMessage)
 	ip, ok := premsgContent.LayerPayload.(ip.IPv4)
 	if !ok {
-		log.Println("IP Process Egress recieved invalid premsg payload")
+		l3AdapterLog.Warn("egress received invalid ip packet")
 		msg.Drop = true
 		return msg
 	}
 	payload, ok := msgContent.LayerPayload.([]byte)
 	if !ok {
-		log.Println("IP Process Egress recieved invalid payload")
+		l3AdapterLog.Warn("egress received invalid payload")
 		msg.Drop = true
 		return msg
 	}
 	ip.Data = payload
 	premsgContent.LayerPayload = ip
 	msg.Content = premsgContent
-	log.Printf("L3 Adapter Egress Msg %+v", msg)
 	return msg
 }
@@ -1,23 +1,33 @@
 package l3
 
 import (
-	"log"
+	"errors"
+	"fmt"
 	"net"
 	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/m-motawea/gSwitch/config"
 	"github.com/m-motawea/gSwitch/controlplane"
+	"github.com/m-motawea/gSwitch/logging"
 	"github.com/m-motawea/ip"
 	"github.com/m-motawea/pipeline"
 	"github.com/mdlayher/ethernet"
 )
 
+var routingLog = logging.ProcLogger(3, "Routing")
+
 func init() {
 	FuncPair := controlplane.ControlProcessFuncPair{
-		InFunc:  IngressRouting,
-		OutFunc: EgressRouting,
-		Init:    InitRouting,
+		InFunc:   IngressRouting,
+		OutFunc:  EgressRouting,
+		Init:     InitRouting,
+		Dump:     RoutingDump,
+		Flush:    RoutingFlush,
+		Reload:   ReloadRouting,
+		Requires: []string{"ipv4", "arp"}, // ARP resolves the next hop of routed packets
+		Provides: []string{"routing"},
 	}
 
 	controlplane.RegisterLayerProc(3, "Routing", FuncPair)
@@ -43,27 +53,170 @@ type RoutingTable struct {
 	Routes     map[string]Route
 }
 
+var ErrNoRoute = errors.New("no such route")
+
+// routingConfig holds the table of a switch so routes can change while
+// frames are routed. the table is replaced on every change, never modified
+// in place, so readers can use their copy without holding the lock.
+type routingConfig struct {
+	mutex  *sync.RWMutex
+	table  RoutingTable
+	loaded bool
+}
+
+func getRoutingConfig(sw *controlplane.Switch) *routingConfig {
+	rc, _ := controlplane.GetConfig[*routingConfig](sw.Stor.GetStor(3, "Routing"))
+	return rc
+}
+
+// getConfig returns the current table. ok is false when the process has no
+// config (not in the pipeline or no config file and no route added)
+func getConfig(sw *controlplane.Switch) (RoutingTable, bool) {
+	rc := getRoutingConfig(sw)
+	if rc == nil {
+		return RoutingTable{}, false
+	}
+	defer rc.mutex.RUnlock()
+	rc.mutex.RLock()
+	return rc.table, rc.loaded
+}
+
 func InitRouting(sw *controlplane.Switch) {
-	log.Println("Starting Routing Process")
+	routingLog.Info("starting process")
 	stor := sw.Stor.GetStor(3, "Routing")
-	log.Printf("Routing Process Config file path: %v", stor["ConfigFile"])
+	path := stor.ConfigFile()
+	routingLog.Info("config file", "path", path)
+	rc := &routingConfig{
+		mutex: &sync.RWMutex{},
+		table: RoutingTable{VLANIfaces: map[string]VLANIface{}, Routes: map[string]Route{}},
+	}
+	stor.SetConfig(rc)
 	configObj := RoutingTable{}
-	if stor["ConfigFile"] != nil {
-		path, ok := stor["ConfigFile"].(string)
-		if ok {
-			err := config.ReadConfigFile(path, &configObj)
-			if err != nil {
-				log.Printf("Routing Process Failed to read config file due to error %v", err)
-			} else {
-				log.Printf("Routing Config: %+v", configObj)
-				stor["CONFIG"] = configObj
-			}
+	if path != "" {
+		err := config.ReadConfigFile(path, &configObj)
+		if err != nil {
+			routingLog.Error("failed to read config file", "path", path, "error", err)
 		} else {
-			log.Printf("Routing invalid config path specified")
+			routingLog.Info("config loaded", "config", configObj)
+			if configObj.VLANIfaces != nil {
+				rc.table.VLANIfaces = configObj.VLANIfaces
+			}
+			if configObj.Routes != nil {
+				rc.table.Routes = configObj.Routes
+			}
+			rc.loaded = true
 		}
 	}
 }
 
+// ReloadRouting replaces the vlan interfaces and routes with the ones in the
+// config file. routes added at runtime are dropped
+func ReloadRouting(sw *controlplane.Switch, path string) error {
+	rc := getRoutingConfig(sw)
+	if rc == nil {
+		return fmt.Errorf("%w: L3:Routing", controlplane.ErrNoProc)
+	}
+	table := RoutingTable{}
+	if path != "" {
+		err := config.ReadConfigFile(path, &table)
+		if err != nil {
+			return err
+		}
+	}
+	if table.VLANIfaces == nil {
+		table.VLANIfaces = map[string]VLANIface{}
+	}
+	if table.Routes == nil {
+		table.Routes = map[string]Route{}
+	}
+	rc.mutex.Lock()
+	rc.table = table
+	rc.loaded = path != ""
+	rc.mutex.Unlock()
+	routingLog.Info("config reloaded", "config", table)
+	return nil
+}
+
+// RoutingDump returns the configured vlan interfaces and static routes
+func RoutingDump(sw *controlplane.Switch) interface{} {
+	rc := getRoutingConfig(sw)
+	if rc == nil {
+		return RoutingTable{VLANIfaces: map[string]VLANIface{}, Routes: map[string]Route{}}
+	}
+	defer rc.mutex.RUnlock()
+	rc.mutex.RLock()
+	return rc.table
+}
+
+// AddRoute adds or replaces a static route while the switch is running
+func AddRoute(sw *controlplane.Switch, prefix string, route Route) error {
+	_, network, err := net.ParseCIDR(prefix)
+	if err != nil || network.IP.To4() == nil {
+		return fmt.Errorf("invalid prefix %q", prefix)
+	}
+	if len(route.Ports) < 1 {
+		return fmt.Errorf("route %s has no ports", prefix)
+	}
+	rc := getRoutingConfig(sw)
+	if rc == nil {
+		return fmt.Errorf("%w: L3:Routing", controlplane.ErrNoProc)
+	}
+	rc.mutex.Lock()
+	routes := map[string]Route{}
+	for p, r := range rc.table.Routes {
+		routes[p] = r
+	}
+	routes[prefix] = route
+	rc.table = RoutingTable{VLANIfaces: rc.table.VLANIfaces, Routes: routes}
+	rc.loaded = true
+	rc.mutex.Unlock()
+	routingLog.Info("route added", "prefix", prefix, "route", route)
+	sw.Events.Publish(controlplane.Event{Type: controlplane.EventRouteAdded, Prefix: prefix})
+	return nil
+}
+
+// DelRoute removes a static route while the switch is running
+func DelRoute(sw *controlplane.Switch, prefix string) error {
+	rc := getRoutingConfig(sw)
+	if rc == nil {
+		return fmt.Errorf("%w: L3:Routing", controlplane.ErrNoProc)
+	}
+	rc.mutex.Lock()
+	_, ok := rc.table.Routes[prefix]
+	if !ok {
+		rc.mutex.Unlock()
+		return fmt.Errorf("%w: %s", ErrNoRoute, prefix)
+	}
+	routes := map[string]Route{}
+	for p, r := range rc.table.Routes {
+		if p != prefix {
+			routes[p] = r
+		}
+	}
+	rc.table = RoutingTable{VLANIfaces: rc.table.VLANIfaces, Routes: routes}
+	rc.mutex.Unlock()
+	routingLog.Info("route removed", "prefix", prefix)
+	sw.Events.Publish(controlplane.Event{Type: controlplane.EventRouteRemoved, Prefix: prefix})
+	return nil
+}
+
+// RoutingFlush removes the static routes. the vlan interfaces are kept
+func RoutingFlush(sw *controlplane.Switch) error {
+	rc := getRoutingConfig(sw)
+	if rc == nil {
+		return fmt.Errorf("%w: L3:Routing", controlplane.ErrNoProc)
+	}
+	rc.mutex.Lock()
+	routes := rc.table.Routes
+	rc.table = RoutingTable{VLANIfaces: rc.table.VLANIfaces, Routes: map[string]Route{}}
+	rc.mutex.Unlock()
+	routingLog.Info("routes flushed", "routes", len(routes))
+	for prefix := range routes {
+		sw.Events.Publish(controlplane.Event{Type: controlplane.EventRouteRemoved, Prefix: prefix})
+	}
+	return nil
+}
+
 func IngressRouting(proc pipeline.PipelineProcess, msg pipeline.PipelineMessage) pipeline.PipelineMessage {
 	/*
 		if msg ip.destination in my addresses > continue the pipeline
@@ -71,21 +224,19 @@ func IngressRouting(proc pipeline.PipelineProcess, msg pipeline.PipelineMessage)
 		else drop the message
 
 	*/
-	log.Println("Routing Process: Ingress Recieved a message")
 	msgContent, _ := msg.Content.(controlplane.ControlMessage)
-	stor := msgContent.ParentSwitch.Stor.GetStor(3, "Routing")
-	config, ok := stor["CONFIG"].(RoutingTable)
+	config, ok := getConfig(msgContent.ParentSwitch)
 	if !ok {
-		log.Printf("Routing Config is not correct %+v", stor["CONFIG"])
+		routingLog.Debug("no valid config")
 		return msg
 	}
 	i, _ := msgContent.LayerPayload.(ip.IPv4)
 	dstIP := i.Destination.String()
 	dstMAC := msgContent.InFrame.FRAME.Destination.String()
-	log.Printf("Routing Process: dstIP %s, dstMAC: %s", dstIP, dstMAC)
+	routingLog.Debug("ingress packet", "dst_ip", dstIP, "dst_mac", dstMAC)
 	for _, addr := range config.VLANIfaces {
 		if addr.IP == dstIP {
-			log.Printf("Routing: Ingress packet sent to my address %s", addr.IP)
+			routingLog.Debug("ingress packet to a local address", "ip", addr.IP)
 			msg.Finished = false
 			return msg
 		} else if dstMAC == addr.MAC {
@@ -117,12 +268,10 @@ func EgressRouting(proc pipeline.PipelineProcess, msg pipeline.PipelineMessage)
 			- set frame vlan as addr.VLAN
 		}
 	*/
-	log.Println("Routing Process: Egress Recieved a message")
 	msgContent, _ := msg.Content.(controlplane.ControlMessage)
-	stor := msgContent.ParentSwitch.Stor.GetStor(3, "Routing")
-	config, ok := stor["CONFIG"].(RoutingTable)
+	config, ok := getConfig(msgContent.ParentSwitch)
 	if !ok {
-		log.Printf("Routing Config is not correct %+v", stor["CONFIG"])
+		routingLog.Debug("no valid config")
 		return msg
 	}
 	i, _ := msgContent.LayerPayload.(ip.IPv4)
@@ -130,65 +279,59 @@ func EgressRouting(proc pipeline.PipelineProcess, msg pipeline.PipelineMessage)
 	// make sure dstIP is not me
 	for _, localIface := range config.VLANIfaces {
 		if localIface.IP == dstIPStr {
-			log.Printf("Routing Process: Egress Dropping payload with destination as %s", dstIPStr)
+			routingLog.Debug("egress packet to a local address. dropping", "ip", dstIPStr)
 			msg.Drop = true
 			return msg
 		}
 	}
 
 	dstMAC := msgContent.InFrame.FRAME.Destination.String()
-	log.Printf("Routing Process: dstIP %s, dstMAC: %s", dstIPStr, dstMAC)
+	routingLog.Debug("egress packet", "dst_ip", dstIPStr, "dst_mac", dstMAC)
 	for prefix, route := range config.Routes {
-		log.Printf("Rouing Process: comparing prefix: %s, with dest %s", prefix, dstIPStr)
 		temp := strings.Split(prefix, "/")
 		if len(temp) != 2 {
-			log.Printf("Routing Process: Invalid prefix in routing table %s", prefix)
+			routingLog.Warn("invalid prefix in routing table", "prefix", prefix)
 			continue
 		}
 		networkAddr := ip.IP(0)
 		err := networkAddr.FromString(temp[0])
-		log.Printf("Routing Process network %s, IP: %d", temp[0], networkAddr)
 		if err != nil {
-			log.Printf("Routing Process: Invalid prefix in routing table %s", prefix)
+			routingLog.Warn("invalid prefix in routing table", "prefix", prefix)
 			continue
 		}
 		cidr, err := strconv.Atoi(temp[1])
 		mask := uint32(0xFFFFFFFF << (32 - cidr))
-		log.Printf("Routing Process Mask is %x", mask)
 		if err != nil {
-			log.Printf("Routing Process: Invalid prefix in routing table %s", prefix)
+			routingLog.Warn("invalid prefix in routing table", "prefix", prefix)
 			continue
 		}
 		networkMatch := uint32(networkAddr) & mask
-		log.Printf("Routing Process: Prefix stored uint32 %d", uint32(networkAddr))
 		destMatch := uint32(i.Destination) & mask
-		log.Printf("Rouing Process: comparing network: %d, with dest %d", networkMatch, destMatch)
 		if networkMatch == destMatch {
 			// use only one port for now
-			log.Printf("Route %s matched destination", prefix)
+			routingLog.Debug("route matched destination", "prefix", prefix, "dst_ip", dstIPStr)
 			if len(route.Ports) < 1 {
-				log.Printf("Routing Process: no ports in this route for prefix %s", prefix)
+				routingLog.Warn("no ports in route", "prefix", prefix)
 				continue
 			}
 			port := route.Ports[0]
 			iface, ok := config.VLANIfaces[port.Name]
 			if !ok {
-				log.Printf("Routing Process: no VLANIface named %s", port.Name)
+				routingLog.Warn("no vlan interface with this name", "interface", port.Name)
 				continue
 			}
 			srcMAC, err := net.ParseMAC(iface.MAC)
 			if err != nil {
-				log.Printf("Routing Process: Invalid MAC Address in interface %s", port.Name)
+				routingLog.Warn("invalid mac address of vlan interface", "interface", port.Name, "mac", iface.MAC)
 			}
 			msgContent.InFrame.FRAME.VLAN = &ethernet.VLAN{ID: iface.VLAN}
 			msgContent.InFrame.FRAME.Source = srcMAC
 			msgContent.InFrame.FRAME.Destination = nil
 			msgContent.NextHop = port.NextHop
 			msg.Content = msgContent
-			log.Printf("Routing Proc: out frame %+v", msgContent.InFrame.FRAME)
 			return msg
 		}
 	}
-	log.Printf("Routing Process: no match for frame %+v", msgContent.InFrame.FRAME)
+	routingLog.Debug("no route matched destination", "dst_ip", dstIPStr)
 	return msg
 }
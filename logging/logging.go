@@ -0,0 +1,200 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/m-motawea/gSwitch/config"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+const DEFAULT_FILE = "gSwitch.log"
+const DEFAULT_LEVEL = slog.LevelInfo
+
+/*
+	every package gets its logger once at init:
+
+		var logger = logging.Logger("dataplane")
+
+	and control processes get one named after the process:
+
+		var logger = logging.ProcLogger(2, "L2Switch")
+
+	the level of a process logger is looked up by process name, then by layer
+	("l2"), then falls back to the default level. loggers are created before the
+	config is read so they resolve their level and output on every Setup.
+*/
+
+type subsystem struct {
+	names []string // most specific first
+	level *slog.LevelVar
+}
+
+var (
+	mutex      = &sync.RWMutex{}
+	base       slog.Handler
+	subsystems = []*subsystem{}
+	levels     = map[string]slog.Level{}
+	defLevel   = DEFAULT_LEVEL
+)
+
+func init() {
+	base = slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug})
+}
+
+func ParseLevel(s string) (slog.Level, error) {
+	var level slog.Level
+	if s == "" {
+		return DEFAULT_LEVEL, nil
+	}
+	err := level.UnmarshalText([]byte(s))
+	if err != nil {
+		return level, fmt.Errorf("invalid log level %q", s)
+	}
+	return level, nil
+}
+
+func newLogger(names []string, attrs ...any) *slog.Logger {
+	sub := &subsystem{names: names, level: &slog.LevelVar{}}
+	defer mutex.Unlock()
+	mutex.Lock()
+	sub.level.Set(resolve(sub))
+	subsystems = append(subsystems, sub)
+	return slog.New(&handler{sub: sub}).With(attrs...)
+}
+
+// Logger returns the logger of a subsystem (dataplane, controlplane, ...)
+func Logger(name string) *slog.Logger {
+	return newLogger([]string{name}, "subsystem", name)
+}
+
+// ProcLogger returns the logger of a control process
+func ProcLogger(layer int, name string) *slog.Logger {
+	layerName := fmt.Sprintf("l%d", layer)
+	return newLogger([]string{name, layerName}, "subsystem", layerName, "process", name)
+}
+
+func resolve(sub *subsystem) slog.Level {
+	for _, name := range sub.names {
+		level, ok := levels[strings.ToLower(name)]
+		if ok {
+			return level
+		}
+	}
+	return defLevel
+}
+
+// Setup applies the log config to every logger. it can be called again to
+// change levels or output at runtime. the returned closer closes the log file.
+func Setup(cfg config.LogConfig) (io.Closer, error) {
+	level, err := ParseLevel(cfg.Level)
+	if err != nil {
+		return nil, err
+	}
+	subLevels := map[string]slog.Level{}
+	for name, s := range cfg.Subsystems {
+		subLevel, err := ParseLevel(s)
+		if err != nil {
+			return nil, fmt.Errorf("subsystem %s: %v", name, err)
+		}
+		subLevels[strings.ToLower(name)] = subLevel
+	}
+
+	var out io.WriteCloser
+	switch {
+	case cfg.File == "-":
+		out = nopCloser{os.Stderr}
+	case cfg.MaxSizeMB > 0:
+		out = &lumberjack.Logger{
+			Filename:   fileName(cfg),
+			MaxSize:    cfg.MaxSizeMB,
+			MaxBackups: cfg.MaxBackups,
+			MaxAge:     cfg.MaxAgeDays,
+			Compress:   cfg.Compress,
+		}
+	default:
+		out, err = os.OpenFile(fileName(cfg), os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	opts := &slog.HandlerOptions{Level: slog.LevelDebug}
+	var h slog.Handler
+	switch cfg.Format {
+	case "", "text":
+		h = slog.NewTextHandler(out, opts)
+	case "json":
+		h = slog.NewJSONHandler(out, opts)
+	default:
+		out.Close()
+		return nil, fmt.Errorf("invalid log format %q", cfg.Format)
+	}
+
+	mutex.Lock()
+	base = h
+	levels = subLevels
+	defLevel = level
+	for _, sub := range subsystems {
+		sub.level.Set(resolve(sub))
+	}
+	mutex.Unlock()
+
+	// anything still using the standard log package ends up in the same output
+	slog.SetDefault(slog.New(h))
+	return out, nil
+}
+
+func fileName(cfg config.LogConfig) string {
+	if cfg.File == "" {
+		return DEFAULT_FILE
+	}
+	return cfg.File
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
+
+// handler filters by the subsystem level and hands records to the handler
+// of the current Setup. attributes and groups added with With are replayed
+// on it so loggers created before Setup still write to the new output.
+type handler struct {
+	sub  *subsystem
+	with []func(slog.Handler) slog.Handler
+}
+
+func (h *handler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.sub.level.Level()
+}
+
+func (h *handler) Handle(ctx context.Context, r slog.Record) error {
+	mutex.RLock()
+	out := base
+	mutex.RUnlock()
+	for _, w := range h.with {
+		out = w(out)
+	}
+	return out.Handle(ctx, r)
+}
+
+func (h *handler) extend(w func(slog.Handler) slog.Handler) *handler {
+	with := make([]func(slog.Handler) slog.Handler, len(h.with), len(h.with)+1)
+	copy(with, h.with)
+	return &handler{sub: h.sub, with: append(with, w)}
+}
+
+func (h *handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return h.extend(func(out slog.Handler) slog.Handler { return out.WithAttrs(attrs) })
+}
+
+func (h *handler) WithGroup(name string) slog.Handler {
+	return h.extend(func(out slog.Handler) slog.Handler { return out.WithGroup(name) })
+}
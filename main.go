@@ -1,40 +1,181 @@
 package main
 
 import (
-	"log"
+	"context"
+	"fmt"
+	"io"
 	"os"
+	"os/signal"
 	"sync"
+	"syscall"
+	"time"
 
+	"github.com/m-motawea/gSwitch/api"
 	"github.com/m-motawea/gSwitch/config"
 	"github.com/m-motawea/gSwitch/controlplane"
+	"github.com/m-motawea/gSwitch/datastore"
+	"github.com/m-motawea/gSwitch/logging"
+	"github.com/m-motawea/gSwitch/metrics"
+	"github.com/m-motawea/gSwitch/rpc"
 )
 
-func main() {
-	f, err := os.OpenFile("gSwitch.log", os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
+var logger = logging.Logger("main")
+
+const SHUTDOWN_TIMEOUT = 10 * time.Second
+
+// reloader applies the config file to the running switch on SIGHUP or a
+// management api call
+type reloader struct {
+	mutex   *sync.Mutex
+	path    string
+	config  config.Config
+	logFile io.Closer
+	sw      *controlplane.Switch
+}
+
+func (r *reloader) Reload() error {
+	defer r.mutex.Unlock()
+	r.mutex.Lock()
+	cfg, err := config.ReadConfig(r.path)
 	if err != nil {
-		log.Fatalf("error opening file: %v", err)
+		logger.Error("failed to read config", "path", r.path, "error", err)
+		return err
 	}
-	defer f.Close()
+	logFile, err := logging.Setup(cfg.Log)
+	if err != nil {
+		logger.Error("failed to set up logging", "error", err)
+		return err
+	}
+	r.logFile.Close()
+	r.logFile = logFile
+	if cfg.Redis != r.config.Redis || cfg.Metrics != r.config.Metrics || cfg.API != r.config.API || cfg.GRPC != r.config.GRPC {
+		logger.Warn("Redis, Metrics, API and GRPC changes need a restart")
+	}
+	r.config = cfg
+	return r.sw.Reload(cfg)
+}
 
-	log.SetOutput(f)
-	var wg sync.WaitGroup
+func (r *reloader) Close() error {
+	defer r.mutex.Unlock()
+	r.mutex.Lock()
+	return r.logFile.Close()
+}
+
+func main() {
 	configPath := "config.toml"
 	if len(os.Args) > 1 {
 		configPath = os.Args[1]
 	}
+	err := run(configPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// run starts the switch and its services and stops them on SIGINT or SIGTERM
+func run(configPath string) error {
+	var wg sync.WaitGroup
 	CONFIG, err := config.ReadConfig(configPath)
 	if err != nil {
-		log.Fatal(err)
+		return err
+	}
+	logFile, err := logging.Setup(CONFIG.Log)
+	if err != nil {
+		return fmt.Errorf("error setting up logging: %w", err)
 	}
-	log.Printf("Config: %v", CONFIG)
-	sw := controlplane.NewSwitch("main switch", CONFIG, &wg)
+
+	logger.Info("config loaded", "path", configPath, "config", CONFIG)
+	sw, err := controlplane.NewSwitch("main switch", CONFIG, &wg)
+	if err != nil {
+		logger.Error("failed to build switch", "error", err)
+		logFile.Close()
+		return err
+	}
+	r := &reloader{mutex: &sync.Mutex{}, path: configPath, config: CONFIG, logFile: logFile, sw: sw}
+	defer r.Close()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 	sw.Start()
+
+	go func() {
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		defer signal.Stop(hup)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hup:
+				logger.Info("received SIGHUP. reloading config", "path", configPath)
+				r.Reload()
+			}
+		}
+	}()
+	if CONFIG.Metrics.Enabled {
+		go func() {
+			err := metrics.Serve(ctx, sw, CONFIG.Metrics)
+			if err != nil {
+				logger.Error("metrics server stopped", "error", err)
+			}
+		}()
+	}
+	// a disabled api serves neither the http listener nor the socket
+	if CONFIG.API.Enabled && CONFIG.API.Address != "-" {
+		go func() {
+			err := api.Serve(ctx, sw, CONFIG.API, r.Reload)
+			if err != nil {
+				logger.Error("management api stopped", "error", err)
+			}
+		}()
+	}
+	if CONFIG.API.Enabled && CONFIG.API.Socket != "-" {
+		go func() {
+			err := api.ServeUnix(ctx, sw, CONFIG.API.Socket, r.Reload)
+			if err != nil {
+				logger.Error("management socket stopped", "error", err)
+			}
+		}()
+	}
+	if CONFIG.GRPC.Enabled {
+		go func() {
+			err := rpc.Serve(ctx, sw, CONFIG.GRPC)
+			if err != nil {
+				logger.Error("grpc api stopped", "error", err)
+			}
+		}()
+	}
 	for name, portCfg := range CONFIG.SwitchPorts {
-		log.Printf("Port %s config: %v", name, portCfg)
-		sw.AddSwitchPort(name, portCfg)
-		if portCfg.Up {
-			sw.UpPort(name)
+		logger.Info("port config", "port", name, "config", portCfg)
+		_, err := sw.AddSwitchPort(name, portCfg)
+		if err != nil {
+			logger.Error("failed to add port", "port", name, "error", err)
+		}
+	}
+	if CONFIG.Redis.Enabled {
+		store, err := datastore.NewRedisStore(sw, CONFIG.Redis)
+		if err != nil {
+			logger.Error("failed to connect to redis", "error", err)
+		} else {
+			defer store.Close()
+			go func() {
+				err := store.Run(ctx)
+				if err != nil {
+					logger.Error("redis datastore stopped", "error", err)
+				}
+			}()
 		}
 	}
-	wg.Wait()
+
+	<-ctx.Done()
+	// a second signal kills the process right away
+	stop()
+	logger.Info("shutting down", "timeout", SHUTDOWN_TIMEOUT)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), SHUTDOWN_TIMEOUT)
+	defer cancel()
+	err = sw.Stop(shutdownCtx)
+	if err != nil {
+		logger.Error("failed to stop switch", "error", err)
+	}
+	return err
 }
@@ -0,0 +1,168 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/m-motawea/gSwitch/config"
+	"github.com/m-motawea/gSwitch/controlplane"
+	"github.com/m-motawea/gSwitch/dataplane"
+	"github.com/m-motawea/gSwitch/logging"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var logger = logging.Logger("metrics")
+
+const NAMESPACE = "gswitch"
+const DEFAULT_ADDRESS = ":9100"
+const DEFAULT_PATH = "/metrics"
+
+func desc(name string, help string, labels ...string) *prometheus.Desc {
+	return prometheus.NewDesc(prometheus.BuildFQName(NAMESPACE, "", name), help, labels, nil)
+}
+
+var (
+	portUp          = desc("port_up", "Whether the port is up.", "port")
+	portPackets     = desc("port_packets_total", "Frames received and sent by the port.", "port", "direction")
+	portBytes       = desc("port_bytes_total", "Bytes received and sent by the port.", "port", "direction")
+	portCast        = desc("port_cast_packets_total", "Frames received and sent by the port per destination type.", "port", "direction", "type")
+	portVLANPackets = desc("port_vlan_packets_total", "Frames received and sent by the port per vlan.", "port", "vlan", "direction")
+	portVLANBytes   = desc("port_vlan_bytes_total", "Bytes received and sent by the port per vlan.", "port", "vlan", "direction")
+	portDrops       = desc("port_drops_total", "Frames dropped by the port per reason.", "port", "reason")
+	portViolations  = desc("port_security_violations_total", "Port security violations of the port.", "port")
+	portErrDisabled = desc("port_err_disabled", "Whether the port is err-disabled.", "port", "reason")
+	procMessages    = desc("process_messages_total", "Messages handled by the control process.", "layer", "process", "direction")
+	procDropped     = desc("process_dropped_total", "Messages dropped by the control process.", "layer", "process", "direction")
+	procFinished    = desc("process_finished_total", "Messages finished by the control process.", "layer", "process", "direction")
+	procSeconds     = desc("process_seconds_total", "Time spent in the control process.", "layer", "process", "direction")
+	pipelineLatency = desc("pipeline_latency_seconds", "Time from a frame entering the control pipeline until it is handed to the out ports.")
+)
+
+// Collector reads the switch counters on every scrape. process gauges are
+// reported by the processes themselves and their label sets are only known
+// when collecting, so the collector is unchecked.
+type Collector struct {
+	sw *controlplane.Switch
+}
+
+func NewCollector(sw *controlplane.Switch) *Collector {
+	return &Collector{sw: sw}
+}
+
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {}
+
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.collectPorts(ch)
+	c.collectProcs(ch)
+	c.collectLatency(ch)
+}
+
+func counter(ch chan<- prometheus.Metric, d *prometheus.Desc, v uint64, labels ...string) {
+	ch <- prometheus.MustNewConstMetric(d, prometheus.CounterValue, float64(v), labels...)
+}
+
+func (c *Collector) collectPorts(ch chan<- prometheus.Metric) {
+	for name, port := range c.sw.PortMap() {
+		up := 0.0
+		if port.IsUp() {
+			up = 1
+		}
+		ch <- prometheus.MustNewConstMetric(portUp, prometheus.GaugeValue, up, name)
+		info, ok := port.ErrDisabled()
+		if ok {
+			ch <- prometheus.MustNewConstMetric(portErrDisabled, prometheus.GaugeValue, 1, name, info.Reason)
+		}
+	}
+	for name, stats := range c.sw.AllPortStats() {
+		for direction, tc := range map[string]dataplane.TrafficCounters{"rx": stats.Rx, "tx": stats.Tx} {
+			counter(ch, portPackets, tc.Packets, name, direction)
+			counter(ch, portBytes, tc.Bytes, name, direction)
+			counter(ch, portCast, tc.Unicast, name, direction, "unicast")
+			counter(ch, portCast, tc.Multicast, name, direction, "multicast")
+			counter(ch, portCast, tc.Broadcast, name, direction, "broadcast")
+		}
+		for vlan, vc := range stats.VLANs {
+			id := strconv.Itoa(vlan)
+			counter(ch, portVLANPackets, vc.Rx.Packets, name, id, "rx")
+			counter(ch, portVLANPackets, vc.Tx.Packets, name, id, "tx")
+			counter(ch, portVLANBytes, vc.Rx.Bytes, name, id, "rx")
+			counter(ch, portVLANBytes, vc.Tx.Bytes, name, id, "tx")
+		}
+		for reason, n := range stats.Drops {
+			counter(ch, portDrops, n, name, reason)
+		}
+		counter(ch, portViolations, stats.Security.Violations, name)
+	}
+}
+
+func (c *Collector) collectProcs(ch chan<- prometheus.Metric) {
+	for _, ps := range c.sw.ProcStats() {
+		layer := strconv.Itoa(ps.Layer)
+		for direction, ds := range map[string]controlplane.ProcDirectionStats{"in": ps.In, "out": ps.Out} {
+			counter(ch, procMessages, ds.Messages, layer, ps.Name, direction)
+			counter(ch, procDropped, ds.Dropped, layer, ps.Name, direction)
+			counter(ch, procFinished, ds.Finished, layer, ps.Name, direction)
+			ch <- prometheus.MustNewConstMetric(procSeconds, prometheus.CounterValue, ds.Seconds, layer, ps.Name, direction)
+		}
+	}
+	for _, g := range c.sw.ProcGauges() {
+		labels := []string{}
+		for label := range g.Labels {
+			labels = append(labels, label)
+		}
+		sort.Strings(labels)
+		values := []string{}
+		for _, label := range labels {
+			values = append(values, g.Labels[label])
+		}
+		valueType := prometheus.GaugeValue
+		if g.Counter {
+			valueType = prometheus.CounterValue
+		}
+		m, err := prometheus.NewConstMetric(desc(g.Name, g.Help, labels...), valueType, g.Value, values...)
+		if err != nil {
+			logger.Warn("invalid process gauge", "gauge", g.Name, "error", err)
+			continue
+		}
+		ch <- m
+	}
+}
+
+func (c *Collector) collectLatency(ch chan<- prometheus.Metric) {
+	ls := c.sw.PipelineLatency()
+	ch <- prometheus.MustNewConstHistogram(pipelineLatency, ls.Count, ls.Sum, ls.Buckets)
+}
+
+// Serve exposes the switch metrics over http. it blocks until ctx is done or the
+// listener fails.
+func Serve(ctx context.Context, sw *controlplane.Switch, cfg config.MetricsConfig) error {
+	if cfg.Address == "" {
+		cfg.Address = DEFAULT_ADDRESS
+	}
+	if cfg.Path == "" {
+		cfg.Path = DEFAULT_PATH
+	}
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(
+		NewCollector(sw),
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	mux := http.NewServeMux()
+	mux.Handle(cfg.Path, promhttp.HandlerFor(reg, promhttp.HandlerOpts{}))
+	srv := &http.Server{Addr: cfg.Address, Handler: mux}
+	stop := context.AfterFunc(ctx, func() {
+		srv.Close()
+	})
+	defer stop()
+	logger.Info("serving metrics", "address", cfg.Address, "path", cfg.Path)
+	err := srv.ListenAndServe()
+	if ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,192 @@
+package rpc
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative gswitch.proto
+
+import (
+	"context"
+	"errors"
+	"net"
+
+	"github.com/m-motawea/gSwitch/config"
+	"github.com/m-motawea/gSwitch/controlplane"
+	"github.com/m-motawea/gSwitch/l2"
+	"github.com/m-motawea/gSwitch/logging"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+var logger = logging.Logger("grpc")
+
+const DEFAULT_ADDRESS = "127.0.0.1:9090"
+
+var eventTypes = map[controlplane.EventType]EventType{
+	controlplane.EventMACLearned:   EventType_EVENT_TYPE_MAC_LEARNED,
+	controlplane.EventMACMoved:     EventType_EVENT_TYPE_MAC_MOVED,
+	controlplane.EventMACAged:      EventType_EVENT_TYPE_MAC_AGED,
+	controlplane.EventMACFlushed:   EventType_EVENT_TYPE_MAC_FLUSHED,
+	controlplane.EventARPAdded:     EventType_EVENT_TYPE_ARP_ADDED,
+	controlplane.EventARPExpired:   EventType_EVENT_TYPE_ARP_EXPIRED,
+	controlplane.EventARPFlushed:   EventType_EVENT_TYPE_ARP_FLUSHED,
+	controlplane.EventPortUp:       EventType_EVENT_TYPE_PORT_UP,
+	controlplane.EventPortDown:     EventType_EVENT_TYPE_PORT_DOWN,
+	controlplane.EventRouteAdded:   EventType_EVENT_TYPE_ROUTE_ADDED,
+	controlplane.EventRouteRemoved: EventType_EVENT_TYPE_ROUTE_REMOVED,
+	controlplane.EventPortSecurity: EventType_EVENT_TYPE_PORT_SECURITY_VIOLATION,
+	controlplane.EventMACFlap:      EventType_EVENT_TYPE_MAC_FLAP,
+	controlplane.EventSTPPortState: EventType_EVENT_TYPE_STP_PORT_STATE,
+	controlplane.EventSTPTopology:  EventType_EVENT_TYPE_STP_TOPOLOGY_CHANGE,
+}
+
+type Server struct {
+	UnimplementedGSwitchServer
+	sw *controlplane.Switch
+}
+
+func NewServer(sw *controlplane.Switch) *Server {
+	return &Server{sw: sw}
+}
+
+// Serve runs the grpc api. it blocks until ctx is done or the listener fails.
+func Serve(ctx context.Context, sw *controlplane.Switch, cfg config.GRPCConfig) error {
+	if cfg.Address == "" {
+		cfg.Address = DEFAULT_ADDRESS
+	}
+	l, err := net.Listen("tcp", cfg.Address)
+	if err != nil {
+		return err
+	}
+	s := grpc.NewServer()
+	RegisterGSwitchServer(s, NewServer(sw))
+	// subscribers never finish on their own so there is nothing to wait for
+	stop := context.AfterFunc(ctx, s.Stop)
+	defer stop()
+	logger.Info("serving grpc api", "address", cfg.Address)
+	err = s.Serve(l)
+	if ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
+
+func toStatus(err error) error {
+	switch {
+	case errors.Is(err, controlplane.ErrNoPort), errors.Is(err, controlplane.ErrNoProc):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, controlplane.ErrNotSupported):
+		return status.Error(codes.Unimplemented, err.Error())
+	}
+	return status.Error(codes.Internal, err.Error())
+}
+
+func (s *Server) ListPorts(ctx context.Context, req *ListPortsRequest) (*ListPortsResponse, error) {
+	resp := &ListPortsResponse{}
+	for _, info := range s.sw.PortInfos() {
+		port := &Port{
+			Name:    info.Name,
+			Up:      info.Up,
+			Trunk:   info.Trunk,
+			Vlan:    int32(info.VLAN),
+			Backend: info.Backend,
+		}
+		if info.ErrDisabled != nil {
+			port.ErrDisabled = info.ErrDisabled.Reason
+		}
+		for _, vlan := range info.AllowedVLANs {
+			port.AllowedVlans = append(port.AllowedVlans, int32(vlan))
+		}
+		resp.Ports = append(resp.Ports, port)
+	}
+	return resp, nil
+}
+
+func (s *Server) GetMACTable(ctx context.Context, req *GetMACTableRequest) (*GetMACTableResponse, error) {
+	entries, err := l2.MACEntries(s.sw, l2.MACQuery{VLAN: int(req.Vlan)})
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	resp := &GetMACTableResponse{}
+	for _, ent := range entries {
+		resp.Entries = append(resp.Entries, &MACEntry{
+			Vlan:       int32(ent.VLAN),
+			Mac:        ent.MAC,
+			Port:       ent.Port,
+			AgeSeconds: ent.Age,
+		})
+	}
+	return resp, nil
+}
+
+func (s *Server) GetARPTable(ctx context.Context, req *GetARPTableRequest) (*GetARPTableResponse, error) {
+	table, err := s.sw.ProcTable(2, "ARP")
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	entries, ok := table.([]l2.ARPTableEntry)
+	if !ok {
+		return nil, status.Errorf(codes.Internal, "unexpected arp table %T", table)
+	}
+	resp := &GetARPTableResponse{}
+	for _, ent := range entries {
+		resp.Entries = append(resp.Entries, &ARPEntry{
+			Ip:         ent.IP,
+			Mac:        ent.MAC,
+			Port:       ent.Port,
+			AgeSeconds: ent.Age,
+		})
+	}
+	return resp, nil
+}
+
+func (s *Server) Subscribe(req *SubscribeRequest, stream GSwitch_SubscribeServer) error {
+	types := []controlplane.EventType{}
+	for _, t := range req.Types {
+		found := false
+		for evType, pbType := range eventTypes {
+			if pbType == t {
+				types = append(types, evType)
+				found = true
+			}
+		}
+		if !found {
+			return status.Errorf(codes.InvalidArgument, "invalid event type %v", t)
+		}
+	}
+	sub := s.sw.Events.Subscribe(0, types...)
+	defer sub.Close()
+	logger.Info("subscriber connected", "types", types)
+	defer func() {
+		logger.Info("subscriber disconnected", "dropped", sub.Dropped())
+	}()
+
+	ctx := stream.Context()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case ev, ok := <-sub.C:
+			if !ok {
+				return nil
+			}
+			err := stream.Send(&Event{
+				Type:     eventTypes[ev.Type],
+				Time:     timestamppb.New(ev.Time),
+				Port:     ev.Port,
+				OldPort:  ev.OldPort,
+				Vlan:     int32(ev.VLAN),
+				Mac:      ev.MAC,
+				Ip:       ev.IP,
+				Prefix:   ev.Prefix,
+				Reason:   ev.Reason,
+				Moves:    int32(ev.Moves),
+				Role:     ev.Role,
+				State:    ev.State,
+				Instance: uint32(ev.Instance),
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package switchtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/m-motawea/gSwitch/config"
+	"github.com/m-motawea/gSwitch/controlplane"
+	"github.com/m-motawea/gSwitch/dataplane"
+	"github.com/m-motawea/gSwitch/logging"
+	"github.com/mdlayher/ethernet"
+
+	_ "github.com/m-motawea/gSwitch/l2"
+	_ "github.com/m-motawea/gSwitch/l3"
+)
+
+var logger = logging.Logger("switchtest")
+
+var ErrNoFrame = errors.New("no frame received")
+
+// Harness runs a Switch built from a config.Config with every port backed by
+// an in-memory pair. Tests hold the far end of each pair to inject frames
+// and to check what the switch sends out of each port.
+type Harness struct {
+	Switch *controlplane.Switch
+	Hosts  map[string]*dataplane.MemoryBackend // port name to the far end of its wire
+	out    map[string]chan *ethernet.Frame
+	wg     *sync.WaitGroup
+}
+
+func NewHarness(cfg config.Config) (*Harness, error) {
+	h := Harness{
+		Hosts: map[string]*dataplane.MemoryBackend{},
+		out:   map[string]chan *ethernet.Frame{},
+		wg:    &sync.WaitGroup{},
+	}
+	sw, err := controlplane.NewSwitch("test switch", cfg, h.wg)
+	if err != nil {
+		return nil, err
+	}
+	h.Switch = sw
+	h.Switch.Start()
+
+	names := []string{}
+	for name := range cfg.SwitchPorts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		portCfg := cfg.SwitchPorts[name]
+		portEnd, hostEnd := dataplane.NewMemoryPair(name, "host-"+name)
+		hostEnd.Open()
+		_, err := h.Switch.AddSwitchPortWithBackend(name, portCfg, portEnd)
+		if err != nil {
+			return &h, err
+		}
+		h.Hosts[name] = hostEnd
+		h.out[name] = make(chan *ethernet.Frame, dataplane.MEMORY_BUFFER_SIZE)
+		go h.readLoop(name, hostEnd, h.out[name])
+	}
+	return &h, nil
+}
+
+// Link adds a port to h and one to other and wires them together, so
+// switches can be tested against each other. the ports have no host end
+func (h *Harness) Link(port string, portCfg config.SwitchPortConfig, other *Harness, otherPort string, otherCfg config.SwitchPortConfig) error {
+	portEnd, otherEnd := dataplane.NewMemoryPair(port, otherPort)
+	_, err := h.Switch.AddSwitchPortWithBackend(port, portCfg, portEnd)
+	if err != nil {
+		return err
+	}
+	_, err = other.Switch.AddSwitchPortWithBackend(otherPort, otherCfg, otherEnd)
+	return err
+}
+
+func (h *Harness) readLoop(port string, host *dataplane.MemoryBackend, out chan *ethernet.Frame) {
+	for {
+		buf := make([]byte, host.MTU())
+		n, _, err := host.ReadFrame(buf)
+		if err != nil {
+			logger.Info("stopped reading port", "port", port, "error", err)
+			close(out)
+			return
+		}
+		f := ethernet.Frame{}
+		err = f.UnmarshalBinary(buf[:n])
+		if err != nil {
+			logger.Warn("port sent invalid frame", "port", port, "error", err)
+			continue
+		}
+		out <- &f
+	}
+}
+
+// Stop stops the switch, waiting up to timeout for it, and unplugs the hosts.
+// frames the switch sent before it stopped can still be received.
+func (h *Harness) Stop(timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	err := h.Switch.Stop(ctx)
+	for _, host := range h.Hosts {
+		host.Close()
+	}
+	return err
+}
+
+func (h *Harness) Inject(port string, frame *ethernet.Frame) error {
+	host, ok := h.Hosts[port]
+	if !ok {
+		return fmt.Errorf("no port named %s in harness", port)
+	}
+	b, err := frame.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	logger.Debug("injecting frame", "port", port)
+	_, err = host.WriteFrame(b)
+	return err
+}
+
+func (h *Harness) Receive(port string, timeout time.Duration) (*ethernet.Frame, error) {
+	out, ok := h.out[port]
+	if !ok {
+		return nil, fmt.Errorf("no port named %s in harness", port)
+	}
+	select {
+	case f, ok := <-out:
+		if !ok {
+			return nil, fmt.Errorf("port %s is closed", port)
+		}
+		return f, nil
+	case <-time.After(timeout):
+		return nil, fmt.Errorf("%w: port %s within %v", ErrNoFrame, port, timeout)
+	}
+}
+
+// ExpectNone returns an error if the switch sends any frame out of the port
+// before the timeout expires.
+func (h *Harness) ExpectNone(port string, timeout time.Duration) error {
+	f, err := h.Receive(port, timeout)
+	if errors.Is(err, ErrNoFrame) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return fmt.Errorf("unexpected frame out of port %s: %+v", port, f)
+}
+
+// Flush discards every frame the switch has sent out of the port so far.
+func (h *Harness) Flush(port string) {
+	for {
+		_, err := h.Receive(port, 10*time.Millisecond)
+		if err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,398 @@
+package switchtest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/m-motawea/gSwitch/config"
+	"github.com/m-motawea/gSwitch/controlplane"
+	"github.com/m-motawea/gSwitch/dataplane"
+	"github.com/m-motawea/gSwitch/l2"
+	"github.com/mdlayher/arp"
+	"github.com/mdlayher/ethernet"
+)
+
+const receiveTimeout = 2 * time.Second
+const noFrameTimeout = 200 * time.Millisecond
+
+var (
+	hostA = mustMAC("02:00:00:00:00:0a")
+	hostB = mustMAC("02:00:00:00:00:0b")
+	hostC = mustMAC("02:00:00:00:00:0c")
+
+	vlan1MAC  = mustMAC("52:9c:57:5e:40:aa")
+	vlan10MAC = mustMAC("52:e1:47:de:21:2a")
+)
+
+func mustMAC(s string) net.HardwareAddr {
+	mac, err := net.ParseMAC(s)
+	if err != nil {
+		panic(err)
+	}
+	return mac
+}
+
+func newTestHarness(t *testing.T, cfg config.Config) *Harness {
+	t.Helper()
+	h, err := NewHarness(cfg)
+	if h != nil {
+		t.Cleanup(func() {
+			h.Stop(5 * time.Second)
+		})
+	}
+	if err != nil {
+		t.Fatalf("failed to start harness: %v", err)
+	}
+	return h
+}
+
+// writeConfig writes a process config file to the test directory
+func writeConfig(t *testing.T, name string, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	err := os.WriteFile(path, []byte(content), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func l2Config() config.Config {
+	return config.Config{
+		SwitchPorts: map[string]config.SwitchPortConfig{
+			"p1": {AllowedVLANs: []int{10}, Up: true},
+			"p2": {AllowedVLANs: []int{10}, Up: true},
+			"p3": {AllowedVLANs: []int{10}, Up: true},
+			"p4": {AllowedVLANs: []int{20}, Up: true},
+		},
+		ControlProcess: []config.ControlProcessConfig{{Layer: 2, Name: "L2Switch"}},
+	}
+}
+
+// l3Config routes between vlan 1 (port a) and vlan 10 (port b) with the
+// addresses of the example config
+func l3Config(t *testing.T) config.Config {
+	arpConf := writeConfig(t, "ARPConfig.toml", `
+[LocalAddresses.VLAN1]
+IP = "10.1.1.1"
+MAC = "52:9c:57:5e:40:aa"
+[LocalAddresses.VLAN10]
+IP = "10.10.1.1"
+MAC = "52:e1:47:de:21:2a"
+`)
+	adapterConf := writeConfig(t, "L2Adapter.toml", `
+[AllowedAddresses."52:9c:57:5e:40:aa"]
+MAC = "52:9c:57:5e:40:aa"
+Name = "VLAN1"
+[AllowedAddresses."52:e1:47:de:21:2a"]
+MAC = "52:e1:47:de:21:2a"
+Name = "VLAN10"
+`)
+	routingConf := writeConfig(t, "RoutingTable.toml", `
+[VLANIfaces.VLAN1]
+IP = "10.1.1.1"
+MAC = "52:9c:57:5e:40:aa"
+VLAN = 1
+[VLANIfaces.VLAN10]
+IP = "10.10.1.1"
+MAC = "52:e1:47:de:21:2a"
+VLAN = 10
+[[Routes."10.1.0.0/16".Ports]]
+Name = "VLAN1"
+[[Routes."10.10.0.0/16".Ports]]
+Name = "VLAN10"
+`)
+	icmpConf := writeConfig(t, "ICMPConfig.toml", `
+[LocalAddresses.VLAN1]
+Address = "10.1.1.1"
+[LocalAddresses.VLAN10]
+Address = "10.10.1.1"
+`)
+	return config.Config{
+		SwitchPorts: map[string]config.SwitchPortConfig{
+			"a": {AllowedVLANs: []int{1}, Up: true},
+			"b": {AllowedVLANs: []int{10}, Up: true},
+		},
+		ControlProcess: []config.ControlProcessConfig{
+			{Layer: 2, Name: "L2Switch"},
+			{Layer: 2, Name: "ARP", ConfigFile: arpConf},
+			{Layer: 2, Name: "L2Adapter", ConfigFile: adapterConf},
+			{Layer: 3, Name: "IPv4"},
+			{Layer: 3, Name: "Routing", ConfigFile: routingConf},
+			{Layer: 3, Name: "ICMP", ConfigFile: icmpConf},
+		},
+	}
+}
+
+func dataFrame(src net.HardwareAddr, dst net.HardwareAddr, payload []byte) *ethernet.Frame {
+	return &ethernet.Frame{Destination: dst, Source: src, EtherType: 0x88b5, Payload: payload}
+}
+
+func receiveFrom(t *testing.T, h *Harness, port string, src net.HardwareAddr) *ethernet.Frame {
+	t.Helper()
+	deadline := time.Now().Add(receiveTimeout)
+	for time.Now().Before(deadline) {
+		f, err := h.Receive(port, time.Until(deadline))
+		if err != nil {
+			break
+		}
+		if bytes.Equal(f.Source, src) {
+			return f
+		}
+	}
+	t.Fatalf("no frame from %s out of port %s", src, port)
+	return nil
+}
+
+func expectNone(t *testing.T, h *Harness, ports ...string) {
+	t.Helper()
+	for _, port := range ports {
+		err := h.ExpectNone(port, noFrameTimeout)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestFloodUnknownUnicast(t *testing.T) {
+	h := newTestHarness(t, l2Config())
+	payload := []byte("unknown unicast")
+	err := h.Inject("p1", dataFrame(hostA, hostB, payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, port := range []string{"p2", "p3"} {
+		f := receiveFrom(t, h, port, hostA)
+		if !bytes.Equal(f.Destination, hostB) || !bytes.HasPrefix(f.Payload, payload) {
+			t.Fatalf("port %s sent %+v", port, f)
+		}
+	}
+	// not back out of the in port and not into another vlan
+	expectNone(t, h, "p1", "p4")
+}
+
+func TestLearnThenForward(t *testing.T) {
+	h := newTestHarness(t, l2Config())
+	h.Inject("p1", dataFrame(hostA, ethernet.Broadcast, []byte("hello")))
+	for _, port := range []string{"p2", "p3"} {
+		receiveFrom(t, h, port, hostA)
+	}
+
+	h.Inject("p2", dataFrame(hostB, hostA, []byte("reply")))
+	receiveFrom(t, h, "p1", hostB)
+	expectNone(t, h, "p3", "p4")
+
+	// hostB was learned from the reply
+	h.Inject("p3", dataFrame(hostC, hostB, []byte("to b")))
+	receiveFrom(t, h, "p2", hostC)
+	expectNone(t, h, "p1", "p4")
+}
+
+func arpRequest(t *testing.T, src net.HardwareAddr, srcIP string, targetIP string) *ethernet.Frame {
+	t.Helper()
+	p, err := arp.NewPacket(arp.OperationRequest, src, net.ParseIP(srcIP), ethernet.Broadcast, net.ParseIP(targetIP))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pb, err := p.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &ethernet.Frame{Destination: ethernet.Broadcast, Source: src, EtherType: ethernet.EtherTypeARP, Payload: pb}
+}
+
+// resolveGateway sends an ARP request for the vlan interface address and
+// checks the reply. it also leaves the host in the ARP table of the switch
+func resolveGateway(t *testing.T, h *Harness, port string, host net.HardwareAddr, hostIP string, gatewayIP string, gatewayMAC net.HardwareAddr) {
+	t.Helper()
+	h.Inject(port, arpRequest(t, host, hostIP, gatewayIP))
+	f := receiveFrom(t, h, port, gatewayMAC)
+	if f.EtherType != ethernet.EtherTypeARP || !bytes.Equal(f.Destination, host) {
+		t.Fatalf("unexpected reply %+v", f)
+	}
+	p := arp.Packet{}
+	err := p.UnmarshalBinary(f.Payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Operation != arp.OperationReply || !bytes.Equal(p.SenderHardwareAddr, gatewayMAC) || !p.SenderIP.Equal(net.ParseIP(gatewayIP)) {
+		t.Fatalf("unexpected arp reply %+v", p)
+	}
+}
+
+func TestARPReply(t *testing.T) {
+	h := newTestHarness(t, l3Config(t))
+	resolveGateway(t, h, "a", hostA, "10.1.1.5", "10.1.1.1", vlan1MAC)
+	resolveGateway(t, h, "b", hostB, "10.10.1.5", "10.10.1.1", vlan10MAC)
+	// no reply for an address that is not the switch's
+	h.Inject("a", arpRequest(t, hostA, "10.1.1.5", "10.1.1.9"))
+	expectNone(t, h, "a")
+}
+
+func checksum(b []byte) uint16 {
+	sum := uint32(0)
+	for i := 0; i < len(b); i += 2 {
+		w := uint32(b[i]) << 8
+		if i+1 < len(b) {
+			w |= uint32(b[i+1])
+		}
+		sum += w
+	}
+	for sum > 0xffff {
+		sum = sum>>16 + sum&0xffff
+	}
+	return ^uint16(sum)
+}
+
+func ipv4Packet(src string, dst string, proto byte, ttl byte, data []byte) []byte {
+	b := make([]byte, 20, 20+len(data))
+	b[0] = 0x45
+	binary.BigEndian.PutUint16(b[2:], uint16(20+len(data)))
+	b[8], b[9] = ttl, proto
+	copy(b[12:16], net.ParseIP(src).To4())
+	copy(b[16:20], net.ParseIP(dst).To4())
+	binary.BigEndian.PutUint16(b[10:], checksum(b))
+	return append(b, data...)
+}
+
+func echoRequest(id uint16, seq uint16, data []byte) []byte {
+	b := []byte{8, 0, 0, 0, byte(id >> 8), byte(id), byte(seq >> 8), byte(seq)}
+	b = append(b, data...)
+	binary.BigEndian.PutUint16(b[2:], checksum(b))
+	return b
+}
+
+// ipv4Header checks the frame carries IPv4 and returns its header and payload
+func ipv4Header(t *testing.T, f *ethernet.Frame) ([]byte, []byte) {
+	t.Helper()
+	if f.EtherType != ethernet.EtherTypeIPv4 || len(f.Payload) < 20 {
+		t.Fatalf("not an ipv4 frame: %+v", f)
+	}
+	ihl := int(f.Payload[0]&0x0f) * 4
+	total := int(binary.BigEndian.Uint16(f.Payload[2:]))
+	if ihl < 20 || total < ihl || total > len(f.Payload) {
+		t.Fatalf("invalid ipv4 header % x", f.Payload[:20])
+	}
+	return f.Payload[:ihl], f.Payload[ihl:total]
+}
+
+func TestICMPEchoReply(t *testing.T) {
+	h := newTestHarness(t, l3Config(t))
+	resolveGateway(t, h, "a", hostA, "10.1.1.5", "10.1.1.1", vlan1MAC)
+
+	echo := echoRequest(0x1234, 1, []byte("ping payload"))
+	h.Inject("a", &ethernet.Frame{
+		Destination: vlan1MAC,
+		Source:      hostA,
+		EtherType:   ethernet.EtherTypeIPv4,
+		Payload:     ipv4Packet("10.1.1.5", "10.1.1.1", 1, 64, echo),
+	})
+	f := receiveFrom(t, h, "a", vlan1MAC)
+	if !bytes.Equal(f.Destination, hostA) {
+		t.Fatalf("reply sent to %s", f.Destination)
+	}
+	header, data := ipv4Header(t, f)
+	if !net.IP(header[12:16]).Equal(net.ParseIP("10.1.1.1")) || !net.IP(header[16:20]).Equal(net.ParseIP("10.1.1.5")) || header[9] != 1 {
+		t.Fatalf("unexpected reply header % x", header)
+	}
+	if len(data) < 8 || data[0] != 0 || !bytes.Equal(data[4:], echo[4:]) {
+		t.Fatalf("unexpected echo reply % x", data)
+	}
+}
+
+func TestRouteBetweenVLANs(t *testing.T) {
+	h := newTestHarness(t, l3Config(t))
+	resolveGateway(t, h, "a", hostA, "10.1.1.5", "10.1.1.1", vlan1MAC)
+	resolveGateway(t, h, "b", hostB, "10.10.1.5", "10.10.1.1", vlan10MAC)
+
+	data := []byte("routed payload")
+	h.Inject("a", &ethernet.Frame{
+		Destination: vlan1MAC,
+		Source:      hostA,
+		EtherType:   ethernet.EtherTypeIPv4,
+		Payload:     ipv4Packet("10.1.1.5", "10.10.1.5", 17, 64, data),
+	})
+	f := receiveFrom(t, h, "b", vlan10MAC)
+	if !bytes.Equal(f.Destination, hostB) {
+		t.Fatalf("routed frame sent to %s", f.Destination)
+	}
+	header, payload := ipv4Header(t, f)
+	if !net.IP(header[16:20]).Equal(net.ParseIP("10.10.1.5")) || header[8] != 63 || !bytes.Equal(payload, data) {
+		t.Fatalf("unexpected routed packet % x", f.Payload)
+	}
+	expectNone(t, h, "a")
+}
+
+func TestAddPortErrors(t *testing.T) {
+	h := newTestHarness(t, l2Config())
+
+	_, err := h.Switch.AddSwitchPort("p1", config.SwitchPortConfig{AllowedVLANs: []int{10}})
+	if !errors.Is(err, controlplane.ErrPortExists) {
+		t.Fatalf("adding p1 twice: %v. want ErrPortExists", err)
+	}
+	if !h.Switch.PortMap()["p1"].IsUp() {
+		t.Fatal("existing port p1 replaced")
+	}
+
+	// a port whose backend fails to open is added down
+	missing := filepath.Join(t.TempDir(), "missing.pcap")
+	_, err = h.Switch.AddSwitchPort("p5", config.SwitchPortConfig{AllowedVLANs: []int{10}, Up: true, Backend: "pcap", Pcap: config.PcapPortConfig{In: missing}})
+	if err == nil {
+		t.Fatal("no error bringing up a port with a missing capture")
+	}
+	port, ok := h.Switch.PortMap()["p5"]
+	if !ok || port.IsUp() {
+		t.Fatalf("port p5 added %v up %v. want added down", ok, ok && port.IsUp())
+	}
+}
+
+func TestMACFlapBlocksPort(t *testing.T) {
+	cfg := l2Config()
+	cfg.ControlProcess[0].ConfigFile = writeConfig(t, "L2Switch.toml", "[Flap]\nMoves = 3\nWindowSeconds = 10\nBlockPort = true\n")
+	h := newTestHarness(t, cfg)
+	// hostA moves p1 -> p2 -> p1 -> p2. the third move raises the alarm and
+	// the entries of the blocked port are flushed
+	for i, port := range []string{"p1", "p2", "p1", "p2"} {
+		err := h.Inject(port, dataFrame(hostA, hostB, []byte("flap")))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i == 3 {
+			break
+		}
+		deadline := time.Now().Add(receiveTimeout)
+		for {
+			entries, err := l2.MACEntries(h.Switch, l2.MACQuery{MAC: hostA.String()})
+			if err == nil && len(entries) == 1 && entries[0].Port == port {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("frame %d: hostA not learned on %s: %+v %v", i, port, entries, err)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	deadline := time.Now().Add(receiveTimeout)
+	for {
+		info, ok := h.Switch.PortMap()["p2"].ErrDisabled()
+		if ok {
+			if info.Reason != dataplane.ERRDISABLE_MAC_FLAP {
+				t.Fatalf("p2 err-disabled for %s", info.Reason)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("port of the flapping address not err-disabled")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if _, ok := h.Switch.PortMap()["p1"].ErrDisabled(); ok {
+		t.Fatal("port the address moved away from err-disabled")
+	}
+}
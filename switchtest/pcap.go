@@ -0,0 +1,117 @@
+package switchtest
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/m-motawea/gSwitch/config"
+	"github.com/m-motawea/gSwitch/controlplane"
+	"github.com/m-motawea/gSwitch/dataplane"
+)
+
+// RunPcap builds a switch from cfg, waits until every pcap port that is up
+// has replayed its input and then for settle more, and flushes the pcap
+// outputs so they can be compared with ComparePcap.
+func RunPcap(cfg config.Config, settle time.Duration) (*controlplane.Switch, error) {
+	wg := &sync.WaitGroup{}
+	sw, err := controlplane.NewSwitch("pcap switch", cfg, wg)
+	if err != nil {
+		return nil, err
+	}
+	sw.Start()
+	// every port is added before any comes up so no input is replayed
+	// while the ports it floods to are still missing
+	for name, portCfg := range cfg.SwitchPorts {
+		portCfg.Up = false
+		_, err := sw.AddSwitchPort(name, portCfg)
+		if err != nil {
+			return sw, err
+		}
+	}
+	backends := []*dataplane.PcapBackend{}
+	replaying := []*dataplane.PcapBackend{}
+	for name, port := range sw.PortMap() {
+		backend, ok := port.Backend.(*dataplane.PcapBackend)
+		if ok {
+			backends = append(backends, backend)
+		}
+		if !cfg.SwitchPorts[name].Up {
+			// a port that is down never opens its input
+			continue
+		}
+		err := sw.UpPort(name)
+		if err != nil {
+			return sw, err
+		}
+		if ok {
+			replaying = append(replaying, backend)
+		}
+	}
+	for _, backend := range replaying {
+		<-backend.Done()
+	}
+	time.Sleep(settle)
+	for _, backend := range backends {
+		err := backend.Flush()
+		if err != nil {
+			return sw, err
+		}
+	}
+	return sw, nil
+}
+
+// ReadPcapFrames returns the frames of a pcap or pcapng file. it fails if the
+// file is truncated or corrupt
+func ReadPcapFrames(path string) ([][]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	reader, err := dataplane.NewPcapReader(f)
+	if err != nil {
+		return nil, err
+	}
+	frames := [][]byte{}
+	for {
+		data, _, err := reader.ReadPacketData()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return frames, fmt.Errorf("%s: frame %d: %w", path, len(frames)+1, err)
+		}
+		frames = append(frames, data)
+	}
+	return frames, nil
+}
+
+// ComparePcap returns an error describing the first difference between the
+// frames recorded in got and in golden. timestamps are ignored.
+func ComparePcap(got string, golden string) error {
+	gotFrames, err := ReadPcapFrames(got)
+	if err != nil {
+		return err
+	}
+	goldenFrames, err := ReadPcapFrames(golden)
+	if err != nil {
+		return err
+	}
+	for i, want := range goldenFrames {
+		if i >= len(gotFrames) {
+			return fmt.Errorf("%s: missing frame %d of %d from %s", got, i+1, len(goldenFrames), golden)
+		}
+		if !bytes.Equal(gotFrames[i], want) {
+			return fmt.Errorf("%s: frame %d differs from %s\ngot:  %x\nwant: %x", got, i+1, golden, gotFrames[i], want)
+		}
+	}
+	if len(gotFrames) > len(goldenFrames) {
+		return fmt.Errorf("%s: %d unexpected frames after the %d in %s", got, len(gotFrames)-len(goldenFrames), len(goldenFrames), golden)
+	}
+	logger.Info("capture matches golden file", "capture", got, "golden", golden, "frames", len(goldenFrames))
+	return nil
+}
@@ -0,0 +1,109 @@
+package switchtest
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/m-motawea/gSwitch/config"
+	"github.com/m-motawea/gSwitch/controlplane"
+)
+
+func pcapPort(in string, out string, vlan int, up bool) config.SwitchPortConfig {
+	return config.SwitchPortConfig{
+		AllowedVLANs: []int{vlan},
+		Up:           up,
+		Backend:      "pcap",
+		Pcap:         config.PcapPortConfig{In: in, Out: out},
+	}
+}
+
+// runPcap runs RunPcap and fails the test if it does not return in time
+func runPcap(t *testing.T, cfg config.Config) *controlplane.Switch {
+	t.Helper()
+	type result struct {
+		sw  *controlplane.Switch
+		err error
+	}
+	res := make(chan result, 1)
+	go func() {
+		sw, err := RunPcap(cfg, 200*time.Millisecond)
+		res <- result{sw, err}
+	}()
+	select {
+	case r := <-res:
+		if r.sw != nil {
+			t.Cleanup(func() {
+				ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				defer cancel()
+				r.sw.Stop(ctx)
+			})
+		}
+		if r.err != nil {
+			t.Fatal(r.err)
+		}
+		return r.sw
+	case <-time.After(10 * time.Second):
+		t.Fatal("RunPcap did not return")
+		return nil
+	}
+}
+
+func TestPcapGolden(t *testing.T) {
+	dir := t.TempDir()
+	out := func(port string) string {
+		return filepath.Join(dir, port+"_out.pcap")
+	}
+	cfg := config.Config{
+		SwitchPorts: map[string]config.SwitchPortConfig{
+			"sw1": pcapPort("testdata/sw1_in.pcap", out("sw1"), 10, true),
+			"sw2": pcapPort("", out("sw2"), 10, true),
+			"sw3": pcapPort("", out("sw3"), 10, true),
+			"sw4": pcapPort("", out("sw4"), 20, true),
+			// a port that is down never replays its input
+			"sw5": pcapPort("testdata/sw1_in.pcap", out("sw5"), 10, false),
+		},
+		ControlProcess: []config.ControlProcessConfig{{Layer: 2, Name: "L2Switch"}},
+	}
+	runPcap(t, cfg)
+
+	golden := map[string]string{
+		"sw1": "testdata/empty_golden.pcap",
+		"sw2": "testdata/flood_golden.pcap",
+		"sw3": "testdata/flood_golden.pcap",
+		"sw4": "testdata/empty_golden.pcap",
+	}
+	for port, path := range golden {
+		err := ComparePcap(out(port), path)
+		if err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestReadPcapFramesTruncated(t *testing.T) {
+	frames, err := ReadPcapFrames("testdata/sw1_in.pcap")
+	if err != nil || len(frames) != 3 {
+		t.Fatalf("read %d frames: %v. want 3", len(frames), err)
+	}
+
+	b, err := os.ReadFile("testdata/sw1_in.pcap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "truncated.pcap")
+	err = os.WriteFile(path, b[:len(b)-10], 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = ReadPcapFrames(path)
+	if err == nil {
+		t.Fatal("no error reading a truncated capture")
+	}
+	err = ComparePcap(path, "testdata/flood_golden.pcap")
+	if err == nil {
+		t.Fatal("truncated capture matches the golden file")
+	}
+}
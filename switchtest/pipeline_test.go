@@ -0,0 +1,126 @@
+package switchtest
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/m-motawea/gSwitch/config"
+	"github.com/m-motawea/gSwitch/controlplane"
+	"github.com/m-motawea/gSwitch/l2"
+)
+
+func procNames(h *Harness) []string {
+	names := []string{}
+	for _, proc := range h.Switch.Procs() {
+		names = append(names, proc.Name)
+	}
+	return names
+}
+
+func TestSwapHubForSwitchWhileForwarding(t *testing.T) {
+	cfg := l2Config()
+	cfg.ControlProcess = []config.ControlProcessConfig{{Layer: 2, Name: "Hub"}}
+	h := newTestHarness(t, cfg)
+
+	// a steady stream of numbered frames from p1 to p2 while the pipeline
+	// is replaced. hostB is never learned, so the switch floods them like
+	// the hub does
+	const frames = 500
+	sent := make(chan error, 1)
+	swapped := make(chan error, 1)
+	go func() {
+		for i := 0; i < frames; i++ {
+			payload := binary.BigEndian.AppendUint32(nil, uint32(i))
+			err := h.Inject("p1", dataFrame(hostA, hostB, payload))
+			if err != nil {
+				sent <- err
+				return
+			}
+			if i == frames/2 {
+				go func() {
+					ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+					defer cancel()
+					swapped <- h.Switch.SwapProc(ctx, 2, "Hub", config.ControlProcessConfig{Layer: 2, Name: "L2Switch"})
+				}()
+			}
+			time.Sleep(200 * time.Microsecond)
+		}
+		sent <- nil
+	}()
+
+	seen := make([]bool, frames)
+	for received := 0; received < frames; {
+		f, err := h.Receive("p2", receiveTimeout)
+		if err != nil {
+			t.Fatalf("%d of %d frames received: %v", received, frames, err)
+		}
+		i := binary.BigEndian.Uint32(f.Payload)
+		if i >= frames || seen[i] {
+			t.Fatalf("unexpected frame %d", i)
+		}
+		seen[i] = true
+		received++
+	}
+	err := <-sent
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = <-swapped
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := procNames(h)
+	if len(names) != 1 || names[0] != "L2Switch" {
+		t.Fatalf("processes after the swap = %v", names)
+	}
+	_, ok := h.Switch.Stor.LookupStor(2, "Hub")
+	if ok {
+		t.Fatal("storage of the hub kept after the swap")
+	}
+	// the switch is forwarding: hostA was learned from the stream
+	entries, err := l2.MACEntries(h.Switch, l2.MACQuery{MAC: hostA.String()})
+	if err != nil || len(entries) != 1 || entries[0].Port != "p1" {
+		t.Fatalf("entries of hostA = %+v %v", entries, err)
+	}
+}
+
+func TestSwapProcWithItself(t *testing.T) {
+	cfg := l2Config()
+	cfg.ControlProcess = []config.ControlProcessConfig{{Layer: 2, Name: "L2Switch"}}
+	h := newTestHarness(t, cfg)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// the new config file is applied, not dropped
+	path := writeConfig(t, "L2Switch.toml", "[[Static]]\nVLAN = 10\nMAC = \""+hostC.String()+"\"\nPort = \"p3\"\n")
+	err := h.Switch.SwapProc(ctx, 2, "L2Switch", config.ControlProcessConfig{Layer: 2, Name: "L2Switch", ConfigFile: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	procs := h.Switch.Procs()
+	if len(procs) != 1 || procs[0].ConfigFile != path {
+		t.Fatalf("processes after the swap = %+v", procs)
+	}
+	entries, err := l2.MACEntries(h.Switch, l2.MACQuery{MAC: hostC.String()})
+	if err != nil || len(entries) != 1 || entries[0].Type != l2.MACStatic {
+		t.Fatalf("entries of hostC = %+v %v", entries, err)
+	}
+
+	// a process that can not reload its config file says so
+	err = h.Switch.SwapProc(ctx, 2, "L2Switch", config.ControlProcessConfig{Layer: 2, Name: "Hub"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = h.Switch.SwapProc(ctx, 2, "Hub", config.ControlProcessConfig{Layer: 2, Name: "Hub", ConfigFile: path})
+	if !errors.Is(err, controlplane.ErrRestartRequired) {
+		t.Fatalf("err = %v. want %v", err, controlplane.ErrRestartRequired)
+	}
+	procs = h.Switch.Procs()
+	if len(procs) != 1 || procs[0].Name != "Hub" || procs[0].ConfigFile != "" {
+		t.Fatalf("processes after the failed swap = %+v", procs)
+	}
+}
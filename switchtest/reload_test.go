@@ -0,0 +1,112 @@
+package switchtest
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/m-motawea/gSwitch/config"
+	"github.com/m-motawea/gSwitch/controlplane"
+	"github.com/mdlayher/ethernet"
+)
+
+// copyConfig copies the ports and processes of cfg so they can be changed
+// without changing the config the harness was started with
+func copyConfig(cfg config.Config) config.Config {
+	ports := map[string]config.SwitchPortConfig{}
+	for name, portCfg := range cfg.SwitchPorts {
+		ports[name] = portCfg
+	}
+	cfg.SwitchPorts = ports
+	cfg.ControlProcess = append([]config.ControlProcessConfig{}, cfg.ControlProcess...)
+	return cfg
+}
+
+// expectPcapFrame waits for a frame with payload in the output file of a
+// pcap port
+func expectPcapFrame(t *testing.T, path string, payload []byte) {
+	t.Helper()
+	deadline := time.Now().Add(receiveTimeout)
+	for time.Now().Before(deadline) {
+		frames, _ := ReadPcapFrames(path)
+		for _, b := range frames {
+			f := ethernet.Frame{}
+			if f.UnmarshalBinary(b) == nil && bytes.HasPrefix(f.Payload, payload) {
+				return
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("no frame with payload %q in %s", payload, path)
+}
+
+func TestReloadPorts(t *testing.T) {
+	cfg := l2Config()
+	h := newTestHarness(t, cfg)
+	p4 := h.Switch.PortMap()["p4"]
+	dir := t.TempDir()
+
+	next := copyConfig(cfg)
+	// p5 is added
+	p5Out := filepath.Join(dir, "p5.pcap")
+	next.SwitchPorts["p5"] = config.SwitchPortConfig{AllowedVLANs: []int{10}, Up: true, Backend: "pcap", Pcap: config.PcapPortConfig{Out: p5Out}}
+	// p3 is removed
+	delete(next.SwitchPorts, "p3")
+	// p2 moves from vlan 10 to vlan 20
+	next.SwitchPorts["p2"] = config.SwitchPortConfig{AllowedVLANs: []int{20}, Up: true}
+	// p4 is re-created with another backend
+	p4Out := filepath.Join(dir, "p4.pcap")
+	next.SwitchPorts["p4"] = config.SwitchPortConfig{AllowedVLANs: []int{20}, Up: true, Backend: "pcap", Pcap: config.PcapPortConfig{Out: p4Out}}
+	err := h.Switch.Reload(next)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = h.Switch.PortInfo("p3")
+	if !errors.Is(err, controlplane.ErrNoPort) {
+		t.Fatalf("p3 after reload: %v. want %v", err, controlplane.ErrNoPort)
+	}
+	for _, name := range []string{"p4", "p5"} {
+		info, err := h.Switch.PortInfo(name)
+		if err != nil || !info.Up {
+			t.Fatalf("%s after reload = %+v %v", name, info, err)
+		}
+	}
+	if h.Switch.PortMap()["p4"] == p4 {
+		t.Fatal("p4 not re-created for its new backend")
+	}
+
+	// vlan 10 is p1 and p5
+	h.Inject("p1", dataFrame(hostA, ethernet.Broadcast, []byte("vlan 10")))
+	expectPcapFrame(t, p5Out, []byte("vlan 10"))
+	expectNone(t, h, "p2")
+	// vlan 20 is p2 and the new p4
+	h.Inject("p2", dataFrame(hostB, ethernet.Broadcast, []byte("vlan 20")))
+	expectPcapFrame(t, p4Out, []byte("vlan 20"))
+	expectNone(t, h, "p1")
+}
+
+func TestReloadProcWithoutReload(t *testing.T) {
+	cfg := l2Config()
+	cfg.ControlProcess = []config.ControlProcessConfig{{Layer: 2, Name: "Hub"}}
+	h := newTestHarness(t, cfg)
+
+	next := copyConfig(cfg)
+	next.ControlProcess[0].ConfigFile = writeConfig(t, "Hub.toml", "")
+	next.SwitchPorts["p2"] = config.SwitchPortConfig{AllowedVLANs: []int{10}, Up: false}
+	err := h.Switch.Reload(next)
+	if !errors.Is(err, controlplane.ErrRestartRequired) {
+		t.Fatalf("err = %v. want %v", err, controlplane.ErrRestartRequired)
+	}
+	procs := h.Switch.Procs()
+	if len(procs) != 1 || procs[0].Name != "Hub" || procs[0].ConfigFile != "" {
+		t.Fatalf("processes after reload = %+v", procs)
+	}
+	// the rest of the config is still applied
+	info, err := h.Switch.PortInfo("p2")
+	if err != nil || info.Up {
+		t.Fatalf("p2 after reload = %+v %v. want down", info, err)
+	}
+}